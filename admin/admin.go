@@ -70,9 +70,20 @@ func RegisterStatusHandler(name string, handler PackageStatusHandler) {
 	instance.statusHandlersMutex.Unlock()
 }
 
+// RegisterHTTPHandler exposes an http handler over the unix socket based admin interface,
+// for admin functions which stream their output instead of replying over rpc.
+// Handlers must be registered before the server is started.
+func RegisterHTTPHandler(pattern string, handler http.Handler) {
+	instance.httpHandlersMutex.Lock()
+	instance.httpHandlers[pattern] = handler
+	instance.httpHandlersMutex.Unlock()
+}
+
 type Admin struct {
 	statusHandlersMutex sync.RWMutex
 	statusHandlers      map[string]PackageStatusHandler
+	httpHandlersMutex   sync.RWMutex
+	httpHandlers        map[string]http.Handler
 	rpcServer           *rpc.Server
 }
 
@@ -82,6 +93,7 @@ var pkgLogger logger.LoggerI
 func Init() {
 	instance = &Admin{
 		statusHandlers: make(map[string]PackageStatusHandler),
+		httpHandlers:   make(map[string]http.Handler),
 		rpcServer:      rpc.NewServer(),
 	}
 	_ = instance.rpcServer.Register(instance) // @TODO fix ignored error
@@ -264,6 +276,11 @@ func StartServer(ctx context.Context) error {
 	pkgLogger.Info("Serving on admin interface @ ", sockAddr)
 	srvMux := http.NewServeMux()
 	srvMux.Handle(rpc.DefaultRPCPath, instance.rpcServer)
+	instance.httpHandlersMutex.RLock()
+	for pattern, handler := range instance.httpHandlers {
+		srvMux.Handle(pattern, handler)
+	}
+	instance.httpHandlersMutex.RUnlock()
 
 	srv := &http.Server{Handler: srvMux}
 	go func() {
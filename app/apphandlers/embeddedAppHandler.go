@@ -46,10 +46,20 @@ func (embedded *EmbeddedApp) GetAppType() string {
 func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.Options) error {
 	pkgLogger.Info("Main starting")
 
-	rudderCoreDBValidator()
-	rudderCoreWorkSpaceTableSetup()
-	rudderCoreNodeSetup()
-	rudderCoreBaseSetup()
+	// badger jobs are stored locally without postgres, so migration, replay, reporting clients
+	// and readonly (admin) jobsdbs are only available with the postgres backend
+	usesPostgres := !jobsdb.UsesBadgerBackend()
+	if usesPostgres {
+		rudderCoreDBValidator()
+		rudderCoreWorkSpaceTableSetup()
+		rudderCoreNodeSetup()
+		rudderCoreBaseSetup()
+	} else {
+		if db.IsValidMigrationMode(embedded.App.Options().MigrationMode) {
+			return fmt.Errorf("migration mode is not supported by the %s jobsdb backend", jobsdb.BadgerBackend)
+		}
+		rudderCoreBaseSetupWithoutPostgres()
+	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -57,10 +67,12 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 	if embedded.App.Features().Reporting != nil {
 		reporting := embedded.App.Features().Reporting.Setup(backendconfig.DefaultBackendConfig)
 
-		g.Go(func() error {
-			reporting.AddClient(ctx, types.Config{ConnInfo: jobsdb.GetConnectionString()})
-			return nil
-		})
+		if usesPostgres {
+			g.Go(func() error {
+				reporting.AddClient(ctx, types.Config{ConnInfo: jobsdb.GetConnectionString()})
+				return nil
+			})
+		}
 	}
 
 	pkgLogger.Info("Clearing DB ", options.ClearDB)
@@ -72,10 +84,11 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 	migrationMode := embedded.App.Options().MigrationMode
 	reportingI := embedded.App.Features().Reporting.GetReportingInstance()
 
+	jobsDBs := newJobsDBFactory()
 	//IMP NOTE: All the jobsdb setups must happen before migrator setup.
 	// This gwDBForProcessor should only be used by processor as this is supposed to be stopped and started with the
 	//Processor.
-	gwDBForProcessor := jobsdb.NewForRead(
+	gwDBForProcessor := jobsDBs.NewForRead(
 		"gw",
 		jobsdb.WithClearDB(options.ClearDB),
 		jobsdb.WithRetention(gwDBRetention),
@@ -84,7 +97,7 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 		jobsdb.WithQueryFilterKeys(jobsdb.QueryFiltersT{}),
 	)
 	defer gwDBForProcessor.Close()
-	routerDB := jobsdb.NewForReadWrite(
+	routerDB := jobsDBs.NewForReadWrite(
 		"rt",
 		jobsdb.WithClearDB(options.ClearDB),
 		jobsdb.WithRetention(routerDBRetention),
@@ -93,7 +106,7 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 		jobsdb.WithQueryFilterKeys(router.QueryFilters),
 	)
 	defer routerDB.Close()
-	batchRouterDB := jobsdb.NewForReadWrite(
+	batchRouterDB := jobsDBs.NewForReadWrite(
 		"batch_rt",
 		jobsdb.WithClearDB(options.ClearDB),
 		jobsdb.WithRetention(routerDBRetention),
@@ -102,7 +115,7 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 		jobsdb.WithQueryFilterKeys(batchrouter.QueryFilters),
 	)
 	defer batchRouterDB.Close()
-	errDB := jobsdb.NewForReadWrite(
+	errDB := jobsDBs.NewForReadWrite(
 		"proc_error",
 		jobsdb.WithClearDB(options.ClearDB),
 		jobsdb.WithRetention(routerDBRetention),
@@ -111,31 +124,30 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 		jobsdb.WithQueryFilterKeys(jobsdb.QueryFiltersT{}),
 	)
 
-	var tenantRouterDB jobsdb.MultiTenantJobsDB
 	var multitenantStats multitenant.MultiTenantI
-	if config.GetBool("EnableMultitenancy", false) {
-		tenantRouterDB = &jobsdb.MultiTenantHandleT{HandleT: routerDB}
-		multitenantStats = multitenant.NewStats(map[string]jobsdb.MultiTenantJobsDB{
-			"rt":       tenantRouterDB,
-			"batch_rt": &jobsdb.MultiTenantLegacy{HandleT: batchRouterDB},
-		})
+	enableMultitenancy := config.GetBool("EnableMultitenancy", false)
+	tenantRouterDB := jobsDBs.MultiTenant(routerDB, !enableMultitenancy)
+	tenantDBs := map[string]jobsdb.MultiTenantJobsDB{
+		"rt":       tenantRouterDB,
+		"batch_rt": jobsDBs.MultiTenant(batchRouterDB, true),
+	}
+	if enableMultitenancy {
+		multitenantStats = multitenant.NewStats(tenantDBs)
 	} else {
-		tenantRouterDB = &jobsdb.MultiTenantLegacy{HandleT: routerDB}
-		multitenantStats = multitenant.WithLegacyPickupJobs(multitenant.NewStats(map[string]jobsdb.MultiTenantJobsDB{
-			"rt":       tenantRouterDB,
-			"batch_rt": &jobsdb.MultiTenantLegacy{HandleT: batchRouterDB},
-		}))
+		multitenantStats = multitenant.WithLegacyPickupJobs(multitenant.NewStats(tenantDBs))
 	}
 
+	gwHandle, routerHandle, batchRouterHandle, errHandle := postgresHandles(gwDBForProcessor, routerDB, batchRouterDB, errDB)
+
 	enableGateway := true
-	if embedded.App.Features().Migrator != nil {
+	if usesPostgres && embedded.App.Features().Migrator != nil {
 		if migrationMode == db.IMPORT || migrationMode == db.EXPORT || migrationMode == db.IMPORT_EXPORT {
 			startProcessorFunc := func() {
 				clearDB := false
 				if enableProcessor {
 					g.Go(misc.WithBugsnag(func() error {
 						StartProcessor(
-							ctx, &clearDB, gwDBForProcessor, routerDB, batchRouterDB, errDB,
+							ctx, &clearDB, gwHandle, routerHandle, batchRouterHandle, errHandle,
 							reportingI, multitenant.NOOP,
 						)
 						return nil
@@ -145,7 +157,7 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 			startRouterFunc := func() {
 				if enableRouter {
 					g.Go(misc.WithBugsnag(func() error {
-						StartRouter(ctx, tenantRouterDB, batchRouterDB, errDB, reportingI, multitenant.NOOP)
+						StartRouter(ctx, tenantRouterDB, batchRouterHandle, errHandle, reportingI, multitenant.NOOP)
 						return nil
 					}))
 				}
@@ -154,10 +166,10 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 			enableProcessor = false
 			enableGateway = migrationMode != db.EXPORT
 
-			embedded.App.Features().Migrator.PrepareJobsdbsForImport(gwDBForProcessor, routerDB, batchRouterDB)
+			embedded.App.Features().Migrator.PrepareJobsdbsForImport(gwHandle, routerHandle, batchRouterHandle)
 
 			g.Go(func() error {
-				embedded.App.Features().Migrator.Run(ctx, gwDBForProcessor, routerDB, batchRouterDB, startProcessorFunc,
+				embedded.App.Features().Migrator.Run(ctx, gwHandle, routerHandle, batchRouterHandle, startProcessorFunc,
 					startRouterFunc) //TODO
 				return nil
 			})
@@ -204,21 +216,19 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 		MultiTenantStat: multitenantStats,
 	}
 
-	if enableReplay && embedded.App.Features().Replay != nil {
-		var replayDB jobsdb.HandleT
-		replayDB.Setup(jobsdb.ReadWrite, options.ClearDB, "replay", routerDBRetention, migrationMode, true, jobsdb.QueryFiltersT{})
-		defer replayDB.TearDown()
-		embedded.App.Features().Replay.Setup(&replayDB, gwDBForProcessor, routerDB, batchRouterDB)
+	if usesPostgres && enableReplay && embedded.App.Features().Replay != nil {
+		teardownReplay := setupReplay(embedded.App.Features().Replay, options.ClearDB, migrationMode, gwHandle, routerHandle, batchRouterHandle)
+		defer teardownReplay()
 	}
 
 	if enableGateway {
 		rateLimiter := ratelimiter.HandleT{}
-		rateLimiter.SetUp()
+		rateLimiter.SetUp(ctx, backendconfig.DefaultBackendConfig)
 		gw := gateway.HandleT{}
 		// This separate gateway db is created just to be used with gateway because in case of degraded mode,
 		//the earlier created gwDb (which was created to be used mainly with processor) will not be running, and it
 		//will cause issues for gateway because gateway is supposed to receive jobs even in degraded mode.
-		gatewayDB = *jobsdb.NewForWrite(
+		gatewayDB := jobsDBs.NewForWrite(
 			"gw",
 			jobsdb.WithClearDB(options.ClearDB),
 			jobsdb.WithRetention(gwDBRetention),
@@ -226,12 +236,14 @@ func (embedded *EmbeddedApp) StartRudderCore(ctx context.Context, options *app.O
 			jobsdb.WithStatusHandler(),
 			jobsdb.WithQueryFilterKeys(jobsdb.QueryFiltersT{}),
 		)
-		defer gwDBForProcessor.Close()
+		defer gatewayDB.Close()
 		gatewayDB.Start()
 		defer gatewayDB.Stop()
 
-		gw.SetReadonlyDBs(&readonlyGatewayDB, &readonlyRouterDB, &readonlyBatchRouterDB)
-		gw.Setup(embedded.App, backendconfig.DefaultBackendConfig, &gatewayDB, &rateLimiter, embedded.VersionHandler)
+		if usesPostgres {
+			gw.SetReadonlyDBs(&readonlyGatewayDB, &readonlyRouterDB, &readonlyBatchRouterDB)
+		}
+		gw.Setup(embedded.App, backendconfig.DefaultBackendConfig, gatewayDB, &rateLimiter, embedded.VersionHandler)
 		defer gw.Shutdown()
 
 		g.Go(func() error {
@@ -257,6 +269,10 @@ func (embedded *EmbeddedApp) HandleRecovery(options *app.Options) {
 }
 
 func (embedded *EmbeddedApp) LegacyStart(ctx context.Context, options *app.Options) error {
+	if jobsdb.UsesBadgerBackend() {
+		return errBadgerBackendNotSupported
+	}
+
 	pkgLogger.Info("Main starting")
 
 	rudderCoreDBValidator()
@@ -376,17 +392,15 @@ func (embedded *EmbeddedApp) LegacyStart(ctx context.Context, options *app.Optio
 	}
 
 	if enableReplay && embedded.App.Features().Replay != nil {
-		var replayDB jobsdb.HandleT
-		replayDB.Setup(jobsdb.ReadWrite, options.ClearDB, "replay", routerDBRetention, migrationMode, true, jobsdb.QueryFiltersT{})
-		defer replayDB.TearDown()
-		embedded.App.Features().Replay.Setup(&replayDB, &gatewayDB, &routerDB, &batchRouterDB)
+		teardownReplay := setupReplay(embedded.App.Features().Replay, options.ClearDB, migrationMode, &gatewayDB, &routerDB, &batchRouterDB)
+		defer teardownReplay()
 	}
 
 	if enableGateway {
 		var gateway gateway.HandleT
 		var rateLimiter ratelimiter.HandleT
 
-		rateLimiter.SetUp()
+		rateLimiter.SetUp(ctx, backendconfig.DefaultBackendConfig)
 		gateway.SetReadonlyDBs(&readonlyGatewayDB, &readonlyRouterDB, &readonlyBatchRouterDB)
 		gateway.Setup(embedded.App, backendconfig.DefaultBackendConfig, &gatewayDB, &rateLimiter, embedded.VersionHandler)
 		defer gateway.Shutdown()
@@ -31,6 +31,10 @@ func (gatewayApp *GatewayApp) GetAppType() string {
 }
 
 func (gatewayApp *GatewayApp) StartRudderCore(ctx context.Context, options *app.Options) error {
+	if jobsdb.UsesBadgerBackend() {
+		return errBadgerBackendNotSupported
+	}
+
 	pkgLogger.Info("Gateway starting")
 
 	rudderCoreDBValidator()
@@ -70,7 +74,7 @@ func (gatewayApp *GatewayApp) StartRudderCore(ctx context.Context, options *app.
 		var gw gateway.HandleT
 		var rateLimiter ratelimiter.HandleT
 
-		rateLimiter.SetUp()
+		rateLimiter.SetUp(ctx, backendconfig.DefaultBackendConfig)
 		gw.SetReadonlyDBs(&readonlyGatewayDB, &readonlyRouterDB, &readonlyBatchRouterDB)
 		gw.Setup(gatewayApp.App, backendconfig.DefaultBackendConfig, gatewayDB, &rateLimiter, gatewayApp.VersionHandler)
 		defer gw.Shutdown()
@@ -91,6 +95,10 @@ func (gateway *GatewayApp) HandleRecovery(options *app.Options) {
 }
 
 func (gatewayApp *GatewayApp) LegacyStart(ctx context.Context, options *app.Options) error {
+	if jobsdb.UsesBadgerBackend() {
+		return errBadgerBackendNotSupported
+	}
+
 	pkgLogger.Info("Gateway starting")
 
 	rudderCoreDBValidator()
@@ -122,7 +130,7 @@ func (gatewayApp *GatewayApp) LegacyStart(ctx context.Context, options *app.Opti
 
 	if enableGateway {
 		rateLimiter := ratelimiter.HandleT{}
-		rateLimiter.SetUp()
+		rateLimiter.SetUp(ctx, backendconfig.DefaultBackendConfig)
 
 		gw := gateway.HandleT{}
 		gw.SetReadonlyDBs(&readonlyGatewayDB, &readonlyRouterDB, &readonlyBatchRouterDB)
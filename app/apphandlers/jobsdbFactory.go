@@ -0,0 +1,83 @@
+package apphandlers
+
+import (
+	"github.com/rudderlabs/rudder-server/jobsdb"
+)
+
+// coreJobsDB is a jobsdb instance used by gateway, processor and routers
+type coreJobsDB interface {
+	jobsdb.JobsDB
+	Start()
+	Stop()
+	Close()
+}
+
+// jobsDBFactory creates the jobsdb instances of rudder core on top of the configured jobsdb backend
+type jobsDBFactory interface {
+	NewForRead(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB
+	NewForWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB
+	NewForReadWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB
+	// MultiTenant returns the view of a router jobsdb which jobs are picked up through,
+	// legacy pickup ignores the limits of workspaces
+	MultiTenant(jobsDB coreJobsDB, legacy bool) jobsdb.MultiTenantJobsDB
+}
+
+// newJobsDBFactory returns the factory of the jobsdb backend configured by JobsDB.backend
+func newJobsDBFactory() jobsDBFactory {
+	if jobsdb.UsesBadgerBackend() {
+		return badgerJobsDBFactory{}
+	}
+	return postgresJobsDBFactory{}
+}
+
+type postgresJobsDBFactory struct{}
+
+func (postgresJobsDBFactory) NewForRead(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewForRead(tablePrefix, opts...)
+}
+
+func (postgresJobsDBFactory) NewForWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewForWrite(tablePrefix, opts...)
+}
+
+func (postgresJobsDBFactory) NewForReadWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewForReadWrite(tablePrefix, opts...)
+}
+
+func (postgresJobsDBFactory) MultiTenant(jobsDB coreJobsDB, legacy bool) jobsdb.MultiTenantJobsDB {
+	if legacy {
+		return &jobsdb.MultiTenantLegacy{HandleT: jobsDB.(*jobsdb.HandleT)}
+	}
+	return &jobsdb.MultiTenantHandleT{HandleT: jobsDB.(*jobsdb.HandleT)}
+}
+
+// badgerJobsDBFactory creates jobsdb instances sharing the embedded badger store.
+// Postgres only options, like retention and migration mode, are ignored.
+type badgerJobsDBFactory struct{}
+
+func (badgerJobsDBFactory) NewForRead(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewBadgerForRead(tablePrefix, opts...)
+}
+
+func (badgerJobsDBFactory) NewForWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewBadgerForWrite(tablePrefix, opts...)
+}
+
+func (badgerJobsDBFactory) NewForReadWrite(tablePrefix string, opts ...jobsdb.OptsFunc) coreJobsDB {
+	return jobsdb.NewBadgerForReadWrite(tablePrefix, opts...)
+}
+
+// MultiTenant returns jobsDB itself, badger jobsdb instances pick up jobs per workspace either way
+func (badgerJobsDBFactory) MultiTenant(jobsDB coreJobsDB, _ bool) jobsdb.MultiTenantJobsDB {
+	return jobsDB.(*jobsdb.BadgerHandleT)
+}
+
+// postgresHandles returns the postgres handles of jobsdbs, needed by the features the badger backend does not support
+// (migration and replay). Handles are nil with the badger backend.
+func postgresHandles(gwDB, routerDB, batchRouterDB, procErrorDB coreJobsDB) (gw, rt, brt, procError *jobsdb.HandleT) {
+	gw, _ = gwDB.(*jobsdb.HandleT)
+	rt, _ = routerDB.(*jobsdb.HandleT)
+	brt, _ = batchRouterDB.(*jobsdb.HandleT)
+	procError, _ = procErrorDB.(*jobsdb.HandleT)
+	return gw, rt, brt, procError
+}
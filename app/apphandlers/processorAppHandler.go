@@ -68,6 +68,10 @@ func loadConfigHandler() {
 }
 
 func (processor *ProcessorApp) StartRudderCore(ctx context.Context, options *app.Options) error {
+	if jobsdb.UsesBadgerBackend() {
+		return errBadgerBackendNotSupported
+	}
+
 	pkgLogger.Info("Processor starting")
 
 	rudderCoreDBValidator()
@@ -222,10 +226,8 @@ func (processor *ProcessorApp) StartRudderCore(ctx context.Context, options *app
 	}
 
 	if enableReplay && processor.App.Features().Replay != nil {
-		var replayDB jobsdb.HandleT
-		replayDB.Setup(jobsdb.ReadWrite, options.ClearDB, "replay", routerDBRetention, migrationMode, true, jobsdb.QueryFiltersT{})
-		defer replayDB.TearDown()
-		processor.App.Features().Replay.Setup(&replayDB, gwDBForProcessor, routerDB, batchRouterDB)
+		teardownReplay := setupReplay(processor.App.Features().Replay, options.ClearDB, migrationMode, gwDBForProcessor, routerDB, batchRouterDB)
+		defer teardownReplay()
 	}
 
 	g.Go(func() error {
@@ -278,6 +280,10 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (processor *ProcessorApp) LegacyStart(ctx context.Context, options *app.Options) error {
+	if jobsdb.UsesBadgerBackend() {
+		return errBadgerBackendNotSupported
+	}
+
 	pkgLogger.Info("Processor starting")
 
 	var batchRouterDB jobsdb.HandleT
@@ -392,10 +398,8 @@ func (processor *ProcessorApp) LegacyStart(ctx context.Context, options *app.Opt
 	}
 
 	if enableReplay && processor.App.Features().Replay != nil {
-		var replayDB jobsdb.HandleT
-		replayDB.Setup(jobsdb.ReadWrite, options.ClearDB, "replay", routerDBRetention, migrationMode, true, jobsdb.QueryFiltersT{})
-		defer replayDB.TearDown()
-		processor.App.Features().Replay.Setup(&replayDB, &gatewayDB, &routerDB, &batchRouterDB)
+		teardownReplay := setupReplay(processor.App.Features().Replay, options.ClearDB, migrationMode, &gatewayDB, &routerDB, &batchRouterDB)
+		defer teardownReplay()
 	}
 
 	g.Go(func() error {
@@ -16,6 +16,7 @@ import (
 	"github.com/rudderlabs/rudder-server/router"
 	"github.com/rudderlabs/rudder-server/router/batchrouter"
 	"github.com/rudderlabs/rudder-server/services/diagnostics"
+	"github.com/rudderlabs/rudder-server/services/journey"
 	"github.com/rudderlabs/rudder-server/services/multitenant"
 	"github.com/rudderlabs/rudder-server/services/validators"
 	"github.com/rudderlabs/rudder-server/utils/logger"
@@ -39,6 +40,10 @@ var (
 	readonlyProcErrorDB                                        jobsdb.ReadonlyHandleT
 )
 
+// errBadgerBackendNotSupported is returned by app types which cannot run on the badger jobsdb backend.
+// Badger jobs are stored locally, so gateway, processor and routers need to run in the same (embedded) process.
+var errBadgerBackendNotSupported = fmt.Errorf("%s jobsdb backend is only supported by the %s app type in non legacy mode", jobsdb.BadgerBackend, app.EMBEDDED)
+
 //AppHandler to be implemented by different app type objects.
 type AppHandler interface {
 	GetAppType() string
@@ -109,6 +114,20 @@ func rudderCoreBaseSetup() {
 
 	processor.RegisterAdminHandlers(&readonlyProcErrorDB)
 	router.RegisterAdminHandlers(&readonlyRouterDB, &readonlyBatchRouterDB)
+	journey.Setup(&readonlyGatewayDB, &readonlyProcErrorDB, &readonlyRouterDB, &readonlyBatchRouterDB)
+}
+
+// rudderCoreBaseSetupWithoutPostgres is the equivalent of rudderCoreBaseSetup for the badger jobsdb backend,
+// which skips the readonly jobsdb connections and the admin handlers depending on them.
+func rudderCoreBaseSetupWithoutPostgres() {
+	if diagnostics.EnableServerStartMetric {
+		Diagnostics.Track(diagnostics.ServerStart, map[string]interface{}{
+			diagnostics.ServerStart: fmt.Sprint(time.Unix(misc.AppStartTime, 0)),
+		})
+	}
+
+	//Reload Config
+	loadConfig()
 }
 
 //StartProcessor atomically starts processor process if not already started
@@ -160,6 +179,19 @@ func StartRouter(
 	monitorDestRouters(ctx, &routerFactory, &batchRouterFactory)
 }
 
+// setupReplay sets up the replay feature, along with a replay jobsdb unless the feature tells it doesn't need one.
+// The returned function tears the replay jobsdb down.
+func setupReplay(replay app.ReplayFeature, clearDB bool, migrationMode string, gwDB, routerDB, batchRouterDB *jobsdb.HandleT) func() {
+	if f, ok := replay.(app.ReplayDBFeature); ok && !f.UsesReplayDB() {
+		replay.Setup(nil, gwDB, routerDB, batchRouterDB)
+		return func() {}
+	}
+	var replayDB jobsdb.HandleT
+	replayDB.Setup(jobsdb.ReadWrite, clearDB, "replay", routerDBRetention, migrationMode, true, jobsdb.QueryFiltersT{})
+	replay.Setup(&replayDB, gwDB, routerDB, batchRouterDB)
+	return replayDB.TearDown
+}
+
 // Gets the config from config backend and extracts enabled writekeys
 func monitorDestRouters(ctx context.Context, routerFactory *router.Factory, batchRouterFactory *batchrouter.Factory) {
 	ch := make(chan pubsub.DataEvent)
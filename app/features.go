@@ -9,6 +9,8 @@ import (
 
 	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
 	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/services/replay"
+	"github.com/rudderlabs/rudder-server/services/reporting"
 	"github.com/rudderlabs/rudder-server/utils/types"
 )
 
@@ -92,6 +94,10 @@ type reportingFactoryFallback struct {
 
 func (f *reportingFactoryFallback) Setup(backendConfig backendconfig.BackendConfig) types.ReportingI {
 	f.once.Do(func() {
+		if reporting.IsEnabled() {
+			f.instance = reporting.New(backendConfig)
+			return
+		}
 		f.instance = &reportingNOOP{}
 	})
 	return f.instance
@@ -122,16 +128,37 @@ type ReplayFeature interface {
 	Setup(replayDB, gwDB, routerDB, batchRouterDB *jobsdb.HandleT)
 }
 
+// ReplayDBFeature is implemented by replay features telling whether they need a replay jobsdb.
+// Replay features not implementing it are always given one.
+type ReplayDBFeature interface {
+	UsesReplayDB() bool
+}
+
 // ReplayFeatureSetup is a function that initializes a Replay feature
 type ReplayFeatureSetup func(Interface) ReplayFeature
 
-var replayFeatureSetup ReplayFeatureSetup
+var replayFeatureSetup ReplayFeatureSetup = func(a Interface) ReplayFeature {
+	return &replayFallback{}
+}
 
 // RegisterReplayFeature registers a config env feature implementation
 func RegisterReplayFeature(f ReplayFeatureSetup) {
 	replayFeatureSetup = f
 }
 
+// replayFallback replays the jobs backed up in object storage by jobsdb
+type replayFallback struct {
+}
+
+func (f *replayFallback) Setup(replayDB, gwDB, routerDB, batchRouterDB *jobsdb.HandleT) {
+	replay.Setup(gwDB, routerDB, batchRouterDB)
+}
+
+// UsesReplayDB is false, as the jobs are replayed from object storage
+func (f *replayFallback) UsesReplayDB() bool {
+	return false
+}
+
 // Features contains optional implementations of Enterprise only features.
 type Features struct {
 	Migrator     MigratorFeature
@@ -94,6 +94,7 @@ type DestinationT struct {
 	Enabled               bool
 	Transformations       []TransformationT
 	IsProcessorEnabled    bool
+	EventFilter           *EventFilterT
 }
 
 type SourceT struct {
@@ -199,6 +200,26 @@ type TrackingPlanT struct {
 	Version int    `json:"version"`
 }
 
+// EventFilterT declares the events a destination receives. Events are kept if their type and name are allowed and not denied,
+// if they match all conditions, and if they are part of the sample. Empty allow lists allow everything.
+type EventFilterT struct {
+	AllowEventTypes []string                `json:"allowEventTypes"`
+	DenyEventTypes  []string                `json:"denyEventTypes"`
+	AllowEventNames []string                `json:"allowEventNames"`
+	DenyEventNames  []string                `json:"denyEventNames"`
+	Conditions      []EventFilterConditionT `json:"conditions"`
+	// SamplingPercentage of the events kept, sampled by message id. Nil keeps all events
+	SamplingPercentage *float64 `json:"samplingPercentage"`
+}
+
+// EventFilterConditionT is a predicate on the value at Path of events, keys separated by dots, e.g. properties.plan.
+// Operator is one of eq, neq, in, nin, exists, notExists, gt, gte, lt, lte, contains or regex.
+type EventFilterConditionT struct {
+	Path     string      `json:"path"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
 type BackendConfig interface {
 	SetUp()
 	Get(string) (ConfigT, bool)
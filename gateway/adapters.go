@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/gateway/adapters"
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+// webAdapterHandler accepts the requests of a third-party tracker protocol, converts them into Rudder events
+// and processes these as a batch request.
+// The write key is read from the basic auth, the writeKey query parameter, or the request itself if the protocol carries it.
+func (gateway *HandleT) webAdapterHandler(converter adapters.ConverterI) http.HandlerFunc {
+	reqType := "batch"
+	conversionErrorsStat := gateway.stats.NewTaggedStat("gateway.adapter_conversion_errors", stats.CountType, stats.Tags{"adapter": converter.Name()})
+	return func(w http.ResponseWriter, r *http.Request) {
+		webReqHandlerTime := gateway.stats.NewTaggedStat("gateway.web_req_handler_time", stats.TimerType, stats.Tags{"reqType": converter.Name()})
+		webReqHandlerStartTime := time.Now()
+		defer webReqHandlerTime.Since(webReqHandlerStartTime)
+
+		gateway.logger.LogRequest(r)
+		atomic.AddUint64(&gateway.recvCount, 1)
+		var errorMessage string
+		defer func() {
+			gateway.writeErrorResponse(w, r, errorMessage)
+		}()
+		body, err := gateway.getPayloadFromRequest(r)
+		if err != nil {
+			errorMessage = err.Error()
+			return
+		}
+		converted, err := converter.Convert(r, body)
+		if err != nil {
+			conversionErrorsStat.Increment()
+			gateway.logger.Debugf("IP: %s -- %s -- Conversion failed: %v", misc.GetIPFromReq(r), r.URL.Path, err)
+			errorMessage = err.Error()
+			return
+		}
+
+		writeKey, _, ok := r.BasicAuth()
+		if !ok || writeKey == "" {
+			writeKey = r.URL.Query().Get("writeKey")
+		}
+		if writeKey == "" {
+			writeKey = converted.WriteKey
+		}
+		if writeKey == "" {
+			var sourceFailStats = make(map[string]int)
+			misc.IncrementMapByKey(sourceFailStats, "noWriteKey", 1)
+			gateway.updateSourceStats(sourceFailStats, "gateway.write_key_failed_requests", map[string]string{"noWriteKey": "noWriteKey", "reqType": reqType})
+			gateway.updateSourceStats(sourceFailStats, "gateway.write_key_requests", map[string]string{"noWriteKey": "noWriteKey", "reqType": reqType})
+			errorMessage = response.GetStatus(response.NoWriteKeyInBasicAuth)
+			return
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{"batch": converted.Events})
+		if err != nil {
+			errorMessage = response.GetStatus(response.ErrorInMarshal)
+			return
+		}
+		errorMessage = gateway.rrh.ProcessRequest(gateway, &w, r, reqType, payload, writeKey)
+		atomic.AddUint64(&gateway.ackCount, 1)
+		if errorMessage == response.GetStatus(response.DuplicateRequest) {
+			errorMessage = ""
+		}
+		gateway.trackRequestMetrics(errorMessage)
+		if errorMessage != "" {
+			return
+		}
+		gateway.logger.Debugf("IP: %s -- %s -- Response: 200, %s", misc.GetIPFromReq(r), r.URL.Path, response.GetStatus(response.Ok))
+		w.Write([]byte(response.GetStatus(response.Ok)))
+	}
+}
@@ -0,0 +1,99 @@
+// Package adapters converts the payloads of third-party tracker protocols into Rudder events,
+// so that clients still speaking these protocols can send events to the gateway.
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+// ConverterI converts the requests of a tracker protocol into Rudder events
+type ConverterI interface {
+	// Name identifies the adapter, e.g. in stats
+	Name() string
+	// Routes are the gateway paths accepting requests of the protocol
+	Routes() []string
+	// Convert returns the Rudder events of a request, along with the write key if the protocol carries one
+	Convert(r *http.Request, body []byte) (ConvertedT, error)
+}
+
+// ConvertedT holds the events converted from a request
+type ConvertedT struct {
+	// WriteKey is empty if the request does not carry it, in which case it is read from the basic auth or writeKey query parameter
+	WriteKey string
+	Events   []map[string]interface{}
+}
+
+// Converters returns the converters of all supported protocols
+func Converters() []ConverterI {
+	return []ConverterI{
+		&SnowplowT{},
+		&AmplitudeT{},
+		&MixpanelT{},
+	}
+}
+
+// decodeJSON unmarshals data keeping numbers as json.Number, so that they are stored without loss of precision
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// timestampFromMillis formats milliseconds since the epoch as Rudder timestamps
+func timestampFromMillis(millis int64) string {
+	return time.UnixMilli(millis).UTC().Format(misc.RFC3339Milli)
+}
+
+// toInt64 returns v as an integer, accepting json numbers and numeric strings
+func toInt64(v interface{}) (int64, bool) {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := value.Float64(); err == nil {
+			return int64(f), true
+		}
+	case string:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, true
+		}
+	case float64:
+		return int64(value), true
+	}
+	return 0, false
+}
+
+// setIfNotEmpty sets key in m if value is not empty
+func setIfNotEmpty(m map[string]interface{}, key string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		if v == "" {
+			return
+		}
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return
+		}
+	}
+	m[key] = value
+}
+
+// stringValue returns v if it is a string, its text if it is a number
+func stringValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
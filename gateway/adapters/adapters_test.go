@@ -0,0 +1,99 @@
+package adapters_test
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/gateway/adapters"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the adapters")
+
+func converter(name string) adapters.ConverterI {
+	for _, converter := range adapters.Converters() {
+		if converter.Name() == name {
+			return converter
+		}
+	}
+	return nil
+}
+
+// Test_Convert converts testdata/<adapter>/<case>.input and compares the result with testdata/<adapter>/<case>.golden.json
+func Test_Convert(t *testing.T) {
+	tests := []struct {
+		adapter  string
+		name     string
+		target   string
+		writeKey string
+	}{
+		{adapter: "snowplow", name: "events", target: "/com.snowplowanalytics.snowplow/tp2"},
+		{adapter: "amplitude", name: "events", target: "/2/httpapi", writeKey: "amplitude-write-key"},
+		{adapter: "mixpanel", name: "track", target: "/track", writeKey: "mixpanel-write-key"},
+		{adapter: "mixpanel", name: "engage", target: "/engage", writeKey: "mixpanel-write-key"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.adapter+"/"+tt.name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", tt.adapter, tt.name+".input"))
+			require.NoError(t, err)
+
+			converted, err := converter(tt.adapter).Convert(httptest.NewRequest("POST", tt.target, nil), input)
+			require.NoError(t, err)
+			require.Equal(t, tt.writeKey, converted.WriteKey)
+
+			output, err := json.MarshalIndent(converted.Events, "", "  ")
+			require.NoError(t, err)
+			goldenFile := filepath.Join("testdata", tt.adapter, tt.name+".golden.json")
+			if *update {
+				require.NoError(t, os.WriteFile(goldenFile, append(output, '\n'), 0o644))
+			}
+			golden, err := os.ReadFile(goldenFile)
+			require.NoError(t, err)
+			require.JSONEq(t, string(golden), string(output))
+		})
+	}
+}
+
+func Test_ConvertErrors(t *testing.T) {
+	tests := []struct {
+		adapter string
+		target  string
+		body    string
+		err     string
+	}{
+		{adapter: "snowplow", target: "/com.snowplowanalytics.snowplow/tp2", body: `not-json`, err: "snowplow: invalid payload"},
+		{adapter: "snowplow", target: "/com.snowplowanalytics.snowplow/tp2", body: `{"data":[]}`, err: "snowplow: payload without events"},
+		{adapter: "snowplow", target: "/com.snowplowanalytics.snowplow/tp2", body: `{"data":[{"e":"tr"}]}`, err: `snowplow: event 0: unsupported event type "tr"`},
+		{adapter: "snowplow", target: "/com.snowplowanalytics.snowplow/tp2", body: `{"data":[{"e":"ue","ue_pr":"{\"data\":{\"schema\":\"invalid\"}}"}]}`, err: `snowplow: event 0: unstructured event with invalid schema "invalid"`},
+		{adapter: "amplitude", target: "/2/httpapi", body: `{"api_key":"key","events":[{"user_id":"u1"}]}`, err: "amplitude: event 0: event without event_type"},
+		{adapter: "amplitude", target: "/2/httpapi", body: `{"api_key":"key","events":[{"user_id":"u1","event_type":"$groupidentify"}]}`, err: `amplitude: event 0: unsupported event type "$groupidentify"`},
+		{adapter: "mixpanel", target: "/track", body: ``, err: "mixpanel: request without data"},
+		{adapter: "mixpanel", target: "/track", body: `data=not-base64`, err: "mixpanel: invalid data"},
+		{adapter: "mixpanel", target: "/engage", body: `{"$token":"key","$distinct_id":"u1","$add":{"plays":1}}`, err: "mixpanel: event 0: unsupported profile update"},
+	}
+	for _, tt := range tests {
+		converted, err := converter(tt.adapter).Convert(httptest.NewRequest("POST", tt.target, nil), []byte(tt.body))
+		require.Error(t, err, tt.body)
+		require.Contains(t, err.Error(), tt.err)
+		require.Empty(t, converted.Events)
+	}
+}
+
+func Test_MixpanelData(t *testing.T) {
+	event := `{"event":"Signed Up","properties":{"token":"key","distinct_id":"u1"}}`
+	for _, target := range []string{"/track?data=" + url.QueryEscape(event), "/track?data=eyJldmVudCI6IlNpZ25lZCBVcCIsInByb3BlcnRpZXMiOnsidG9rZW4iOiJrZXkiLCJkaXN0aW5jdF9pZCI6InUxIn19"} {
+		converted, err := converter("mixpanel").Convert(httptest.NewRequest("GET", target, nil), nil)
+		require.NoError(t, err, target)
+		require.Equal(t, "key", converted.WriteKey)
+		require.Len(t, converted.Events, 1)
+		require.Equal(t, "Signed Up", converted.Events[0]["event"])
+		require.Equal(t, "u1", converted.Events[0]["userId"])
+	}
+}
@@ -0,0 +1,126 @@
+package adapters
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AmplitudeT converts the requests of Amplitude HTTP API v2. $identify events are converted into identify events,
+// other events into track events. The api_key of the request is the write key.
+type AmplitudeT struct{}
+
+type amplitudePayloadT struct {
+	APIKey string                   `json:"api_key"`
+	Events []map[string]interface{} `json:"events"`
+}
+
+func (*AmplitudeT) Name() string {
+	return "amplitude"
+}
+
+func (*AmplitudeT) Routes() []string {
+	return []string{"/2/httpapi"}
+}
+
+func (am *AmplitudeT) Convert(_ *http.Request, body []byte) (ConvertedT, error) {
+	var payload amplitudePayloadT
+	if err := decodeJSON(body, &payload); err != nil {
+		return ConvertedT{}, fmt.Errorf("amplitude: invalid payload: %w", err)
+	}
+	if len(payload.Events) == 0 {
+		return ConvertedT{}, fmt.Errorf("amplitude: payload without events")
+	}
+	converted := ConvertedT{WriteKey: payload.APIKey}
+	for idx, amEvent := range payload.Events {
+		event, err := am.convertEvent(amEvent)
+		if err != nil {
+			return ConvertedT{}, fmt.Errorf("amplitude: event %d: %w", idx, err)
+		}
+		converted.Events = append(converted.Events, event)
+	}
+	return converted, nil
+}
+
+func (*AmplitudeT) convertEvent(amEvent map[string]interface{}) (map[string]interface{}, error) {
+	event := map[string]interface{}{}
+	eventType, _ := amEvent["event_type"].(string)
+	userProperties, _ := amEvent["user_properties"].(map[string]interface{})
+	switch eventType {
+	case "":
+		return nil, fmt.Errorf("event without event_type")
+	case "$identify":
+		event["type"] = "identify"
+		setIfNotEmpty(event, "traits", amplitudeTraits(userProperties))
+	case "$groupidentify":
+		return nil, fmt.Errorf("unsupported event type %q", eventType)
+	default:
+		event["type"] = "track"
+		event["event"] = eventType
+		if properties, ok := amEvent["event_properties"].(map[string]interface{}); ok {
+			setIfNotEmpty(event, "properties", properties)
+		}
+	}
+
+	setIfNotEmpty(event, "userId", stringValue(amEvent["user_id"]))
+	setIfNotEmpty(event, "anonymousId", stringValue(amEvent["device_id"]))
+	setIfNotEmpty(event, "messageId", stringValue(amEvent["insert_id"]))
+	if millis, ok := toInt64(amEvent["time"]); ok {
+		event["originalTimestamp"] = timestampFromMillis(millis)
+	}
+
+	context := map[string]interface{}{
+		"library": map[string]interface{}{"name": "amplitude"},
+	}
+	if eventType != "$identify" {
+		setIfNotEmpty(context, "traits", amplitudeTraits(userProperties))
+	}
+	app := map[string]interface{}{}
+	setIfNotEmpty(app, "version", stringValue(amEvent["app_version"]))
+	setIfNotEmpty(context, "app", app)
+	os := map[string]interface{}{}
+	setIfNotEmpty(os, "name", stringValue(amEvent["os_name"]))
+	setIfNotEmpty(os, "version", stringValue(amEvent["os_version"]))
+	setIfNotEmpty(context, "os", os)
+	device := map[string]interface{}{}
+	setIfNotEmpty(device, "id", stringValue(amEvent["device_id"]))
+	setIfNotEmpty(device, "manufacturer", stringValue(amEvent["device_manufacturer"]))
+	setIfNotEmpty(device, "model", stringValue(amEvent["device_model"]))
+	setIfNotEmpty(context, "device", device)
+	setIfNotEmpty(context, "locale", stringValue(amEvent["language"]))
+	setIfNotEmpty(context, "ip", stringValue(amEvent["ip"]))
+	if sessionID, ok := toInt64(amEvent["session_id"]); ok && sessionID > 0 {
+		context["sessionId"] = sessionID
+	}
+	event["context"] = context
+	event["channel"] = amplitudeChannel(stringValue(amEvent["platform"]))
+	return event, nil
+}
+
+// amplitudeTraits returns the user properties set by $setOnce and $set operations along with plain ones.
+// Other operations, e.g. $add or $unset, cannot be expressed as traits and are dropped.
+func amplitudeTraits(userProperties map[string]interface{}) map[string]interface{} {
+	traits := map[string]interface{}{}
+	for _, operation := range []string{"$setOnce", "$set"} {
+		if values, ok := userProperties[operation].(map[string]interface{}); ok {
+			for key, value := range values {
+				traits[key] = value
+			}
+		}
+	}
+	for key, value := range userProperties {
+		if len(key) > 0 && key[0] != '$' {
+			traits[key] = value
+		}
+	}
+	return traits
+}
+
+func amplitudeChannel(platform string) string {
+	switch platform {
+	case "Web":
+		return "web"
+	case "iOS", "Android":
+		return "mobile"
+	}
+	return "server"
+}
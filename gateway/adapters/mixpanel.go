@@ -0,0 +1,222 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MixpanelT converts the requests of Mixpanel /track and /engage endpoints, either JSON or base64 encoded in the data parameter.
+// Events are converted into track events, except $mp_web_page_view, $identify and $create_alias into page, identify and alias events.
+// Profile updates are converted into identify events with the properties of $set and $set_once as traits.
+// The token of the project is the write key.
+type MixpanelT struct{}
+
+// properties of mixpanel events which are not kept as properties of the converted events
+var mixpanelReservedProperties = map[string]struct{}{
+	"token": {}, "distinct_id": {}, "time": {}, "$insert_id": {}, "$user_id": {}, "$device_id": {},
+	"$lib_version": {}, "$current_url": {}, "$referrer": {}, "$os": {}, "$screen_width": {}, "$screen_height": {},
+	"$identified_id": {}, "$anon_id": {}, "alias": {}, "ip": {},
+}
+
+// reserved profile properties of mixpanel and their names as Rudder traits
+var mixpanelTraits = map[string]string{
+	"$email": "email", "$name": "name", "$first_name": "firstName", "$last_name": "lastName",
+	"$phone": "phone", "$avatar": "avatar", "$created": "createdAt",
+}
+
+func (*MixpanelT) Name() string {
+	return "mixpanel"
+}
+
+func (*MixpanelT) Routes() []string {
+	return []string{"/track", "/engage"}
+}
+
+func (mp *MixpanelT) Convert(r *http.Request, body []byte) (ConvertedT, error) {
+	data, err := mixpanelData(r, body)
+	if err != nil {
+		return ConvertedT{}, fmt.Errorf("mixpanel: %w", err)
+	}
+	var mpEvents []map[string]interface{}
+	if data[0] == '{' {
+		mpEvents = make([]map[string]interface{}, 1)
+		err = decodeJSON(data, &mpEvents[0])
+	} else {
+		err = decodeJSON(data, &mpEvents)
+	}
+	if err != nil {
+		return ConvertedT{}, fmt.Errorf("mixpanel: invalid payload: %w", err)
+	}
+	if len(mpEvents) == 0 {
+		return ConvertedT{}, fmt.Errorf("mixpanel: payload without events")
+	}
+
+	engage := strings.HasSuffix(r.URL.Path, "/engage")
+	converted := ConvertedT{}
+	for idx, mpEvent := range mpEvents {
+		var event map[string]interface{}
+		var token string
+		if engage {
+			event, token, err = mp.convertProfileUpdate(mpEvent)
+		} else {
+			event, token, err = mp.convertEvent(mpEvent)
+		}
+		if err != nil {
+			return ConvertedT{}, fmt.Errorf("mixpanel: event %d: %w", idx, err)
+		}
+		if converted.WriteKey == "" {
+			converted.WriteKey = token
+		}
+		converted.Events = append(converted.Events, event)
+	}
+	return converted, nil
+}
+
+func (*MixpanelT) convertEvent(mpEvent map[string]interface{}) (map[string]interface{}, string, error) {
+	name, _ := mpEvent["event"].(string)
+	if name == "" {
+		return nil, "", fmt.Errorf("event without name")
+	}
+	mpProperties, _ := mpEvent["properties"].(map[string]interface{})
+	event := map[string]interface{}{}
+	properties := map[string]interface{}{}
+	for key, value := range mpProperties {
+		if _, reserved := mixpanelReservedProperties[key]; !reserved {
+			properties[key] = value
+		}
+	}
+
+	userID := stringValue(mpProperties["$user_id"])
+	anonymousID := stringValue(mpProperties["$device_id"])
+	if userID == "" && anonymousID == "" {
+		userID = stringValue(mpProperties["distinct_id"])
+	}
+	switch name {
+	case "$mp_web_page_view":
+		event["type"] = "page"
+		setIfNotEmpty(properties, "url", stringValue(mpProperties["$current_url"]))
+		setIfNotEmpty(properties, "referrer", stringValue(mpProperties["$referrer"]))
+	case "$identify":
+		event["type"] = "identify"
+		userID = stringValue(mpProperties["$identified_id"])
+		anonymousID = stringValue(mpProperties["$anon_id"])
+	case "$create_alias":
+		alias := stringValue(mpProperties["alias"])
+		if alias == "" {
+			return nil, "", fmt.Errorf("$create_alias without alias")
+		}
+		event["type"] = "alias"
+		event["previousId"] = stringValue(mpProperties["distinct_id"])
+		userID, anonymousID = alias, ""
+	default:
+		event["type"] = "track"
+		event["event"] = name
+	}
+	if event["type"] != "identify" {
+		setIfNotEmpty(event, "properties", properties)
+	}
+	setIfNotEmpty(event, "userId", userID)
+	setIfNotEmpty(event, "anonymousId", anonymousID)
+	setIfNotEmpty(event, "messageId", stringValue(mpProperties["$insert_id"]))
+	if timestamp, ok := mixpanelTimestamp(mpProperties["time"]); ok {
+		event["originalTimestamp"] = timestamp
+	}
+
+	library := map[string]interface{}{"name": "mixpanel"}
+	setIfNotEmpty(library, "version", stringValue(mpProperties["$lib_version"]))
+	context := map[string]interface{}{"library": library}
+	page := map[string]interface{}{}
+	setIfNotEmpty(page, "url", stringValue(mpProperties["$current_url"]))
+	setIfNotEmpty(page, "referrer", stringValue(mpProperties["$referrer"]))
+	setIfNotEmpty(context, "page", page)
+	os := map[string]interface{}{}
+	setIfNotEmpty(os, "name", stringValue(mpProperties["$os"]))
+	setIfNotEmpty(context, "os", os)
+	screen := map[string]interface{}{}
+	setIfNotEmpty(screen, "width", mpProperties["$screen_width"])
+	setIfNotEmpty(screen, "height", mpProperties["$screen_height"])
+	setIfNotEmpty(context, "screen", screen)
+	setIfNotEmpty(context, "ip", stringValue(mpProperties["ip"]))
+	event["context"] = context
+	return event, stringValue(mpProperties["token"]), nil
+}
+
+func (*MixpanelT) convertProfileUpdate(mpUpdate map[string]interface{}) (map[string]interface{}, string, error) {
+	traits := map[string]interface{}{}
+	var found bool
+	for _, operation := range []string{"$set_once", "$set"} {
+		if values, ok := mpUpdate[operation].(map[string]interface{}); ok {
+			found = true
+			for key, value := range values {
+				if trait, ok := mixpanelTraits[key]; ok {
+					key = trait
+				}
+				traits[key] = value
+			}
+		}
+	}
+	if !found {
+		return nil, "", fmt.Errorf("unsupported profile update, only $set and $set_once are supported")
+	}
+	event := map[string]interface{}{
+		"type":   "identify",
+		"traits": traits,
+		"context": map[string]interface{}{
+			"library": map[string]interface{}{"name": "mixpanel"},
+		},
+	}
+	setIfNotEmpty(event, "userId", stringValue(mpUpdate["$distinct_id"]))
+	setIfNotEmpty(event["context"].(map[string]interface{}), "ip", stringValue(mpUpdate["$ip"]))
+	if timestamp, ok := mixpanelTimestamp(mpUpdate["$time"]); ok {
+		event["originalTimestamp"] = timestamp
+	}
+	return event, stringValue(mpUpdate["$token"]), nil
+}
+
+// mixpanelData returns the JSON payload of a request, sent either as the body or in the data parameter of the query or form, possibly base64 encoded
+func mixpanelData(r *http.Request, body []byte) ([]byte, error) {
+	data := r.URL.Query().Get("data")
+	if data == "" {
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && (body[0] == '{' || body[0] == '[') {
+			return body, nil
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid form: %w", err)
+		}
+		data = values.Get("data")
+	}
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, fmt.Errorf("request without data")
+	}
+	if data[0] == '{' || data[0] == '[' {
+		return []byte(data), nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(data); err == nil {
+			decoded = bytes.TrimSpace(decoded)
+			if len(decoded) > 0 && (decoded[0] == '{' || decoded[0] == '[') {
+				return decoded, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid data")
+}
+
+// mixpanelTimestamp converts times sent either in seconds or milliseconds since the epoch
+func mixpanelTimestamp(v interface{}) (string, bool) {
+	millis, ok := toInt64(v)
+	if !ok || millis <= 0 {
+		return "", false
+	}
+	if millis < 1e11 {
+		millis *= 1000
+	}
+	return timestampFromMillis(millis), true
+}
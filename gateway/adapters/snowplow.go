@@ -0,0 +1,197 @@
+package adapters
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SnowplowT converts the POST requests of Snowplow trackers (tracker protocol v2).
+// Page views, structured, unstructured and page ping events are supported.
+type SnowplowT struct{}
+
+type snowplowPayloadT struct {
+	Schema string              `json:"schema"`
+	Data   []map[string]string `json:"data"`
+}
+
+type selfDescribingT struct {
+	Schema string      `json:"schema"`
+	Data   interface{} `json:"data"`
+}
+
+func (*SnowplowT) Name() string {
+	return "snowplow"
+}
+
+func (*SnowplowT) Routes() []string {
+	return []string{"/com.snowplowanalytics.snowplow/tp2"}
+}
+
+func (sp *SnowplowT) Convert(_ *http.Request, body []byte) (ConvertedT, error) {
+	var payload snowplowPayloadT
+	if err := decodeJSON(body, &payload); err != nil {
+		return ConvertedT{}, fmt.Errorf("snowplow: invalid payload: %w", err)
+	}
+	if len(payload.Data) == 0 {
+		return ConvertedT{}, fmt.Errorf("snowplow: payload without events")
+	}
+	converted := ConvertedT{}
+	for idx, spEvent := range payload.Data {
+		event, err := sp.convertEvent(spEvent)
+		if err != nil {
+			return ConvertedT{}, fmt.Errorf("snowplow: event %d: %w", idx, err)
+		}
+		converted.Events = append(converted.Events, event)
+	}
+	return converted, nil
+}
+
+func (sp *SnowplowT) convertEvent(spEvent map[string]string) (map[string]interface{}, error) {
+	event := map[string]interface{}{}
+	properties := map[string]interface{}{}
+	switch eventType := spEvent["e"]; eventType {
+	case "pv":
+		event["type"] = "page"
+		setIfNotEmpty(event, "name", spEvent["page"])
+		setIfNotEmpty(properties, "url", spEvent["url"])
+		setIfNotEmpty(properties, "title", spEvent["page"])
+		setIfNotEmpty(properties, "referrer", spEvent["refr"])
+	case "pp":
+		event["type"] = "track"
+		event["event"] = "Page Ping"
+		setIfNotEmpty(properties, "url", spEvent["url"])
+		setIfNotEmpty(properties, "title", spEvent["page"])
+		for _, key := range []string{"pp_mix", "pp_max", "pp_miy", "pp_may"} {
+			if value, err := strconv.ParseInt(spEvent[key], 10, 64); err == nil {
+				properties[key] = value
+			}
+		}
+	case "se":
+		if spEvent["se_ac"] == "" {
+			return nil, fmt.Errorf("structured event without action")
+		}
+		event["type"] = "track"
+		event["event"] = spEvent["se_ac"]
+		setIfNotEmpty(properties, "category", spEvent["se_ca"])
+		setIfNotEmpty(properties, "label", spEvent["se_la"])
+		setIfNotEmpty(properties, "property", spEvent["se_pr"])
+		if value, err := strconv.ParseFloat(spEvent["se_va"], 64); err == nil {
+			properties["value"] = value
+		}
+	case "ue":
+		var unstructured selfDescribingT
+		if err := decodeSnowplowJSON(spEvent["ue_pr"], spEvent["ue_px"], &unstructured); err != nil {
+			return nil, fmt.Errorf("invalid unstructured event: %w", err)
+		}
+		inner, ok := unstructured.Data.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unstructured event without data")
+		}
+		schema, _ := inner["schema"].(string)
+		name := snowplowSchemaName(schema)
+		if name == "" {
+			return nil, fmt.Errorf("unstructured event with invalid schema %q", schema)
+		}
+		event["type"] = "track"
+		event["event"] = name
+		if data, ok := inner["data"].(map[string]interface{}); ok {
+			properties = data
+		}
+	default:
+		return nil, fmt.Errorf("unsupported event type %q", eventType)
+	}
+	setIfNotEmpty(event, "properties", properties)
+
+	setIfNotEmpty(event, "userId", spEvent["uid"])
+	anonymousID := spEvent["duid"]
+	if anonymousID == "" {
+		anonymousID = spEvent["nuid"]
+	}
+	setIfNotEmpty(event, "anonymousId", anonymousID)
+	setIfNotEmpty(event, "messageId", spEvent["eid"])
+	if millis, err := strconv.ParseInt(spEvent["dtm"], 10, 64); err == nil {
+		event["originalTimestamp"] = timestampFromMillis(millis)
+	}
+	if millis, err := strconv.ParseInt(spEvent["stm"], 10, 64); err == nil {
+		event["sentAt"] = timestampFromMillis(millis)
+	}
+	event["channel"] = snowplowChannel(spEvent["p"])
+
+	context := map[string]interface{}{
+		"library": map[string]interface{}{"name": "snowplow", "version": spEvent["tv"]},
+	}
+	if event["type"] == "page" {
+		page := map[string]interface{}{}
+		setIfNotEmpty(page, "url", spEvent["url"])
+		setIfNotEmpty(page, "title", spEvent["page"])
+		setIfNotEmpty(page, "referrer", spEvent["refr"])
+		setIfNotEmpty(context, "page", page)
+	}
+	if spEvent["aid"] != "" {
+		context["app"] = map[string]interface{}{"name": spEvent["aid"]}
+	}
+	setIfNotEmpty(context, "userAgent", spEvent["ua"])
+	setIfNotEmpty(context, "locale", spEvent["lang"])
+	setIfNotEmpty(context, "timezone", spEvent["tz"])
+	if width, height, ok := snowplowResolution(spEvent["res"]); ok {
+		context["screen"] = map[string]interface{}{"width": width, "height": height}
+	}
+	if spEvent["co"] != "" || spEvent["cx"] != "" {
+		var contexts selfDescribingT
+		if err := decodeSnowplowJSON(spEvent["co"], spEvent["cx"], &contexts); err != nil {
+			return nil, fmt.Errorf("invalid contexts: %w", err)
+		}
+		context["snowplowContexts"] = contexts.Data
+	}
+	event["context"] = context
+	return event, nil
+}
+
+// decodeSnowplowJSON decodes a self-describing JSON sent either as is, or base64 encoded
+func decodeSnowplowJSON(plain, encoded string, v interface{}) error {
+	if plain != "" {
+		return decodeJSON([]byte(plain), v)
+	}
+	if encoded == "" {
+		return fmt.Errorf("empty")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		if decoded, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return err
+		}
+	}
+	return decodeJSON(decoded, v)
+}
+
+// snowplowSchemaName returns the name of an iglu schema, e.g. link_click for iglu:com.acme/link_click/jsonschema/1-0-0
+func snowplowSchemaName(schema string) string {
+	parts := strings.Split(strings.TrimPrefix(schema, "iglu:"), "/")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[1]
+}
+
+func snowplowResolution(res string) (width, height int, ok bool) {
+	parts := strings.Split(res, "x")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	width, errWidth := strconv.Atoi(parts[0])
+	height, errHeight := strconv.Atoi(parts[1])
+	return width, height, errWidth == nil && errHeight == nil
+}
+
+func snowplowChannel(platform string) string {
+	switch platform {
+	case "web":
+		return "web"
+	case "mob", "tv", "iot":
+		return "mobile"
+	}
+	return "server"
+}
@@ -24,12 +24,16 @@ func (g *GatewayAdmin) Status() interface{} {
 		writeKeys = append(writeKeys, k)
 	}
 
-	return map[string]interface{}{
+	status := map[string]interface{}{
 		"ack-count":          g.handle.ackCount,
 		"recv-count":         g.handle.recvCount,
 		"enabled-write-keys": writeKeys,
 		"jobsdb":             g.handle.jobsDB.Status(),
 	}
+	if g.handle.spillBuffer != nil {
+		status["spill-buffer"] = g.handle.spillBuffer.status()
+	}
+	return status
 
 }
 
@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+var (
+	bulkBatchPrefix = []byte(`{"batch":[`)
+	bulkBatchSuffix = []byte(`]}`)
+)
+
+// bulkUserEventsT holds the events of a user read from a bulk request and not queued yet
+type bulkUserEventsT struct {
+	events [][]byte
+	size   int
+}
+
+func (e *bulkUserEventsT) add(event []byte) {
+	e.events = append(e.events, append([]byte{}, event...))
+	e.size += len(event)
+}
+
+// payloadSize is the size of the batch payload of the events, as checked against maxReqSize by the user web request workers
+func (e *bulkUserEventsT) payloadSize() int {
+	return len(bulkBatchPrefix) + e.size + len(e.events) + len(bulkBatchSuffix)
+}
+
+func (e *bulkUserEventsT) payload() []byte {
+	payload := make([]byte, 0, e.payloadSize())
+	payload = append(payload, bulkBatchPrefix...)
+	payload = append(payload, bytes.Join(e.events, []byte(","))...)
+	return append(payload, bulkBatchSuffix...)
+}
+
+// webBulkHandler accepts newline delimited JSON events, one event per line.
+// The body is streamed: events are grouped per user as they are read and queued as batch requests, so it is never held in memory as a whole.
+func (gateway *HandleT) webBulkHandler(w http.ResponseWriter, r *http.Request) {
+	reqType := "bulk"
+	webReqHandlerTime := gateway.stats.NewTaggedStat("gateway.web_req_handler_time", stats.TimerType, stats.Tags{"reqType": reqType})
+	webReqHandlerStartTime := time.Now()
+	defer webReqHandlerTime.Since(webReqHandlerStartTime)
+
+	gateway.logger.LogRequest(r)
+	atomic.AddUint64(&gateway.recvCount, 1)
+	var errorMessage string
+	defer func() {
+		gateway.writeErrorResponse(w, r, errorMessage)
+	}()
+	var sourceFailStats = make(map[string]int)
+	writeKey, _, ok := r.BasicAuth()
+	if !ok || writeKey == "" {
+		errorMessage = response.GetStatus(response.NoWriteKeyInBasicAuth)
+		misc.IncrementMapByKey(sourceFailStats, "noWriteKey", 1)
+		gateway.updateSourceStats(sourceFailStats, "gateway.write_key_failed_requests", map[string]string{"noWriteKey": "noWriteKey", "reqType": reqType})
+		gateway.updateSourceStats(sourceFailStats, "gateway.write_key_requests", map[string]string{"noWriteKey": "noWriteKey", "reqType": reqType})
+		return
+	}
+	if r.Body == nil {
+		errorMessage = response.GetStatus(response.RequestBodyNil)
+		return
+	}
+	errorMessage = gateway.processBulkRequest(&w, r, writeKey)
+	atomic.AddUint64(&gateway.ackCount, 1)
+	gateway.trackRequestMetrics(errorMessage)
+	if errorMessage != "" {
+		return
+	}
+	gateway.logger.Debugf("IP: %s -- %s -- Response: 200, %s", misc.GetIPFromReq(r), r.URL.Path, response.GetStatus(response.Ok))
+	w.Write([]byte(response.GetStatus(response.Ok)))
+}
+
+// processBulkRequest queues the events of a user once bulkMaxEventsPerJob of them are read, or once they would exceed maxReqSize.
+// Events of all users are queued whenever bulkMaxBufferSize bytes of events are buffered.
+// A user's events are queued only after the previous ones of the user are stored, to preserve their order.
+// Events read before an invalid line are stored, the response reports the line which failed.
+func (gateway *HandleT) processBulkRequest(w *http.ResponseWriter, r *http.Request, writeKey string) string {
+	body, err := requestBodyReader(r, int64(bulkMaxReqSize))
+	if err != nil {
+		r.Body.Close()
+		return err.Error()
+	}
+	defer body.Close()
+
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.store", attribute.String("reqType", "bulk"))
+	req := r.WithContext(ctx)
+
+	var (
+		errorMessage string
+		interimMsgs  []string
+		pending      = make(map[string]*bulkUserEventsT)
+		pendingSize  int
+		outstanding  = make(map[string]chan string)
+		outcomes     []*webRequestOutcomeT
+	)
+	recordResponse := func(done chan string) {
+		if interimErrorMessage := <-done; interimErrorMessage != response.GetStatus(response.DuplicateRequest) {
+			interimMsgs = append(interimMsgs, interimErrorMessage)
+		}
+	}
+	flush := func(userKey string) {
+		events := pending[userKey]
+		delete(pending, userKey)
+		pendingSize -= events.size
+		if previous, ok := outstanding[userKey]; ok {
+			recordResponse(previous)
+		}
+		done := make(chan string, 1)
+		outstanding[userKey] = done
+		outcome := &webRequestOutcomeT{}
+		outcomes = append(outcomes, outcome)
+		gateway.addToUserWebRequestQ(userKey, outcome, req, done, "batch", events.payload(), writeKey, nil)
+	}
+	flushAll := func() {
+		for userKey := range pending {
+			flush(userKey)
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReqSize)
+	var line int
+	for scanner.Scan() {
+		line++
+		event := bytes.TrimSpace(scanner.Bytes())
+		if len(event) == 0 {
+			continue
+		}
+		if !gjson.ValidBytes(event) {
+			errorMessage = fmt.Sprintf("%s at line %d", response.GetStatus(response.InvalidJSON), line)
+			break
+		}
+		ids := gjson.GetManyBytes(event, "userId", "anonymousId")
+		rudderID, err := misc.GetMD5UUID(strings.TrimSpace(ids[0].String()) + ":" + strings.TrimSpace(ids[1].String()))
+		if err != nil {
+			errorMessage = fmt.Sprintf("%s at line %d", response.GetStatus(response.NonIdentifiableRequest), line)
+			break
+		}
+		userKey := rudderID.String()
+		if events, ok := pending[userKey]; ok && (len(events.events) >= bulkMaxEventsPerJob || events.payloadSize()+len(event)+1 > maxReqSize) {
+			flush(userKey)
+		}
+		if _, ok := pending[userKey]; !ok {
+			pending[userKey] = &bulkUserEventsT{}
+		}
+		pending[userKey].add(event)
+		pendingSize += len(event)
+		if pendingSize > bulkMaxBufferSize {
+			flushAll()
+		}
+	}
+	if err := scanner.Err(); err != nil && errorMessage == "" {
+		if errors.Is(err, bufio.ErrTooLong) || errors.Is(err, errRequestBodyTooLarge) {
+			errorMessage = response.GetStatus(response.RequestBodyTooLarge)
+		} else {
+			errorMessage = fmt.Sprintf("read payload from request: %v", err)
+		}
+	}
+	flushAll()
+	for _, done := range outstanding {
+		recordResponse(done)
+	}
+	setRateLimitHeaders(*w, outcomes...)
+	errorMessage = strings.Join(append(interimMsgs, errorMessage), "")
+	tracing.End(span, errorMessage)
+	return errorMessage
+}
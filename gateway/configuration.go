@@ -27,10 +27,22 @@ func loadConfig() {
 	config.RegisterStringConfigVariable("GW", &CustomVal, false, "Gateway.CustomVal")
 	// Maximum request size to gateway
 	config.RegisterIntConfigVariable(4000, &maxReqSize, true, 1024, "Gateway.maxReqSizeInKB")
+	// Maximum size of gzip or zstd request bodies once decompressed
+	config.RegisterIntConfigVariable(40000, &maxDecompressedReqSize, true, 1024, "Gateway.maxDecompressedReqSizeInKB")
+	// Maximum size of bulk request bodies, once decompressed
+	config.RegisterIntConfigVariable(1024, &bulkMaxReqSize, true, 1024*1024, "Gateway.bulk.maxReqSizeInMB")
+	// Maximum number of events of a user stored in a single job by bulk requests
+	config.RegisterIntConfigVariable(100, &bulkMaxEventsPerJob, true, 1, "Gateway.bulk.maxEventsPerJob")
+	// Size of the events a bulk request buffers before queueing them as jobs
+	config.RegisterIntConfigVariable(4000, &bulkMaxBufferSize, true, 1024, "Gateway.bulk.maxBufferSizeInKB")
 	// Enable rate limit on incoming events. false by default
 	config.RegisterBoolConfigVariable(false, &enableRateLimit, true, "Gateway.enableRateLimit")
 	// Enable suppress user feature. false by default
 	config.RegisterBoolConfigVariable(true, &enableSuppressUserFeature, false, "Gateway.enableSuppressUserFeature")
+	// Enable dedup of incoming events by messageId at the gateway. false by default
+	config.RegisterBoolConfigVariable(false, &enableDedup, false, "Gateway.enableDedup")
+	// Time window in which gateway dedup remembers messageIds
+	config.RegisterDurationConfigVariable(time.Duration(15), &dedupWindow, false, time.Minute, []string{"Gateway.dedupWindow", "Gateway.dedupWindowInMin"}...)
 	// EventSchemas feature. false by default
 	config.RegisterBoolConfigVariable(false, &enableEventSchemasFeature, false, "EventSchemas.enableEventSchemasFeature")
 	// Time period for diagnosis ticker
@@ -38,6 +50,43 @@ func loadConfig() {
 	// Enables accepting requests without user id and anonymous id. This is added to prevent client 4xx retries.
 	config.RegisterBoolConfigVariable(false, &allowReqsWithoutUserIDAndAnonymousID, true, "Gateway.allowReqsWithoutUserIDAndAnonymousID")
 	config.RegisterBoolConfigVariable(true, &gwAllowPartialWriteWithErrors, true, "Gateway.allowPartialWriteWithErrors")
+	// Store the valid events of batch requests and reject invalid ones individually, responding with the rejected events
+	config.RegisterBoolConfigVariable(false, &enablePartialBatchAcceptance, true, "Gateway.enablePartialBatchAcceptance")
+	// Serve the gRPC ingestion API, alongside the web handlers
+	config.RegisterBoolConfigVariable(false, &enableGRPC, false, "Gateway.grpc.enabled")
+	config.RegisterIntConfigVariable(8079, &grpcPort, false, 1, "Gateway.grpc.port")
+	// Consume events from Kafka topics, each entry of Gateway.kafka.topics being topic:writeKey
+	config.RegisterBoolConfigVariable(false, &enableKafkaSource, false, "Gateway.kafka.enabled")
+	config.RegisterStringSliceConfigVariable(nil, &kafkaSourceTopics, false, "Gateway.kafka.topics")
+	config.RegisterStringConfigVariable("rudder-gateway", &kafkaSourceGroupID, false, "Gateway.kafka.groupId")
+	config.RegisterStringConfigVariable("localhost", &kafkaSourceConfig.HostName, false, "Gateway.kafka.hostName")
+	config.RegisterStringConfigVariable("9092", &kafkaSourceConfig.Port, false, "Gateway.kafka.port")
+	config.RegisterBoolConfigVariable(false, &kafkaSourceConfig.SslEnabled, false, "Gateway.kafka.sslEnabled")
+	config.RegisterStringConfigVariable("", &kafkaSourceConfig.CACertificate, false, "Gateway.kafka.caCertificate")
+	config.RegisterBoolConfigVariable(false, &kafkaSourceConfig.UseSASL, false, "Gateway.kafka.useSASL")
+	config.RegisterStringConfigVariable("plain", &kafkaSourceConfig.SaslType, false, "Gateway.kafka.saslType")
+	config.RegisterStringConfigVariable("", &kafkaSourceConfig.Username, false, "Gateway.kafka.username")
+	config.RegisterStringConfigVariable("", &kafkaSourceConfig.Password, false, "Gateway.kafka.password")
+	// Maximum number of messages of a partition queued to the workers before their offsets are committed
+	config.RegisterIntConfigVariable(1000, &kafkaSourceMaxInFlight, false, 1, "Gateway.kafka.maxInFlight")
+	config.RegisterDurationConfigVariable(time.Duration(1), &kafkaSourceCommitInterval, true, time.Second, "Gateway.kafka.commitInterval")
+	config.RegisterDurationConfigVariable(time.Duration(1), &kafkaSourceRetryBackoff, true, time.Second, "Gateway.kafka.retryBackoff")
+	// Spill batches to an on-disk log when storing them into gw_db fails or takes longer than the latency budget,
+	// and drain them into gw_db once it recovers
+	config.RegisterBoolConfigVariable(false, &enableSpillBuffer, false, "Gateway.spill.enabled")
+	config.RegisterStringConfigVariable("", &spillDir, false, "Gateway.spill.dir")
+	config.RegisterInt64ConfigVariable(1024, &spillMaxSize, false, 1024*1024, "Gateway.spill.maxSizeInMB")
+	config.RegisterInt64ConfigVariable(64, &spillSegmentSize, false, 1024*1024, "Gateway.spill.segmentSizeInMB")
+	// Fsync policy of the spill log: always, interval or never
+	config.RegisterStringConfigVariable("always", &spillFsync, false, "Gateway.spill.fsync")
+	config.RegisterDurationConfigVariable(time.Duration(1), &spillFsyncInterval, false, time.Second, "Gateway.spill.fsyncInterval")
+	config.RegisterDurationConfigVariable(time.Duration(5), &spillLatencyBudget, true, time.Second, "Gateway.spill.latencyBudget")
+	config.RegisterDurationConfigVariable(time.Duration(1), &spillDrainInterval, true, time.Second, "Gateway.spill.drainInterval")
+	config.RegisterDurationConfigVariable(time.Duration(1), &spillDrainRetryBackoff, true, time.Second, "Gateway.spill.drainRetryBackoff")
+	// Local file of redaction rules by source id and salts by workspace id, taking precedence over backend config
+	config.RegisterStringConfigVariable("", &redactionOverridesFile, false, "Gateway.redaction.overridesFile")
+	// Salt of hashed values of workspaces without a salt in the overrides file
+	config.RegisterStringConfigVariable("", &redactionSalt, false, "Gateway.redaction.salt")
 	config.RegisterDurationConfigVariable(time.Duration(0), &ReadTimeout, false, time.Second, []string{"ReadTimeout", "ReadTimeOutInSec"}...)
 	config.RegisterDurationConfigVariable(time.Duration(0), &ReadHeaderTimeout, false, time.Second, []string{"ReadHeaderTimeout", "ReadHeaderTimeoutInSec"}...)
 	config.RegisterDurationConfigVariable(time.Duration(10), &WriteTimeout, false, time.Second, []string{"WriteTimeout", "WriteTimeOutInSec"}...)
@@ -75,3 +124,17 @@ func SetEnableSuppressUserFeature(b bool) bool {
 	enableSuppressUserFeature = b
 	return prev
 }
+
+//SetEnableDedup overrides enableDedup configuration and returns previous value
+func SetEnableDedup(b bool) bool {
+	prev := enableDedup
+	enableDedup = b
+	return prev
+}
+
+//SetEnablePartialBatchAcceptance overrides enablePartialBatchAcceptance configuration and returns previous value
+func SetEnablePartialBatchAcceptance(b bool) bool {
+	prev := enablePartialBatchAcceptance
+	enablePartialBatchAcceptance = b
+	return prev
+}
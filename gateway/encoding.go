@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+)
+
+var errRequestBodyTooLarge = errors.New(response.RequestBodyTooLarge)
+
+// requestBodyReader returns a reader of the request body, decompressing it according to its Content-Encoding.
+// Reading more than maxSize bytes, decompressed if the body is compressed, fails with errRequestBodyTooLarge.
+// Closing the reader closes the request body.
+func requestBodyReader(r *http.Request, maxSize int64) (io.ReadCloser, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return &decompressedBodyT{reader: &maxSizeReaderT{reader: r.Body, remaining: maxSize}, closers: []io.Closer{r.Body}}, nil
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedBodyT{reader: &maxSizeReaderT{reader: gzipReader, remaining: maxSize}, closers: []io.Closer{gzipReader, r.Body}}, nil
+	case "zstd":
+		decoder, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		zstdReader := decoder.IOReadCloser()
+		return &decompressedBodyT{reader: &maxSizeReaderT{reader: zstdReader, remaining: maxSize}, closers: []io.Closer{zstdReader, r.Body}}, nil
+	default:
+		return nil, errors.New(response.UnsupportedContentEncoding)
+	}
+}
+
+type decompressedBodyT struct {
+	reader  io.Reader
+	closers []io.Closer
+}
+
+func (b *decompressedBodyT) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func (b *decompressedBodyT) Close() error {
+	var err error
+	for _, closer := range b.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// maxSizeReaderT fails with errRequestBodyTooLarge instead of reading past remaining bytes,
+// so that neither large bodies nor small compressed ones can exhaust the memory of the gateway
+type maxSizeReaderT struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *maxSizeReaderT) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// the body is too large only if it has more bytes to read
+		var probe [1]byte
+		n, err := l.reader.Read(probe[:])
+		if n > 0 {
+			return 0, errRequestBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
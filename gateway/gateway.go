@@ -19,11 +19,14 @@ import (
 
 	"github.com/rudderlabs/rudder-server/admin"
 	"github.com/rudderlabs/rudder-server/app"
+	"github.com/rudderlabs/rudder-server/gateway/adapters"
+	"github.com/rudderlabs/rudder-server/gateway/redaction"
 	"github.com/rudderlabs/rudder-server/gateway/response"
 	"github.com/rudderlabs/rudder-server/gateway/webhook"
 	operationmanager "github.com/rudderlabs/rudder-server/operation-manager"
 	"github.com/rudderlabs/rudder-server/router"
 	recovery "github.com/rudderlabs/rudder-server/services/db"
+	"github.com/rudderlabs/rudder-server/services/dedup"
 	"github.com/rudderlabs/rudder-server/services/diagnostics"
 	warehouseutils "github.com/rudderlabs/rudder-server/warehouse/utils"
 	"golang.org/x/sync/errgroup"
@@ -39,13 +42,18 @@ import (
 	ratelimiter "github.com/rudderlabs/rudder-server/rate-limiter"
 	"github.com/rudderlabs/rudder-server/rruntime"
 	sourcedebugger "github.com/rudderlabs/rudder-server/services/debugger/source"
+	"github.com/rudderlabs/rudder-server/services/journey"
+	"github.com/rudderlabs/rudder-server/services/livetail"
 	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/streammanager/kafka"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
 	"github.com/rudderlabs/rudder-server/utils/pubsub"
 	"github.com/rudderlabs/rudder-server/utils/types"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 /*
@@ -64,10 +72,24 @@ import (
 */
 type webRequestT struct {
 	done           chan<- string
+	outcome        *webRequestOutcomeT
 	reqType        string
 	requestPayload []byte
 	writeKey       string
 	ipAddr         string
+	traceParent    string
+	// rejectedEvents is set for requests with partial acceptance, the worker fills it before responding on done
+	rejectedEvents *[]RejectedEventT
+}
+
+// webRequestOutcomeT is filled by the user web request worker before it responds on done,
+// so that the handler of the request reads it, and writes the response, from its own goroutine
+type webRequestOutcomeT struct {
+	limitStatus ratelimiter.LimitStatusT
+	// storedEvents is the number of events of the request stored in the jobs database
+	storedEvents int
+	// duplicateEvents is the number of events of the request dropped as duplicates
+	duplicateEvents int
 }
 
 type batchWebRequestT struct {
@@ -81,12 +103,17 @@ var (
 	enabledWriteKeysSourceMap                                                 map[string]backendconfig.SourceT
 	enabledWriteKeyWebhookMap                                                 map[string]string
 	enabledWriteKeyWorkspaceMap                                               map[string]string
+	enabledWriteKeyRedactorMap                                                map[string]*redaction.RedactorT
 	sourceIDToNameMap                                                         map[string]string
 	configSubscriberLock                                                      sync.RWMutex
 	maxReqSize                                                                int
+	maxDecompressedReqSize                                                    int
+	bulkMaxReqSize, bulkMaxEventsPerJob, bulkMaxBufferSize                    int
 	enableRateLimit                                                           bool
 	enableSuppressUserFeature                                                 bool
 	enableEventSchemasFeature                                                 bool
+	enableDedup                                                               bool
+	dedupWindow                                                               time.Duration
 	diagnosisTickerTime                                                       time.Duration
 	ReadTimeout                                                               time.Duration
 	ReadHeaderTimeout                                                         time.Duration
@@ -94,6 +121,27 @@ var (
 	IdleTimeout                                                               time.Duration
 	allowReqsWithoutUserIDAndAnonymousID                                      bool
 	gwAllowPartialWriteWithErrors                                             bool
+	enablePartialBatchAcceptance                                              bool
+	enableGRPC                                                                bool
+	grpcPort                                                                  int
+	enableKafkaSource                                                         bool
+	kafkaSourceTopics                                                         []string
+	kafkaSourceGroupID                                                        string
+	kafkaSourceConfig                                                         kafka.Config
+	kafkaSourceMaxInFlight                                                    int
+	kafkaSourceCommitInterval                                                 time.Duration
+	kafkaSourceRetryBackoff                                                   time.Duration
+	enableSpillBuffer                                                         bool
+	spillDir                                                                  string
+	spillMaxSize                                                              int64
+	spillSegmentSize                                                          int64
+	spillFsync                                                                string
+	spillFsyncInterval                                                        time.Duration
+	spillLatencyBudget                                                        time.Duration
+	spillDrainInterval                                                        time.Duration
+	spillDrainRetryBackoff                                                    time.Duration
+	redactionOverridesFile                                                    string
+	redactionSalt                                                             string
 	pkgLogger                                                                 logger.LoggerI
 	Diagnostics                                                               diagnostics.DiagnosticsI
 )
@@ -168,6 +216,8 @@ type HandleT struct {
 	userWebRequestWorkers                                      []*userWebRequestWorkerT
 	webhookHandler                                             *webhook.HandleT
 	suppressUserHandler                                        types.SuppressUserI
+	dedupHandler                                               dedup.DedupI
+	spillBuffer                                                *spillBufferT
 	eventSchemaHandler                                         types.EventSchemasI
 	versionHandler                                             func(w http.ResponseWriter, r *http.Request)
 	logger                                                     logger.LoggerI
@@ -304,7 +354,9 @@ func (gateway *HandleT) dbWriterWorkerProcess(process int) {
 			jobList = append(jobList, userWorkerBatchRequest.jobList...)
 		}
 
-		if gwAllowPartialWriteWithErrors {
+		if gateway.spillBuffer != nil {
+			errorMessagesMap = gateway.spillBuffer.store(jobList, gwAllowPartialWriteWithErrors)
+		} else if gwAllowPartialWriteWithErrors {
 			errorMessagesMap = gateway.jobsDB.StoreWithRetryEach(jobList)
 		} else {
 			err := gateway.jobsDB.Store(jobList)
@@ -407,6 +459,12 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 		var sourceFailStats = make(map[string]int)
 		var sourceFailEventStats = make(map[string]int)
 		var workspaceDropRequestStats = make(map[string]int)
+		var sourceRateLimitedEventStats = make(map[string]int)
+		var sourceDuplicateStats = make(map[string]int)
+		var sourceDuplicateEventStats = make(map[string]int)
+		var sourceRejectedEventStats = make(map[string]int)
+		var jobMessageIDsMap = make(map[uuid.UUID][]string)
+		var batchMessageIDsSet = make(map[string]struct{})
 		var sourceTagMap = make(map[string]string)
 		var preDbStoreCount int
 		//Saving the event data read from req.request.Body to the splice.
@@ -422,6 +480,7 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			//Should be function of body
 			configSubscriberLock.RLock()
 			workspaceId := enabledWriteKeyWorkspaceMap[writeKey]
+			redactor := enabledWriteKeyRedactorMap[writeKey]
 			configSubscriberLock.RUnlock()
 
 			sourceTagMap["workspaceId"] = workspaceId
@@ -436,17 +495,6 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 				continue
 			}
 
-			if enableRateLimit {
-				//In case of "batch" requests, if ratelimiter returns true for LimitReached, just drop the event batch and continue.
-				restrictorKey := gateway.backendConfig.GetWorkspaceIDForWriteKey(writeKey)
-				if gateway.rateLimiter.LimitReached(restrictorKey) {
-					req.done <- response.GetStatus(response.TooManyRequests)
-					preDbStoreCount++
-					misc.IncrementMapByKey(workspaceDropRequestStats, sourceTag, 1)
-					continue
-				}
-			}
-
 			gateway.requestSizeStat.Observe(float64(len(body)))
 			if req.reqType != "batch" {
 				body, _ = sjson.SetBytes(body, "type", req.reqType)
@@ -458,6 +506,25 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			// store sourceID before call made to check if source is enabled
 			// this prevents not setting sourceID in gw job if disabled before setting it
 			sourceID := gateway.getSourceIDForWriteKey(writeKey)
+
+			if enableRateLimit {
+				//In case of "batch" requests, if ratelimiter returns true for LimitReached, just drop the event batch and continue.
+				limitStatus := gateway.rateLimiter.LimitReached(ratelimiter.KeysT{
+					WorkspaceID: gateway.backendConfig.GetWorkspaceIDForWriteKey(writeKey),
+					SourceID:    sourceID,
+					WriteKey:    writeKey,
+				}, totalEventsInReq)
+				if req.outcome != nil {
+					req.outcome.limitStatus = limitStatus
+				}
+				if limitStatus.Reached {
+					req.done <- response.GetStatus(response.TooManyRequests)
+					preDbStoreCount++
+					misc.IncrementMapByKey(workspaceDropRequestStats, sourceTag, 1)
+					misc.IncrementMapByKey(sourceRateLimitedEventStats, sourceTag, totalEventsInReq)
+					continue
+				}
+			}
 			if !gateway.isWriteKeyEnabled(writeKey) {
 				req.done <- response.GetStatus(response.InvalidWriteKey)
 				preDbStoreCount++
@@ -469,19 +536,37 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			// set anonymousId if not set in payload
 			result := gjson.GetBytes(body, "batch")
 			out := []map[string]interface{}{}
-			var builtUserID string
+			var messageIDs []string
+			var builtUserID, suppressionUserID string
 			var notIdentifiable, containsAudienceList bool
+			// with partial acceptance, invalid events are rejected individually instead of failing the whole request
+			partialAcceptance := req.rejectedEvents != nil
+			var eventIndex, acceptedSize int
+			reject := func(vjson gjson.Result, reason string) {
+				*req.rejectedEvents = append(*req.rejectedEvents, RejectedEventT{
+					Index:     eventIndex,
+					MessageID: strings.TrimSpace(vjson.Get("messageId").String()),
+					Reason:    reason,
+				})
+				misc.IncrementMapByKey(sourceRejectedEventStats, sourceTag+DELIMITER+reason, 1)
+			}
 			result.ForEach(func(_, vjson gjson.Result) bool {
+				defer func() { eventIndex++ }()
+				if partialAcceptance && !vjson.IsObject() {
+					reject(vjson, RejectedInvalidJSON)
+					return true
+				}
 				anonIDFromReq := strings.TrimSpace(vjson.Get("anonymousId").String())
 				userIDFromReq := strings.TrimSpace(vjson.Get("userId").String())
-				if builtUserID == "" {
-					builtUserID = anonIDFromReq + DELIMITER + userIDFromReq
-				}
 
 				eventTypeFromReq := strings.TrimSpace(vjson.Get("type").String())
 
 				if anonIDFromReq == "" {
 					if userIDFromReq == "" && !allowReqsWithoutUserIDAndAnonymousID {
+						if partialAcceptance {
+							reject(vjson, RejectedNotIdentifiable)
+							return true
+						}
 						notIdentifiable = true
 						return false
 					}
@@ -492,20 +577,58 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 				// hashing combination of userIDFromReq + anonIDFromReq, using colon as a delimiter
 				rudderId, err := misc.GetMD5UUID(userIDFromReq + ":" + anonIDFromReq)
 				if err != nil {
+					if partialAcceptance {
+						reject(vjson, RejectedNotIdentifiable)
+						return true
+					}
 					notIdentifiable = true
 					return false
 				}
+				if partialAcceptance {
+					if enableSuppressUserFeature && gateway.suppressUserHandler != nil && gateway.suppressUserHandler.IsSuppressedUser(userIDFromReq, sourceID, writeKey) {
+						reject(vjson, RejectedSuppressed)
+						return true
+					}
+					if !containsAudienceList && acceptedSize+len(vjson.Raw) > maxReqSize {
+						reject(vjson, RejectedOversize)
+						return true
+					}
+					acceptedSize += len(vjson.Raw)
+				}
+				if len(out) == 0 {
+					suppressionUserID = vjson.Get("userId").String()
+				}
 
 				toSet := vjson.Value().(map[string]interface{})
+				if redactor != nil {
+					// personal data is redacted before the event is stored or recorded, ids included, as they make the user id of the job
+					redactor.Apply(toSet)
+					anonIDFromReq, userIDFromReq = redactedID(toSet["anonymousId"]), redactedID(toSet["userId"])
+				}
+				if builtUserID == "" {
+					builtUserID = anonIDFromReq + DELIMITER + userIDFromReq
+				}
 				toSet["rudderId"] = rudderId
-				if messageId := strings.TrimSpace(vjson.Get("messageId").String()); messageId == "" {
-					toSet["messageId"] = uuid.Must(uuid.NewV4()).String()
+				messageId := strings.TrimSpace(vjson.Get("messageId").String())
+				if messageId == "" {
+					messageId = uuid.Must(uuid.NewV4()).String()
+					toSet["messageId"] = messageId
 				}
 				out = append(out, toSet)
+				messageIDs = append(messageIDs, messageId)
 				return true // keep iterating
 			})
 
-			if len(body) > maxReqSize && !containsAudienceList {
+			if partialAcceptance {
+				totalEventsInReq = len(out)
+				if totalEventsInReq == 0 {
+					req.done <- ""
+					preDbStoreCount++
+					continue
+				}
+			}
+
+			if len(body) > maxReqSize && !containsAudienceList && !partialAcceptance {
 				req.done <- response.GetStatus(response.RequestBodyTooLarge)
 				preDbStoreCount++
 				misc.IncrementMapByKey(sourceFailStats, sourceTag, 1)
@@ -522,15 +645,37 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 				continue
 			}
 
-			if enableSuppressUserFeature && gateway.suppressUserHandler != nil {
-				userID := gjson.GetBytes(body, "batch.0.userId").String()
-				if gateway.suppressUserHandler.IsSuppressedUser(userID, gateway.getSourceIDForWriteKey(writeKey), writeKey) {
+			if enableSuppressUserFeature && gateway.suppressUserHandler != nil && !partialAcceptance {
+				if gateway.suppressUserHandler.IsSuppressedUser(suppressionUserID, gateway.getSourceIDForWriteKey(writeKey), writeKey) {
 					req.done <- ""
 					preDbStoreCount++
 					continue
 				}
 			}
 
+			// drop events already seen by the gateway within the dedup window, either in a previous request or earlier in this batch
+			if enableDedup && gateway.dedupHandler != nil {
+				duplicateIndexes := gateway.dedupHandler.FindDuplicates(messageIDs, batchMessageIDsSet)
+				if len(duplicateIndexes) > 0 {
+					misc.IncrementMapByKey(sourceDuplicateEventStats, sourceTag, len(duplicateIndexes))
+					if req.outcome != nil {
+						req.outcome.duplicateEvents = len(duplicateIndexes)
+					}
+					if len(duplicateIndexes) == len(out) {
+						req.done <- response.GetStatus(response.DuplicateRequest)
+						preDbStoreCount++
+						misc.IncrementMapByKey(sourceDuplicateStats, sourceTag, 1)
+						continue
+					}
+					out, messageIDs = removeDuplicateEvents(out, messageIDs, duplicateIndexes)
+					body, _ = sjson.SetBytes(body, "batch", out)
+					totalEventsInReq = len(out)
+				}
+				for _, messageID := range messageIDs {
+					batchMessageIDsSet[messageID] = struct{}{}
+				}
+			}
+
 			body, _ = sjson.SetBytes(body, "requestIP", ipAddr)
 			body, _ = sjson.SetBytes(body, "writeKey", writeKey)
 			body, _ = sjson.SetBytes(body, "receivedAt", time.Now().Format(misc.RFC3339Milli))
@@ -543,6 +688,9 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 				"batch_id":          counter,
 				"source_job_run_id": sourcesJobRunID,
 			}
+			if req.traceParent != "" {
+				params[tracing.TraceParentHeader] = req.traceParent
+			}
 			marshalledParams, err := json.Marshal(params)
 			if err != nil {
 				gateway.logger.Errorf("[Gateway] Failed to marshal parameters map. Parameters: %+v", params)
@@ -563,6 +711,7 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			jobIDReqMap[newJob.UUID] = req
 			jobWriteKeyMap[newJob.UUID] = sourceTag
 			jobEventCountMap[newJob.UUID] = totalEventsInReq
+			jobMessageIDsMap[newJob.UUID] = messageIDs
 		}
 
 		errorMessagesMap := make(map[uuid.UUID]string)
@@ -578,6 +727,18 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			panic(fmt.Errorf("preDbStoreCount:%d+len(jobList):%d != len(breq.batchRequest):%d",
 				preDbStoreCount, len(jobList), len(breq.batchRequest)))
 		}
+		if enableDedup && gateway.dedupHandler != nil {
+			// only messageIDs of stored jobs are marked, so that clients can safely retry failed requests
+			var storedMessageIDs []string
+			for _, job := range jobList {
+				if _, found := errorMessagesMap[job.UUID]; !found {
+					storedMessageIDs = append(storedMessageIDs, jobMessageIDsMap[job.UUID]...)
+				}
+			}
+			if len(storedMessageIDs) > 0 {
+				gateway.dedupHandler.MarkProcessed(storedMessageIDs)
+			}
+		}
 		for _, job := range jobList {
 			err, found := errorMessagesMap[job.UUID]
 			if found {
@@ -586,9 +747,17 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 			} else {
 				misc.IncrementMapByKey(sourceSuccessStats, jobWriteKeyMap[job.UUID], 1)
 				misc.IncrementMapByKey(sourceSuccessEventStats, jobWriteKeyMap[job.UUID], jobEventCountMap[job.UUID])
+				if outcome := jobIDReqMap[job.UUID].outcome; outcome != nil {
+					outcome.storedEvents = jobEventCountMap[job.UUID]
+				}
 			}
 			jobIDReqMap[job.UUID].done <- err
 		}
+		for _, job := range jobList {
+			if _, found := errorMessagesMap[job.UUID]; !found {
+				publishLiveEvents(job)
+			}
+		}
 		//Sending events to config backend
 		for _, eventBatch := range eventBatchesToRecord {
 			writeKey := gjson.Get(eventBatch, "writeKey").Str
@@ -603,15 +772,72 @@ func (gateway *HandleT) userWebRequestWorkerProcess(userWebRequestWorker *userWe
 		gateway.updateSourceStats(sourceFailStats, "gateway.write_key_failed_requests", sourceTagMap)
 		if enableRateLimit {
 			gateway.updateSourceStats(workspaceDropRequestStats, "gateway.work_space_dropped_requests", sourceTagMap)
+			gateway.updateSourceStats(sourceRateLimitedEventStats, "gateway.write_key_rate_limited_events", sourceTagMap)
+		}
+		if enableDedup {
+			gateway.updateSourceStats(sourceDuplicateStats, "gateway.write_key_duplicate_requests", sourceTagMap)
+			gateway.updateSourceStats(sourceDuplicateEventStats, "gateway.write_key_duplicate_events", sourceTagMap)
 		}
 		// update stats event wise
 		gateway.updateSourceStats(sourceEventStats, "gateway.write_key_events", sourceTagMap)
 		gateway.updateSourceStats(sourceSuccessEventStats, "gateway.write_key_successful_events", sourceTagMap)
 		gateway.updateSourceStats(sourceFailEventStats, "gateway.write_key_failed_events", sourceTagMap)
+		gateway.updateRejectedEventStats(sourceRejectedEventStats, sourceTagMap)
 	}
 
 }
 
+// publishLiveEvents publishes the events of a stored job to the live tail watchers of its source
+func publishLiveEvents(job *jobsdb.JobT) {
+	sourceID := gjson.GetBytes(job.Parameters, "source_id").String()
+	if !livetail.Watching(livetail.PointGateway, sourceID, "") {
+		return
+	}
+	gjson.GetBytes(job.EventPayload, "batch").ForEach(func(_, event gjson.Result) bool {
+		livetail.Publish(livetail.NewEvent(livetail.PointGateway, sourceID, "", []byte(event.Raw)))
+		return true
+	})
+}
+
+// setRateLimitHeaders sets the X-RateLimit-* headers, and Retry-After if the limit is reached, from the most restrictive
+// limiter status of the outcomes of a request. It must be called from the goroutine of the handler, once the outcomes are filled.
+func setRateLimitHeaders(writer http.ResponseWriter, outcomes ...*webRequestOutcomeT) {
+	var status ratelimiter.LimitStatusT
+	for _, outcome := range outcomes {
+		if outcome.limitStatus.Limit == 0 {
+			continue
+		}
+		if status.Limit == 0 || outcome.limitStatus.Reached || (!status.Reached && outcome.limitStatus.Remaining < status.Remaining) {
+			status = outcome.limitStatus
+		}
+	}
+	if status.Limit == 0 {
+		return
+	}
+	header := writer.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+	if status.Reached {
+		header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(status.RetryAfter.Seconds())), 10))
+	}
+}
+
+// removeDuplicateEvents removes the events at duplicateIndexes (sorted in ascending order) from the batch along with their messageIDs
+func removeDuplicateEvents(events []map[string]interface{}, messageIDs []string, duplicateIndexes []int) ([]map[string]interface{}, []string) {
+	dedupedEvents := make([]map[string]interface{}, 0, len(events)-len(duplicateIndexes))
+	dedupedMessageIDs := make([]string, 0, len(messageIDs)-len(duplicateIndexes))
+	for idx := range events {
+		if len(duplicateIndexes) > 0 && duplicateIndexes[0] == idx {
+			duplicateIndexes = duplicateIndexes[1:]
+			continue
+		}
+		dedupedEvents = append(dedupedEvents, events[idx])
+		dedupedMessageIDs = append(dedupedMessageIDs, messageIDs[idx])
+	}
+	return dedupedEvents, dedupedMessageIDs
+}
+
 func (gateway *HandleT) isWriteKeyEnabled(writeKey string) bool {
 	configSubscriberLock.RLock()
 	defer configSubscriberLock.RUnlock()
@@ -684,8 +910,16 @@ func (gateway *HandleT) getPayloadFromRequest(r *http.Request) ([]byte, error) {
 	start := time.Now()
 	defer gateway.bodyReadTimeStat.Since(start)
 
-	payload, err := io.ReadAll(r.Body)
-	r.Body.Close()
+	body, err := requestBodyReader(r, int64(maxDecompressedReqSize))
+	if err != nil {
+		r.Body.Close()
+		return []byte{}, err
+	}
+	payload, err := io.ReadAll(body)
+	body.Close()
+	if errors.Is(err, errRequestBodyTooLarge) {
+		return []byte{}, err
+	}
 	if err != nil {
 		gateway.logger.Errorf(
 			"Error reading request body, 'Content-Length': %s, partial payload:\n\t%s\n",
@@ -706,6 +940,10 @@ func (gateway *HandleT) webAudienceListHandler(w http.ResponseWriter, r *http.Re
 }
 
 func (gateway *HandleT) webBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if enablePartialBatchAcceptance {
+		gateway.webPartialBatchHandler(w, r)
+		return
+	}
 	gateway.webHandler(w, r, "batch")
 }
 
@@ -815,7 +1053,49 @@ func (gateway *HandleT) ClearHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	opID, err := operationmanager.GetOperationManager().InsertOperation(payload)
+	opID, err := operationmanager.GetOperationManager().InsertOperation(operationmanager.ClearOperation, payload)
+	if err != nil {
+		errorMessage = err.Error()
+		return
+	}
+
+	w.Write([]byte(fmt.Sprintf(`{"op_id": %d}`, opID)))
+}
+
+func (gateway *HandleT) ReplayAbortedHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.logger.LogRequest(r)
+	var errorMessage string
+	defer func() {
+		if errorMessage != "" {
+			gateway.logger.Info(fmt.Sprintf("IP: %s -- %s -- Response: 400, %s", misc.GetIPFromReq(r), r.URL.Path, errorMessage))
+			http.Error(w, errorMessage, 400)
+		}
+	}()
+
+	payload, _, err := gateway.getPayloadAndWriteKey(w, r, "replay-aborted")
+	if err != nil {
+		errorMessage = err.Error()
+		return
+	}
+
+	if !gjson.ValidBytes(payload) {
+		errorMessage = response.GetStatus(response.InvalidJSON)
+		return
+	}
+
+	var reqPayload operationmanager.ReplayAbortedRequestPayload
+	err = json.Unmarshal(payload, &reqPayload)
+	if err != nil {
+		errorMessage = err.Error()
+		return
+	}
+
+	if err = reqPayload.Validate(); err != nil {
+		errorMessage = err.Error()
+		return
+	}
+
+	opID, err := operationmanager.GetOperationManager().InsertOperation(operationmanager.ReplayAbortedOperation, payload)
 	if err != nil {
 		errorMessage = err.Error()
 		return
@@ -831,8 +1111,8 @@ type pendingEventsRequestPayload struct {
 }
 
 func (gateway *HandleT) pendingEventsHandler(w http.ResponseWriter, r *http.Request) {
-	//Force return that there are pending
-	if config.GetBool("Gateway.DisablePendingEvents", false) {
+	//Force return that there are pending, also when there are no readonly jobsdbs to query (e.g. badger jobsdb backend)
+	if config.GetBool("Gateway.DisablePendingEvents", false) || gateway.readonlyGatewayDB == nil {
 		w.Write([]byte(`{ "pending_events": 1 }`))
 		return
 	}
@@ -1060,10 +1340,14 @@ func (gateway *HandleT) failedEventsHandler(w http.ResponseWriter, r *http.Reque
 func (rrh *RegularRequestHandler) ProcessRequest(gateway *HandleT, w *http.ResponseWriter, r *http.Request, reqType string, payload []byte, writeKey string) string {
 	done := make(chan string, 1)
 	start := time.Now()
-	gateway.addToWebRequestQ(w, r, done, reqType, payload, writeKey)
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.store", attribute.String("reqType", reqType))
+	outcome := &webRequestOutcomeT{}
+	gateway.addToWebRequestQ(outcome, r.WithContext(ctx), done, reqType, payload, writeKey)
 	gateway.addToWebRequestQWaitTime.SendTiming(time.Since(start))
 	defer gateway.ProcessRequestTime.Since(start)
 	errorMessage := <-done
+	setRateLimitHeaders(*w, outcome)
+	tracing.End(span, errorMessage)
 	return errorMessage
 }
 
@@ -1125,15 +1409,7 @@ func (gateway *HandleT) webRequestHandler(rh RequestHandler, w http.ResponseWrit
 	atomic.AddUint64(&gateway.recvCount, 1)
 	var errorMessage string
 	defer func() {
-		if errorMessage != "" {
-			if strings.Contains(errorMessage, response.GetStatus(response.TooManyRequests)) {
-				gateway.logger.Infof("IP: %s -- %s -- Response: %d, %s", misc.GetIPFromReq(r), r.URL.Path, http.StatusTooManyRequests, errorMessage)
-				http.Error(w, errorMessage, http.StatusTooManyRequests)
-				return
-			}
-			gateway.logger.Infof("IP: %s -- %s -- Response: 400, %s", misc.GetIPFromReq(r), r.URL.Path, errorMessage)
-			http.Error(w, errorMessage, 400)
-		}
+		gateway.writeErrorResponse(w, r, errorMessage)
 	}()
 	payload, writeKey, err := gateway.getPayloadAndWriteKey(w, r, reqType)
 	if err != nil {
@@ -1142,6 +1418,14 @@ func (gateway *HandleT) webRequestHandler(rh RequestHandler, w http.ResponseWrit
 	}
 	errorMessage = rh.ProcessRequest(gateway, &w, r, reqType, payload, writeKey)
 	atomic.AddUint64(&gateway.ackCount, 1)
+	if errorMessage == response.GetStatus(response.DuplicateRequest) {
+		// duplicate requests are acknowledged, with a distinct message so that clients can tell them apart
+		errorMessage = ""
+		gateway.trackRequestMetrics(errorMessage)
+		gateway.logger.Debugf("IP: %s -- %s -- Response: 200, %s", misc.GetIPFromReq(r), r.URL.Path, response.GetStatus(response.DuplicateRequest))
+		w.Write([]byte(response.GetStatus(response.DuplicateRequest)))
+		return
+	}
 	gateway.trackRequestMetrics(errorMessage)
 	if errorMessage != "" {
 		return
@@ -1154,6 +1438,25 @@ func (gateway *HandleT) webRequestHandler(rh RequestHandler, w http.ResponseWrit
 	httpWriteTime.Since(httpWriteStartTime)
 }
 
+// writeErrorResponse responds with errorMessage, if any
+func (gateway *HandleT) writeErrorResponse(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	if errorMessage == "" {
+		return
+	}
+	if strings.Contains(errorMessage, response.GetStatus(response.TooManyRequests)) {
+		gateway.logger.Infof("IP: %s -- %s -- Response: %d, %s", misc.GetIPFromReq(r), r.URL.Path, http.StatusTooManyRequests, errorMessage)
+		http.Error(w, errorMessage, http.StatusTooManyRequests)
+		return
+	}
+	if strings.Contains(errorMessage, response.GetStatus(response.StoreUnavailable)) {
+		gateway.logger.Infof("IP: %s -- %s -- Response: %d, %s", misc.GetIPFromReq(r), r.URL.Path, http.StatusServiceUnavailable, errorMessage)
+		http.Error(w, errorMessage, http.StatusServiceUnavailable)
+		return
+	}
+	gateway.logger.Infof("IP: %s -- %s -- Response: 400, %s", misc.GetIPFromReq(r), r.URL.Path, errorMessage)
+	http.Error(w, errorMessage, 400)
+}
+
 func (gateway *HandleT) pixelWebRequestHandler(rh RequestHandler, w http.ResponseWriter, r *http.Request, reqType string) {
 	sendPixelResponse(w)
 	gateway.logger.LogRequest(r)
@@ -1184,8 +1487,12 @@ func (irh *ImportRequestHandler) ProcessRequest(gateway *HandleT, w *http.Respon
 	}
 	count := len(usersPayload)
 	done := make(chan string, count)
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.store", attribute.String("reqType", reqType))
+	outcomes := make([]*webRequestOutcomeT, 0, count)
 	for key := range usersPayload {
-		gateway.addToWebRequestQ(w, r, done, "batch", usersPayload[key], writeKey)
+		outcome := &webRequestOutcomeT{}
+		outcomes = append(outcomes, outcome)
+		gateway.addToWebRequestQ(outcome, r.WithContext(ctx), done, "batch", usersPayload[key], writeKey)
 	}
 
 	interimMsgs := []string{}
@@ -1193,7 +1500,9 @@ func (irh *ImportRequestHandler) ProcessRequest(gateway *HandleT, w *http.Respon
 		interimErrorMessage := <-done
 		interimMsgs = append(interimMsgs, interimErrorMessage)
 	}
+	setRateLimitHeaders(*w, outcomes...)
 	errorMessage = strings.Join(interimMsgs[:], "")
+	tracing.End(span, errorMessage)
 
 	return errorMessage
 }
@@ -1391,6 +1700,7 @@ func (gateway *HandleT) StartWebHandler(ctx context.Context) error {
 	srvMux.HandleFunc("/v1/group", gateway.stat(gateway.webGroupHandler)).Methods("POST")
 	srvMux.HandleFunc("/health", gateway.healthHandler).Methods("GET")
 	srvMux.HandleFunc("/v1/import", gateway.stat(gateway.webImportHandler)).Methods("POST")
+	srvMux.HandleFunc("/v1/bulk", gateway.stat(gateway.webBulkHandler)).Methods("POST")
 	srvMux.HandleFunc("/v1/audiencelist", gateway.stat(gateway.webAudienceListHandler)).Methods("POST")
 	srvMux.HandleFunc("/", gateway.healthHandler).Methods("GET")
 	srvMux.HandleFunc("/pixel/v1/track", gateway.stat(gateway.pixelTrackHandler)).Methods("GET")
@@ -1398,6 +1708,12 @@ func (gateway *HandleT) StartWebHandler(ctx context.Context) error {
 	srvMux.HandleFunc("/version", gateway.versionHandler).Methods("GET")
 	srvMux.HandleFunc("/v1/webhook", gateway.stat(gateway.webhookHandler.RequestHandler)).Methods("POST", "GET")
 	srvMux.HandleFunc("/beacon/v1/batch", gateway.stat(gateway.beaconBatchHandler)).Methods("POST")
+	for _, converter := range adapters.Converters() {
+		handler := gateway.stat(gateway.webAdapterHandler(converter))
+		for _, route := range converter.Routes() {
+			srvMux.HandleFunc(route, handler).Methods("POST")
+		}
+	}
 
 	if enableEventSchemasFeature {
 		srvMux.HandleFunc("/schemas/event-models", gateway.eventSchemaWebHandler(gateway.eventSchemaHandler.GetEventModels)).Methods("GET")
@@ -1444,6 +1760,16 @@ func (gateway *HandleT) StartWebHandler(ctx context.Context) error {
 	g.Go(func() error {
 		return gateway.httpWebServer.ListenAndServe()
 	})
+	if enableGRPC {
+		g.Go(func() error {
+			return gateway.startGRPCServer(ctx)
+		})
+	}
+	if enableKafkaSource {
+		g.Go(func() error {
+			return gateway.startKafkaSource(ctx)
+		})
+	}
 
 	return g.Wait()
 }
@@ -1460,7 +1786,11 @@ func (gateway *HandleT) StartAdminHandler(ctx context.Context) error {
 	srvMux.Use(headerMiddleware)
 	srvMux.HandleFunc("/v1/clear", gateway.stat(gateway.ClearHandler)).Methods("POST")
 	srvMux.HandleFunc("/v1/clear", gateway.stat(gateway.OperationStatusHandler)).Methods("GET")
+	srvMux.HandleFunc("/v1/replay-aborted", gateway.stat(gateway.ReplayAbortedHandler)).Methods("POST")
+	srvMux.HandleFunc("/v1/replay-aborted", gateway.stat(gateway.OperationStatusHandler)).Methods("GET")
 	srvMux.HandleFunc("/v1/pending-events", gateway.stat(gateway.pendingEventsHandler)).Methods("POST")
+	srvMux.HandleFunc("/v1/tail", livetail.Handler(ctx)).Methods("GET")
+	srvMux.HandleFunc("/v1/journey", gateway.stat(journey.Handler)).Methods("GET")
 
 	srv := &http.Server{
 		Addr:    ":" + strconv.Itoa(adminWebPort),
@@ -1500,13 +1830,18 @@ func (gateway *HandleT) backendConfigSubscriber() {
 		enabledWriteKeysSourceMap = map[string]backendconfig.SourceT{}
 		enabledWriteKeyWebhookMap = map[string]string{}
 		enabledWriteKeyWorkspaceMap = map[string]string{}
+		enabledWriteKeyRedactorMap = map[string]*redaction.RedactorT{}
 		sources := config.Data.(backendconfig.ConfigT)
+		redactionOverrides := loadRedactionOverrides()
 		sourceIDToNameMap = map[string]string{}
 		for _, source := range sources.Sources {
 			sourceIDToNameMap[source.ID] = source.Name
 			if source.Enabled {
 				enabledWriteKeysSourceMap[source.WriteKey] = source
 				enabledWriteKeyWorkspaceMap[source.WriteKey] = source.WorkspaceID
+				if redactor := newSourceRedactor(source, redactionOverrides); redactor != nil {
+					enabledWriteKeyRedactorMap[source.WriteKey] = redactor
+				}
 				if source.SourceDefinition.Category == "webhook" {
 					enabledWriteKeyWebhookMap[source.WriteKey] = source.SourceDefinition.Name
 					gateway.webhookHandler.Register(source.SourceDefinition.Name)
@@ -1526,17 +1861,27 @@ Finds the worker for a particular userID and queues the webrequest with the work
 
 They are further batched together in userWebRequestBatcher
 */
-func (gateway *HandleT) addToWebRequestQ(writer *http.ResponseWriter, req *http.Request, done chan string, reqType string, requestPayload []byte, writeKey string) {
+func (gateway *HandleT) addToWebRequestQ(outcome *webRequestOutcomeT, req *http.Request, done chan string, reqType string, requestPayload []byte, writeKey string) {
+	gateway.addToUserWebRequestQ(webRequestUserKey(req), outcome, req, done, reqType, requestPayload, writeKey, nil)
+}
+
+func webRequestUserKey(req *http.Request) string {
 	userIDHeader := req.Header.Get("AnonymousId")
 	//If necessary fetch userID from request body.
 	if userIDHeader == "" {
 		//If the request comes through proxy, proxy would already send this. So this shouldn't be happening in that case
 		userIDHeader = uuid.Must(uuid.NewV4()).String()
 	}
-	userWebRequestWorker := gateway.findUserWebRequestWorker(userIDHeader)
+	return userIDHeader
+}
+
+// addToUserWebRequestQ queues the webrequest with the worker of userKey, so that webrequests of the same user are stored in order.
+// The worker fills outcome, if not nil, before responding on done.
+// If rejectedEvents is not nil, invalid events of the webrequest are rejected individually and appended to it.
+func (gateway *HandleT) addToUserWebRequestQ(userKey string, outcome *webRequestOutcomeT, req *http.Request, done chan string, reqType string, requestPayload []byte, writeKey string, rejectedEvents *[]RejectedEventT) {
 	ipAddr := misc.GetIPFromReq(req)
-	webReq := webRequestT{done: done, reqType: reqType, requestPayload: requestPayload, writeKey: writeKey, ipAddr: ipAddr}
-	userWebRequestWorker.webRequestQ <- &webReq
+	webReq := webRequestT{done: done, outcome: outcome, reqType: reqType, requestPayload: requestPayload, writeKey: writeKey, ipAddr: ipAddr, traceParent: tracing.TraceParent(req.Context()), rejectedEvents: rejectedEvents}
+	gateway.findUserWebRequestWorker(userKey).webRequestQ <- &webReq
 }
 
 // IncrementRecvCount increments the received count for gateway requests
@@ -1632,6 +1977,19 @@ func (gateway *HandleT) Setup(application app.Interface, backendConfig backendco
 		gateway.eventSchemaHandler = event_schema.GetInstance()
 	}
 
+	if enableDedup {
+		// gateway uses its own badger directory, since the processor's dedup may be running in the same process
+		gateway.dedupHandler = dedup.New(dedup.DefaultRudderPath()+"_gw", dedup.WithWindow(dedupWindow))
+	}
+
+	if enableSpillBuffer {
+		spillBuffer, err := newSpillBuffer(gateway.jobsDB, gateway.stats)
+		if err != nil {
+			panic(err)
+		}
+		gateway.spillBuffer = spillBuffer
+	}
+
 	rruntime.Go(func() {
 		gateway.backendConfigSubscriber()
 	})
@@ -1661,6 +2019,12 @@ func (gateway *HandleT) Setup(application app.Interface, backendConfig backendco
 		gateway.initDBWriterWorkers(ctx)
 		return nil
 	}))
+	if gateway.spillBuffer != nil {
+		g.Go(misc.WithBugsnag(func() error {
+			gateway.spillBuffer.drain(ctx)
+			return nil
+		}))
+	}
 	g.Go(misc.WithBugsnag(func() error {
 		gateway.printStats(ctx)
 		return nil
@@ -1681,4 +2045,11 @@ func (gateway *HandleT) Shutdown() {
 	}
 
 	gateway.backgroundWait()
+
+	if gateway.dedupHandler != nil {
+		gateway.dedupHandler.Close()
+	}
+	if gateway.spillBuffer != nil {
+		gateway.spillBuffer.close()
+	}
 }
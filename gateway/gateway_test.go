@@ -2,34 +2,57 @@ package gateway
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Shopify/sarama"
 	uuid "github.com/gofrs/uuid"
 	"github.com/golang/mock/gomock"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/rudderlabs/rudder-server/admin"
 	"github.com/rudderlabs/rudder-server/app"
 	"github.com/rudderlabs/rudder-server/config"
 	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/gateway/adapters"
+	"github.com/rudderlabs/rudder-server/gateway/redaction"
 	"github.com/rudderlabs/rudder-server/gateway/response"
 	"github.com/rudderlabs/rudder-server/jobsdb"
 	mocksApp "github.com/rudderlabs/rudder-server/mocks/app"
 	mocksBackendConfig "github.com/rudderlabs/rudder-server/mocks/config/backend-config"
 	mocksJobsDB "github.com/rudderlabs/rudder-server/mocks/jobsdb"
 	mocksRateLimiter "github.com/rudderlabs/rudder-server/mocks/rate-limiter"
+	mocksDedup "github.com/rudderlabs/rudder-server/mocks/services/dedup"
 	mocksTypes "github.com/rudderlabs/rudder-server/mocks/utils/types"
+	proto "github.com/rudderlabs/rudder-server/proto/gateway"
+	ratelimiter "github.com/rudderlabs/rudder-server/rate-limiter"
 	"github.com/rudderlabs/rudder-server/services/stats"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
@@ -235,6 +258,102 @@ var _ = Describe("Gateway Enterprise", func() {
 		})
 	})
 
+	Context("Partial batch acceptance", func() {
+		gateway := &HandleT{}
+
+		BeforeEach(func() {
+			SetEnablePartialBatchAcceptance(true)
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+		})
+
+		AfterEach(func() {
+			SetEnablePartialBatchAcceptance(false)
+		})
+
+		It("should store valid events and report rejected events individually", func() {
+			defer func(previous int) { maxReqSize = previous }(maxReqSize)
+			maxReqSize = 200
+			body := fmt.Sprintf(`{"batch":[
+				{"userId":%[1]q,"messageId":"m0"},
+				"not-an-event",
+				{"messageId":"m2"},
+				{"userId":%[2]q,"messageId":"m3"},
+				{"userId":%[1]q,"messageId":"m4","data":%[3]q},
+				{"userId":%[1]q,"messageId":"m5"}
+			]}`, NormalUserID, SuppressedUserID, strings.Repeat("a", 200))
+
+			mockCall := c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					Expect(jobs).To(HaveLen(1))
+					batch := gjson.GetBytes(jobs[0].EventPayload, "batch").Array()
+					Expect(batch).To(HaveLen(2))
+					Expect(batch[0].Get("messageId").String()).To(Equal("m0"))
+					Expect(batch[1].Get("messageId").String()).To(Equal("m5"))
+					Expect(jobs[0].EventCount).To(Equal(2))
+					return jobsToEmptyErrors(jobs)
+				}).Times(1)
+			tFunc := c.asyncHelper.ExpectAndNotifyCallbackWithName("store-job")
+			mockCall.Do(func(interface{}) { tFunc() })
+
+			rr := expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200,
+				`{"accepted":2,"duplicates":0,"rejected":[{"index":1,"reason":"invalid_json"},{"index":2,"messageId":"m2","reason":"not_identifiable"},{"index":3,"messageId":"m3","reason":"suppressed"},{"index":4,"messageId":"m4","reason":"oversize"}]}`)
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/json"))
+		})
+
+		It("should respond with 400 if every event is rejected", func() {
+			body := `{"batch":[{"messageId":"m0"}]}`
+
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+
+			expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 400,
+				`{"accepted":0,"duplicates":0,"rejected":[{"index":0,"messageId":"m0","reason":"not_identifiable"}]}`)
+		})
+
+		Context("with dedup", func() {
+			var mockDedup *mocksDedup.MockDedupI
+
+			BeforeEach(func() {
+				mockDedup = mocksDedup.NewMockDedupI(c.mockCtrl)
+				gateway.dedupHandler = mockDedup
+				SetEnableDedup(true)
+			})
+
+			AfterEach(func() {
+				SetEnableDedup(false)
+				gateway.dedupHandler = nil
+			})
+
+			It("should report duplicate events separately from the accepted ones", func() {
+				body := fmt.Sprintf(`{"batch":[{"userId":%[1]q,"messageId":"m0"},{"userId":%[1]q,"messageId":"m1"},{"messageId":"m2"}]}`, NormalUserID)
+
+				mockDedup.EXPECT().FindDuplicates([]string{"m0", "m1"}, gomock.Any()).Return([]int{1}).Times(1)
+				mockDedup.EXPECT().MarkProcessed([]string{"m0"}).Times(1)
+				c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).DoAndReturn(jobsToEmptyErrors).Times(1)
+
+				expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200,
+					`{"accepted":1,"duplicates":1,"rejected":[{"index":2,"messageId":"m2","reason":"not_identifiable"}]}`)
+			})
+
+			It("should acknowledge requests whose events are all duplicates", func() {
+				body := fmt.Sprintf(`{"batch":[{"userId":%[1]q,"messageId":"m0"},{"messageId":"m1"}]}`, NormalUserID)
+
+				mockDedup.EXPECT().FindDuplicates([]string{"m0"}, gomock.Any()).Return([]int{0}).Times(1)
+				c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+
+				expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200,
+					`{"accepted":0,"duplicates":1,"rejected":[{"index":1,"messageId":"m1","reason":"not_identifiable"}]}`)
+			})
+		})
+
+		It("should still fail requests with invalid write keys as a whole", func() {
+			body := fmt.Sprintf(`{"batch":[{"userId":%q}]}`, NormalUserID)
+
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+
+			expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyDisabled, bytes.NewBufferString(body)), 400, response.InvalidWriteKey+"\n")
+		})
+	})
+
 })
 
 var _ = Describe("Gateway", func() {
@@ -389,15 +508,21 @@ var _ = Describe("Gateway", func() {
 			tFunc := c.asyncHelper.ExpectAndNotifyCallbackWithName("")
 			mockCall.Do(func(interface{}) { tFunc() })
 
-			mockCall = c.mockRateLimiter.EXPECT().LimitReached(workspaceID).Return(false).Times(1)
+			limitKeys := ratelimiter.KeysT{WorkspaceID: workspaceID, SourceID: SourceIDEnabled, WriteKey: WriteKeyEnabled}
+			limitStatus := ratelimiter.LimitStatusT{Limit: 10, Remaining: 9, ResetAt: time.Unix(1000, 0)}
+			mockCall = c.mockRateLimiter.EXPECT().LimitReached(limitKeys, 1).Return(limitStatus).Times(1)
 			tFunc = c.asyncHelper.ExpectAndNotifyCallbackWithName("")
-			mockCall.Do(func(interface{}) { tFunc() })
+			mockCall.Do(func(interface{}, interface{}) { tFunc() })
 
 			mockCall = c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).DoAndReturn(jobsToEmptyErrors).Times(1)
 			tFunc = c.asyncHelper.ExpectAndNotifyCallbackWithName("")
 			mockCall.Do(func(interface{}) { tFunc() })
 
-			expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(`{"userId":"dummyId"}`)), 200, "OK")
+			rr := expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(`{"userId":"dummyId"}`)), 200, "OK")
+			Expect(rr.Header().Get("X-RateLimit-Limit")).To(Equal("10"))
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("9"))
+			Expect(rr.Header().Get("X-RateLimit-Reset")).To(Equal("1000"))
+			Expect(rr.Header().Get("Retry-After")).To(BeEmpty())
 		})
 
 		It("should reject messages if rate limit is reached for workspace", func() {
@@ -407,11 +532,713 @@ var _ = Describe("Gateway", func() {
 			tFunc := c.asyncHelper.ExpectAndNotifyCallbackWithName("")
 			mockCall.Do(func(interface{}) { tFunc() })
 
-			c.mockRateLimiter.EXPECT().LimitReached(workspaceID).Return(true).Times(1)
+			limitStatus := ratelimiter.LimitStatusT{Reached: true, Limit: 10, Remaining: 0, ResetAt: time.Unix(1000, 0), RetryAfter: 1500 * time.Millisecond}
+			c.mockRateLimiter.EXPECT().LimitReached(gomock.Any(), 1).Return(limitStatus).Times(1)
 			tFunc = c.asyncHelper.ExpectAndNotifyCallbackWithName("")
 			mockCall.Do(func(interface{}) { tFunc() })
 
-			expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")), 429, response.TooManyRequests+"\n")
+			rr := expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")), 429, response.TooManyRequests+"\n")
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("0"))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("2"))
+		})
+
+		It("should set the headers of the most restrictive limit status of the jobs of a bulk request", func() {
+			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return("some-workspace-id").AnyTimes()
+			var remaining int32 = 10
+			c.mockRateLimiter.EXPECT().LimitReached(gomock.Any(), 1).
+				DoAndReturn(func(ratelimiter.KeysT, int) ratelimiter.LimitStatusT {
+					return ratelimiter.LimitStatusT{Limit: 10, Remaining: int(atomic.AddInt32(&remaining, -1)), ResetAt: time.Unix(1000, 0)}
+				}).Times(2)
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).DoAndReturn(jobsToEmptyErrors).AnyTimes()
+
+			body := `{"type":"track","userId":"u1","messageId":"m1"}` + "\n" + `{"type":"track","userId":"u2","messageId":"m2"}`
+			rr := expectHandlerResponse(gateway.webBulkHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("8"))
+		})
+
+		It("should set the headers of the most restrictive limit status of the requests of an import", func() {
+			rr := httptest.NewRecorder()
+			setRateLimitHeaders(rr,
+				&webRequestOutcomeT{},
+				&webRequestOutcomeT{limitStatus: ratelimiter.LimitStatusT{Limit: 10, Remaining: 5, ResetAt: time.Unix(1000, 0)}},
+				&webRequestOutcomeT{limitStatus: ratelimiter.LimitStatusT{Limit: 10, Remaining: 3, ResetAt: time.Unix(1000, 0)}},
+				&webRequestOutcomeT{limitStatus: ratelimiter.LimitStatusT{Limit: 10, Remaining: 4, ResetAt: time.Unix(1000, 0)}},
+			)
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("3"))
+			Expect(rr.Header().Get("Retry-After")).To(BeEmpty())
+
+			rr = httptest.NewRecorder()
+			setRateLimitHeaders(rr, &webRequestOutcomeT{})
+			Expect(rr.Header()).To(BeEmpty())
+		})
+	})
+
+	Context("Dedup", func() {
+		var (
+			gateway   = &HandleT{}
+			mockDedup *mocksDedup.MockDedupI
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+			mockDedup = mocksDedup.NewMockDedupI(c.mockCtrl)
+			gateway.dedupHandler = mockDedup
+			SetEnableDedup(true)
+		})
+
+		AfterEach(func() {
+			SetEnableDedup(false)
+			gateway.dedupHandler = nil
+		})
+
+		It("should drop duplicate events and mark stored messageIds as processed", func() {
+			body := `{"batch":[{"userId":"dummyId","messageId":"m1"},{"userId":"dummyId","messageId":"m2"}]}`
+
+			mockDedup.EXPECT().FindDuplicates([]string{"m1", "m2"}, gomock.Any()).Return([]int{0}).Times(1)
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					Expect(jobs).To(HaveLen(1))
+					batch := gjson.GetBytes(jobs[0].EventPayload, "batch").Array()
+					Expect(batch).To(HaveLen(1))
+					Expect(batch[0].Get("messageId").String()).To(Equal("m2"))
+					Expect(jobs[0].EventCount).To(Equal(1))
+					return jobsToEmptyErrors(jobs)
+				}).Times(1)
+			mockCall := mockDedup.EXPECT().MarkProcessed([]string{"m2"}).Times(1)
+			tFunc := c.asyncHelper.ExpectAndNotifyCallbackWithName("mark_processed")
+			mockCall.Do(func(interface{}) { tFunc() })
+
+			expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+		})
+
+		It("should acknowledge requests with only duplicate events without storing them", func() {
+			body := `{"userId":"dummyId","messageId":"m1"}`
+
+			mockDedup.EXPECT().FindDuplicates([]string{"m1"}, gomock.Any()).Return([]int{0}).Times(1)
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+			mockDedup.EXPECT().MarkProcessed(gomock.Any()).Times(0)
+
+			expectHandlerResponse(gateway.webTrackHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, response.DuplicateRequest)
+		})
+
+		It("should not mark messageIds of jobs which failed to be stored", func() {
+			body := `{"userId":"dummyId","messageId":"m1"}`
+
+			mockDedup.EXPECT().FindDuplicates([]string{"m1"}, gomock.Any()).Return(nil).Times(1)
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					return map[uuid.UUID]string{jobs[0].UUID: "store failed"}
+				}).Times(1)
+			mockDedup.EXPECT().MarkProcessed(gomock.Any()).Times(0)
+
+			expectHandlerResponse(gateway.webTrackHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 400, "store failed\n")
+		})
+	})
+
+	Context("Compressed requests", func() {
+		var (
+			gateway = &HandleT{}
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+		})
+
+		compressedRequest := func(encoding string, body []byte) *http.Request {
+			var compressed bytes.Buffer
+			switch encoding {
+			case "gzip":
+				writer := gzip.NewWriter(&compressed)
+				writer.Write(body)
+				writer.Close()
+			case "zstd":
+				writer, _ := zstd.NewWriter(&compressed)
+				writer.Write(body)
+				writer.Close()
+			default:
+				compressed.Write(body)
+			}
+			req := authorizedRequest(WriteKeyEnabled, &compressed)
+			req.Header.Set("Content-Encoding", encoding)
+			return req
+		}
+
+		for _, encoding := range []string{"gzip", "zstd"} {
+			encoding := encoding
+			It(fmt.Sprintf("should decompress %s request bodies", encoding), func() {
+				body := `{"batch":[{"userId":"dummyId","messageId":"m1"},{"userId":"dummyId","messageId":"m2"}]}`
+
+				c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+					DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+						Expect(jobs).To(HaveLen(1))
+						batch := gjson.GetBytes(jobs[0].EventPayload, "batch").Array()
+						Expect(batch).To(HaveLen(2))
+						Expect(batch[1].Get("messageId").String()).To(Equal("m2"))
+						return jobsToEmptyErrors(jobs)
+					}).Times(1)
+
+				expectHandlerResponse(gateway.webBatchHandler, compressedRequest(encoding, []byte(body)), 200, "OK")
+			})
+		}
+
+		for _, encoding := range []string{"", "gzip"} {
+			encoding := encoding
+			It(fmt.Sprintf("should reject request bodies exceeding the decompressed size limit with encoding %q", encoding), func() {
+				defer func(previous int) { maxDecompressedReqSize = previous }(maxDecompressedReqSize)
+				maxDecompressedReqSize = 1024
+				body := fmt.Sprintf(`{"userId":"dummyId","data":%q}`, strings.Repeat("a", 2048))
+
+				c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+
+				expectHandlerResponse(gateway.webTrackHandler, compressedRequest(encoding, []byte(body)), 400, fmt.Sprintf("read payload from request: %s\n", response.RequestBodyTooLarge))
+			})
+		}
+
+		It("should reject request bodies with unsupported encodings", func() {
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).Times(0)
+
+			expectHandlerResponse(gateway.webTrackHandler, compressedRequest("br", []byte(`{"userId":"dummyId"}`)), 400, fmt.Sprintf("read payload from request: %s\n", response.UnsupportedContentEncoding))
+		})
+	})
+
+	Context("Bulk requests", func() {
+		var (
+			gateway    = &HandleT{}
+			storedLock sync.Mutex
+			stored     []*jobsdb.JobT
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+			stored = nil
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					storedLock.Lock()
+					defer storedLock.Unlock()
+					stored = append(stored, jobs...)
+					return jobsToEmptyErrors(jobs)
+				}).AnyTimes()
+		})
+
+		storedMessageIDs := func() map[string][]string {
+			storedLock.Lock()
+			defer storedLock.Unlock()
+			messageIDs := make(map[string][]string)
+			for _, job := range stored {
+				for _, event := range gjson.GetBytes(job.EventPayload, "batch").Array() {
+					userID := event.Get("userId").String()
+					messageIDs[userID] = append(messageIDs[userID], event.Get("messageId").String())
+				}
+			}
+			return messageIDs
+		}
+
+		It("should split events into jobs per user", func() {
+			defer func(previous int) { bulkMaxEventsPerJob = previous }(bulkMaxEventsPerJob)
+			bulkMaxEventsPerJob = 2
+			body := strings.Join([]string{
+				`{"type":"track","userId":"u1","messageId":"m1"}`,
+				`{"type":"track","userId":"u2","messageId":"m2"}`,
+				``,
+				`{"type":"track","userId":"u1","messageId":"m3"}`,
+				`{"type":"identify","userId":"u1","messageId":"m4"}`,
+			}, "\n")
+
+			expectHandlerResponse(gateway.webBulkHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+
+			Expect(stored).To(HaveLen(3))
+			for _, job := range stored {
+				userIDs := map[string]struct{}{}
+				for _, event := range gjson.GetBytes(job.EventPayload, "batch").Array() {
+					userIDs[event.Get("userId").String()] = struct{}{}
+				}
+				Expect(userIDs).To(HaveLen(1))
+			}
+			Expect(storedMessageIDs()).To(Equal(map[string][]string{"u1": {"m1", "m3", "m4"}, "u2": {"m2"}}))
+		})
+
+		It("should accept gzip compressed bodies", func() {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			writer.Write([]byte(`{"type":"track","userId":"u1","messageId":"m1"}` + "\n" + `{"type":"track","userId":"u1","messageId":"m2"}` + "\n"))
+			writer.Close()
+			req := authorizedRequest(WriteKeyEnabled, &compressed)
+			req.Header.Set("Content-Encoding", "gzip")
+
+			expectHandlerResponse(gateway.webBulkHandler, req, 200, "OK")
+
+			Expect(stored).To(HaveLen(1))
+			Expect(storedMessageIDs()).To(Equal(map[string][]string{"u1": {"m1", "m2"}}))
+		})
+
+		It("should store events preceding an invalid line and report it", func() {
+			body := `{"type":"track","userId":"u1","messageId":"m1"}` + "\n" + `{"type":"track",` + "\n" + `{"type":"track","userId":"u1","messageId":"m3"}`
+
+			expectHandlerResponse(gateway.webBulkHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 400, response.InvalidJSON+" at line 2\n")
+
+			Expect(storedMessageIDs()).To(Equal(map[string][]string{"u1": {"m1"}}))
+		})
+
+		It("should reject requests without Authorization header", func() {
+			expectHandlerResponse(gateway.webBulkHandler, unauthorizedRequest(bytes.NewBufferString(`{}`)), 400, response.NoWriteKeyInBasicAuth+"\n")
+		})
+	})
+
+	Context("Adapter requests", func() {
+		var (
+			gateway = &HandleT{}
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+		})
+
+		It("should store converted amplitude events, authorized by the api_key of the payload", func() {
+			body := `{"api_key":"` + WriteKeyEnabled + `","events":[{"event_type":"Song Played","user_id":"u1","insert_id":"m1"},{"event_type":"$identify","user_id":"u1","insert_id":"m2","user_properties":{"$set":{"plan":"pro"}}}]}`
+
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					Expect(jobs).To(HaveLen(1))
+					batch := gjson.GetBytes(jobs[0].EventPayload, "batch").Array()
+					Expect(batch).To(HaveLen(2))
+					Expect(batch[0].Get("type").String()).To(Equal("track"))
+					Expect(batch[0].Get("event").String()).To(Equal("Song Played"))
+					Expect(batch[1].Get("type").String()).To(Equal("identify"))
+					Expect(batch[1].Get("traits.plan").String()).To(Equal("pro"))
+					Expect(gjson.GetBytes(jobs[0].EventPayload, "writeKey").String()).To(Equal(WriteKeyEnabled))
+					return jobsToEmptyErrors(jobs)
+				}).Times(1)
+
+			req := httptest.NewRequest("POST", "/2/httpapi", bytes.NewBufferString(body))
+			expectHandlerResponse(gateway.webAdapterHandler(&adapters.AmplitudeT{}), req, 200, "OK")
+		})
+
+		It("should reject requests which cannot be converted", func() {
+			req := httptest.NewRequest("POST", "/2/httpapi", bytes.NewBufferString(`{"api_key":"`+WriteKeyEnabled+`","events":[{"user_id":"u1"}]}`))
+			expectHandlerResponse(gateway.webAdapterHandler(&adapters.AmplitudeT{}), req, 400, "amplitude: event 0: event without event_type\n")
+		})
+
+		It("should reject requests without write key", func() {
+			req := httptest.NewRequest("POST", "/com.snowplowanalytics.snowplow/tp2", bytes.NewBufferString(`{"data":[{"e":"pv","uid":"u1"}]}`))
+			expectHandlerResponse(gateway.webAdapterHandler(&adapters.SnowplowT{}), req, 400, response.NoWriteKeyInBasicAuth+"\n")
+		})
+	})
+
+	Context("Kafka source", func() {
+		var (
+			gateway    = &HandleT{}
+			storedLock sync.Mutex
+			stored     []*jobsdb.JobT
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+			stored = nil
+		})
+
+		consume := func(source *kafkaSourceT, messages ...*sarama.ConsumerMessage) *fakeKafkaSessionT {
+			session := &fakeKafkaSessionT{ctx: context.Background()}
+			claim := &fakeKafkaClaimT{messages: make(chan *sarama.ConsumerMessage, len(messages))}
+			for _, message := range messages {
+				claim.messages <- message
+			}
+			close(claim.messages)
+			Expect(source.ConsumeClaim(session, claim)).To(BeNil())
+			return session
+		}
+
+		It("should store messages and mark them once stored", func() {
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					storedLock.Lock()
+					defer storedLock.Unlock()
+					stored = append(stored, jobs...)
+					return jobsToEmptyErrors(jobs)
+				}).AnyTimes()
+			source := &kafkaSourceT{gateway: gateway, writeKeys: map[string]string{"events": WriteKeyEnabled}}
+
+			session := consume(source,
+				&sarama.ConsumerMessage{Topic: "events", Offset: 0, Key: []byte("u1"), Value: []byte(`{"type":"track","userId":"u1","messageId":"m0"}`)},
+				&sarama.ConsumerMessage{Topic: "events", Offset: 1, Value: []byte(`not-json`)},
+				&sarama.ConsumerMessage{Topic: "events", Offset: 2, Key: []byte("u2"), Value: []byte(`{"batch":[{"type":"track","userId":"u2","messageId":"m2"}]}`)},
+				&sarama.ConsumerMessage{Topic: "other", Offset: 3, Key: []byte("u3"), Value: []byte(`{"type":"track","userId":"u3","messageId":"m3"}`),
+					Headers: []*sarama.RecordHeader{{Key: []byte("writeKey"), Value: []byte(WriteKeyEnabled)}}},
+			)
+
+			Expect(session.marked).To(Equal([]int64{0, 1, 2, 3}))
+			Expect(session.commits).To(BeNumerically(">", 0))
+			Expect(stored).To(HaveLen(3))
+			messageIDs := []string{}
+			for _, job := range stored {
+				Expect(gjson.GetBytes(job.EventPayload, "writeKey").String()).To(Equal(WriteKeyEnabled))
+				for _, event := range gjson.GetBytes(job.EventPayload, "batch").Array() {
+					messageIDs = append(messageIDs, event.Get("messageId").String())
+				}
+			}
+			Expect(messageIDs).To(ConsistOf("m0", "m2", "m3"))
+		})
+
+		It("should retry messages failing to be stored before marking them", func() {
+			defer func(previous time.Duration) { kafkaSourceRetryBackoff = previous }(kafkaSourceRetryBackoff)
+			kafkaSourceRetryBackoff = time.Millisecond
+			var attempts int
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					attempts++
+					if attempts == 1 {
+						return map[uuid.UUID]string{jobs[0].UUID: "tx error"}
+					}
+					return jobsToEmptyErrors(jobs)
+				}).Times(2)
+			source := &kafkaSourceT{gateway: gateway, writeKeys: map[string]string{"events": WriteKeyEnabled}}
+
+			session := consume(source, &sarama.ConsumerMessage{Topic: "events", Offset: 7, Value: []byte(`{"type":"track","userId":"u1","messageId":"m0"}`)})
+
+			Expect(attempts).To(Equal(2))
+			Expect(session.marked).To(Equal([]int64{7}))
+		})
+
+		It("should not mark messages which are not stored when the session ends", func() {
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					return map[uuid.UUID]string{jobs[0].UUID: "tx error"}
+				}).AnyTimes()
+			source := &kafkaSourceT{gateway: gateway, writeKeys: map[string]string{"events": WriteKeyEnabled}}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			session := &fakeKafkaSessionT{ctx: ctx}
+			claim := &fakeKafkaClaimT{messages: make(chan *sarama.ConsumerMessage, 1)}
+			claim.messages <- &sarama.ConsumerMessage{Topic: "events", Value: []byte(`{"type":"track","userId":"u1","messageId":"m0"}`)}
+
+			Expect(source.ConsumeClaim(session, claim)).To(BeNil())
+			Expect(session.marked).To(BeEmpty())
+		})
+
+		It("should not mark messages processed after a message which is not stored when the session ends", func() {
+			source := &kafkaSourceT{gateway: gateway}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			session := &fakeKafkaSessionT{ctx: ctx}
+			inFlight := make(chan *kafkaMessageT, 2)
+			inFlight <- &kafkaMessageT{message: &sarama.ConsumerMessage{Topic: "events", Offset: 0}, done: make(chan string, 1)}
+			stored := &kafkaMessageT{message: &sarama.ConsumerMessage{Topic: "events", Offset: 1}, done: make(chan string, 1)}
+			stored.done <- ""
+			inFlight <- stored
+			close(inFlight)
+
+			source.markProcessed(session, inFlight)
+			Expect(session.marked).To(BeEmpty())
+		})
+
+		It("should parse topics", func() {
+			writeKeys, err := parseKafkaTopics([]string{"events:key-1", " other : key-2 "})
+			Expect(err).To(BeNil())
+			Expect(writeKeys).To(Equal(map[string]string{"events": "key-1", "other": "key-2"}))
+			_, err = parseKafkaTopics([]string{"events"})
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Context("Spill buffer", func() {
+		var (
+			gateway = &HandleT{}
+		)
+
+		BeforeEach(func() {
+			var err error
+			enableSpillBuffer = true
+			spillDir, err = os.MkdirTemp("", "gateway-spill")
+			Expect(err).To(BeNil())
+			spillDrainInterval = 10 * time.Millisecond
+			spillDrainRetryBackoff = 10 * time.Millisecond
+		})
+
+		JustBeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+		})
+
+		AfterEach(func() {
+			gateway.Shutdown()
+			enableSpillBuffer = false
+			Expect(os.RemoveAll(spillDir)).To(Succeed())
+			spillDir = ""
+		})
+
+		failedJobs := func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+			errorMessagesMap := make(map[uuid.UUID]string)
+			for _, job := range jobs {
+				errorMessagesMap[job.UUID] = "connection refused"
+			}
+			return errorMessagesMap
+		}
+
+		It("should acknowledge batches failing to be stored and drain them in order once the database recovers", func() {
+			var (
+				storeLock sync.Mutex
+				available bool
+				stored    []string
+			)
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					storeLock.Lock()
+					defer storeLock.Unlock()
+					if !available {
+						return failedJobs(jobs)
+					}
+					for _, job := range jobs {
+						stored = append(stored, gjson.GetBytes(job.EventPayload, "batch.0.messageId").String())
+					}
+					return jobsToEmptyErrors(jobs)
+				}).AnyTimes()
+
+			for _, messageID := range []string{"m1", "m2"} {
+				body := `{"batch":[{"userId":"dummyId","messageId":"` + messageID + `"}]}`
+				expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+			}
+			status := gateway.spillBuffer.status()
+			Expect(status["spilling"]).To(BeTrue())
+			Expect(status["pending-batches"]).To(BeEquivalentTo(2))
+			Expect(status["last-drain-error"]).To(Equal("connection refused"))
+
+			storeLock.Lock()
+			available = true
+			storeLock.Unlock()
+			Eventually(func() interface{} { return gateway.spillBuffer.status()["spilling"] }).Should(BeFalse())
+			storeLock.Lock()
+			defer storeLock.Unlock()
+			Expect(stored).To(Equal([]string{"m1", "m2"}))
+			status = gateway.spillBuffer.status()
+			Expect(status["pending-batches"]).To(BeEquivalentTo(0))
+			Expect(status["drained-jobs"]).To(BeEquivalentTo(2))
+		})
+
+		It("should fail batches failing to be stored on their own rather than spilling them", func() {
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					return map[uuid.UUID]string{jobs[0].UUID: "invalid input syntax for type json"}
+				}).Times(1)
+
+			body := `{"batch":[{"userId":"dummyId","messageId":"m1"}]}`
+			expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 400, "invalid input syntax for type json\n")
+			status := gateway.spillBuffer.status()
+			Expect(status["spilling"]).To(BeFalse())
+			Expect(status["spilled-batches"]).To(BeEquivalentTo(0))
+		})
+
+		Context("without partial writes", func() {
+			BeforeEach(func() {
+				gwAllowPartialWriteWithErrors = false
+			})
+
+			AfterEach(func() {
+				gwAllowPartialWriteWithErrors = true
+			})
+
+			It("should drain batches with the store they were received with", func() {
+				var (
+					storeLock sync.Mutex
+					available bool
+					stored    []string
+				)
+				c.mockJobsDB.EXPECT().Store(gomock.Any()).
+					DoAndReturn(func(jobs []*jobsdb.JobT) error {
+						storeLock.Lock()
+						defer storeLock.Unlock()
+						if !available {
+							return errors.New("dial tcp: connection refused")
+						}
+						for _, job := range jobs {
+							stored = append(stored, gjson.GetBytes(job.EventPayload, "batch.0.messageId").String())
+						}
+						return nil
+					}).AnyTimes()
+
+				body := `{"batch":[{"userId":"dummyId","messageId":"m1"}]}`
+				expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+				Expect(gateway.spillBuffer.status()["pending-batches"]).To(BeEquivalentTo(1))
+
+				storeLock.Lock()
+				available = true
+				storeLock.Unlock()
+				Eventually(func() interface{} { return gateway.spillBuffer.status()["spilling"] }).Should(BeFalse())
+				storeLock.Lock()
+				defer storeLock.Unlock()
+				Expect(stored).To(Equal([]string{"m1"}))
+			})
+		})
+
+		Context("once full", func() {
+			var previousMaxSize int64
+
+			BeforeEach(func() {
+				previousMaxSize, spillMaxSize = spillMaxSize, 1
+			})
+
+			AfterEach(func() {
+				spillMaxSize = previousMaxSize
+			})
+
+			It("should reject batches failing to be stored as the jobs database is unavailable", func() {
+				c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).DoAndReturn(failedJobs).AnyTimes()
+
+				body := `{"batch":[{"userId":"dummyId","messageId":"m1"}]}`
+				expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 503, response.GetStatus(response.StoreUnavailable)+"\n")
+				Expect(gateway.spillBuffer.status()["pending-batches"]).To(BeEquivalentTo(0))
+			})
+		})
+	})
+
+	Context("Redaction", func() {
+		var (
+			gateway = &HandleT{}
+		)
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "gateway-redaction")
+			Expect(err).To(BeNil())
+			redactionOverridesFile = filepath.Join(dir, "redaction.json")
+			overrides := `{"sources":{"` + SourceIDEnabled + `":[
+				{"path":"userId","action":"hash"},
+				{"path":"context.ip","action":"mask"},
+				{"keyPattern":"^email$","action":"drop"}
+			]}}`
+			Expect(os.WriteFile(redactionOverridesFile, []byte(overrides), 0o600)).To(Succeed())
+			redactionSalt = "salt"
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+			Eventually(func() bool {
+				configSubscriberLock.RLock()
+				defer configSubscriberLock.RUnlock()
+				return enabledWriteKeyRedactorMap[WriteKeyEnabled] != nil
+			}).Should(BeTrue())
+		})
+
+		AfterEach(func() {
+			gateway.Shutdown()
+			Expect(os.RemoveAll(filepath.Dir(redactionOverridesFile))).To(Succeed())
+			redactionOverridesFile = ""
+			redactionSalt = ""
+		})
+
+		It("should redact events before storing them", func() {
+			var stored []*jobsdb.JobT
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					stored = append(stored, jobs...)
+					return jobsToEmptyErrors(jobs)
+				}).AnyTimes()
+
+			body := `{"batch":[{"userId":"dummyId","context":{"ip":"10.1.2.3","traits":{"email":"user@example.com","plan":"pro"}}}]}`
+			expectHandlerResponse(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)), 200, "OK")
+
+			hashedUserID := sha256.Sum256([]byte("salt" + "dummyId"))
+			Expect(stored).To(HaveLen(1))
+			Expect(stored[0].UserID).To(Equal(DELIMITER + hex.EncodeToString(hashedUserID[:])))
+			event := gjson.GetBytes(stored[0].EventPayload, "batch.0")
+			Expect(event.Get("userId").String()).To(Equal(hex.EncodeToString(hashedUserID[:])))
+			Expect(event.Get("context.ip").String()).To(Equal(redaction.MaskValue))
+			Expect(event.Get("context.traits.email").Exists()).To(BeFalse())
+			Expect(event.Get("context.traits.plan").String()).To(Equal("pro"))
+		})
+	})
+
+	Context("gRPC ingestion", func() {
+		var (
+			gateway    = &HandleT{}
+			conn       *grpc.ClientConn
+			client     proto.GatewayClient
+			srv        *grpc.Server
+			storedLock sync.Mutex
+			stored     []*jobsdb.JobT
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockApp, c.mockBackendConfig, c.mockJobsDB, nil, c.mockVersionHandler)
+			stored = nil
+			c.mockJobsDB.EXPECT().StoreWithRetryEach(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					storedLock.Lock()
+					defer storedLock.Unlock()
+					stored = append(stored, jobs...)
+					return jobsToEmptyErrors(jobs)
+				}).AnyTimes()
+
+			listener := bufconn.Listen(1024 * 1024)
+			srv = gateway.newGRPCServer()
+			go srv.Serve(listener)
+			var err error
+			conn, err = grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}))
+			Expect(err).To(BeNil())
+			client = proto.NewGatewayClient(conn)
+		})
+
+		AfterEach(func() {
+			conn.Close()
+			srv.Stop()
+		})
+
+		withWriteKey := func(writeKey string) context.Context {
+			return metadata.AppendToOutgoingContext(context.Background(), "writekey", writeKey)
+		}
+
+		It("should store batches and acknowledge every event", func() {
+			resp, err := client.Batch(withWriteKey(WriteKeyEnabled), &proto.BatchRequest{
+				Events: [][]byte{
+					[]byte(`{"type":"track","userId":"u1","messageId":"m0"}`),
+					[]byte(`not-json`),
+					[]byte(`{"type":"track","messageId":"m2"}`),
+					[]byte(`{"type":"track","userId":"u1"}`),
+				},
+			})
+			Expect(err).To(BeNil())
+
+			acks := resp.GetAcks()
+			Expect(acks).To(HaveLen(4))
+			Expect(acks[0].GetAccepted()).To(BeTrue())
+			Expect(acks[0].GetMessageId()).To(Equal("m0"))
+			Expect(acks[1].GetAccepted()).To(BeFalse())
+			Expect(acks[1].GetReason()).To(Equal(RejectedInvalidJSON))
+			Expect(acks[2].GetAccepted()).To(BeFalse())
+			Expect(acks[2].GetReason()).To(Equal(RejectedNotIdentifiable))
+			Expect(acks[3].GetAccepted()).To(BeTrue())
+			Expect(acks[3].GetMessageId()).To(testutils.BeValidUUID())
+
+			Expect(stored).To(HaveLen(1))
+			batch := gjson.GetBytes(stored[0].EventPayload, "batch").Array()
+			Expect(batch).To(HaveLen(2))
+			Expect(batch[1].Get("messageId").String()).To(Equal(acks[3].GetMessageId()))
+		})
+
+		It("should authenticate with basic authorization metadata", func() {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(WriteKeyEnabled+":")))
+			resp, err := client.Batch(ctx, &proto.BatchRequest{Events: [][]byte{[]byte(`{"type":"track","userId":"u1"}`)}})
+			Expect(err).To(BeNil())
+			Expect(resp.GetAcks()[0].GetAccepted()).To(BeTrue())
+		})
+
+		It("should reject calls without a valid write key", func() {
+			_, err := client.Batch(context.Background(), &proto.BatchRequest{Events: [][]byte{[]byte(`{"type":"track","userId":"u1"}`)}})
+			Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+
+			_, err = client.Batch(withWriteKey(WriteKeyDisabled), &proto.BatchRequest{Events: [][]byte{[]byte(`{"type":"track","userId":"u1"}`)}})
+			Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+			Expect(stored).To(BeEmpty())
+		})
+
+		It("should acknowledge the batches of a stream once it is closed", func() {
+			stream, err := client.BatchStream(withWriteKey(WriteKeyEnabled))
+			Expect(err).To(BeNil())
+			Expect(stream.Send(&proto.BatchRequest{AnonymousId: "a1", Events: [][]byte{[]byte(`{"type":"track","anonymousId":"a1","messageId":"m0"}`)}})).To(BeNil())
+			Expect(stream.Send(&proto.BatchRequest{AnonymousId: "a1", Events: [][]byte{[]byte(`{"type":"track","anonymousId":"a1","messageId":"m1"}`), []byte(`{"type":"track"}`)}})).To(BeNil())
+			resp, err := stream.CloseAndRecv()
+			Expect(err).To(BeNil())
+
+			Expect(resp.GetResponses()).To(HaveLen(2))
+			Expect(resp.GetResponses()[0].GetAcks()[0].GetAccepted()).To(BeTrue())
+			Expect(resp.GetResponses()[1].GetAcks()[0].GetAccepted()).To(BeTrue())
+			Expect(resp.GetResponses()[1].GetAcks()[1].GetReason()).To(Equal(RejectedNotIdentifiable))
+			Expect(stored).To(HaveLen(2))
 		})
 	})
 
@@ -512,9 +1339,9 @@ func authorizedRequest(username string, body io.Reader) *http.Request {
 	return req
 }
 
-func expectHandlerResponse(handler http.HandlerFunc, req *http.Request, responseStatus int, responseBody string) {
+func expectHandlerResponse(handler http.HandlerFunc, req *http.Request, responseStatus int, responseBody string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
 	testutils.RunTestWithTimeout(func() {
-		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
 		bodyBytes, _ := io.ReadAll(rr.Body)
@@ -523,6 +1350,7 @@ func expectHandlerResponse(handler http.HandlerFunc, req *http.Request, response
 		Expect(rr.Result().StatusCode).To(Equal(responseStatus))
 		Expect(body).To(Equal(responseBody))
 	}, testTimeout)
+	return rr
 }
 
 type RequestExpectation struct {
@@ -570,3 +1398,38 @@ func allHandlers(gateway *HandleT) map[string]http.HandlerFunc {
 func jobsToEmptyErrors(jobs []*jobsdb.JobT) map[uuid.UUID]string {
 	return make(map[uuid.UUID]string)
 }
+
+// fakeKafkaSessionT records the offsets of the messages marked during a consumer group session
+type fakeKafkaSessionT struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	marked  []int64
+	commits int
+}
+
+func (*fakeKafkaSessionT) Claims() map[string][]int32               { return nil }
+func (*fakeKafkaSessionT) MemberID() string                         { return "" }
+func (*fakeKafkaSessionT) GenerationID() int32                      { return 0 }
+func (*fakeKafkaSessionT) MarkOffset(string, int32, int64, string)  {}
+func (*fakeKafkaSessionT) ResetOffset(string, int32, int64, string) {}
+func (s *fakeKafkaSessionT) Context() context.Context               { return s.ctx }
+func (s *fakeKafkaSessionT) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+func (s *fakeKafkaSessionT) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits++
+}
+
+type fakeKafkaClaimT struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (*fakeKafkaClaimT) Topic() string                              { return "" }
+func (*fakeKafkaClaimT) Partition() int32                           { return 0 }
+func (*fakeKafkaClaimT) InitialOffset() int64                       { return 0 }
+func (*fakeKafkaClaimT) HighWaterMarkOffset() int64                 { return 0 }
+func (c *fakeKafkaClaimT) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
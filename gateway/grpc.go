@@ -0,0 +1,251 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	proto "github.com/rudderlabs/rudder-server/proto/gateway"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
+)
+
+// grpcServerT ingests batches of events sent through gRPC. They go through the same user web request workers as /v1/batch requests,
+// with partial acceptance, so that every event is acknowledged individually.
+type grpcServerT struct {
+	proto.UnimplementedGatewayServer
+	gateway *HandleT
+}
+
+// grpcBatchT is a batch of a gRPC call queued to the user web request workers
+type grpcBatchT struct {
+	acks           []*proto.EventAck
+	indexes        []int // index in the request of each queued event
+	done           chan string
+	rejectedEvents []RejectedEventT
+}
+
+func (gateway *HandleT) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.MaxRecvMsgSize(maxReqSize))
+	proto.RegisterGatewayServer(srv, &grpcServerT{gateway: gateway})
+	return srv
+}
+
+// startGRPCServer serves the gateway gRPC service until ctx is cancelled
+func (gateway *HandleT) startGRPCServer(ctx context.Context) error {
+	gateway.logger.Infof("Starting gRPC server in %d", grpcPort)
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(grpcPort))
+	if err != nil {
+		return err
+	}
+	srv := gateway.newGRPCServer()
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		<-ctx.Done()
+		srv.GracefulStop()
+		return nil
+	})
+	g.Go(func() error {
+		return srv.Serve(listener)
+	})
+	return g.Wait()
+}
+
+func (s *grpcServerT) Batch(ctx context.Context, req *proto.BatchRequest) (*proto.BatchResponse, error) {
+	start := time.Now()
+	defer s.gateway.stats.NewTaggedStat("gateway.web_req_handler_time", stats.TimerType, stats.Tags{"reqType": "grpc_batch"}).Since(start)
+	atomic.AddUint64(&s.gateway.recvCount, 1)
+
+	writeKey, err := grpcWriteKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(grpcTraceContext(ctx), "gateway.store", attribute.String("reqType", "grpc_batch"))
+	batch := s.enqueue(ctx, writeKey, req)
+	resp, errorMessage := batch.wait()
+	tracing.End(span, errorMessage)
+	atomic.AddUint64(&s.gateway.ackCount, 1)
+	s.gateway.trackRequestMetrics(errorMessage)
+	if errorMessage != "" {
+		return nil, status.Error(grpcErrorCode(errorMessage), errorMessage)
+	}
+	return resp, nil
+}
+
+func (s *grpcServerT) BatchStream(stream proto.Gateway_BatchStreamServer) error {
+	start := time.Now()
+	defer s.gateway.stats.NewTaggedStat("gateway.web_req_handler_time", stats.TimerType, stats.Tags{"reqType": "grpc_batch_stream"}).Since(start)
+	atomic.AddUint64(&s.gateway.recvCount, 1)
+
+	writeKey, err := grpcWriteKey(stream.Context())
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(grpcTraceContext(stream.Context()), "gateway.store", attribute.String("reqType", "grpc_batch_stream"))
+	var batches []*grpcBatchT
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// batches already queued are stored anyway, the client cannot be acknowledged
+			for _, batch := range batches {
+				batch.wait()
+			}
+			tracing.End(span, err.Error())
+			return err
+		}
+		batches = append(batches, s.enqueue(ctx, writeKey, req))
+	}
+
+	var errorMessages []string
+	resp := &proto.BatchStreamResponse{}
+	for _, batch := range batches {
+		batchResp, errorMessage := batch.wait()
+		batchResp.Error = errorMessage
+		resp.Responses = append(resp.Responses, batchResp)
+		errorMessages = append(errorMessages, errorMessage)
+	}
+	errorMessage := strings.Join(errorMessages, "")
+	tracing.End(span, errorMessage)
+	atomic.AddUint64(&s.gateway.ackCount, 1)
+	s.gateway.trackRequestMetrics(errorMessage)
+	return stream.SendAndClose(resp)
+}
+
+// enqueue queues the valid events of the request as a batch request, events which are not JSON objects are rejected right away
+func (s *grpcServerT) enqueue(ctx context.Context, writeKey string, req *proto.BatchRequest) *grpcBatchT {
+	batch := &grpcBatchT{
+		acks: make([]*proto.EventAck, len(req.Events)),
+		done: make(chan string, 1),
+	}
+	events := &bulkUserEventsT{}
+	for idx, event := range req.Events {
+		ack := &proto.EventAck{Index: int32(idx), Accepted: true}
+		batch.acks[idx] = ack
+		if !gjson.ValidBytes(event) || !gjson.ParseBytes(event).IsObject() {
+			ack.Accepted, ack.Reason = false, RejectedInvalidJSON
+			continue
+		}
+		// assign messageIds here rather than in the worker, so that they are acknowledged
+		ack.MessageId = strings.TrimSpace(gjson.GetBytes(event, "messageId").String())
+		if ack.MessageId == "" {
+			ack.MessageId = uuid.Must(uuid.NewV4()).String()
+			event, _ = sjson.SetBytes(event, "messageId", ack.MessageId)
+		}
+		events.add(event)
+		batch.indexes = append(batch.indexes, idx)
+	}
+	if len(batch.indexes) == 0 {
+		batch.done <- ""
+		return batch
+	}
+
+	userKey := req.AnonymousId
+	if userKey == "" {
+		userKey = uuid.Must(uuid.NewV4()).String()
+	}
+	webReq := webRequestT{
+		done:           batch.done,
+		reqType:        "batch",
+		requestPayload: events.payload(),
+		writeKey:       writeKey,
+		ipAddr:         grpcIPAddr(ctx),
+		traceParent:    tracing.TraceParent(ctx),
+		rejectedEvents: &batch.rejectedEvents,
+	}
+	s.gateway.findUserWebRequestWorker(userKey).webRequestQ <- &webReq
+	return batch
+}
+
+// wait returns the acknowledgements of the batch once it is stored, or the error which failed the whole batch
+func (batch *grpcBatchT) wait() (*proto.BatchResponse, string) {
+	errorMessage := <-batch.done
+	if errorMessage == response.GetStatus(response.DuplicateRequest) {
+		errorMessage = ""
+	}
+	for _, rejected := range batch.rejectedEvents {
+		ack := batch.acks[batch.indexes[rejected.Index]]
+		ack.Accepted, ack.Reason = false, rejected.Reason
+	}
+	if errorMessage != "" {
+		for _, idx := range batch.indexes {
+			if ack := batch.acks[idx]; ack.Accepted {
+				ack.Accepted, ack.Reason = false, errorMessage
+			}
+		}
+	}
+	return &proto.BatchResponse{Acks: batch.acks}, errorMessage
+}
+
+// grpcWriteKey reads the write key from the writekey metadata, or from the username of a basic authorization metadata
+func grpcWriteKey(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("writekey"); len(values) > 0 && values[0] != "" {
+		return values[0], nil
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		const prefix = "basic "
+		if len(values[0]) > len(prefix) && strings.EqualFold(values[0][:len(prefix)], prefix) {
+			if decoded, err := base64.StdEncoding.DecodeString(values[0][len(prefix):]); err == nil {
+				if writeKey := strings.SplitN(string(decoded), ":", 2)[0]; writeKey != "" {
+					return writeKey, nil
+				}
+			}
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, response.GetStatus(response.NoWriteKeyInBasicAuth))
+}
+
+func grpcTraceContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := http.Header{}
+	if values := md.Get(tracing.TraceParentHeader); len(values) > 0 {
+		header.Set(tracing.TraceParentHeader, values[0])
+	}
+	return tracing.Extract(ctx, header)
+}
+
+func grpcIPAddr(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-forwarded-for"); len(values) > 0 && values[0] != "" {
+		return strings.TrimSpace(strings.Split(values[0], ",")[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+	}
+	return ""
+}
+
+func grpcErrorCode(errorMessage string) codes.Code {
+	switch {
+	case strings.Contains(errorMessage, response.GetStatus(response.TooManyRequests)):
+		return codes.ResourceExhausted
+	case errorMessage == response.GetStatus(response.InvalidWriteKey):
+		return codes.Unauthenticated
+	case errorMessage == response.GetStatus(response.InvalidJSON), errorMessage == response.GetStatus(response.RequestBodyTooLarge):
+		return codes.InvalidArgument
+	}
+	return codes.Unavailable
+}
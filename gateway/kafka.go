@@ -0,0 +1,257 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/tidwall/gjson"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/streammanager/kafka"
+	"github.com/rudderlabs/rudder-server/services/tracing"
+)
+
+const (
+	// kafkaWriteKeyHeader overrides the write key of the topic of a message
+	kafkaWriteKeyHeader = "writeKey"
+
+	kafkaMessageStored   = "stored"
+	kafkaMessageRejected = "rejected"
+	kafkaMessageRetried  = "retried"
+)
+
+// kafkaSourceT consumes events from Kafka topics and stores them through the user web request workers, as /v1/batch requests.
+// Each message holds either a single event or a batch payload. Offsets of messages are committed only once they are stored,
+// or rejected for good, e.g. because they are not valid JSON, so that delivery is at-least-once.
+type kafkaSourceT struct {
+	gateway   *HandleT
+	writeKeys map[string]string // write key of the events of each topic
+}
+
+// kafkaMessageT is a message queued to the user web request workers
+type kafkaMessageT struct {
+	message *sarama.ConsumerMessage
+	done    chan string
+}
+
+// parseKafkaTopics parses topic:writeKey entries into the write key of each topic
+func parseKafkaTopics(entries []string) (map[string]string, error) {
+	writeKeys := make(map[string]string)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid topic %q, expected topic:writeKey", entry)
+		}
+		writeKeys[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return writeKeys, nil
+}
+
+// startKafkaSource consumes the configured topics until ctx is cancelled
+func (gateway *HandleT) startKafkaSource(ctx context.Context) error {
+	writeKeys, err := parseKafkaTopics(kafkaSourceTopics)
+	if err != nil {
+		return fmt.Errorf("kafka source: %w", err)
+	}
+	if len(writeKeys) == 0 {
+		gateway.logger.Warn("Kafka source is enabled without topics")
+		return nil
+	}
+	topics := make([]string, 0, len(writeKeys))
+	for topic := range writeKeys {
+		topics = append(topics, topic)
+	}
+
+	group, err := kafka.NewConsumerGroup(kafkaSourceConfig, kafkaSourceGroupID)
+	if err != nil {
+		return fmt.Errorf("kafka source: %w", err)
+	}
+	defer group.Close()
+	go func() {
+		for err := range group.Errors() {
+			gateway.logger.Errorf("Kafka source: %v", err)
+		}
+	}()
+
+	gateway.logger.Infof("Starting Kafka source, consuming topics %v", topics)
+	source := &kafkaSourceT{gateway: gateway, writeKeys: writeKeys}
+	for {
+		// Consume returns whenever the group rebalances, it is called again to join the new generation
+		if err := group.Consume(ctx, topics, source); err != nil {
+			gateway.logger.Errorf("Kafka source: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(kafkaSourceRetryBackoff):
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (*kafkaSourceT) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (*kafkaSourceT) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	return nil
+}
+
+// ConsumeClaim queues up to kafkaSourceMaxInFlight messages of a partition to the workers, and marks them in order once processed.
+// A message failing to be stored, e.g. because of rate limits, is retried until stored or until the session ends,
+// so that offsets of later messages are not committed before it.
+func (s *kafkaSourceT) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	inFlight := make(chan *kafkaMessageT, kafkaSourceMaxInFlight)
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		s.markProcessed(session, inFlight)
+	}()
+
+	defer func() {
+		close(inFlight)
+		<-committed
+	}()
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			select {
+			case inFlight <- s.enqueue(message):
+			case <-session.Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+// markProcessed marks messages in the order they are queued once processed, committing offsets once no more messages are in flight,
+// or at least every kafkaSourceCommitInterval.
+// It stops at the first message which is not processed when the session ends, so that no later message is marked before it.
+func (s *kafkaSourceT) markProcessed(session sarama.ConsumerGroupSession, inFlight <-chan *kafkaMessageT) {
+	lastCommit := time.Now()
+	for msg := range inFlight {
+		if !s.wait(session.Context(), msg) {
+			// the session ended before the message was stored, it is consumed again by the next owner of the partition
+			break
+		}
+		session.MarkMessage(msg.message, "")
+		if len(inFlight) == 0 || time.Since(lastCommit) > kafkaSourceCommitInterval {
+			session.Commit()
+			lastCommit = time.Now()
+		}
+	}
+	session.Commit()
+}
+
+// wait returns true once the message is stored or rejected for good, retrying it if it fails to be stored
+func (s *kafkaSourceT) wait(ctx context.Context, msg *kafkaMessageT) bool {
+	for {
+		var errorMessage string
+		select {
+		case errorMessage = <-msg.done:
+		case <-ctx.Done():
+			return false
+		}
+		if errorMessage == response.GetStatus(response.DuplicateRequest) {
+			errorMessage = ""
+		}
+		if errorMessage == "" {
+			s.countMessage(msg.message.Topic, kafkaMessageStored)
+			return true
+		}
+		if !isRetryableError(errorMessage) {
+			s.gateway.logger.Errorf("Kafka source: message of topic %s, partition %d, offset %d rejected: %s", msg.message.Topic, msg.message.Partition, msg.message.Offset, errorMessage)
+			s.countMessage(msg.message.Topic, kafkaMessageRejected)
+			return true
+		}
+		s.countMessage(msg.message.Topic, kafkaMessageRetried)
+		s.gateway.logger.Debugf("Kafka source: retrying message of topic %s, partition %d, offset %d: %s", msg.message.Topic, msg.message.Partition, msg.message.Offset, errorMessage)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(kafkaSourceRetryBackoff):
+		}
+		msg = s.enqueue(msg.message)
+	}
+}
+
+// enqueue queues a message to the worker of its key, or of its partition for messages without key, to preserve their order
+func (s *kafkaSourceT) enqueue(message *sarama.ConsumerMessage) *kafkaMessageT {
+	msg := &kafkaMessageT{message: message, done: make(chan string, 1)}
+	writeKey := s.writeKeys[message.Topic]
+	var traceParent string
+	for _, header := range message.Headers {
+		switch string(header.Key) {
+		case kafkaWriteKeyHeader:
+			writeKey = string(header.Value)
+		case tracing.TraceParentHeader:
+			traceParent = string(header.Value)
+		}
+	}
+	if writeKey == "" {
+		msg.done <- response.GetStatus(response.NoWriteKeyInBasicAuth)
+		return msg
+	}
+	payload, ok := kafkaBatchPayload(message.Value)
+	if !ok {
+		msg.done <- response.GetStatus(response.InvalidJSON)
+		return msg
+	}
+
+	userKey := string(message.Key)
+	if userKey == "" {
+		userKey = message.Topic + ":" + strconv.Itoa(int(message.Partition))
+	}
+	webReq := webRequestT{
+		done:           msg.done,
+		reqType:        "batch",
+		requestPayload: payload,
+		writeKey:       writeKey,
+		traceParent:    traceParent,
+	}
+	s.gateway.findUserWebRequestWorker(userKey).webRequestQ <- &webReq
+	return msg
+}
+
+func (s *kafkaSourceT) countMessage(topic, status string) {
+	s.gateway.stats.NewTaggedStat("gateway.kafka_source_messages", stats.CountType, stats.Tags{"topic": topic, "status": status}).Increment()
+}
+
+// kafkaBatchPayload returns the batch payload of a message, holding either a batch payload or a single event
+func kafkaBatchPayload(value []byte) ([]byte, bool) {
+	if !gjson.ValidBytes(value) {
+		return nil, false
+	}
+	parsed := gjson.ParseBytes(value)
+	if !parsed.IsObject() {
+		return nil, false
+	}
+	if parsed.Get("batch").IsArray() {
+		return value, true
+	}
+	events := &bulkUserEventsT{}
+	events.add(value)
+	return events.payload(), true
+}
+
+// isRetryableError is true for errors which are not caused by the request itself, e.g. rate limits or failures to store it
+func isRetryableError(errorMessage string) bool {
+	if strings.Contains(errorMessage, response.GetStatus(response.TooManyRequests)) ||
+		strings.Contains(errorMessage, response.GetStatus(response.StoreUnavailable)) {
+		return true
+	}
+	return response.GetStatusCode(errorMessage) == http.StatusOK
+}
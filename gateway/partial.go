@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
+)
+
+// Reasons of events rejected by batch requests with partial acceptance
+const (
+	RejectedInvalidJSON     = "invalid_json"
+	RejectedNotIdentifiable = "not_identifiable"
+	RejectedSuppressed      = "suppressed"
+	RejectedOversize        = "oversize"
+)
+
+// RejectedEventT is an event of a batch request which was not stored
+type RejectedEventT struct {
+	Index     int    `json:"index"`
+	MessageID string `json:"messageId,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// PartialBatchResponseT is the response to batch requests with partial acceptance.
+// Accepted is the number of events stored, Duplicates the number of events dropped as already received.
+type PartialBatchResponseT struct {
+	Accepted   int              `json:"accepted"`
+	Duplicates int              `json:"duplicates"`
+	Rejected   []RejectedEventT `json:"rejected"`
+}
+
+// webPartialBatchHandler stores the valid events of a batch request and responds with the events which were rejected.
+// Failures of the whole request, e.g. an invalid write key, are responded as by webRequestHandler.
+// The response is 400 if every event is rejected, 200 otherwise, duplicate events being acknowledged.
+func (gateway *HandleT) webPartialBatchHandler(w http.ResponseWriter, r *http.Request) {
+	reqType := "batch"
+	webReqHandlerTime := gateway.stats.NewTaggedStat("gateway.web_req_handler_time", stats.TimerType, stats.Tags{"reqType": reqType})
+	webReqHandlerStartTime := time.Now()
+	defer webReqHandlerTime.Since(webReqHandlerStartTime)
+
+	gateway.logger.LogRequest(r)
+	atomic.AddUint64(&gateway.recvCount, 1)
+	var errorMessage string
+	defer func() {
+		gateway.writeErrorResponse(w, r, errorMessage)
+	}()
+	payload, writeKey, err := gateway.getPayloadAndWriteKey(w, r, reqType)
+	if err != nil {
+		errorMessage = err.Error()
+		return
+	}
+
+	rejectedEvents := []RejectedEventT{}
+	done := make(chan string, 1)
+	start := time.Now()
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "gateway.store", attribute.String("reqType", reqType))
+	outcome := &webRequestOutcomeT{}
+	gateway.addToUserWebRequestQ(webRequestUserKey(r), outcome, r.WithContext(ctx), done, reqType, payload, writeKey, &rejectedEvents)
+	gateway.addToWebRequestQWaitTime.SendTiming(time.Since(start))
+	errorMessage = <-done
+	setRateLimitHeaders(w, outcome)
+	gateway.ProcessRequestTime.Since(start)
+	tracing.End(span, errorMessage)
+	atomic.AddUint64(&gateway.ackCount, 1)
+	if errorMessage == response.GetStatus(response.DuplicateRequest) {
+		errorMessage = ""
+	}
+	gateway.trackRequestMetrics(errorMessage)
+	if errorMessage != "" {
+		return
+	}
+
+	resp := PartialBatchResponseT{
+		Accepted:   outcome.storedEvents,
+		Duplicates: outcome.duplicateEvents,
+		Rejected:   rejectedEvents,
+	}
+	status := http.StatusOK
+	if resp.Accepted == 0 && resp.Duplicates == 0 && len(resp.Rejected) > 0 {
+		status = http.StatusBadRequest
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		errorMessage = response.GetStatus(response.ErrorInMarshal)
+		return
+	}
+	gateway.logger.Debugf("Response: %d, %d events accepted, %d duplicates, %d rejected", status, resp.Accepted, resp.Duplicates, len(resp.Rejected))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// updateRejectedEventStats updates gateway.write_key_failed_events with the events rejected by batch requests with partial acceptance,
+// tagged by reason. rejectedEventStats is keyed by the source tag and the reason, separated by DELIMITER
+func (gateway *HandleT) updateRejectedEventStats(rejectedEventStats map[string]int, sourceTagMap map[string]string) {
+	for key, count := range rejectedEventStats {
+		sourceTag, reason := key, ""
+		if idx := strings.LastIndex(key, DELIMITER); idx >= 0 {
+			sourceTag, reason = key[:idx], key[idx+len(DELIMITER):]
+		}
+		tags := map[string]string{
+			"source":      sourceTag,
+			"writeKey":    sourceTagMap[sourceTag],
+			"reqType":     sourceTagMap["reqType"],
+			"workspaceId": sourceTagMap["workspaceId"],
+			"reason":      reason,
+		}
+		gateway.stats.NewTaggedStat("gateway.write_key_failed_events", stats.CountType, tags).Count(count)
+	}
+}
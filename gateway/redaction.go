@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/gateway/redaction"
+)
+
+// loadRedactionOverrides reads redactionOverridesFile, if set
+func loadRedactionOverrides() redaction.OverridesT {
+	if redactionOverridesFile == "" {
+		return redaction.OverridesT{}
+	}
+	overrides, err := redaction.LoadOverrides(redactionOverridesFile)
+	if err != nil {
+		pkgLogger.Errorf("Failed to load redaction overrides, using the rules of backend config: %v", err)
+	}
+	return overrides
+}
+
+// newSourceRedactor returns the redactor of a source, nil if it has no rules.
+// Rules of the overrides file replace the ones in the config of the source, invalid rules being skipped.
+func newSourceRedactor(source backendconfig.SourceT, overrides redaction.OverridesT) *redaction.RedactorT {
+	rules, overridden := overrides.Sources[source.ID]
+	if !overridden {
+		var err error
+		rules, err = redaction.RulesFromSourceConfig(source.Config)
+		if err != nil {
+			pkgLogger.Errorf("Failed to read redaction rules of source %s: %v", source.ID, err)
+		}
+	}
+	validRules := make([]redaction.RuleT, 0, len(rules))
+	for idx, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			pkgLogger.Errorf("Skipping redaction rule %d of source %s: %v", idx, source.ID, err)
+			continue
+		}
+		validRules = append(validRules, rule)
+	}
+	if len(validRules) == 0 {
+		return nil
+	}
+	salt, ok := overrides.Salts[source.WorkspaceID]
+	if !ok {
+		salt = redactionSalt
+	}
+	redactor, err := redaction.New(validRules, salt)
+	if err != nil {
+		pkgLogger.Errorf("Failed to create redactor of source %s: %v", source.ID, err)
+		return nil
+	}
+	return redactor
+}
+
+// redactedID returns an id of a redacted event, as it would be read from its payload
+func redactedID(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,251 @@
+// Package redaction removes personal data from events, according to rules matching either the paths of values in events
+// or the names of their keys. Values matched by a rule are dropped, masked, or replaced with their salted SHA-256 hash.
+package redaction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Actions of the rules
+const (
+	// ActionDrop removes the key of the value
+	ActionDrop = "drop"
+	// ActionMask replaces the value with MaskValue
+	ActionMask = "mask"
+	// ActionHash replaces the value with the hex encoded SHA-256 hash of the salt followed by the value
+	ActionHash = "hash"
+)
+
+// MaskValue replaces the values masked by rules
+const MaskValue = "****"
+
+// SourceConfigKey is the key of the rules in the config of sources
+const SourceConfigKey = "redactionRules"
+
+// RuleT redacts the values either at Path or of keys whose name matches KeyPattern
+type RuleT struct {
+	// Path of the values in an event, keys separated by dots, e.g. context.traits.email.
+	// A * matches any key of an object or any element of an array.
+	Path string `json:"path,omitempty"`
+	// KeyPattern is a regular expression matched against the name of keys at any depth, e.g. (?i)^(email|phone)$
+	KeyPattern string `json:"keyPattern,omitempty"`
+	// Action is one of drop, mask or hash
+	Action string `json:"action"`
+}
+
+type compiledRuleT struct {
+	path       []string
+	keyPattern *regexp.Regexp
+	action     string
+}
+
+// RedactorT applies the rules of a source to its events
+type RedactorT struct {
+	rules []compiledRuleT
+	salt  string
+}
+
+// New compiles rules, the salt being used by hash actions
+func New(rules []RuleT, salt string) (*RedactorT, error) {
+	redactor := &RedactorT{salt: salt}
+	for idx, rule := range rules {
+		compiled, err := rule.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", idx, err)
+		}
+		redactor.rules = append(redactor.rules, compiled)
+	}
+	return redactor, nil
+}
+
+// Validate returns an error if the rule is invalid
+func (rule RuleT) Validate() error {
+	_, err := rule.compile()
+	return err
+}
+
+func (rule RuleT) compile() (compiledRuleT, error) {
+	switch rule.Action {
+	case ActionDrop, ActionMask, ActionHash:
+	default:
+		return compiledRuleT{}, fmt.Errorf("invalid action %q", rule.Action)
+	}
+	compiled := compiledRuleT{action: rule.Action}
+	switch {
+	case rule.Path != "" && rule.KeyPattern != "":
+		return compiledRuleT{}, fmt.Errorf("either path or keyPattern must be set, not both")
+	case rule.Path != "":
+		compiled.path = strings.Split(rule.Path, ".")
+		for _, key := range compiled.path {
+			if key == "" {
+				return compiledRuleT{}, fmt.Errorf("invalid path %q", rule.Path)
+			}
+		}
+	case rule.KeyPattern != "":
+		keyPattern, err := regexp.Compile(rule.KeyPattern)
+		if err != nil {
+			return compiledRuleT{}, fmt.Errorf("invalid keyPattern: %w", err)
+		}
+		compiled.keyPattern = keyPattern
+	default:
+		return compiledRuleT{}, fmt.Errorf("either path or keyPattern must be set")
+	}
+	return compiled, nil
+}
+
+// Apply redacts event in place
+func (r *RedactorT) Apply(event map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	for _, rule := range r.rules {
+		if rule.keyPattern != nil {
+			r.applyKeyPattern(event, rule)
+		} else {
+			r.applyPath(event, rule.path, rule.action)
+		}
+	}
+}
+
+func (r *RedactorT) applyPath(value interface{}, path []string, action string) {
+	key, last := path[0], len(path) == 1
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if key == "*" {
+			for k, child := range v {
+				if last {
+					r.redactKey(v, k, action)
+				} else {
+					r.applyPath(child, path[1:], action)
+				}
+			}
+			return
+		}
+		child, ok := v[key]
+		if !ok {
+			return
+		}
+		if last {
+			r.redactKey(v, key, action)
+		} else {
+			r.applyPath(child, path[1:], action)
+		}
+	case []interface{}:
+		indexes := make([]int, 0, len(v))
+		if key == "*" {
+			for idx := range v {
+				indexes = append(indexes, idx)
+			}
+		} else if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(v) {
+			indexes = append(indexes, idx)
+		}
+		if last && action == ActionDrop {
+			// dropped elements are set to null, so that indexes of other elements are kept
+			for _, idx := range indexes {
+				v[idx] = nil
+			}
+			return
+		}
+		for _, idx := range indexes {
+			if last {
+				v[idx] = r.redactValue(v[idx], action)
+			} else {
+				r.applyPath(v[idx], path[1:], action)
+			}
+		}
+	}
+}
+
+func (r *RedactorT) applyKeyPattern(value interface{}, rule compiledRuleT) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if rule.keyPattern.MatchString(key) {
+				r.redactKey(v, key, rule.action)
+				continue
+			}
+			r.applyKeyPattern(child, rule)
+		}
+	case []interface{}:
+		for _, child := range v {
+			r.applyKeyPattern(child, rule)
+		}
+	}
+}
+
+func (r *RedactorT) redactKey(m map[string]interface{}, key, action string) {
+	if action == ActionDrop {
+		delete(m, key)
+		return
+	}
+	m[key] = r.redactValue(m[key], action)
+}
+
+func (r *RedactorT) redactValue(value interface{}, action string) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch action {
+	case ActionMask:
+		return MaskValue
+	case ActionHash:
+		return r.hash(value)
+	}
+	return nil
+}
+
+// hash returns the salted hash of strings, or of the JSON encoding of other values
+func (r *RedactorT) hash(value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		encoded, _ := json.Marshal(value)
+		text = string(encoded)
+	}
+	sum := sha256.Sum256([]byte(r.salt + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// RulesFromSourceConfig returns the rules set in the config of a source, if any
+func RulesFromSourceConfig(sourceConfig map[string]interface{}) ([]RuleT, error) {
+	value, ok := sourceConfig[SourceConfigKey]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RuleT
+	if err := json.Unmarshal(encoded, &rules); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SourceConfigKey, err)
+	}
+	return rules, nil
+}
+
+// OverridesT are the rules and salts of a local override file, taking precedence over the ones of backend config
+type OverridesT struct {
+	// Sources are the rules of sources by source id, replacing the ones of their config
+	Sources map[string][]RuleT `json:"sources"`
+	// Salts are the salts of hash actions by workspace id
+	Salts map[string]string `json:"salts"`
+}
+
+// LoadOverrides reads the overrides of a JSON file
+func LoadOverrides(path string) (OverridesT, error) {
+	var overrides OverridesT
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return overrides, err
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("invalid redaction overrides in %s: %w", path, err)
+	}
+	return overrides, nil
+}
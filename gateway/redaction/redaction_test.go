@@ -0,0 +1,149 @@
+package redaction_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/gateway/redaction"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_Apply(t *testing.T) {
+	event := `{
+		"userId": "user-1",
+		"context": {"traits": {"email": "user@example.com", "phone": "+301234567890", "plan": "pro"}, "ip": "10.1.2.3"},
+		"properties": {"items": [{"sku": "a", "email": "a@example.com"}, {"sku": "b"}], "age": 42}
+	}`
+	tests := []struct {
+		name     string
+		rules    []redaction.RuleT
+		expected string
+	}{
+		{
+			name:     "no rules",
+			expected: event,
+		},
+		{
+			name:     "drop path",
+			rules:    []redaction.RuleT{{Path: "context.traits.email", Action: redaction.ActionDrop}},
+			expected: `{"userId":"user-1","context":{"traits":{"phone":"+301234567890","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"a@example.com"},{"sku":"b"}],"age":42}}`,
+		},
+		{
+			name:     "mask path",
+			rules:    []redaction.RuleT{{Path: "context.ip", Action: redaction.ActionMask}},
+			expected: `{"userId":"user-1","context":{"traits":{"email":"user@example.com","phone":"+301234567890","plan":"pro"},"ip":"****"},"properties":{"items":[{"sku":"a","email":"a@example.com"},{"sku":"b"}],"age":42}}`,
+		},
+		{
+			name:     "hash path with salt",
+			rules:    []redaction.RuleT{{Path: "userId", Action: redaction.ActionHash}},
+			expected: `{"userId":"` + sha256Hex("salt"+"user-1") + `","context":{"traits":{"email":"user@example.com","phone":"+301234567890","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"a@example.com"},{"sku":"b"}],"age":42}}`,
+		},
+		{
+			name:     "hash non string values",
+			rules:    []redaction.RuleT{{Path: "properties.age", Action: redaction.ActionHash}},
+			expected: `{"userId":"user-1","context":{"traits":{"email":"user@example.com","phone":"+301234567890","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"a@example.com"},{"sku":"b"}],"age":"` + sha256Hex("salt"+"42") + `"}}`,
+		},
+		{
+			name:     "wildcards in path",
+			rules:    []redaction.RuleT{{Path: "properties.items.*.email", Action: redaction.ActionMask}, {Path: "context.traits.*", Action: redaction.ActionDrop}},
+			expected: `{"userId":"user-1","context":{"traits":{},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"****"},{"sku":"b"}],"age":42}}`,
+		},
+		{
+			name:     "array index in path",
+			rules:    []redaction.RuleT{{Path: "properties.items.1", Action: redaction.ActionDrop}},
+			expected: `{"userId":"user-1","context":{"traits":{"email":"user@example.com","phone":"+301234567890","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"a@example.com"},null],"age":42}}`,
+		},
+		{
+			name:     "missing path",
+			rules:    []redaction.RuleT{{Path: "context.device.id", Action: redaction.ActionDrop}, {Path: "userId.nested", Action: redaction.ActionDrop}},
+			expected: event,
+		},
+		{
+			name:     "key pattern at any depth",
+			rules:    []redaction.RuleT{{KeyPattern: "(?i)^(email|phone)$", Action: redaction.ActionHash}},
+			expected: `{"userId":"user-1","context":{"traits":{"email":"` + sha256Hex("salt"+"user@example.com") + `","phone":"` + sha256Hex("salt"+"+301234567890") + `","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"` + sha256Hex("salt"+"a@example.com") + `"},{"sku":"b"}],"age":42}}`,
+		},
+		{
+			name:     "rules applied in order",
+			rules:    []redaction.RuleT{{KeyPattern: "^email$", Action: redaction.ActionMask}, {Path: "context.traits.email", Action: redaction.ActionDrop}},
+			expected: `{"userId":"user-1","context":{"traits":{"phone":"+301234567890","plan":"pro"},"ip":"10.1.2.3"},"properties":{"items":[{"sku":"a","email":"****"},{"sku":"b"}],"age":42}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := redaction.New(tt.rules, "salt")
+			require.NoError(t, err)
+			var value map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(event), &value))
+
+			redactor.Apply(value)
+
+			redacted, err := json.Marshal(value)
+			require.NoError(t, err)
+			require.JSONEq(t, tt.expected, string(redacted))
+		})
+	}
+}
+
+func Test_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule redaction.RuleT
+	}{
+		{name: "invalid action", rule: redaction.RuleT{Path: "userId", Action: "encrypt"}},
+		{name: "without path or pattern", rule: redaction.RuleT{Action: redaction.ActionDrop}},
+		{name: "with both path and pattern", rule: redaction.RuleT{Path: "userId", KeyPattern: "email", Action: redaction.ActionDrop}},
+		{name: "empty key in path", rule: redaction.RuleT{Path: "context..email", Action: redaction.ActionDrop}},
+		{name: "invalid pattern", rule: redaction.RuleT{KeyPattern: "(email", Action: redaction.ActionDrop}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := redaction.New([]redaction.RuleT{tt.rule}, "")
+			require.Error(t, err)
+			require.Error(t, tt.rule.Validate())
+		})
+	}
+}
+
+func Test_RulesFromSourceConfig(t *testing.T) {
+	rules, err := redaction.RulesFromSourceConfig(map[string]interface{}{
+		redaction.SourceConfigKey: []interface{}{
+			map[string]interface{}{"path": "context.traits.email", "action": "hash"},
+			map[string]interface{}{"keyPattern": "phone", "action": "drop"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []redaction.RuleT{
+		{Path: "context.traits.email", Action: redaction.ActionHash},
+		{KeyPattern: "phone", Action: redaction.ActionDrop},
+	}, rules)
+
+	rules, err = redaction.RulesFromSourceConfig(map[string]interface{}{})
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	_, err = redaction.RulesFromSourceConfig(map[string]interface{}{redaction.SourceConfigKey: "drop everything"})
+	require.Error(t, err)
+}
+
+func Test_LoadOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"sources":{"source-1":[{"path":"userId","action":"mask"}]},"salts":{"workspace-1":"salt"}}`), 0o600))
+
+	overrides, err := redaction.LoadOverrides(path)
+	require.NoError(t, err)
+	require.Equal(t, redaction.OverridesT{
+		Sources: map[string][]redaction.RuleT{"source-1": {{Path: "userId", Action: redaction.ActionMask}}},
+		Salts:   map[string]string{"workspace-1": "salt"},
+	}, overrides)
+}
@@ -22,6 +22,8 @@ const (
 	RequestBodyReadFailed = "Failed to read body from request"
 	//RequestBodyTooLarge - Request size exceeds max limit
 	RequestBodyTooLarge = "Request size exceeds max limit"
+	//UnsupportedContentEncoding - Content-Encoding of the request is neither gzip nor zstd
+	UnsupportedContentEncoding = "Unsupported content encoding"
 	//InvalidWriteKey - Invalid Write Key
 	InvalidWriteKey = "Invalid Write Key"
 	//InvalidJSON - Invalid JSON
@@ -48,6 +50,10 @@ const (
 	ErrorInParseForm = "Error during parsing form"
 	//ErrorInParseMultiform - Error during parsing multiform
 	ErrorInParseMultiform = "Error during parsing multiform"
+	//DuplicateRequest - All events in the request have already been received
+	DuplicateRequest = "OK: duplicate request"
+	//StoreUnavailable - Events cannot be stored until the jobs database recovers
+	StoreUnavailable = "Failed to store events, retry later"
 )
 
 var (
@@ -74,6 +80,7 @@ func loadStatusMap() {
 	statusMap[NoWriteKeyInQueryParams] = ResponseStatus{message: NoWriteKeyInQueryParams, code: http.StatusUnauthorized}
 	statusMap[RequestBodyReadFailed] = ResponseStatus{message: RequestBodyReadFailed, code: http.StatusBadRequest}
 	statusMap[RequestBodyTooLarge] = ResponseStatus{message: RequestBodyTooLarge, code: http.StatusRequestEntityTooLarge}
+	statusMap[UnsupportedContentEncoding] = ResponseStatus{message: UnsupportedContentEncoding, code: http.StatusUnsupportedMediaType}
 	statusMap[InvalidWriteKey] = ResponseStatus{message: InvalidWriteKey, code: http.StatusUnauthorized}
 	statusMap[InvalidJSON] = ResponseStatus{message: InvalidJSON, code: http.StatusBadRequest}
 	// webhook specific status
@@ -88,6 +95,8 @@ func loadStatusMap() {
 	statusMap[ErrorInMarshal] = ResponseStatus{message: ErrorInMarshal, code: http.StatusBadRequest}
 	statusMap[ErrorInParseForm] = ResponseStatus{message: ErrorInParseForm, code: http.StatusBadRequest}
 	statusMap[ErrorInParseMultiform] = ResponseStatus{message: ErrorInParseMultiform, code: http.StatusBadRequest}
+	statusMap[DuplicateRequest] = ResponseStatus{message: DuplicateRequest, code: http.StatusOK}
+	statusMap[StoreUnavailable] = ResponseStatus{message: StoreUnavailable, code: http.StatusServiceUnavailable}
 }
 
 func GetStatus(key string) string {
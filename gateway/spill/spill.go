@@ -0,0 +1,465 @@
+// Package spill implements an on-disk log of entries, written in segment files and consumed in order.
+// The gateway spills batches of jobs to it while the jobs database is unavailable, and drains them once it recovers.
+package spill
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fsync policies of the log
+const (
+	// FsyncAlways syncs segments on every append and checkpoint on every commit
+	FsyncAlways = "always"
+	// FsyncInterval syncs segments and checkpoint every FsyncInterval
+	FsyncInterval = "interval"
+	// FsyncNever leaves syncing to the operating system
+	FsyncNever = "never"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	checkpointFile = "checkpoint"
+	headerSize     = 8 // length and crc32 of an entry
+)
+
+// ErrFull is returned when appending an entry would exceed the maximum size of the log
+var ErrFull = errors.New("spill log is full")
+
+// OptsT configures a log
+type OptsT struct {
+	// MaxSize is the maximum size of the entries not consumed yet, 0 for unlimited
+	MaxSize int64
+	// SegmentSize is the size after which entries are appended to a new segment file
+	SegmentSize int64
+	// Fsync is the fsync policy, FsyncAlways by default
+	Fsync string
+	// FsyncInterval is the period of syncs of the FsyncInterval policy
+	FsyncInterval time.Duration
+}
+
+// StatsT describes the state of a log
+type StatsT struct {
+	Size      int64 // bytes of the entries not consumed yet
+	Entries   int64 // entries not consumed yet
+	Segments  int
+	Appended  int64 // entries appended since the log was opened
+	Committed int64 // entries consumed since the log was opened
+}
+
+// checkpointT is the position of the next entry to consume
+type checkpointT struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// LogT is an append-only log of entries, consumed in order by a single consumer with Peek and Commit.
+// The position of the consumer is checkpointed, so that entries not committed are consumed again once the log is reopened.
+type LogT struct {
+	dir  string
+	opts OptsT
+
+	mu           sync.Mutex
+	segments     []int64 // ids of the segment files, in order
+	writer       *os.File
+	writerSize   int64
+	reader       *os.File
+	read         checkpointT
+	peekedSize   int64 // size of the entry returned by the last Peek, if not committed yet
+	size         int64
+	entries      int64
+	appended     int64
+	committed    int64
+	dirty        bool // appended or committed since the last sync
+	closed       bool
+	stopSyncing  chan struct{}
+	syncingEnded chan struct{}
+	closeOnce    sync.Once
+}
+
+// Open opens the log in dir, creating it if needed. Entries which were partially written, e.g. because of a crash, are discarded.
+func Open(dir string, opts OptsT) (*LogT, error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncAlways
+	}
+	switch opts.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("invalid fsync policy %q", opts.Fsync)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spill directory: %w", err)
+	}
+	l := &LogT{dir: dir, opts: opts}
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+	if opts.Fsync == FsyncInterval && opts.FsyncInterval > 0 {
+		l.stopSyncing = make(chan struct{})
+		l.syncingEnded = make(chan struct{})
+		go l.syncPeriodically()
+	}
+	return l, nil
+}
+
+func (l *LogT) recover() error {
+	if data, err := os.ReadFile(filepath.Join(l.dir, checkpointFile)); err == nil {
+		if err := json.Unmarshal(data, &l.read); err != nil {
+			return fmt.Errorf("read spill checkpoint: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("read spill checkpoint: %w", err)
+	}
+
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("list spill segments: %w", err)
+	}
+	for _, file := range files {
+		id, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), segmentSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(file.Name(), segmentSuffix) {
+			continue
+		}
+		if id < l.read.Segment {
+			// consumed before the checkpoint was written, but not removed yet
+			if err := os.Remove(l.segmentPath(id)); err != nil {
+				return fmt.Errorf("remove consumed spill segment: %w", err)
+			}
+			continue
+		}
+		l.segments = append(l.segments, id)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	if len(l.segments) == 0 || l.segments[0] != l.read.Segment {
+		l.read.Offset = 0
+		if len(l.segments) > 0 {
+			l.read.Segment = l.segments[0]
+		}
+	}
+	for _, id := range l.segments {
+		offset := int64(0)
+		if id == l.read.Segment {
+			offset = l.read.Offset
+		}
+		validSize, entries, err := scanSegment(l.segmentPath(id), offset)
+		if err != nil {
+			return err
+		}
+		l.entries += entries
+		l.size += validSize - offset
+	}
+
+	if len(l.segments) == 0 {
+		l.segments = append(l.segments, l.read.Segment)
+	}
+	last := l.segments[len(l.segments)-1]
+	if l.writer, err = os.OpenFile(l.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return fmt.Errorf("open spill segment: %w", err)
+	}
+	info, err := l.writer.Stat()
+	if err != nil {
+		return fmt.Errorf("stat spill segment: %w", err)
+	}
+	l.writerSize = info.Size()
+	return nil
+}
+
+// scanSegment validates the entries of a segment from offset, truncating it after the last valid entry
+func scanSegment(path string, offset int64) (size, entries int64, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open spill segment: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("stat spill segment: %w", err)
+	}
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	size = offset
+	for size < info.Size() {
+		entry, err := readEntry(f, size)
+		if err != nil {
+			break
+		}
+		size += headerSize + int64(len(entry))
+		entries++
+	}
+	if size < info.Size() {
+		if err := f.Truncate(size); err != nil {
+			return 0, 0, fmt.Errorf("truncate spill segment: %w", err)
+		}
+	}
+	return size, entries, nil
+}
+
+// readEntry reads the entry at offset, checking its crc
+func readEntry(f *os.File, offset int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], offset); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset+headerSize+int64(length) > info.Size() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	entry := make([]byte, length)
+	if _, err := f.ReadAt(entry, offset+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(entry) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("corrupted spill entry at offset %d", offset)
+	}
+	return entry, nil
+}
+
+func (l *LogT) segmentPath(id int64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// Append appends an entry to the log, returning ErrFull if the log would exceed its maximum size
+func (l *LogT) Append(entry []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	entrySize := headerSize + int64(len(entry))
+	if l.opts.MaxSize > 0 && l.size+entrySize > l.opts.MaxSize {
+		return ErrFull
+	}
+	if l.opts.SegmentSize > 0 && l.writerSize > 0 && l.writerSize+entrySize > l.opts.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, entrySize)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(entry)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(entry))
+	copy(buf[headerSize:], entry)
+	if n, err := l.writer.Write(buf); err != nil {
+		// discard a partially written entry, so that the segment stays readable
+		if n > 0 {
+			_ = l.writer.Truncate(l.writerSize)
+		}
+		return fmt.Errorf("write spill entry: %w", err)
+	}
+	if l.opts.Fsync == FsyncAlways {
+		if err := l.writer.Sync(); err != nil {
+			return fmt.Errorf("sync spill segment: %w", err)
+		}
+	} else {
+		l.dirty = true
+	}
+	l.writerSize += entrySize
+	l.size += entrySize
+	l.entries++
+	l.appended++
+	return nil
+}
+
+// rotate starts appending to a new segment
+func (l *LogT) rotate() error {
+	if err := l.writer.Sync(); err != nil {
+		return fmt.Errorf("sync spill segment: %w", err)
+	}
+	if err := l.writer.Close(); err != nil {
+		return fmt.Errorf("close spill segment: %w", err)
+	}
+	id := l.segments[len(l.segments)-1] + 1
+	writer, err := os.OpenFile(l.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create spill segment: %w", err)
+	}
+	l.writer, l.writerSize = writer, 0
+	l.segments = append(l.segments, id)
+	return nil
+}
+
+// Peek returns the next entry to consume, or nil if there is none
+func (l *LogT) Peek() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, os.ErrClosed
+	}
+	for {
+		if l.entries == 0 {
+			return nil, nil
+		}
+		current := l.read.Segment == l.segments[len(l.segments)-1]
+		if current && l.read.Offset >= l.writerSize {
+			return nil, nil
+		}
+		if l.reader == nil {
+			reader, err := os.Open(l.segmentPath(l.read.Segment))
+			if err != nil {
+				return nil, fmt.Errorf("open spill segment: %w", err)
+			}
+			l.reader = reader
+		}
+		entry, err := readEntry(l.reader, l.read.Offset)
+		if err == nil {
+			l.peekedSize = headerSize + int64(len(entry))
+			return entry, nil
+		}
+		if current || !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read spill entry: %w", err)
+		}
+		// end of a previous segment, which is fully consumed
+		if err := l.removeReadSegment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeReadSegment removes the segment being read, once fully consumed, and moves on to the next one
+func (l *LogT) removeReadSegment() error {
+	l.reader.Close()
+	l.reader = nil
+	if err := os.Remove(l.segmentPath(l.read.Segment)); err != nil {
+		return fmt.Errorf("remove consumed spill segment: %w", err)
+	}
+	l.segments = l.segments[1:]
+	l.read = checkpointT{Segment: l.segments[0]}
+	return l.writeCheckpoint()
+}
+
+// Commit consumes the entry returned by the last Peek
+func (l *LogT) Commit() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.peekedSize == 0 {
+		return errors.New("no spill entry to commit")
+	}
+	l.read.Offset += l.peekedSize
+	l.size -= l.peekedSize
+	l.entries--
+	l.committed++
+	l.peekedSize = 0
+	return l.writeCheckpoint()
+}
+
+func (l *LogT) writeCheckpoint() error {
+	data, err := json.Marshal(l.read)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(l.dir, checkpointFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("write spill checkpoint: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write spill checkpoint: %w", err)
+	}
+	if l.opts.Fsync == FsyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("sync spill checkpoint: %w", err)
+		}
+	} else {
+		l.dirty = true
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write spill checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(l.dir, checkpointFile)); err != nil {
+		return fmt.Errorf("write spill checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Sync flushes appended entries and the checkpoint to disk
+func (l *LogT) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sync()
+}
+
+func (l *LogT) sync() error {
+	if !l.dirty || l.closed {
+		return nil
+	}
+	if err := l.writer.Sync(); err != nil {
+		return fmt.Errorf("sync spill segment: %w", err)
+	}
+	if dir, err := os.Open(l.dir); err == nil {
+		// syncs the renames of the checkpoint
+		_ = dir.Sync()
+		dir.Close()
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *LogT) syncPeriodically() {
+	defer close(l.syncingEnded)
+	ticker := time.NewTicker(l.opts.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopSyncing:
+			return
+		case <-ticker.C:
+			_ = l.Sync()
+		}
+	}
+}
+
+// Stats returns the state of the log
+func (l *LogT) Stats() StatsT {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return StatsT{
+		Size:      l.size,
+		Entries:   l.entries,
+		Segments:  len(l.segments),
+		Appended:  l.appended,
+		Committed: l.committed,
+	}
+}
+
+// Close syncs and closes the log
+func (l *LogT) Close() error {
+	l.closeOnce.Do(func() {
+		if l.stopSyncing != nil {
+			close(l.stopSyncing)
+			<-l.syncingEnded
+		}
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	err := l.sync()
+	l.closed = true
+	if l.reader != nil {
+		l.reader.Close()
+	}
+	if closeErr := l.writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package spill_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/gateway/spill"
+)
+
+func consumeAll(t *testing.T, log *spill.LogT) []string {
+	var consumed []string
+	for {
+		entry, err := log.Peek()
+		require.NoError(t, err)
+		if entry == nil {
+			return consumed
+		}
+		consumed = append(consumed, string(entry))
+		require.NoError(t, log.Commit())
+	}
+}
+
+func Test_AppendAndConsumeInOrder(t *testing.T) {
+	log, err := spill.Open(t.TempDir(), spill.OptsT{SegmentSize: 64})
+	require.NoError(t, err)
+	defer log.Close()
+
+	var appended []string
+	for i := 0; i < 20; i++ {
+		entry := fmt.Sprintf("entry-%d", i)
+		require.NoError(t, log.Append([]byte(entry)))
+		appended = append(appended, entry)
+	}
+	stats := log.Stats()
+	require.EqualValues(t, 20, stats.Entries)
+	require.Greater(t, stats.Segments, 1)
+
+	require.Equal(t, appended, consumeAll(t, log))
+	stats = log.Stats()
+	require.EqualValues(t, 0, stats.Entries)
+	require.EqualValues(t, 0, stats.Size)
+	require.Equal(t, 1, stats.Segments, "consumed segments are removed")
+	require.EqualValues(t, 20, stats.Committed)
+}
+
+func Test_ReopenResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	log, err := spill.Open(dir, spill.OptsT{SegmentSize: 32, Fsync: spill.FsyncNever})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, log.Append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	for i := 0; i < 2; i++ {
+		_, err := log.Peek()
+		require.NoError(t, err)
+		require.NoError(t, log.Commit())
+	}
+	// peeked but not committed, it is consumed again
+	_, err = log.Peek()
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	log, err = spill.Open(dir, spill.OptsT{SegmentSize: 32})
+	require.NoError(t, err)
+	defer log.Close()
+	require.EqualValues(t, 3, log.Stats().Entries)
+	require.NoError(t, log.Append([]byte("entry-5")))
+	require.Equal(t, []string{"entry-2", "entry-3", "entry-4", "entry-5"}, consumeAll(t, log))
+}
+
+func Test_PartiallyWrittenEntriesAreDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	log, err := spill.Open(dir, spill.OptsT{})
+	require.NoError(t, err)
+	require.NoError(t, log.Append([]byte("entry-0")))
+	require.NoError(t, log.Append([]byte("entry-1")))
+	require.NoError(t, log.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	info, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(segments[0], info.Size()-3))
+
+	log, err = spill.Open(dir, spill.OptsT{})
+	require.NoError(t, err)
+	defer log.Close()
+	require.EqualValues(t, 1, log.Stats().Entries)
+	require.NoError(t, log.Append([]byte("entry-2")))
+	require.Equal(t, []string{"entry-0", "entry-2"}, consumeAll(t, log))
+}
+
+func Test_Full(t *testing.T) {
+	log, err := spill.Open(t.TempDir(), spill.OptsT{MaxSize: 30})
+	require.NoError(t, err)
+	defer log.Close()
+
+	require.NoError(t, log.Append([]byte("entry-0")))
+	require.NoError(t, log.Append([]byte("entry-1")))
+	require.ErrorIs(t, log.Append([]byte("entry-2")), spill.ErrFull)
+
+	_, err = log.Peek()
+	require.NoError(t, err)
+	require.NoError(t, log.Commit())
+	require.NoError(t, log.Append([]byte("entry-2")))
+	require.Equal(t, []string{"entry-1", "entry-2"}, consumeAll(t, log))
+}
+
+func Test_InvalidFsyncPolicy(t *testing.T) {
+	_, err := spill.Open(t.TempDir(), spill.OptsT{Fsync: "sometimes"})
+	require.Error(t, err)
+}
@@ -0,0 +1,342 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+
+	"github.com/rudderlabs/rudder-server/gateway/response"
+	"github.com/rudderlabs/rudder-server/gateway/spill"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+// spillBufferT acknowledges batches of jobs while the jobs database is unavailable, by appending them to an on-disk log.
+// Jobs are spilled once storing them fails as the jobs database is unavailable, or after storing a batch took longer than spillLatencyBudget.
+// Batches keep being spilled, so that they are stored in order, until the drainer has replayed all of them into the jobs database.
+type spillBufferT struct {
+	log    *spill.LogT
+	jobsDB jobsdb.JobsDB
+
+	mu       sync.Mutex // serializes spilling batches with the drainer leaving spilling mode
+	spilling bool
+	healthy  bool // the last store of the drainer succeeded within spillLatencyBudget
+
+	statsLock      sync.Mutex
+	drainedJobs    int64
+	droppedJobs    int64
+	lastDrainError string
+	lastDrainedAt  time.Time
+
+	spilledJobsStat stats.RudderStats
+	drainedJobsStat stats.RudderStats
+	droppedJobsStat stats.RudderStats
+	sizeStat        stats.RudderStats
+}
+
+// spillBufferDir is the default directory of the spill buffer
+func spillBufferDir() string {
+	tmpDirPath, err := misc.CreateTMPDIR()
+	if err != nil {
+		panic(err)
+	}
+	return tmpDirPath + "/rudder-gateway-spill"
+}
+
+func newSpillBuffer(jobsDB jobsdb.JobsDB, statsFactory stats.Stats) (*spillBufferT, error) {
+	dir := spillDir
+	if dir == "" {
+		dir = spillBufferDir()
+	}
+	log, err := spill.Open(dir, spill.OptsT{
+		MaxSize:       spillMaxSize,
+		SegmentSize:   spillSegmentSize,
+		Fsync:         spillFsync,
+		FsyncInterval: spillFsyncInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open spill buffer in %s: %w", dir, err)
+	}
+	return &spillBufferT{
+		log:    log,
+		jobsDB: jobsDB,
+		// batches left by a previous run are drained before any new batch is stored
+		spilling:        log.Stats().Entries > 0,
+		spilledJobsStat: statsFactory.NewStat("gateway.spill_buffer_spilled_jobs", stats.CountType),
+		drainedJobsStat: statsFactory.NewStat("gateway.spill_buffer_drained_jobs", stats.CountType),
+		droppedJobsStat: statsFactory.NewStat("gateway.spill_buffer_dropped_jobs", stats.CountType),
+		sizeStat:        statsFactory.NewStat("gateway.spill_buffer_size", stats.GaugeType),
+	}, nil
+}
+
+// spilledBatchT is an entry of the spill log, replayed with the same store of the jobs database the batch was received with
+type spilledBatchT struct {
+	RetryEach bool           `json:"retryEach"`
+	Jobs      []*jobsdb.JobT `json:"jobs"`
+}
+
+// dbUnavailableErrors are the errors of the jobs database, or of the connection to it, being unavailable,
+// rather than of jobs failing to be stored on their own
+var dbUnavailableErrors = []string{
+	"connection refused",
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	"no such host",
+	"network is unreachable",
+	"unexpected EOF",
+	"driver: bad connection",
+	"sql: database is closed",
+	"the database system is starting up",
+	"the database system is shutting down",
+	"the database system is in recovery mode",
+	"too many clients already",
+	"terminating connection due to administrator command",
+}
+
+func isDBUnavailable(errorMessage string) bool {
+	for _, unavailableError := range dbUnavailableErrors {
+		if strings.Contains(errorMessage, unavailableError) {
+			return true
+		}
+	}
+	return false
+}
+
+// store stores jobs into the jobs database, with StoreWithRetryEach if retryEach or Store otherwise, returning the errors of the jobs failing to be stored.
+// Jobs failing to be stored as the jobs database is unavailable are spilled. Once the spill buffer is full, they fail with StoreUnavailable,
+// as do all batches while older spilled batches are pending, so that no batch is stored before them.
+func (sb *spillBufferT) store(jobList []*jobsdb.JobT, retryEach bool) map[uuid.UUID]string {
+	if len(jobList) == 0 {
+		return nil
+	}
+	if spilling, err := sb.spillIfSpilling(spilledBatchT{RetryEach: retryEach, Jobs: jobList}); spilling {
+		if err != nil {
+			pkgLogger.Errorf("Failed to spill batch of %d jobs: %v", len(jobList), err)
+			return unavailableJobErrors(nil, jobList)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	errorMessagesMap, unavailableJobs := sb.storeInDB(spilledBatchT{RetryEach: retryEach, Jobs: jobList})
+	if len(unavailableJobs) > 0 {
+		if err := sb.spill(spilledBatchT{RetryEach: retryEach, Jobs: unavailableJobs}); err != nil {
+			pkgLogger.Errorf("Failed to spill batch of %d jobs: %v", len(unavailableJobs), err)
+			return unavailableJobErrors(errorMessagesMap, unavailableJobs)
+		}
+		return errorMessagesMap
+	}
+	if spillLatencyBudget > 0 && time.Since(start) > spillLatencyBudget {
+		pkgLogger.Warnf("Storing batch of %d jobs took %v, spilling next batches", len(jobList), time.Since(start))
+		sb.mu.Lock()
+		sb.spilling, sb.healthy = true, false
+		sb.mu.Unlock()
+	}
+	return errorMessagesMap
+}
+
+// storeInDB stores the jobs of batch into the jobs database, returning the errors of the jobs failing to be stored on their own,
+// and the jobs failing to be stored as the jobs database is unavailable
+func (sb *spillBufferT) storeInDB(batch spilledBatchT) (map[uuid.UUID]string, []*jobsdb.JobT) {
+	if !batch.RetryEach {
+		err := sb.jobsDB.Store(batch.Jobs)
+		if err == nil {
+			return nil, nil
+		}
+		pkgLogger.Errorf("Store into gateway db failed with error: %v", err)
+		if isDBUnavailable(err.Error()) {
+			sb.setDrainError(err.Error())
+			return nil, batch.Jobs
+		}
+		errorMessagesMap := make(map[uuid.UUID]string, len(batch.Jobs))
+		for _, job := range batch.Jobs {
+			errorMessagesMap[job.UUID] = err.Error()
+		}
+		return errorMessagesMap, nil
+	}
+
+	errorMessagesMap := sb.jobsDB.StoreWithRetryEach(batch.Jobs)
+	var unavailableJobs []*jobsdb.JobT
+	for _, job := range batch.Jobs {
+		if errorMessage, found := errorMessagesMap[job.UUID]; found && isDBUnavailable(errorMessage) {
+			sb.setDrainError(errorMessage)
+			unavailableJobs = append(unavailableJobs, job)
+			delete(errorMessagesMap, job.UUID)
+		}
+	}
+	return errorMessagesMap, unavailableJobs
+}
+
+// unavailableJobErrors adds StoreUnavailable errors of jobs to errorMessagesMap
+func unavailableJobErrors(errorMessagesMap map[uuid.UUID]string, jobs []*jobsdb.JobT) map[uuid.UUID]string {
+	if errorMessagesMap == nil {
+		errorMessagesMap = make(map[uuid.UUID]string, len(jobs))
+	}
+	for _, job := range jobs {
+		errorMessagesMap[job.UUID] = response.GetStatus(response.StoreUnavailable)
+	}
+	return errorMessagesMap
+}
+
+// spillIfSpilling spills batch if batches are being spilled
+func (sb *spillBufferT) spillIfSpilling(batch spilledBatchT) (bool, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if !sb.spilling {
+		return false, nil
+	}
+	return true, sb.append(batch)
+}
+
+func (sb *spillBufferT) spill(batch spilledBatchT) error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if err := sb.append(batch); err != nil {
+		return err
+	}
+	if !sb.spilling {
+		pkgLogger.Warnf("Failed to store batch of %d jobs, spilling batches until the jobs database recovers", len(batch.Jobs))
+	}
+	sb.spilling, sb.healthy = true, false
+	return nil
+}
+
+func (sb *spillBufferT) append(batch spilledBatchT) error {
+	entry, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if err := sb.log.Append(entry); err != nil {
+		return err
+	}
+	sb.spilledJobsStat.Count(len(batch.Jobs))
+	sb.sizeStat.Gauge(sb.log.Stats().Size)
+	return nil
+}
+
+// drain replays spilled batches into the jobs database in order, until ctx is cancelled, with the store they were received with.
+// Jobs of a batch failing to be stored as the jobs database is unavailable are retried after spillDrainRetryBackoff.
+// Jobs failing to be stored on their own are dropped, as they would be rejected by the jobs database anyway.
+func (sb *spillBufferT) drain(ctx context.Context) {
+	var pending *spilledBatchT // the jobs of the oldest batch still to be stored
+	for {
+		if pending == nil {
+			entry, err := sb.log.Peek()
+			if err != nil {
+				pkgLogger.Errorf("Failed to read spill buffer: %v", err)
+				sb.setDrainError(err.Error())
+				if misc.SleepCtx(ctx, spillDrainRetryBackoff) {
+					return
+				}
+				continue
+			}
+			if entry == nil {
+				sb.mu.Lock()
+				if sb.spilling && sb.healthy && sb.log.Stats().Entries == 0 {
+					pkgLogger.Info("Spill buffer drained, storing batches into the jobs database")
+					sb.spilling = false
+				}
+				sb.mu.Unlock()
+				if misc.SleepCtx(ctx, spillDrainInterval) {
+					return
+				}
+				continue
+			}
+			pending = &spilledBatchT{}
+			if err := json.Unmarshal(entry, pending); err != nil {
+				pkgLogger.Errorf("Dropping unreadable spilled batch: %v", err)
+				sb.setDrainError(err.Error())
+				pending = nil
+				if err := sb.log.Commit(); err != nil {
+					pkgLogger.Errorf("Failed to commit spill buffer: %v", err)
+				}
+				continue
+			}
+		}
+
+		start := time.Now()
+		errorMessagesMap, unavailableJobs := sb.storeInDB(*pending)
+		for _, job := range pending.Jobs {
+			if errorMessage, found := errorMessagesMap[job.UUID]; found {
+				pkgLogger.Errorf("Dropping spilled job %s failing to be stored: %s", job.UUID, errorMessage)
+			}
+		}
+		drained := len(pending.Jobs) - len(errorMessagesMap) - len(unavailableJobs)
+		sb.drainedJobsStat.Count(drained)
+		sb.droppedJobsStat.Count(len(errorMessagesMap))
+		sb.statsLock.Lock()
+		sb.drainedJobs += int64(drained)
+		sb.droppedJobs += int64(len(errorMessagesMap))
+		sb.statsLock.Unlock()
+
+		if len(unavailableJobs) > 0 {
+			pending.Jobs = unavailableJobs
+			sb.mu.Lock()
+			sb.healthy = false
+			sb.mu.Unlock()
+			if misc.SleepCtx(ctx, spillDrainRetryBackoff) {
+				return
+			}
+			continue
+		}
+		pending = nil
+		if err := sb.log.Commit(); err != nil {
+			pkgLogger.Errorf("Failed to commit spill buffer: %v", err)
+		}
+		sb.sizeStat.Gauge(sb.log.Stats().Size)
+
+		sb.mu.Lock()
+		sb.healthy = spillLatencyBudget <= 0 || time.Since(start) <= spillLatencyBudget
+		sb.mu.Unlock()
+		sb.statsLock.Lock()
+		sb.lastDrainError = ""
+		sb.lastDrainedAt = time.Now()
+		sb.statsLock.Unlock()
+	}
+}
+
+func (sb *spillBufferT) setDrainError(errorMessage string) {
+	sb.statsLock.Lock()
+	defer sb.statsLock.Unlock()
+	sb.lastDrainError = errorMessage
+}
+
+// status describes the spill buffer in GatewayAdmin.Status
+func (sb *spillBufferT) status() map[string]interface{} {
+	logStats := sb.log.Stats()
+	sb.mu.Lock()
+	spilling := sb.spilling
+	sb.mu.Unlock()
+	sb.statsLock.Lock()
+	defer sb.statsLock.Unlock()
+	status := map[string]interface{}{
+		"spilling":         spilling,
+		"fsync":            spillFsync,
+		"size-bytes":       logStats.Size,
+		"max-size-bytes":   spillMaxSize,
+		"pending-batches":  logStats.Entries,
+		"segments":         logStats.Segments,
+		"spilled-batches":  logStats.Appended,
+		"drained-batches":  logStats.Committed,
+		"drained-jobs":     sb.drainedJobs,
+		"dropped-jobs":     sb.droppedJobs,
+		"last-drain-error": sb.lastDrainError,
+	}
+	if !sb.lastDrainedAt.IsZero() {
+		status["last-drained-at"] = sb.lastDrainedAt
+	}
+	return status
+}
+
+func (sb *spillBufferT) close() {
+	if err := sb.log.Close(); err != nil {
+		pkgLogger.Errorf("Failed to close spill buffer: %v", err)
+	}
+}
@@ -187,6 +187,11 @@ func (webhook *HandleT) RequestHandler(w http.ResponseWriter, r *http.Request) {
 	resp := <-done
 	webhook.gwHandle.IncrementAckCount(1)
 	atomic.AddUint64(&webhook.ackCount, 1)
+	if resp.err == response.GetStatus(response.DuplicateRequest) {
+		webhook.gwHandle.TrackRequestMetrics("")
+		w.Write([]byte(resp.err))
+		return
+	}
 	webhook.gwHandle.TrackRequestMetrics(resp.err)
 	if resp.err != "" {
 		code := 400
@@ -0,0 +1,1242 @@
+/*
+Embedded implementation of JobsDB on top of a Badger key-value store.
+
+Jobs are kept as JSON records under <tablePrefix>:j:<jobID>, every status
+written for a job is appended under <tablePrefix>:h:<jobID><statusID>, the
+id of the latest one is kept under <tablePrefix>:l:<jobID> and the latest
+state of each job is indexed under <tablePrefix>:s:<state>:<jobID>, so that
+queries by state only scan the jobs they may return. Job ids are big-endian
+encoded which keeps every prefix scan ordered by job id, the same order the
+postgres implementation returns jobs in.
+
+Badger transactions are atomic and durable, so there are no dataset
+migrations to journal and recover from: after a crash the only state left
+behind is jobs in executing state, which the callers already clean up via
+DeleteExecuting, exactly as they do with postgres. Transactions passed
+around through BeginGlobalTransaction are not supported and are always nil.
+
+Store and UpdateJobStatus are all-or-nothing like their postgres
+counterparts, even though job payloads and status responses of a large list
+don't fit in a single badger transaction. They are written first with a
+write batch, which splits them into as many transactions as needed, and
+only made visible by a final transaction which writes the small state index
+and latest status keys. The keys of the write batch are recorded beforehand
+in a rollback marker under <tablePrefix>:r:<markerID>, deleted by the final
+transaction, so that they are deleted if writing the list fails, or on Start
+if the server crashed before it completed.
+*/
+
+package jobsdb
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+	uuid "github.com/gofrs/uuid"
+	"github.com/tidwall/gjson"
+
+	"github.com/rudderlabs/rudder-server/admin"
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/rruntime"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+const (
+	// PostgresBackend stores jobs in postgres datasets (default)
+	PostgresBackend = "postgres"
+	// BadgerBackend stores jobs in an embedded badger store
+	BadgerBackend = "badger"
+)
+
+var (
+	backend                     string
+	badgerPath                  string
+	badgerTerminalJobsRetention time.Duration
+	badgerCleanupInterval       time.Duration
+)
+
+func loadBadgerConfig() {
+	config.RegisterStringConfigVariable(PostgresBackend, &backend, false, "JobsDB.backend")
+	config.RegisterStringConfigVariable("", &badgerPath, false, "JobsDB.badger.path")
+	config.RegisterDurationConfigVariable(time.Duration(60), &badgerTerminalJobsRetention, true, time.Minute, "JobsDB.badger.terminalJobsRetention")
+	config.RegisterDurationConfigVariable(time.Duration(5), &badgerCleanupInterval, true, time.Minute, "JobsDB.badger.cleanupInterval")
+}
+
+// UsesBadgerBackend returns true if jobsdb instances should be created on top of the embedded badger store
+func UsesBadgerBackend() bool {
+	return strings.EqualFold(strings.TrimSpace(backend), BadgerBackend)
+}
+
+func defaultBadgerPath() string {
+	tmpDirPath, err := misc.CreateTMPDIR()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(tmpDirPath, "jobsdb_badger")
+}
+
+type loggerForBadger struct {
+	logger.LoggerI
+}
+
+func (l loggerForBadger) Warningf(fmt string, args ...interface{}) {
+	l.Warnf(fmt, args...)
+}
+
+// badgerStore is a badger database shared by all jobsdb instances using the same path,
+// e.g. the gateway writer and the processor reader of the gw jobsdb in embedded mode.
+type badgerStore struct {
+	path      string
+	db        *badger.DB
+	refs      int
+	seqLock   sync.Mutex
+	sequences map[string]*badger.Sequence
+	close     chan struct{}
+	gcDone    chan struct{}
+}
+
+var (
+	badgerStoresLock sync.Mutex
+	badgerStores     = map[string]*badgerStore{}
+)
+
+func acquireBadgerStore(path string, log logger.LoggerI) (*badgerStore, error) {
+	badgerStoresLock.Lock()
+	defer badgerStoresLock.Unlock()
+
+	if s, ok := badgerStores[path]; ok {
+		s.refs++
+		return s, nil
+	}
+
+	opts := badger.
+		DefaultOptions(path).
+		WithTruncate(true).
+		WithLogger(loggerForBadger{log})
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &badgerStore{
+		path:      path,
+		db:        db,
+		refs:      1,
+		sequences: map[string]*badger.Sequence{},
+		close:     make(chan struct{}),
+		gcDone:    make(chan struct{}),
+	}
+	rruntime.Go(func() {
+		s.gcLoop()
+		close(s.gcDone)
+	})
+	badgerStores[path] = s
+	return s, nil
+}
+
+func releaseBadgerStore(s *badgerStore) {
+	badgerStoresLock.Lock()
+	defer badgerStoresLock.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	close(s.close)
+	<-s.gcDone
+	s.seqLock.Lock()
+	for _, seq := range s.sequences {
+		_ = seq.Release()
+	}
+	s.seqLock.Unlock()
+	_ = s.db.Close()
+	delete(badgerStores, s.path)
+}
+
+func (s *badgerStore) gcLoop() {
+	for {
+		select {
+		case <-s.close:
+			return
+		case <-time.After(5 * time.Minute):
+		}
+		// One call only removes at most one value log file, so keep going while it succeeds
+		for s.db.RunValueLogGC(0.5) == nil {
+		}
+	}
+}
+
+// next returns the next value of the named sequence, starting from 1
+func (s *badgerStore) next(name string) (int64, error) {
+	s.seqLock.Lock()
+	defer s.seqLock.Unlock()
+	seq, ok := s.sequences[name]
+	if !ok {
+		var err error
+		seq, err = s.db.GetSequence([]byte(name), 1000)
+		if err != nil {
+			return 0, err
+		}
+		s.sequences[name] = seq
+	}
+	v, err := seq.Next()
+	if err != nil {
+		return 0, err
+	}
+	return int64(v) + 1, nil
+}
+
+/*
+BadgerHandleT implements JobsDB and MultiTenantJobsDB using an embedded badger store.
+It honours the same job state machine, custom value & parameter filters as HandleT.
+*/
+type BadgerHandleT struct {
+	ownerType             OwnerType
+	tablePrefix           string
+	path                  string
+	clearAll              bool
+	registerStatusHandler bool
+
+	store  *badgerStore
+	logger logger.LoggerI
+
+	storeLock        sync.RWMutex
+	updateStatusLock sync.RWMutex
+	writeLock        sync.Mutex
+
+	statStoreTime  stats.RudderStats
+	statUpdateTime stats.RudderStats
+	statReadTime   stats.RudderStats
+
+	backgroundClose chan struct{}
+	backgroundDone  chan struct{}
+}
+
+type badgerJournalEntryT struct {
+	JournalEntryT
+	Owner OwnerType `json:"owner"`
+}
+
+// NewBadgerForRead creates a badger backed jobsdb instance which only reads jobs
+func NewBadgerForRead(tablePrefix string, opts ...OptsFunc) *BadgerHandleT {
+	return newBadgerOwnerType(Read, tablePrefix, opts...)
+}
+
+// NewBadgerForWrite creates a badger backed jobsdb instance which only writes jobs
+func NewBadgerForWrite(tablePrefix string, opts ...OptsFunc) *BadgerHandleT {
+	return newBadgerOwnerType(Write, tablePrefix, opts...)
+}
+
+// NewBadgerForReadWrite creates a badger backed jobsdb instance which reads and writes jobs
+func NewBadgerForReadWrite(tablePrefix string, opts ...OptsFunc) *BadgerHandleT {
+	return newBadgerOwnerType(ReadWrite, tablePrefix, opts...)
+}
+
+func newBadgerOwnerType(ownerType OwnerType, tablePrefix string, opts ...OptsFunc) *BadgerHandleT {
+	// options are shared with the postgres implementation, only the relevant ones are honoured
+	var o HandleT
+	for _, fn := range opts {
+		fn(&o)
+	}
+	jd := &BadgerHandleT{
+		ownerType:             ownerType,
+		tablePrefix:           tablePrefix,
+		path:                  badgerPath,
+		clearAll:              o.clearAll,
+		registerStatusHandler: o.registerStatusHandler,
+	}
+	if jd.tablePrefix == "" {
+		panic(errors.New("tablePrefix received is empty"))
+	}
+	jd.logger = pkgLogger.Child(jd.tablePrefix)
+	if jd.registerStatusHandler {
+		admin.RegisterStatusHandler(jd.tablePrefix+"-jobsdb", jd)
+	}
+	jd.statStoreTime = stats.NewTaggedStat("jobsdb.badger.store_time", stats.TimerType, stats.Tags{"customVal": jd.tablePrefix})
+	jd.statUpdateTime = stats.NewTaggedStat("jobsdb.badger.update_job_status_time", stats.TimerType, stats.Tags{"customVal": jd.tablePrefix})
+	jd.statReadTime = stats.NewTaggedStat("jobsdb.badger.read_time", stats.TimerType, stats.Tags{"customVal": jd.tablePrefix})
+	return jd
+}
+
+// WithBadgerPath overrides the directory of the badger store, used mainly in tests
+func (jd *BadgerHandleT) WithBadgerPath(path string) *BadgerHandleT {
+	jd.path = path
+	return jd
+}
+
+// Start opens the underlying badger store and starts the cleanup of terminal jobs.
+// Start should be called before any other jobsdb methods are called.
+func (jd *BadgerHandleT) Start() {
+	if jd.path == "" {
+		jd.path = defaultBadgerPath()
+	}
+	s, err := acquireBadgerStore(jd.path, jd.logger)
+	jd.assertError(err)
+	jd.store = s
+
+	// same as postgres, readers never clear the jobs written by others
+	if jd.clearAll && jd.ownerType != Read {
+		jd.assertError(jd.store.db.DropPrefix(jd.prefix()))
+		// Avoid clearing the database, if .Start() is called again.
+		jd.clearAll = false
+	}
+	jd.assertError(jd.recoverRollbacks())
+
+	jd.backgroundClose = make(chan struct{})
+	jd.backgroundDone = make(chan struct{})
+	rruntime.Go(func() {
+		defer close(jd.backgroundDone)
+		if jd.ownerType == Write {
+			// terminal states are written by readers
+			return
+		}
+		jd.cleanupLoop()
+	})
+	jd.logger.Infof("Connected to %s badger jobsdb at %s", jd.tablePrefix, jd.path)
+}
+
+// Stop stops the background cleanup and releases the badger store
+func (jd *BadgerHandleT) Stop() {
+	if jd.store == nil {
+		return
+	}
+	close(jd.backgroundClose)
+	<-jd.backgroundDone
+	releaseBadgerStore(jd.store)
+	jd.store = nil
+}
+
+// TearDown stops the jobsdb
+func (jd *BadgerHandleT) TearDown() {
+	jd.Stop()
+}
+
+// Close is a no-op, resources are released on Stop
+func (*BadgerHandleT) Close() {
+}
+
+func (jd *BadgerHandleT) assertError(err error) {
+	if err != nil {
+		jd.logger.Fatal(err)
+		panic(err)
+	}
+}
+
+func (jd *BadgerHandleT) assert(cond bool, errorString string) {
+	if !cond {
+		panic(fmt.Errorf("[[ %s ]]: %s", jd.tablePrefix, errorString))
+	}
+}
+
+/*
+Key layout helpers
+*/
+
+func (jd *BadgerHandleT) prefix() []byte {
+	return []byte(jd.tablePrefix + ":")
+}
+
+func encodeID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func decodeID(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b[len(b)-8:]))
+}
+
+func (jd *BadgerHandleT) jobKey(jobID int64) []byte {
+	return append([]byte(jd.tablePrefix+":j:"), encodeID(jobID)...)
+}
+
+func (jd *BadgerHandleT) statePrefix(state string) []byte {
+	return []byte(jd.tablePrefix + ":s:" + state + ":")
+}
+
+func (jd *BadgerHandleT) stateKey(state string, jobID int64) []byte {
+	return append(jd.statePrefix(state), encodeID(jobID)...)
+}
+
+func (jd *BadgerHandleT) historyPrefix(jobID int64) []byte {
+	return append([]byte(jd.tablePrefix+":h:"), encodeID(jobID)...)
+}
+
+func (jd *BadgerHandleT) historyKey(jobID, statusID int64) []byte {
+	return append(jd.historyPrefix(jobID), encodeID(statusID)...)
+}
+
+func (jd *BadgerHandleT) lastStatusKey(jobID int64) []byte {
+	return append([]byte(jd.tablePrefix+":l:"), encodeID(jobID)...)
+}
+
+func (jd *BadgerHandleT) rollbackPrefix() []byte {
+	return []byte(jd.tablePrefix + ":r:")
+}
+
+func (jd *BadgerHandleT) rollbackKey(markerID int64) []byte {
+	return append(jd.rollbackPrefix(), encodeID(markerID)...)
+}
+
+func (jd *BadgerHandleT) journalPrefix() []byte {
+	return []byte(jd.tablePrefix + ":o:")
+}
+
+func (jd *BadgerHandleT) journalKey(opID int64) []byte {
+	return append(jd.journalPrefix(), encodeID(opID)...)
+}
+
+func (jd *BadgerHandleT) sequence(name string) string {
+	return jd.tablePrefix + ":seq:" + name
+}
+
+// the state index value carries the workspace and custom val, so that pile up counts and custom val filters
+// can be evaluated without loading the job
+func stateIndexValue(job *JobT) []byte {
+	return []byte(job.WorkspaceId + "\x00" + job.CustomVal)
+}
+
+func parseStateIndexValue(v []byte) (workspace, customVal string) {
+	parts := strings.SplitN(string(v), "\x00", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func jobState(job *JobT) string {
+	if job.LastJobStatus.JobState == "" {
+		return NotProcessed.State
+	}
+	return job.LastJobStatus.JobState
+}
+
+// update runs fn in a read-write transaction, retrying on conflicts with concurrent transactions
+func (jd *BadgerHandleT) update(fn func(txn *badger.Txn) error) error {
+	for {
+		err := jd.store.db.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+}
+
+func (jd *BadgerHandleT) getJob(txn *badger.Txn, jobID int64) (*JobT, error) {
+	item, err := txn.Get(jd.jobKey(jobID))
+	if err != nil {
+		return nil, err
+	}
+	var job JobT
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	job.LastJobStatus, err = jd.lastStatus(txn, jobID)
+	return &job, err
+}
+
+// lastStatus returns the latest status of a job, an empty status if it has none
+func (jd *BadgerHandleT) lastStatus(txn *badger.Txn, jobID int64) (JobStatusT, error) {
+	var status JobStatusT
+	item, err := txn.Get(jd.lastStatusKey(jobID))
+	if err == badger.ErrKeyNotFound {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	var statusID int64
+	if err = item.Value(func(val []byte) error {
+		statusID = decodeID(val)
+		return nil
+	}); err != nil {
+		return status, err
+	}
+	if item, err = txn.Get(jd.historyKey(jobID, statusID)); err != nil {
+		return status, fmt.Errorf("status %d of job %d: %w", statusID, jobID, err)
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &status)
+	})
+	return status, err
+}
+
+func (jd *BadgerHandleT) setJob(txn *badger.Txn, job *JobT) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return txn.Set(jd.jobKey(job.JobID), b)
+}
+
+// badgerRollbackT is a rollback marker, recording the keys of a write batch until they are made visible
+type badgerRollbackT struct {
+	Owner OwnerType `json:"owner"`
+	Keys  [][]byte  `json:"keys"`
+}
+
+/*
+writeBatch writes values under keys with a badger write batch, which splits them into as many transactions as needed,
+returning the key of the rollback marker recording them. The caller makes them visible in a transaction deleting the marker,
+or calls rollback if it fails to.
+*/
+func (jd *BadgerHandleT) writeBatch(keys, values [][]byte) ([]byte, error) {
+	markerID, err := jd.store.next(jd.sequence("rollback"))
+	if err != nil {
+		return nil, err
+	}
+	markerKey := jd.rollbackKey(markerID)
+	marker, err := json.Marshal(badgerRollbackT{Owner: jd.ownerType, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	if err = jd.update(func(txn *badger.Txn) error {
+		return txn.Set(markerKey, marker)
+	}); err != nil {
+		return nil, err
+	}
+
+	wb := jd.store.db.NewWriteBatch()
+	for i := range keys {
+		if err = wb.Set(keys[i], values[i]); err != nil {
+			wb.Cancel()
+			return nil, jd.rollback(markerKey, keys, err)
+		}
+	}
+	if err = wb.Flush(); err != nil {
+		return nil, jd.rollback(markerKey, keys, err)
+	}
+	return markerKey, nil
+}
+
+// rollback rolls back the keys recorded in a rollback marker, returning cause along with the error of rolling them back, if any.
+// The marker is left behind for Start to roll back if it fails.
+func (jd *BadgerHandleT) rollback(markerKey []byte, keys [][]byte, cause error) error {
+	if err := jd.deleteKeys(markerKey, keys); err != nil {
+		return fmt.Errorf("%w; rollback: %s", cause, err)
+	}
+	return cause
+}
+
+// deleteKeys deletes the keys recorded in a rollback marker, then the marker
+func (jd *BadgerHandleT) deleteKeys(markerKey []byte, keys [][]byte) error {
+	wb := jd.store.db.NewWriteBatch()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			wb.Cancel()
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	return jd.update(func(txn *badger.Txn) error {
+		return txn.Delete(markerKey)
+	})
+}
+
+// recoverRollbacks rolls back the write batches of this owner which were left behind by a crash
+func (jd *BadgerHandleT) recoverRollbacks() error {
+	markers := make(map[string]badgerRollbackT)
+	err := jd.store.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = jd.rollbackPrefix()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var marker badgerRollbackT
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &marker) }); err != nil {
+				return err
+			}
+			if marker.Owner == jd.ownerType {
+				markers[string(it.Item().KeyCopy(nil))] = marker
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for markerKey, marker := range markers {
+		jd.logger.Infof("Rolling back %d keys of an incomplete write", len(marker.Keys))
+		if err := jd.deleteKeys([]byte(markerKey), marker.Keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Store
+*/
+
+// BeginGlobalTransaction is not supported by the badger backend and always returns nil
+func (*BadgerHandleT) BeginGlobalTransaction() *sql.Tx {
+	return nil
+}
+
+// CommitTransaction is a no-op, see BeginGlobalTransaction
+func (*BadgerHandleT) CommitTransaction(_ *sql.Tx) {
+}
+
+func (jd *BadgerHandleT) AcquireStoreLock() {
+	jd.storeLock.Lock()
+}
+
+func (jd *BadgerHandleT) ReleaseStoreLock() {
+	jd.storeLock.Unlock()
+}
+
+func (jd *BadgerHandleT) AcquireUpdateJobStatusLocks() {
+	jd.updateStatusLock.Lock()
+}
+
+func (jd *BadgerHandleT) ReleaseUpdateJobStatusLocks() {
+	jd.updateStatusLock.Unlock()
+}
+
+func (jd *BadgerHandleT) prepareJob(job *JobT) error {
+	if !json.Valid(job.EventPayload) {
+		return errors.New("Invalid JSON")
+	}
+	if len(job.Parameters) == 0 {
+		job.Parameters = []byte(`{}`)
+	}
+	if !json.Valid(job.Parameters) {
+		return errors.New("Invalid JSON")
+	}
+	if job.EventCount < 1 {
+		job.EventCount = 1
+	}
+	now := getTimeNowFunc()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	if job.ExpireAt.IsZero() {
+		job.ExpireAt = now
+	}
+	jobID, err := jd.store.next(jd.sequence("job"))
+	if err != nil {
+		return err
+	}
+	job.JobID = jobID
+	job.LastJobStatus = JobStatusT{}
+	return nil
+}
+
+func (jd *BadgerHandleT) storeJobInTxn(txn *badger.Txn, job *JobT) error {
+	if err := jd.setJob(txn, job); err != nil {
+		return err
+	}
+	return txn.Set(jd.stateKey(NotProcessed.State, job.JobID), stateIndexValue(job))
+}
+
+/*
+Store stores new jobs, either all of them or none if an error occurs.
+Their records are written with a write batch and made visible by indexing them all in a single transaction.
+*/
+func (jd *BadgerHandleT) Store(jobList []*JobT) error {
+	jd.storeLock.RLock()
+	defer jd.storeLock.RUnlock()
+	defer jd.statStoreTime.Since(time.Now())
+
+	if len(jobList) == 0 {
+		return nil
+	}
+	keys := make([][]byte, 0, len(jobList))
+	values := make([][]byte, 0, len(jobList))
+	for _, job := range jobList {
+		if err := jd.prepareJob(job); err != nil {
+			return err
+		}
+		b, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, jd.jobKey(job.JobID))
+		values = append(values, b)
+	}
+
+	markerKey, err := jd.writeBatch(keys, values)
+	if err != nil {
+		return err
+	}
+	err = jd.update(func(txn *badger.Txn) error {
+		for _, job := range jobList {
+			if err := txn.Set(jd.stateKey(NotProcessed.State, job.JobID), stateIndexValue(job)); err != nil {
+				return err
+			}
+		}
+		return txn.Delete(markerKey)
+	})
+	if err != nil {
+		return jd.rollback(markerKey, keys, err)
+	}
+	return nil
+}
+
+// StoreWithRetryEach stores each job individually, returning the error messages of the jobs which failed
+func (jd *BadgerHandleT) StoreWithRetryEach(jobList []*JobT) map[uuid.UUID]string {
+	jd.storeLock.RLock()
+	defer jd.storeLock.RUnlock()
+	defer jd.statStoreTime.Since(time.Now())
+
+	errorMessagesMap := make(map[uuid.UUID]string)
+	for _, job := range jobList {
+		err := jd.prepareJob(job)
+		if err == nil {
+			err = jd.update(func(txn *badger.Txn) error {
+				return jd.storeJobInTxn(txn, job)
+			})
+		}
+		if err != nil {
+			errorMessagesMap[job.UUID] = err.Error()
+		}
+	}
+	return errorMessagesMap
+}
+
+// CheckPGHealth returns true while the badger store is open
+func (jd *BadgerHandleT) CheckPGHealth() bool {
+	return jd.store != nil && !jd.store.db.IsClosed()
+}
+
+/*
+Status updates
+*/
+
+// UpdateJobStatusInTxn ignores the transaction and updates the job statuses directly, see BeginGlobalTransaction
+func (jd *BadgerHandleT) UpdateJobStatusInTxn(_ *sql.Tx, statusList []*JobStatusT, customValFilters []string, parameterFilters []ParameterFilterT) error {
+	return jd.UpdateJobStatus(statusList, customValFilters, parameterFilters)
+}
+
+/*
+UpdateJobStatus appends the statuses to the history of each job and moves
+the job to the index of its new state, either for all of them or none if an error occurs.
+The statuses are written with a write batch and made visible by moving the jobs in a single transaction.
+customValFilters and parameterFilters are accepted for compatibility, every job is looked up by its id.
+*/
+func (jd *BadgerHandleT) UpdateJobStatus(statusList []*JobStatusT, _ []string, _ []ParameterFilterT) error {
+	if len(statusList) == 0 {
+		return nil
+	}
+	defer jd.statUpdateTime.Since(time.Now())
+
+	for _, status := range statusList {
+		checkValidJobState(jd, []string{status.JobState})
+	}
+
+	jd.writeLock.Lock()
+	defer jd.writeLock.Unlock()
+
+	statusIDs := make([]int64, len(statusList))
+	keys := make([][]byte, len(statusList))
+	values := make([][]byte, len(statusList))
+	for i, status := range statusList {
+		id, err := jd.store.next(jd.sequence("status"))
+		if err != nil {
+			return err
+		}
+		statusIDs[i] = id
+		if len(status.ErrorResponse) == 0 {
+			status.ErrorResponse = []byte(`{}`)
+		}
+		if len(status.Parameters) == 0 {
+			status.Parameters = []byte(`{}`)
+		}
+		b, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		keys[i] = jd.historyKey(status.JobID, id)
+		values[i] = b
+	}
+
+	markerKey, err := jd.writeBatch(keys, values)
+	if err != nil {
+		return err
+	}
+	err = jd.update(func(txn *badger.Txn) error {
+		for i, status := range statusList {
+			job, err := jd.getJob(txn, status.JobID)
+			if err != nil {
+				return fmt.Errorf("job %d: %w", status.JobID, err)
+			}
+			if err = txn.Delete(jd.stateKey(jobState(job), job.JobID)); err != nil {
+				return err
+			}
+			if err = txn.Set(jd.lastStatusKey(job.JobID), encodeID(statusIDs[i])); err != nil {
+				return err
+			}
+			job.LastJobStatus = *status
+			if err = txn.Set(jd.stateKey(status.JobState, job.JobID), stateIndexValue(job)); err != nil {
+				return err
+			}
+		}
+		return txn.Delete(markerKey)
+	})
+	if err != nil {
+		return jd.rollback(markerKey, keys, err)
+	}
+	return nil
+}
+
+/*
+DeleteExecuting deletes the executing status of jobs whose latest state is executing,
+reverting them to their previous state. This is only done during recovery, which happens during the server start.
+*/
+func (jd *BadgerHandleT) DeleteExecuting(params GetQueryParamsT) {
+	if params.JobCount == 0 {
+		return
+	}
+	params.StateFilters = []string{Executing.State}
+	params.JobCount = -1
+	jobs := jd.getJobs(params, "", false)
+
+	jd.writeLock.Lock()
+	defer jd.writeLock.Unlock()
+
+	for _, executing := range jobs {
+		jobID := executing.JobID
+		err := jd.update(func(txn *badger.Txn) error {
+			job, err := jd.getJob(txn, jobID)
+			if err != nil {
+				return err
+			}
+			if jobState(job) != Executing.State {
+				return nil
+			}
+			opts := badger.DefaultIteratorOptions
+			opts.Reverse = true
+			opts.Prefix = jd.historyPrefix(job.JobID)
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			var history [][]byte
+			// reverse iteration needs to seek past the last possible key of the prefix
+			for it.Seek(append(jd.historyPrefix(job.JobID), 0xff)); it.Valid() && len(history) < 2; it.Next() {
+				history = append(history, it.Item().KeyCopy(nil))
+			}
+			if len(history) > 0 {
+				if err := txn.Delete(history[0]); err != nil {
+					return err
+				}
+			}
+
+			if err := txn.Delete(jd.stateKey(Executing.State, job.JobID)); err != nil {
+				return err
+			}
+			if len(history) == 2 {
+				if err := txn.Set(jd.lastStatusKey(job.JobID), encodeID(decodeID(history[1]))); err != nil {
+					return err
+				}
+			} else if err := txn.Delete(jd.lastStatusKey(job.JobID)); err != nil {
+				return err
+			}
+			lastStatus, err := jd.lastStatus(txn, job.JobID)
+			if err != nil {
+				return err
+			}
+			job.LastJobStatus = lastStatus
+			return txn.Set(jd.stateKey(jobState(job), job.JobID), stateIndexValue(job))
+		})
+		jd.assertError(err)
+	}
+}
+
+/*
+Reads
+*/
+
+func matchesParameterFilters(parameters []byte, parameterFilters []ParameterFilterT) bool {
+	for _, filter := range parameterFilters {
+		value := gjson.GetBytes(parameters, filter.Name)
+		if !value.Exists() {
+			if filter.Optional {
+				continue
+			}
+			return false
+		}
+		if value.Type != gjson.String || value.Str != filter.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// scanState returns up to count (all if count < 0) jobs in the given state, ordered by job id
+func (jd *BadgerHandleT) scanState(txn *badger.Txn, state string, count int, workspace string, params GetQueryParamsT) ([]*JobT, error) {
+	var customValSet map[string]struct{}
+	if len(params.CustomValFilters) > 0 && !params.IgnoreCustomValFiltersInQuery {
+		customValSet = make(map[string]struct{})
+		for _, cv := range params.CustomValFilters {
+			customValSet[cv] = struct{}{}
+		}
+	}
+	now := getTimeNowFunc()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	opts.Prefix = jd.statePrefix(state)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var jobs []*JobT
+	eventCount := 0
+	for it.Rewind(); it.Valid(); it.Next() {
+		if count >= 0 && len(jobs) >= count {
+			break
+		}
+		if params.EventCount > 0 && eventCount >= params.EventCount {
+			break
+		}
+		var jobWorkspace, customVal string
+		err := it.Item().Value(func(val []byte) error {
+			jobWorkspace, customVal = parseStateIndexValue(val)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if workspace != "" && jobWorkspace != workspace {
+			continue
+		}
+		if customValSet != nil {
+			if _, ok := customValSet[customVal]; !ok {
+				continue
+			}
+		}
+		jobID := decodeID(it.Item().Key())
+		if state != NotProcessed.State && jobID <= params.AfterJobID {
+			continue
+		}
+		job, err := jd.getJob(txn, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if !matchesParameterFilters(job.Parameters, params.ParameterFilters) {
+			continue
+		}
+		if state == NotProcessed.State {
+			if params.UseTimeFilter && !job.CreatedAt.Before(params.Before) {
+				continue
+			}
+		} else if !job.LastJobStatus.RetryTime.Before(now) {
+			continue
+		}
+		jobs = append(jobs, job)
+		eventCount += job.EventCount
+	}
+	return jobs, nil
+}
+
+/*
+getJobs returns jobs in any of params.StateFilters ordered by job id, honouring
+params.JobCount (all if negative) and params.EventCount. If workspace is not empty
+only jobs of that workspace are returned.
+*/
+func (jd *BadgerHandleT) getJobs(params GetQueryParamsT, workspace string, checkStates bool) []*JobT {
+	if params.JobCount == 0 {
+		return []*JobT{}
+	}
+	if checkStates {
+		for _, state := range params.StateFilters {
+			if state != NotProcessed.State {
+				checkValidJobState(jd, []string{state})
+			}
+		}
+	}
+	defer jd.statReadTime.Since(time.Now())
+
+	var jobs []*JobT
+	err := jd.store.db.View(func(txn *badger.Txn) error {
+		for _, state := range params.StateFilters {
+			stateJobs, err := jd.scanState(txn, state, params.JobCount, workspace, params)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, stateJobs...)
+		}
+		return nil
+	})
+	jd.assertError(err)
+
+	if len(params.StateFilters) > 1 {
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	}
+	if params.JobCount > 0 && len(jobs) > params.JobCount {
+		jobs = jobs[:params.JobCount]
+	}
+	if params.EventCount > 0 {
+		// same as postgres, the job which crosses the event count limit is still returned
+		eventCount := 0
+		for i, job := range jobs {
+			if eventCount >= params.EventCount {
+				jobs = jobs[:i]
+				break
+			}
+			eventCount += job.EventCount
+		}
+	}
+	if jobs == nil {
+		jobs = []*JobT{}
+	}
+	return jobs
+}
+
+// GetUnprocessed returns jobs which don't have any status yet
+func (jd *BadgerHandleT) GetUnprocessed(params GetQueryParamsT) []*JobT {
+	params.StateFilters = []string{NotProcessed.State}
+	return jd.getJobs(params, "", false)
+}
+
+// GetProcessed returns jobs whose latest state is one of params.StateFilters and whose retry time has passed
+func (jd *BadgerHandleT) GetProcessed(params GetQueryParamsT) []*JobT {
+	return jd.getJobs(params, "", true)
+}
+
+func (jd *BadgerHandleT) GetToRetry(params GetQueryParamsT) []*JobT {
+	params.StateFilters = []string{Failed.State}
+	return jd.GetProcessed(params)
+}
+
+func (jd *BadgerHandleT) GetWaiting(params GetQueryParamsT) []*JobT {
+	params.StateFilters = []string{Waiting.State}
+	return jd.GetProcessed(params)
+}
+
+func (jd *BadgerHandleT) GetExecuting(params GetQueryParamsT) []*JobT {
+	params.StateFilters = []string{Executing.State}
+	return jd.GetProcessed(params)
+}
+
+func (jd *BadgerHandleT) GetImportingList(params GetQueryParamsT) []*JobT {
+	params.StateFilters = []string{Importing.State}
+	return jd.GetProcessed(params)
+}
+
+// GetAllJobs returns unprocessed, waiting and failed jobs, up to workspaceCount jobs per workspace
+func (jd *BadgerHandleT) GetAllJobs(workspaceCount map[string]int, params GetQueryParamsT, _ int) []*JobT {
+	params.StateFilters = []string{NotProcessed.State, Waiting.State, Failed.State}
+	outJobs := make([]*JobT, 0)
+	for workspace, count := range workspaceCount {
+		if count <= 0 {
+			continue
+		}
+		params.JobCount = count
+		outJobs = append(outJobs, jd.getJobs(params, workspace, false)...)
+	}
+	return outJobs
+}
+
+// GetPileUpCounts adds the number of pending jobs per workspace and custom val to statMap
+func (jd *BadgerHandleT) GetPileUpCounts(statMap map[string]map[string]int) {
+	err := jd.store.db.View(func(txn *badger.Txn) error {
+		for _, js := range jobStates {
+			if js.isTerminal || js == Executing {
+				continue
+			}
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = jd.statePrefix(js.State)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				err := it.Item().Value(func(val []byte) error {
+					workspace, customVal := parseStateIndexValue(val)
+					if _, ok := statMap[workspace]; !ok {
+						statMap[workspace] = make(map[string]int)
+					}
+					statMap[workspace][customVal]++
+					return nil
+				})
+				if err != nil {
+					it.Close()
+					return err
+				}
+			}
+			it.Close()
+		}
+		return nil
+	})
+	jd.assertError(err)
+}
+
+/*
+Journal
+*/
+
+func (jd *BadgerHandleT) JournalMarkStart(opType string, opPayload json.RawMessage) int64 {
+	jd.assert(opType == RawDataDestUploadOperation, fmt.Sprintf("opType: %s is not a supported op", opType))
+
+	opID, err := jd.store.next(jd.sequence("journal"))
+	jd.assertError(err)
+	entry := badgerJournalEntryT{
+		JournalEntryT: JournalEntryT{OpID: opID, OpType: opType, OpPayload: opPayload},
+		Owner:         jd.ownerType,
+	}
+	b, err := json.Marshal(entry)
+	jd.assertError(err)
+	err = jd.update(func(txn *badger.Txn) error {
+		return txn.Set(jd.journalKey(opID), b)
+	})
+	jd.assertError(err)
+	return opID
+}
+
+func (jd *BadgerHandleT) JournalDeleteEntry(opID int64) {
+	err := jd.update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jd.journalKey(opID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var entry badgerJournalEntryT
+		if err = item.Value(func(val []byte) error { return json.Unmarshal(val, &entry) }); err != nil {
+			return err
+		}
+		if entry.Owner != jd.ownerType {
+			return nil
+		}
+		return txn.Delete(jd.journalKey(opID))
+	})
+	jd.assertError(err)
+}
+
+func (jd *BadgerHandleT) GetJournalEntries(opType string) (entries []JournalEntryT) {
+	err := jd.store.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = jd.journalPrefix()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var entry badgerJournalEntryT
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &entry) }); err != nil {
+				return err
+			}
+			if entry.OpDone || entry.OpType != opType || entry.Owner != jd.ownerType {
+				continue
+			}
+			entries = append(entries, entry.JournalEntryT)
+		}
+		return nil
+	})
+	jd.assertError(err)
+	return
+}
+
+/*
+Housekeeping
+*/
+
+// cleanupLoop deletes jobs which reached a terminal state more than JobsDB.badger.terminalJobsRetention ago
+func (jd *BadgerHandleT) cleanupLoop() {
+	for {
+		select {
+		case <-jd.backgroundClose:
+			return
+		case <-time.After(badgerCleanupInterval):
+		}
+		jd.deleteTerminalJobs(getTimeNowFunc().Add(-badgerTerminalJobsRetention))
+	}
+}
+
+func (jd *BadgerHandleT) deleteTerminalJobs(before time.Time) {
+	var expired []int64
+	err := jd.store.db.View(func(txn *badger.Txn) error {
+		for _, state := range getValidTerminalStates() {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = jd.statePrefix(state)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				job, err := jd.getJob(txn, decodeID(it.Item().Key()))
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if job.LastJobStatus.ExecTime.Before(before) {
+					expired = append(expired, job.JobID)
+				}
+			}
+			it.Close()
+		}
+		return nil
+	})
+	jd.assertError(err)
+
+	jd.writeLock.Lock()
+	defer jd.writeLock.Unlock()
+	for _, jobID := range expired {
+		err := jd.update(func(txn *badger.Txn) error {
+			job, err := jd.getJob(txn, jobID)
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = jd.historyPrefix(jobID)
+			it := txn.NewIterator(opts)
+			var keys [][]byte
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+			it.Close()
+			keys = append(keys, jd.stateKey(jobState(job), jobID), jd.lastStatusKey(jobID), jd.jobKey(jobID))
+			for _, key := range keys {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		jd.assertError(err)
+	}
+	if len(expired) > 0 {
+		jd.logger.Debugf("Deleted %d terminal jobs from badger jobsdb", len(expired))
+	}
+}
+
+func (jd *BadgerHandleT) GetIdentifier() string {
+	return jd.tablePrefix
+}
+
+func (jd *BadgerHandleT) Status() interface{} {
+	counts := make(map[string]int)
+	if jd.store != nil {
+		_ = jd.store.db.View(func(txn *badger.Txn) error {
+			for _, js := range jobStates {
+				opts := badger.DefaultIteratorOptions
+				opts.PrefetchValues = false
+				opts.Prefix = jd.statePrefix(js.State)
+				it := txn.NewIterator(opts)
+				count := 0
+				for it.Rewind(); it.Valid(); it.Next() {
+					count++
+				}
+				it.Close()
+				counts[js.State] = count
+			}
+			return nil
+		})
+	}
+	return map[string]interface{}{
+		"backend":    BadgerBackend,
+		"path":       jd.path,
+		"job-states": counts,
+	}
+}
@@ -0,0 +1,239 @@
+package jobsdb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+	uuid "github.com/gofrs/uuid"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func newBadgerTestJob(customVal, workspace, sourceID string, eventCount int) *JobT {
+	return &JobT{
+		UUID:         uuid.Must(uuid.NewV4()),
+		UserID:       "user",
+		CustomVal:    customVal,
+		WorkspaceId:  workspace,
+		EventCount:   eventCount,
+		Parameters:   []byte(`{"source_id":"` + sourceID + `"}`),
+		EventPayload: []byte(`{"batch":[{"type":"track"}]}`),
+	}
+}
+
+func newBadgerTestStatus(jobID int64, state string, retryTime time.Time) *JobStatusT {
+	return &JobStatusT{
+		JobID:         jobID,
+		JobState:      state,
+		AttemptNum:    1,
+		ExecTime:      time.Now(),
+		RetryTime:     retryTime,
+		ErrorCode:     "500",
+		ErrorResponse: []byte(`{}`),
+		Parameters:    []byte(`{}`),
+	}
+}
+
+func TestBadgerHandleT(t *testing.T) {
+	initJobsDB()
+	stats.Setup()
+
+	path := t.TempDir()
+	jobDB := NewBadgerForReadWrite("rt").WithBadgerPath(path)
+	jobDB.Start()
+	defer jobDB.Stop()
+
+	jobs := []*JobT{
+		newBadgerTestJob("WEBHOOK", "w1", "s1", 1),
+		newBadgerTestJob("WEBHOOK", "w1", "s2", 2),
+		newBadgerTestJob("MOCKDS", "w2", "s1", 3),
+	}
+	require.NoError(t, jobDB.Store(jobs))
+	require.Less(t, jobs[0].JobID, jobs[1].JobID)
+	require.Less(t, jobs[1].JobID, jobs[2].JobID)
+
+	t.Run("invalid payload", func(t *testing.T) {
+		invalid := newBadgerTestJob("WEBHOOK", "w1", "s1", 1)
+		invalid.EventPayload = []byte(`{"batch":`)
+		errMap := jobDB.StoreWithRetryEach([]*JobT{invalid})
+		require.Equal(t, "Invalid JSON", errMap[invalid.UUID])
+	})
+
+	t.Run("unprocessed with filters", func(t *testing.T) {
+		unprocessed := jobDB.GetUnprocessed(GetQueryParamsT{CustomValFilters: []string{"WEBHOOK"}, JobCount: 10})
+		require.Len(t, unprocessed, 2)
+		require.Equal(t, jobs[0].JobID, unprocessed[0].JobID)
+
+		unprocessed = jobDB.GetUnprocessed(GetQueryParamsT{
+			JobCount:         10,
+			ParameterFilters: []ParameterFilterT{{Name: "source_id", Value: "s1"}},
+		})
+		require.Len(t, unprocessed, 2)
+		require.Equal(t, jobs[2].JobID, unprocessed[1].JobID)
+
+		unprocessed = jobDB.GetUnprocessed(GetQueryParamsT{
+			JobCount:         10,
+			ParameterFilters: []ParameterFilterT{{Name: "destination_id", Value: "d1", Optional: true}},
+		})
+		require.Len(t, unprocessed, 3)
+
+		// the job which crosses the event count limit is still returned
+		unprocessed = jobDB.GetUnprocessed(GetQueryParamsT{JobCount: 10, EventCount: 2})
+		require.Len(t, unprocessed, 2)
+	})
+
+	t.Run("state transitions", func(t *testing.T) {
+		require.NoError(t, jobDB.UpdateJobStatus([]*JobStatusT{
+			newBadgerTestStatus(jobs[0].JobID, Executing.State, time.Now()),
+			newBadgerTestStatus(jobs[1].JobID, Failed.State, time.Now().Add(-time.Minute)),
+			newBadgerTestStatus(jobs[2].JobID, Failed.State, time.Now().Add(time.Hour)),
+		}, nil, nil))
+
+		require.Len(t, jobDB.GetUnprocessed(GetQueryParamsT{JobCount: 10}), 0)
+		require.Len(t, jobDB.GetExecuting(GetQueryParamsT{JobCount: 10}), 1)
+
+		// jobs are only retried once their retry time has passed
+		toRetry := jobDB.GetToRetry(GetQueryParamsT{JobCount: 10})
+		require.Len(t, toRetry, 1)
+		require.Equal(t, jobs[1].JobID, toRetry[0].JobID)
+		require.Equal(t, Failed.State, toRetry[0].LastJobStatus.JobState)
+
+		statMap := map[string]map[string]int{}
+		jobDB.GetPileUpCounts(statMap)
+		require.Equal(t, map[string]map[string]int{"w1": {"WEBHOOK": 1}, "w2": {"MOCKDS": 1}}, statMap)
+
+		allJobs := jobDB.GetAllJobs(map[string]int{"w1": 10, "w2": 10}, GetQueryParamsT{}, 10)
+		require.Len(t, allJobs, 1)
+
+		require.NoError(t, jobDB.UpdateJobStatus([]*JobStatusT{
+			newBadgerTestStatus(jobs[1].JobID, Succeeded.State, time.Now()),
+		}, nil, nil))
+		require.Len(t, jobDB.GetToRetry(GetQueryParamsT{JobCount: 10}), 0)
+
+		// terminal jobs can be paginated by job id
+		succeeded := jobDB.GetProcessed(GetQueryParamsT{StateFilters: []string{Succeeded.State}, JobCount: 10, AfterJobID: jobs[0].JobID})
+		require.Len(t, succeeded, 1)
+		require.Equal(t, jobs[1].JobID, succeeded[0].JobID)
+		require.Len(t, jobDB.GetProcessed(GetQueryParamsT{StateFilters: []string{Succeeded.State}, JobCount: 10, AfterJobID: jobs[1].JobID}), 0)
+	})
+
+	t.Run("delete executing", func(t *testing.T) {
+		require.NoError(t, jobDB.UpdateJobStatus([]*JobStatusT{
+			newBadgerTestStatus(jobs[2].JobID, Executing.State, time.Now()),
+		}, nil, nil))
+		jobDB.DeleteExecuting(GetQueryParamsT{JobCount: -1})
+
+		require.Len(t, jobDB.GetExecuting(GetQueryParamsT{JobCount: 10}), 0)
+		// jobs[0] had no previous status, jobs[2] goes back to failed
+		unprocessed := jobDB.GetUnprocessed(GetQueryParamsT{JobCount: 10})
+		require.Len(t, unprocessed, 1)
+		require.Equal(t, jobs[0].JobID, unprocessed[0].JobID)
+		statusCounts := jobDB.Status().(map[string]interface{})["job-states"].(map[string]int)
+		require.Equal(t, 1, statusCounts[Failed.State])
+	})
+
+	t.Run("journal", func(t *testing.T) {
+		payload, _ := json.Marshal(map[string]string{"key": "value"})
+		opID := jobDB.JournalMarkStart(RawDataDestUploadOperation, payload)
+		entries := jobDB.GetJournalEntries(RawDataDestUploadOperation)
+		require.Len(t, entries, 1)
+		require.Equal(t, opID, entries[0].OpID)
+		require.JSONEq(t, string(payload), string(entries[0].OpPayload))
+
+		jobDB.JournalDeleteEntry(opID)
+		require.Len(t, jobDB.GetJournalEntries(RawDataDestUploadOperation), 0)
+	})
+
+	t.Run("terminal jobs cleanup", func(t *testing.T) {
+		jobDB.deleteTerminalJobs(time.Now().Add(time.Minute))
+		statusCounts := jobDB.Status().(map[string]interface{})["job-states"].(map[string]int)
+		require.Equal(t, 0, statusCounts[Succeeded.State])
+		require.Equal(t, 1, statusCounts[NotProcessed.State])
+	})
+
+	t.Run("jobs survive restarts", func(t *testing.T) {
+		jobDB.Stop()
+		jobDB.Start()
+		unprocessed := jobDB.GetUnprocessed(GetQueryParamsT{JobCount: 10})
+		require.Len(t, unprocessed, 1)
+		require.Equal(t, jobs[0].JobID, unprocessed[0].JobID)
+
+		newJob := newBadgerTestJob("WEBHOOK", "w1", "s1", 1)
+		require.NoError(t, jobDB.Store([]*JobT{newJob}))
+		require.Greater(t, newJob.JobID, jobs[2].JobID)
+	})
+}
+
+func TestBadgerHandleTAllOrNothing(t *testing.T) {
+	initJobsDB()
+	stats.Setup()
+
+	jobDB := NewBadgerForReadWrite("gw").WithBadgerPath(t.TempDir())
+	jobDB.Start()
+	defer jobDB.Stop()
+
+	t.Run("lists larger than a transaction", func(t *testing.T) {
+		payload := []byte(`{"batch":[{"padding":"` + strings.Repeat("x", 16*1024) + `"}]}`)
+		jobs := make([]*JobT, 1000)
+		for i := range jobs {
+			jobs[i] = newBadgerTestJob("GW", "w1", "s1", 1)
+			jobs[i].EventPayload = payload
+		}
+		require.NoError(t, jobDB.Store(jobs))
+		require.Len(t, jobDB.GetUnprocessed(GetQueryParamsT{JobCount: -1}), len(jobs))
+
+		statuses := make([]*JobStatusT, len(jobs))
+		for i, job := range jobs {
+			statuses[i] = newBadgerTestStatus(job.JobID, Succeeded.State, time.Now())
+			statuses[i].ErrorResponse = payload
+		}
+		require.NoError(t, jobDB.UpdateJobStatus(statuses, nil, nil))
+		require.Empty(t, jobDB.GetUnprocessed(GetQueryParamsT{JobCount: -1}))
+		require.Len(t, jobDB.GetProcessed(GetQueryParamsT{StateFilters: []string{Succeeded.State}, JobCount: -1}), len(jobs))
+	})
+
+	t.Run("failed status updates", func(t *testing.T) {
+		job := newBadgerTestJob("GW", "w1", "s1", 1)
+		require.NoError(t, jobDB.Store([]*JobT{job}))
+		err := jobDB.UpdateJobStatus([]*JobStatusT{
+			newBadgerTestStatus(job.JobID, Executing.State, time.Now()),
+			newBadgerTestStatus(job.JobID+1000, Executing.State, time.Now()),
+		}, nil, nil)
+		require.Error(t, err)
+		unprocessed := jobDB.GetUnprocessed(GetQueryParamsT{JobCount: -1})
+		require.Len(t, unprocessed, 1, "no status is written")
+		require.Equal(t, job.JobID, unprocessed[0].JobID)
+		require.Zero(t, countKeys(t, jobDB, jobDB.historyPrefix(job.JobID)))
+	})
+
+	t.Run("incomplete writes are rolled back on start", func(t *testing.T) {
+		keys := [][]byte{jobDB.jobKey(1_000_000)}
+		_, err := jobDB.writeBatch(keys, [][]byte{[]byte(`{}`)})
+		require.NoError(t, err)
+		require.Equal(t, 1, countKeys(t, jobDB, jobDB.rollbackPrefix()))
+
+		jobDB.Stop()
+		jobDB.Start()
+		require.Zero(t, countKeys(t, jobDB, jobDB.rollbackPrefix()))
+		require.Zero(t, countKeys(t, jobDB, keys[0]))
+	})
+}
+
+func countKeys(t *testing.T, jobDB *BadgerHandleT, prefix []byte) int {
+	count := 0
+	require.NoError(t, jobDB.store.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			count++
+		}
+		return nil
+	}))
+	return count
+}
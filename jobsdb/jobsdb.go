@@ -78,6 +78,7 @@ type GetQueryParamsT struct {
 	IgnoreCustomValFiltersInQuery bool
 	UseTimeFilter                 bool
 	Before                        time.Time
+	AfterJobID                    int64 // if set, only jobs with a greater job id are returned by GetProcessed, for paginating through terminal states
 }
 
 //StatTagsT is a struct to hold tags for stats
@@ -613,6 +614,7 @@ func loadConfig() {
 	config.RegisterDurationConfigVariable(time.Duration(60), &cacheExpiration, true, time.Minute, []string{"JobsDB.cacheExpiration"}...)
 	useJoinForUnprocessed = config.GetBool("JobsDB.useJoinForUnprocessed", true)
 	config.RegisterBoolConfigVariable(true, &useNewCacheBurst, true, "JobsDB.useNewCacheBurst")
+	loadBadgerConfig()
 }
 
 func Init2() {
@@ -2282,10 +2284,14 @@ func (jd *HandleT) getProcessedJobsDS(ds dataSetT, getAll bool, limitCount int,
 	queryStat.Start()
 	defer queryStat.End()
 
-	// We don't reset this in case of error for now, as any error in this function causes panic
-	jd.markClearEmptyResult(ds, allWorkspaces, stateFilters, customValFilters, parameterFilters, willTryToSet, nil)
+	// an empty page doesn't mean the whole DS is empty, so paginated queries don't update the cache
+	useCache := params.AfterJobID == 0
+	if useCache {
+		// We don't reset this in case of error for now, as any error in this function causes panic
+		jd.markClearEmptyResult(ds, allWorkspaces, stateFilters, customValFilters, parameterFilters, willTryToSet, nil)
+	}
 
-	var stateQuery, customValQuery, limitQuery, sourceQuery string
+	var stateQuery, customValQuery, limitQuery, sourceQuery, afterJobIDQuery string
 
 	if len(stateFilters) > 0 {
 		stateQuery = " AND " + constructQuery(jd, "job_state", stateFilters, "OR")
@@ -2314,6 +2320,11 @@ func (jd *HandleT) getProcessedJobsDS(ds dataSetT, getAll bool, limitCount int,
 		limitQuery = ""
 	}
 
+	if params.AfterJobID > 0 {
+		jd.assert(!getAll, "getAll is true")
+		afterJobIDQuery = " AND jobs.job_id > $2"
+	}
+
 	var rows *sql.Rows
 	if getAll {
 		sqlStatement := fmt.Sprintf(`SELECT
@@ -2350,11 +2361,14 @@ func (jd *HandleT) getProcessedJobsDS(ds dataSetT, getAll bool, limitCount int,
                                                    (SELECT MAX(id) from "%[2]s" GROUP BY job_id) %[3]s)
                                                AS job_latest_state
                                             WHERE jobs.job_id=job_latest_state.job_id
-                                             %[4]s %[5]s
+                                             %[4]s %[5]s %[7]s
                                              AND job_latest_state.retry_time < $1 ORDER BY jobs.job_id %[6]s`,
-			ds.JobTable, ds.JobStatusTable, stateQuery, customValQuery, sourceQuery, limitQuery)
+			ds.JobTable, ds.JobStatusTable, stateQuery, customValQuery, sourceQuery, limitQuery, afterJobIDQuery)
 
 		args := []interface{}{getTimeNowFunc()}
+		if params.AfterJobID > 0 {
+			args = append(args, params.AfterJobID)
+		}
 		if params.EventCount > 0 {
 			sqlStatement = fmt.Sprintf(`SELECT * FROM (`+sqlStatement+`) t WHERE running_event_counts - t.event_count + 1 <= $%d;`, len(args)+1)
 			// EXPLAIN `running_event_counts - t.event_count + 1`: If the event count limit "splits" a job we want this jobs to be returned.
@@ -2382,6 +2396,9 @@ func (jd *HandleT) getProcessedJobsDS(ds dataSetT, getAll bool, limitCount int,
 		jobList = append(jobList, &job)
 	}
 
+	if !useCache {
+		return jobList
+	}
 	result := hasJobs
 	if len(jobList) == 0 {
 		jd.logger.Debugf("[getProcessedJobsDS] Setting empty cache for ds: %v, stateFilters: %v, customValFilters: %v, parameterFilters: %v", ds, stateFilters, customValFilters, parameterFilters)
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/lib/pq"
+
 	"github.com/rudderlabs/rudder-server/config"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 
@@ -32,6 +34,7 @@ type ReadonlyJobsDB interface {
 	GetDSListString() (string, error)
 	GetJobIDStatus(job_id string, prefix string) (string, error)
 	GetJobByID(job_id string, prefix string) (string, error)
+	GetJobsWithStatuses(ctx context.Context, query JobsQueryT) ([]*JobWithStatusesT, error)
 }
 
 type ReadonlyHandleT struct {
@@ -85,6 +88,26 @@ type FailedStatusStats struct {
 	FailedStatusStats []JobStatusT
 }
 
+// JobsQueryT selects jobs by the jsonb values contained in their event payload and parameters.
+// A job matches when it contains any of the values of every non empty list.
+type JobsQueryT struct {
+	EventPayloadContains []string
+	ParametersContain    []string
+	// From and To bound the creation time of jobs. They are required, as the payload and parameters of jobs are not indexed,
+	// so that only the jobs of the range of job ids created within them are scanned.
+	From, To time.Time
+	// Limit is the maximum number of jobs returned, datasets being queried from the newest one for the remaining jobs only
+	Limit int
+	// MaxDatasets is the maximum number of datasets queried, 0 querying all of them
+	MaxDatasets int
+}
+
+// JobWithStatusesT is a job along with all of its statuses, oldest first
+type JobWithStatusesT struct {
+	JobT
+	Statuses []JobStatusT `json:"Statuses"`
+}
+
 /*
 Setup is used to initialize the ReadonlyHandleT structure.
 */
@@ -782,3 +805,161 @@ func (jd *ReadonlyHandleT) GetDSListString() (string, error) {
 	}
 	return response, nil
 }
+
+/*
+GetJobsWithStatuses returns the jobs matching query, newest first, along with all of their statuses.
+Every dataset is queried with the limit of jobs remaining, only within the range of job ids created in the time range of query,
+and datasets created out of the time range are skipped.
+*/
+func (jd *ReadonlyHandleT) GetJobsWithStatuses(ctx context.Context, query JobsQueryT) ([]*JobWithStatusesT, error) {
+	if len(query.EventPayloadContains) == 0 && len(query.ParametersContain) == 0 {
+		return nil, fmt.Errorf("jobs query needs event payload or parameters values")
+	}
+	if query.Limit <= 0 {
+		return nil, fmt.Errorf("jobs query needs a positive limit, got %d", query.Limit)
+	}
+	if query.From.IsZero() || query.To.IsZero() || query.To.Before(query.From) {
+		return nil, fmt.Errorf("jobs query needs a time range, got [%v, %v]", query.From, query.To)
+	}
+	var jobs []*JobWithStatusesT
+	dsList := jd.getDSList()
+	for i, queried := len(dsList)-1, 0; i >= 0 && len(jobs) < query.Limit; i-- {
+		if query.MaxDatasets > 0 && queried >= query.MaxDatasets {
+			break
+		}
+		ds := dsList[i]
+		minJobID, maxJobID, err := jd.jobIDRange(ctx, ds, query.From, query.To)
+		if err != nil {
+			return nil, err
+		}
+		if minJobID > maxJobID {
+			continue
+		}
+		queried++
+		dsJobs, err := jd.getJobsWithStatusesDS(ctx, ds, query, minJobID, maxJobID, query.Limit-len(jobs))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, dsJobs...)
+	}
+	return jobs, nil
+}
+
+// jobIDRange returns the range of ids of the jobs of ds created within [from, to], empty if minJobID > maxJobID.
+// Job ids increase along with creation times, so the range is found with binary searches on the primary key.
+func (jd *ReadonlyHandleT) jobIDRange(ctx context.Context, ds dataSetT, from, to time.Time) (minJobID, maxJobID int64, err error) {
+	var first, last sql.NullInt64
+	sqlStatement := fmt.Sprintf(`SELECT (SELECT job_id FROM "%[1]s" ORDER BY job_id ASC LIMIT 1), (SELECT job_id FROM "%[1]s" ORDER BY job_id DESC LIMIT 1)`, ds.JobTable)
+	if err := jd.DbHandle.QueryRowContext(ctx, sqlStatement).Scan(&first, &last); err != nil {
+		return 0, -1, err
+	}
+	if !first.Valid || !last.Valid {
+		return 0, -1, nil
+	}
+	if minJobID, err = jd.searchJobID(ctx, ds, first.Int64, last.Int64, func(createdAt time.Time) bool { return !createdAt.Before(from) }); err != nil {
+		return 0, -1, err
+	}
+	afterRange, err := jd.searchJobID(ctx, ds, minJobID, last.Int64, func(createdAt time.Time) bool { return createdAt.After(to) })
+	if err != nil {
+		return 0, -1, err
+	}
+	return minJobID, afterRange - 1, nil
+}
+
+// searchJobID returns the id of the first job of ds within [lo, hi] whose creation time satisfies reached, hi+1 if there is none.
+// reached must be monotonic along job ids.
+func (jd *ReadonlyHandleT) searchJobID(ctx context.Context, ds dataSetT, lo, hi int64, reached func(createdAt time.Time) bool) (int64, error) {
+	sqlStatement := fmt.Sprintf(`SELECT job_id, created_at FROM "%s" WHERE job_id >= $1 AND job_id <= $2 ORDER BY job_id ASC LIMIT 1`, ds.JobTable)
+	found := hi + 1
+	for lo <= hi {
+		mid := lo + (hi-lo)/2
+		var jobID int64
+		var createdAt time.Time
+		err := jd.DbHandle.QueryRowContext(ctx, sqlStatement, mid, hi).Scan(&jobID, &createdAt)
+		if err == sql.ErrNoRows {
+			hi = mid - 1
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if reached(createdAt) {
+			found, hi = jobID, mid-1
+		} else {
+			lo = jobID + 1
+		}
+	}
+	return found, nil
+}
+
+// jobsQueryConditions returns the conditions of query on the jobs of a dataset within [minJobID, maxJobID], along with their arguments
+func jobsQueryConditions(query JobsQueryT, minJobID, maxJobID int64) (string, []interface{}) {
+	args := []interface{}{minJobID, maxJobID}
+	conditions := []string{`job_id BETWEEN $1 AND $2`}
+	if len(query.EventPayloadContains) > 0 {
+		args = append(args, pq.Array(query.EventPayloadContains))
+		conditions = append(conditions, fmt.Sprintf(`event_payload @> ANY($%d::jsonb[])`, len(args)))
+	}
+	if len(query.ParametersContain) > 0 {
+		args = append(args, pq.Array(query.ParametersContain))
+		conditions = append(conditions, fmt.Sprintf(`parameters @> ANY($%d::jsonb[])`, len(args)))
+	}
+	args = append(args, query.From, query.To)
+	conditions = append(conditions, fmt.Sprintf(`created_at BETWEEN $%d AND $%d`, len(args)-1, len(args)))
+	return strings.Join(conditions, " AND "), args
+}
+
+func (jd *ReadonlyHandleT) getJobsWithStatusesDS(ctx context.Context, ds dataSetT, query JobsQueryT, minJobID, maxJobID int64, limit int) ([]*JobWithStatusesT, error) {
+	conditions, args := jobsQueryConditions(query, minJobID, maxJobID)
+	args = append(args, limit)
+	sqlStatement := fmt.Sprintf(`SELECT job_id, uuid, user_id, parameters, custom_val, event_payload, event_count, created_at, expire_at, workspace_id
+		FROM "%[1]s" WHERE %[2]s ORDER BY job_id DESC LIMIT $%[3]d`, ds.JobTable, conditions, len(args))
+	rows, err := jd.DbHandle.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*JobWithStatusesT
+	jobsByID := make(map[int64]*JobWithStatusesT)
+	var jobIDs []int64
+	for rows.Next() {
+		job := &JobWithStatusesT{}
+		err := rows.Scan(&job.JobID, &job.UUID, &job.UserID, &job.Parameters, &job.CustomVal, &job.EventPayload, &job.EventCount,
+			&job.CreatedAt, &job.ExpireAt, &job.WorkspaceId)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+		jobsByID[job.JobID] = job
+		jobIDs = append(jobIDs, job.JobID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	sqlStatement = fmt.Sprintf(`SELECT job_id, job_state, attempt, exec_time, retry_time, error_code, error_response, parameters
+		FROM "%s" WHERE job_id = ANY($1) ORDER BY id ASC`, ds.JobStatusTable)
+	statusRows, err := jd.DbHandle.QueryContext(ctx, sqlStatement, pq.Array(jobIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer statusRows.Close()
+	for statusRows.Next() {
+		var status JobStatusT
+		var errorCode sql.NullString
+		err := statusRows.Scan(&status.JobID, &status.JobState, &status.AttemptNum, &status.ExecTime, &status.RetryTime,
+			&errorCode, &status.ErrorResponse, &status.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		status.ErrorCode = errorCode.String
+		job := jobsByID[status.JobID]
+		status.WorkspaceId = job.WorkspaceId
+		job.Statuses = append(job.Statuses, status)
+		job.LastJobStatus = status
+	}
+	return jobs, statusRows.Err()
+}
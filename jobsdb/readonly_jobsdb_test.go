@@ -2,8 +2,10 @@ package jobsdb
 
 import (
 	"fmt"
+	"time"
 
 	uuid "github.com/gofrs/uuid"
+	"github.com/lib/pq"
 	. "github.com/onsi/ginkgo"
 
 	. "github.com/onsi/gomega"
@@ -55,6 +57,28 @@ var _ = Describe("readonly_jobsdb", func() {
 			Expect(getStatusPrefix("batch_rt")).To(Equal("batch_rt_job_status_"))
 		})
 	})
+
+	Context("jobsQueryConditions", func() {
+		It("should match any value of every list, within the range of job ids and the time range", func() {
+			from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+			to := from.Add(time.Hour)
+			conditions, args := jobsQueryConditions(JobsQueryT{
+				EventPayloadContains: []string{`{"batch":[{"messageId":"m1"}]}`},
+				ParametersContain:    []string{`{"message_id":"m1"}`, `{"message_id":"m2"}`},
+				From:                 from,
+				To:                   to,
+			}, 10, 20)
+			Expect(conditions).To(Equal(`job_id BETWEEN $1 AND $2 AND event_payload @> ANY($3::jsonb[]) AND parameters @> ANY($4::jsonb[]) AND created_at BETWEEN $5 AND $6`))
+			Expect(args).To(Equal([]interface{}{
+				int64(10),
+				int64(20),
+				pq.Array([]string{`{"batch":[{"messageId":"m1"}]}`}),
+				pq.Array([]string{`{"message_id":"m1"}`, `{"message_id":"m2"}`}),
+				from,
+				to,
+			}))
+		})
+	})
 })
 
 var userJobs = []*JobT{
@@ -69,8 +69,13 @@ import (
 
 	destination_connection_tester "github.com/rudderlabs/rudder-server/services/destination-connection-tester"
 	"github.com/rudderlabs/rudder-server/services/diagnostics"
+	"github.com/rudderlabs/rudder-server/services/journey"
+	"github.com/rudderlabs/rudder-server/services/livetail"
 	"github.com/rudderlabs/rudder-server/services/pgnotifier"
+	"github.com/rudderlabs/rudder-server/services/replay"
+	"github.com/rudderlabs/rudder-server/services/reporting"
 	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
@@ -161,6 +166,7 @@ func runAllInit() {
 	logger.Init()
 	misc.Init()
 	stats.Init()
+	tracing.Init()
 	db.Init()
 	diagnostics.Init()
 	backendconfig.Init()
@@ -173,6 +179,10 @@ func runAllInit() {
 	jobsdb.Init()
 	jobsdb.Init2()
 	jobsdb.Init3()
+	replay.Init()
+	reporting.Init()
+	livetail.Init()
+	journey.Init()
 	destination_connection_tester.Init()
 	warehouse.Init()
 	warehouse.Init2()
@@ -265,6 +275,7 @@ func Run(ctx context.Context) {
 
 	//Creating Stats Client should be done right after setting up logger and before setting up other modules.
 	stats.Setup()
+	tracing.Setup()
 
 	if !enableSuppressUserFeature || application.Features().SuppressUser == nil {
 		pkgLogger.Info("Suppress User feature is either disabled or enterprise only. Unable to poll regulations.")
@@ -278,6 +289,8 @@ func Run(ctx context.Context) {
 	backendconfig.Setup(configEnvHandler)
 	backendconfig.DefaultBackendConfig.StartPolling(backendconfig.GetWorkspaceToken())
 	g, ctx := errgroup.WithContext(ctx)
+	// the gateway admin server only reaches the events of the gateway's process, every process serves them on its admin interface
+	admin.RegisterHTTPHandler("/v1/tail", livetail.Handler(ctx))
 	g.Go(func() error {
 		return admin.StartServer(ctx)
 	})
@@ -340,6 +353,7 @@ func Run(ctx context.Context) {
 		fmt.Print("\n\n")
 
 		application.Stop()
+		tracing.Stop()
 		if logger.Log != nil {
 			logger.Log.Sync()
 		}
@@ -355,6 +369,7 @@ func Run(ctx context.Context) {
 	}
 
 	application.Stop()
+	tracing.Stop()
 
 	pkgLogger.Infof(
 		"Graceful terminal after %s, with %d go-routines",
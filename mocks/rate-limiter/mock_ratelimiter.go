@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	ratelimiter "github.com/rudderlabs/rudder-server/rate-limiter"
 )
 
 // MockRateLimiter is a mock of RateLimiter interface.
@@ -34,15 +35,15 @@ func (m *MockRateLimiter) EXPECT() *MockRateLimiterMockRecorder {
 }
 
 // LimitReached mocks base method.
-func (m *MockRateLimiter) LimitReached(arg0 string) bool {
+func (m *MockRateLimiter) LimitReached(arg0 ratelimiter.KeysT, arg1 int) ratelimiter.LimitStatusT {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LimitReached", arg0)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "LimitReached", arg0, arg1)
+	ret0, _ := ret[0].(ratelimiter.LimitStatusT)
 	return ret0
 }
 
 // LimitReached indicates an expected call of LimitReached.
-func (mr *MockRateLimiterMockRecorder) LimitReached(arg0 interface{}) *gomock.Call {
+func (mr *MockRateLimiterMockRecorder) LimitReached(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LimitReached", reflect.TypeOf((*MockRateLimiter)(nil).LimitReached), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LimitReached", reflect.TypeOf((*MockRateLimiter)(nil).LimitReached), arg0, arg1)
 }
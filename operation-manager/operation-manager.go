@@ -16,6 +16,12 @@ var (
 	OperationManager        OperationManagerI
 	pkgLogger               logger.LoggerI
 	enableOperationsManager bool
+	progressUpdateInterval  time.Duration
+)
+
+const (
+	ClearOperation         = "CLEAR"
+	ReplayAbortedOperation = "REPLAY_ABORTED"
 )
 
 type OperationtT struct {
@@ -27,7 +33,7 @@ type OperationtT struct {
 }
 
 type OperationManagerI interface {
-	InsertOperation(payload []byte) (int64, error)
+	InsertOperation(operation string, payload []byte) (int64, error)
 	StartProcessLoop(ctx context.Context) error
 	GetOperationStatus(opID int64) (bool, string)
 }
@@ -42,9 +48,15 @@ type OperationHandlerI interface {
 	Exec(payload []byte) error
 }
 
+// OperationProgressI is implemented by handlers of long running operations, whose progress is reported through the operation status
+type OperationProgressI interface {
+	Progress() string
+}
+
 func Init2() {
 	pkgLogger = logger.NewLogger().Child("operationmanager")
 	config.RegisterBoolConfigVariable(true, &enableOperationsManager, false, "Operations.enabled")
+	config.RegisterDurationConfigVariable(time.Duration(5), &progressUpdateInterval, true, time.Second, "Operations.progressUpdateInterval")
 }
 
 func Setup(gatewayDB, routerDB, batchRouterDB jobsdb.JobsDB) {
@@ -70,7 +82,7 @@ func GetOperationManager() OperationManagerI {
 	return OperationManager
 }
 
-func (om *OperationManagerT) InsertOperation(payload []byte) (int64, error) {
+func (om *OperationManagerT) InsertOperation(operation string, payload []byte) (int64, error) {
 	if !enableOperationsManager {
 		return -1, fmt.Errorf("operation manager is disabled")
 	}
@@ -85,7 +97,7 @@ func (om *OperationManagerT) InsertOperation(payload []byte) (int64, error) {
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow("CLEAR", payload, false, "queued")
+	row := stmt.QueryRow(operation, payload, false, "queued")
 	var opID int64
 	err = row.Scan(&opID)
 	if err != nil {
@@ -104,9 +116,15 @@ func (om *OperationManagerT) MarkOperationStart(opID int64) error {
 	return nil
 }
 
+func (om *OperationManagerT) UpdateOperationStatus(opID int64, status string) error {
+	sqlStatement := `UPDATE operations SET op_status=$2 WHERE id=$1`
+	_, err := om.dbHandle.Exec(sqlStatement, opID, truncateStatus(status))
+	return err
+}
+
 func (om *OperationManagerT) MarkOperationDone(opID int64, status string) error {
 	sqlStatement := `UPDATE operations SET done=$2, op_status=$4, end_time=$3 WHERE id=$1`
-	_, err := om.dbHandle.Exec(sqlStatement, opID, true, time.Now().UTC(), status)
+	_, err := om.dbHandle.Exec(sqlStatement, opID, true, time.Now().UTC(), truncateStatus(status))
 	if err != nil {
 		return err
 	}
@@ -193,20 +211,56 @@ func (om *OperationManagerT) processOperation() {
 		pkgLogger.Errorf("No handler found for operation: %s", op.Operation)
 		status = "dropped"
 	} else {
+		progressHandler, reportsProgress := opHandler.(OperationProgressI)
+		stopProgressUpdates := make(chan struct{})
+		progressUpdatesStopped := make(chan struct{})
+		go func() {
+			defer close(progressUpdatesStopped)
+			if !reportsProgress {
+				return
+			}
+			for {
+				select {
+				case <-stopProgressUpdates:
+					return
+				case <-time.After(progressUpdateInterval):
+					if progress := progressHandler.Progress(); progress != "" {
+						om.UpdateOperationStatus(op.ID, "executing: "+progress)
+					}
+				}
+			}
+		}()
+
 		err := opHandler.Exec(op.Payload)
+		close(stopProgressUpdates)
+		<-progressUpdatesStopped
 		if err != nil {
 			pkgLogger.Errorf("Operation(%s) execution failed with error: %w", op.Operation, err)
 			status = "failed"
 		}
+		if reportsProgress && progressHandler.Progress() != "" {
+			status += ": " + progressHandler.Progress()
+		}
 	}
 
 	om.MarkOperationDone(op.ID, status)
 }
 
 func (om *OperationManagerT) getHandler(operation string) OperationHandlerI {
-	if operation == "CLEAR" {
+	switch operation {
+	case ClearOperation:
 		return GetClearOperationHandlerInstance(om.gatewayDB, om.routerDB, om.batchRouterDB)
+	case ReplayAbortedOperation:
+		return NewReplayAbortedOperationHandler(om.routerDB)
 	}
 
 	return nil
 }
+
+// truncateStatus truncates the status to the size of the op_status column
+func truncateStatus(status string) string {
+	if len(status) > 128 {
+		return status[:128]
+	}
+	return status
+}
@@ -0,0 +1,140 @@
+package operationmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/rudderlabs/rudder-server/jobsdb"
+)
+
+// ReplayAbortedOperationHandlerT re-enqueues aborted router jobs of a destination as new unprocessed jobs,
+// e.g. after fixing the configuration of the destination that caused them to be aborted
+type ReplayAbortedOperationHandlerT struct {
+	routerDB jobsdb.JobsDB
+
+	progressLock sync.RWMutex
+	progress     string
+}
+
+type ReplayAbortedRequestPayload struct {
+	DestinationID string    `json:"destination_id"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	ErrorCodes    []string  `json:"error_codes"`
+	DryRun        bool      `json:"dry_run"`
+}
+
+// Validate checks that the payload identifies the jobs to replay
+func (payload *ReplayAbortedRequestPayload) Validate() error {
+	if payload.DestinationID == "" {
+		return errors.New("destination id not provided")
+	}
+	if !payload.To.IsZero() && payload.To.Before(payload.From) {
+		return errors.New("to is before from")
+	}
+	return nil
+}
+
+func (payload *ReplayAbortedRequestPayload) matches(job *jobsdb.JobT) bool {
+	if job.CreatedAt.Before(payload.From) {
+		return false
+	}
+	if !payload.To.IsZero() && !job.CreatedAt.Before(payload.To) {
+		return false
+	}
+	if len(payload.ErrorCodes) == 0 {
+		return true
+	}
+	for _, errorCode := range payload.ErrorCodes {
+		if job.LastJobStatus.ErrorCode == errorCode {
+			return true
+		}
+	}
+	return false
+}
+
+func NewReplayAbortedOperationHandler(routerDB jobsdb.JobsDB) *ReplayAbortedOperationHandlerT {
+	return &ReplayAbortedOperationHandlerT{routerDB: routerDB}
+}
+
+func (handler *ReplayAbortedOperationHandlerT) Exec(payload []byte) error {
+	var reqPayload ReplayAbortedRequestPayload
+	err := json.Unmarshal(payload, &reqPayload)
+	if err != nil {
+		return err
+	}
+	if err := reqPayload.Validate(); err != nil {
+		return err
+	}
+
+	parameterFilters := []jobsdb.ParameterFilterT{{
+		Name:     "destination_id",
+		Value:    reqPayload.DestinationID,
+		Optional: false,
+	}}
+
+	var scanned, replayed int
+	var afterJobID int64
+	for {
+		// aborted jobs stay aborted after being replayed, so we page through them by job id
+		abortedList := handler.routerDB.GetProcessed(jobsdb.GetQueryParamsT{
+			StateFilters:     []string{jobsdb.Aborted.State},
+			ParameterFilters: parameterFilters,
+			JobCount:         jobQueryBatchSize,
+			AfterJobID:       afterJobID,
+		})
+		if len(abortedList) == 0 {
+			break
+		}
+		afterJobID = abortedList[len(abortedList)-1].JobID
+		scanned += len(abortedList)
+
+		var replayList []*jobsdb.JobT
+		for _, job := range abortedList {
+			if !reqPayload.matches(job) {
+				continue
+			}
+			replayList = append(replayList, &jobsdb.JobT{
+				UUID:         uuid.Must(uuid.NewV4()),
+				UserID:       job.UserID,
+				CustomVal:    job.CustomVal,
+				Parameters:   job.Parameters,
+				EventPayload: job.EventPayload,
+				EventCount:   job.EventCount,
+				WorkspaceId:  job.WorkspaceId,
+			})
+		}
+		if len(replayList) > 0 && !reqPayload.DryRun {
+			if err := handler.routerDB.Store(replayList); err != nil {
+				return fmt.Errorf("storing replayed jobs of destination %s: %w", reqPayload.DestinationID, err)
+			}
+		}
+		replayed += len(replayList)
+		handler.setProgress(reqPayload.DryRun, replayed, scanned)
+	}
+	handler.setProgress(reqPayload.DryRun, replayed, scanned)
+	pkgLogger.Infof("ReplayAbortedManager: %s for destination %s", handler.Progress(), reqPayload.DestinationID)
+	return nil
+}
+
+func (handler *ReplayAbortedOperationHandlerT) setProgress(dryRun bool, replayed, scanned int) {
+	handler.progressLock.Lock()
+	defer handler.progressLock.Unlock()
+	if dryRun {
+		handler.progress = fmt.Sprintf("dry run, %d of %d aborted jobs to replay", replayed, scanned)
+	} else {
+		handler.progress = fmt.Sprintf("%d of %d aborted jobs replayed", replayed, scanned)
+	}
+}
+
+// Progress returns the number of jobs replayed so far
+func (handler *ReplayAbortedOperationHandlerT) Progress() string {
+	handler.progressLock.RLock()
+	defer handler.progressLock.RUnlock()
+	return handler.progress
+}
@@ -0,0 +1,92 @@
+package operationmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	mocksJobsDB "github.com/rudderlabs/rudder-server/mocks/jobsdb"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+func TestReplayAbortedOperationHandler(t *testing.T) {
+	config.Load()
+	logger.Init()
+	Init()
+	Init2()
+	jobQueryBatchSize = 2
+
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	abortedJob := func(jobID int64, createdAt time.Time, errorCode string) *jobsdb.JobT {
+		return &jobsdb.JobT{
+			JobID:         jobID,
+			UserID:        "u1",
+			CustomVal:     "WEBHOOK",
+			CreatedAt:     createdAt,
+			EventCount:    1,
+			EventPayload:  []byte(`{"type":"track"}`),
+			Parameters:    []byte(`{"source_id":"s1","destination_id":"d1"}`),
+			WorkspaceId:   "w1",
+			LastJobStatus: jobsdb.JobStatusT{JobState: jobsdb.Aborted.State, ErrorCode: errorCode},
+		}
+	}
+	pages := [][]*jobsdb.JobT{
+		{abortedJob(1, from.Add(-time.Hour), "400"), abortedJob(2, from.Add(time.Hour), "400")},
+		{abortedJob(5, from.Add(2*time.Hour), "410"), abortedJob(6, from.Add(48*time.Hour), "400")},
+	}
+	payload := []byte(`{"destination_id":"d1","from":"2022-01-01T00:00:00Z","to":"2022-01-02T00:00:00Z","error_codes":["400"]}`)
+
+	expectPages := func(routerDB *mocksJobsDB.MockJobsDB) {
+		for i, afterJobID := range []int64{0, 2, 6} {
+			var page []*jobsdb.JobT
+			if i < len(pages) {
+				page = pages[i]
+			}
+			routerDB.EXPECT().GetProcessed(jobsdb.GetQueryParamsT{
+				StateFilters:     []string{jobsdb.Aborted.State},
+				ParameterFilters: []jobsdb.ParameterFilterT{{Name: "destination_id", Value: "d1"}},
+				JobCount:         2,
+				AfterJobID:       afterJobID,
+			}).Return(page).Times(1)
+		}
+	}
+
+	t.Run("replays matching aborted jobs as new jobs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		routerDB := mocksJobsDB.NewMockJobsDB(ctrl)
+		expectPages(routerDB)
+		routerDB.EXPECT().Store(gomock.Any()).Times(1).DoAndReturn(func(jobs []*jobsdb.JobT) error {
+			require.Len(t, jobs, 1)
+			require.Zero(t, jobs[0].JobID)
+			require.Equal(t, "WEBHOOK", jobs[0].CustomVal)
+			require.JSONEq(t, `{"source_id":"s1","destination_id":"d1"}`, string(jobs[0].Parameters))
+			require.JSONEq(t, `{"type":"track"}`, string(jobs[0].EventPayload))
+			require.Equal(t, "w1", jobs[0].WorkspaceId)
+			return nil
+		})
+
+		handler := NewReplayAbortedOperationHandler(routerDB)
+		require.NoError(t, handler.Exec(payload))
+		require.Equal(t, "1 of 4 aborted jobs replayed", handler.Progress())
+	})
+
+	t.Run("dry run only counts", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		routerDB := mocksJobsDB.NewMockJobsDB(ctrl)
+		expectPages(routerDB)
+
+		handler := NewReplayAbortedOperationHandler(routerDB)
+		require.NoError(t, handler.Exec([]byte(`{"destination_id":"d1","dry_run":true}`)))
+		require.Equal(t, "dry run, 4 of 4 aborted jobs to replay", handler.Progress())
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		handler := NewReplayAbortedOperationHandler(nil)
+		require.Error(t, handler.Exec([]byte(`{"from":"2022-01-01T00:00:00Z"}`)))
+		require.Error(t, handler.Exec([]byte(`{"destination_id":"d1","from":"2022-01-02T00:00:00Z","to":"2022-01-01T00:00:00Z"}`)))
+	})
+}
@@ -0,0 +1,291 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"strings"
+
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/processor/transformer"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+	"github.com/rudderlabs/rudder-server/utils/types"
+)
+
+// Reasons of events dropped by the event filter of a destination
+const (
+	eventFilterReasonEventType = "event_type"
+	eventFilterReasonEventName = "event_name"
+	eventFilterReasonCondition = "condition"
+	eventFilterReasonSampling  = "sampling"
+)
+
+// eventFilterT is the compiled backendconfig.EventFilterT of a destination
+type eventFilterT struct {
+	allowEventTypes    []string
+	denyEventTypes     []string
+	allowEventNames    []string
+	denyEventNames     []string
+	conditions         []eventFilterConditionT
+	samplingPercentage *float64
+}
+
+type eventFilterConditionT struct {
+	path     []string
+	operator string
+	value    interface{}
+	regexp   *regexp.Regexp
+}
+
+func newEventFilter(filter *backendconfig.EventFilterT) (*eventFilterT, error) {
+	eventFilter := &eventFilterT{
+		allowEventTypes:    lowerCase(filter.AllowEventTypes),
+		denyEventTypes:     lowerCase(filter.DenyEventTypes),
+		allowEventNames:    filter.AllowEventNames,
+		denyEventNames:     filter.DenyEventNames,
+		samplingPercentage: filter.SamplingPercentage,
+	}
+	if p := filter.SamplingPercentage; p != nil && (*p < 0 || *p > 100) {
+		return nil, fmt.Errorf("sampling percentage %v is not between 0 and 100", *p)
+	}
+	for idx, condition := range filter.Conditions {
+		if condition.Path == "" {
+			return nil, fmt.Errorf("condition %d: empty path", idx)
+		}
+		compiled := eventFilterConditionT{
+			path:     strings.Split(condition.Path, "."),
+			operator: condition.Operator,
+			value:    condition.Value,
+		}
+		switch condition.Operator {
+		case "eq", "neq", "exists", "notExists", "contains":
+		case "in", "nin":
+			if _, ok := condition.Value.([]interface{}); !ok {
+				return nil, fmt.Errorf("condition %d: operator %s requires a list of values", idx, condition.Operator)
+			}
+		case "gt", "gte", "lt", "lte":
+			if _, ok := toFloat(condition.Value); !ok {
+				return nil, fmt.Errorf("condition %d: operator %s requires a number", idx, condition.Operator)
+			}
+		case "regex":
+			pattern, ok := condition.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("condition %d: operator regex requires a string", idx)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("condition %d: %w", idx, err)
+			}
+			compiled.regexp = re
+		default:
+			return nil, fmt.Errorf("condition %d: invalid operator %q", idx, condition.Operator)
+		}
+		eventFilter.conditions = append(eventFilter.conditions, compiled)
+	}
+	return eventFilter, nil
+}
+
+// filteredReason returns why the event is dropped, or an empty string if it is kept
+func (f *eventFilterT) filteredReason(event types.SingularEventT, messageID string) string {
+	eventType, _ := event["type"].(string)
+	eventType = strings.ToLower(strings.TrimSpace(eventType))
+	if (len(f.allowEventTypes) > 0 && !misc.ContainsString(f.allowEventTypes, eventType)) || misc.ContainsString(f.denyEventTypes, eventType) {
+		return eventFilterReasonEventType
+	}
+	eventName, _ := event["event"].(string)
+	if (len(f.allowEventNames) > 0 && !misc.ContainsString(f.allowEventNames, eventName)) || misc.ContainsString(f.denyEventNames, eventName) {
+		return eventFilterReasonEventName
+	}
+	for _, condition := range f.conditions {
+		if !condition.matches(event) {
+			return eventFilterReasonCondition
+		}
+	}
+	if f.samplingPercentage != nil {
+		// sampled by message id, so that an event is consistently kept or dropped
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(messageID))
+		if float64(hash.Sum32()%10000) >= *f.samplingPercentage*100 {
+			return eventFilterReasonSampling
+		}
+	}
+	return ""
+}
+
+func (condition eventFilterConditionT) matches(event types.SingularEventT) bool {
+	value, exists := lookupPath(event, condition.path)
+	switch condition.operator {
+	case "exists":
+		return exists
+	case "notExists":
+		return !exists
+	case "eq":
+		return exists && valuesEqual(value, condition.value)
+	case "neq":
+		return !exists || !valuesEqual(value, condition.value)
+	case "in", "nin":
+		in := false
+		for _, v := range condition.value.([]interface{}) {
+			if exists && valuesEqual(value, v) {
+				in = true
+				break
+			}
+		}
+		return in == (condition.operator == "in")
+	case "gt", "gte", "lt", "lte":
+		number, ok := toFloat(value)
+		if !exists || !ok {
+			return false
+		}
+		threshold, _ := toFloat(condition.value)
+		switch condition.operator {
+		case "gt":
+			return number > threshold
+		case "gte":
+			return number >= threshold
+		case "lt":
+			return number < threshold
+		default:
+			return number <= threshold
+		}
+	case "contains":
+		switch v := value.(type) {
+		case string:
+			s, ok := condition.value.(string)
+			return ok && strings.Contains(v, s)
+		case []interface{}:
+			for _, element := range v {
+				if valuesEqual(element, condition.value) {
+					return true
+				}
+			}
+		}
+		return false
+	case "regex":
+		s, ok := value.(string)
+		return ok && condition.regexp.MatchString(s)
+	}
+	return false
+}
+
+func lookupPath(event map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = event
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func lowerCase(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(value)))
+	}
+	return lowered
+}
+
+// compileEventFilter compiles the event filter of a destination into destinationEventFilterMap, once per backend config update.
+// Invalid event filters are logged and ignored. Must be called while holding configSubscriberLock.
+func (proc *HandleT) compileEventFilter(destination backendconfig.DestinationT) {
+	if destination.EventFilter == nil {
+		return
+	}
+	if _, ok := destinationEventFilterMap[destination.ID]; ok {
+		return
+	}
+	eventFilter, err := newEventFilter(destination.EventFilter)
+	if err != nil {
+		proc.logger.Errorf("Ignoring invalid event filter of destination %s: %v", destination.ID, err)
+	}
+	destinationEventFilterMap[destination.ID] = eventFilter
+}
+
+// filterEvents drops the events of a destination not kept by its event filter, before any transformation.
+// Dropped events are removed from inCountMap, so that the diffs of next stages only account for kept events.
+func (proc *HandleT) filterEvents(sourceID, workspaceID string, destination backendconfig.DestinationT, eventList []transformer.TransformerEventT, trackingPlanEnabled bool, inCountMap map[string]int64) ([]transformer.TransformerEventT, []*types.PUReportedMetric) {
+	configSubscriberLock.RLock()
+	eventFilter := destinationEventFilterMap[destination.ID]
+	configSubscriberLock.RUnlock()
+	if eventFilter == nil {
+		return eventList, nil
+	}
+
+	filteredEventsStats := make(map[string]stats.RudderStats)
+	connectionDetailsMap := make(map[string]*types.ConnectionDetails)
+	statusDetailsMap := make(map[string]*types.StatusDetail)
+	filteredCountMap := make(map[string]int64)
+	keptEvents := make([]transformer.TransformerEventT, 0, len(eventList))
+	for i := range eventList {
+		event := &eventList[i]
+		reason := eventFilter.filteredReason(event.Message, event.Metadata.MessageID)
+		if reason == "" {
+			keptEvents = append(keptEvents, *event)
+			continue
+		}
+		if _, ok := filteredEventsStats[reason]; !ok {
+			tags := buildStatTags(sourceID, workspaceID, destination, EVENT_FILTER)
+			tags["reason"] = reason
+			filteredEventsStats[reason] = proc.statsFactory.NewTaggedStat("proc_event_filter_filtered_events", stats.CountType, tags)
+		}
+		filteredEventsStats[reason].Increment()
+		if proc.isReportingEnabled() {
+			filteredEvent := transformer.TransformerResponseT{Metadata: event.Metadata, Error: "filtered by " + strings.ReplaceAll(reason, "_", " ")}
+			proc.updateMetricMaps(nil, filteredCountMap, connectionDetailsMap, statusDetailsMap, filteredEvent, types.EventFilteredStatus, []byte(`{}`))
+			key := strings.Join([]string{
+				event.Metadata.SourceID,
+				event.Metadata.DestinationID,
+				event.Metadata.SourceBatchID,
+				event.Metadata.EventName,
+				event.Metadata.EventType,
+			}, METRICKEYDELIMITER)
+			inCountMap[key]--
+		}
+	}
+
+	var filteredMetrics []*types.PUReportedMetric
+	if proc.isReportingEnabled() {
+		inPU := types.DESTINATION_FILTER
+		if trackingPlanEnabled {
+			inPU = types.TRACKINGPLAN_VALIDATOR
+		}
+		types.AssertSameKeys(connectionDetailsMap, statusDetailsMap)
+		for k, cd := range connectionDetailsMap {
+			filteredMetrics = append(filteredMetrics, &types.PUReportedMetric{
+				ConnectionDetails: *cd,
+				PUDetails:         *types.CreatePUDetails(inPU, types.EVENT_FILTER, false, false),
+				StatusDetail:      statusDetailsMap[k],
+			})
+		}
+	}
+	return keptEvents, filteredMetrics
+}
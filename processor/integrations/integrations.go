@@ -159,6 +159,65 @@ func FilterClientIntegrations(clientEvent types.SingularEventT, destNameIDMap ma
 	return
 }
 
+//GetDeniedConsentCategories returns the consent category ids denied by the user,
+//as sent by consent managers like OneTrust in context.consentManagement.deniedConsentIds
+func GetDeniedConsentCategories(clientEvent types.SingularEventT) []string {
+	deniedConsentIDs, ok := misc.MapLookup(clientEvent, "context", "consentManagement", "deniedConsentIds").([]interface{})
+	if !ok {
+		return nil
+	}
+	var deniedCategories []string
+	for _, deniedConsentID := range deniedConsentIDs {
+		if category, ok := deniedConsentID.(string); ok && strings.TrimSpace(category) != "" {
+			deniedCategories = append(deniedCategories, strings.TrimSpace(category))
+		}
+	}
+	return deniedCategories
+}
+
+//GetConsentCategories returns the consent category ids the destination requires,
+//set in its config as oneTrustCookieCategories: [{"oneTrustCookieCategory": "C0004"}]
+func GetConsentCategories(destination backendconfig.DestinationT) []string {
+	cookieCategories, ok := destination.Config["oneTrustCookieCategories"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var categories []string
+	for _, cookieCategory := range cookieCategories {
+		cookieCategoryMap, ok := cookieCategory.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if category, ok := cookieCategoryMap["oneTrustCookieCategory"].(string); ok && strings.TrimSpace(category) != "" {
+			categories = append(categories, strings.TrimSpace(category))
+		}
+	}
+	return categories
+}
+
+//FilterConsentedDestinations splits destinations into the ones requiring none of the denied consent categories,
+//and the ones requiring at least one of them, which must not receive the event
+func FilterConsentedDestinations(deniedCategories []string, destinations []backendconfig.DestinationT) (consented, denied []backendconfig.DestinationT) {
+	if len(deniedCategories) == 0 {
+		return destinations, nil
+	}
+	for _, destination := range destinations {
+		isDenied := false
+		for _, category := range GetConsentCategories(destination) {
+			if misc.ContainsString(deniedCategories, category) {
+				isDenied = true
+				break
+			}
+		}
+		if isDenied {
+			denied = append(denied, destination)
+		} else {
+			consented = append(consented, destination)
+		}
+	}
+	return consented, denied
+}
+
 //GetTransformerURL gets the transfomer base url endpoint
 func GetTransformerURL() string {
 	return destTransformURL
@@ -17,10 +17,10 @@ type LifecycleManager struct {
 	mainCtx          context.Context
 	currentCancel    context.CancelFunc
 	waitGroup        *errgroup.Group
-	gatewayDB        *jobsdb.HandleT
-	routerDB         *jobsdb.HandleT
-	batchRouterDB    *jobsdb.HandleT
-	errDB            *jobsdb.HandleT
+	gatewayDB        jobsdb.JobsDB
+	routerDB         jobsdb.JobsDB
+	batchRouterDB    jobsdb.JobsDB
+	errDB            jobsdb.JobsDB
 	clearDB          *bool
 	MultitenantStats multitenant.MultiTenantI // need not initialize again
 	ReportingI       types.ReportingI         // need not initialize again
@@ -58,7 +58,7 @@ func (proc *LifecycleManager) Stop() {
 }
 
 // New creates a new Processor instance
-func New(ctx context.Context, clearDb *bool, gwDb, rtDb, brtDb, errDb *jobsdb.HandleT, tenantDB multitenant.MultiTenantI, reporting types.ReportingI) *LifecycleManager {
+func New(ctx context.Context, clearDb *bool, gwDb, rtDb, brtDb, errDb jobsdb.JobsDB, tenantDB multitenant.MultiTenantI, reporting types.ReportingI) *LifecycleManager {
 	proc := &LifecycleManager{
 		HandleT:          &HandleT{transformer: transformer.NewTransformer()},
 		mainCtx:          ctx,
@@ -18,6 +18,7 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/rudderlabs/rudder-server/admin"
@@ -34,8 +35,10 @@ import (
 	destinationdebugger "github.com/rudderlabs/rudder-server/services/debugger/destination"
 	transformationdebugger "github.com/rudderlabs/rudder-server/services/debugger/transformation"
 	"github.com/rudderlabs/rudder-server/services/dedup"
+	"github.com/rudderlabs/rudder-server/services/livetail"
 	"github.com/rudderlabs/rudder-server/services/multitenant"
 	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
 	"github.com/rudderlabs/rudder-server/utils/pubsub"
@@ -60,6 +63,7 @@ type HandleT struct {
 	resumeChannel       chan bool
 	backendConfig       backendconfig.BackendConfig
 	transformer         transformer.Transformer
+	localTransformer    *transformer.LocalTransformerT
 	lastJobID           int64
 	gatewayDB           jobsdb.JobsDB
 	routerDB            jobsdb.JobsDB
@@ -163,6 +167,7 @@ type ParametersT struct {
 	SourceCategory          string      `json:"source_category"`
 	RecordID                interface{} `json:"record_id"`
 	WorkspaceId             string      `json:"workspaceId"`
+	TraceParent             string      `json:"traceparent,omitempty"`
 }
 
 type MetricMetadata struct {
@@ -391,6 +396,9 @@ func (proc *HandleT) Setup(
 	proc.backgroundWait = g.Wait
 	proc.backgroundCancel = cancel
 
+	if proc.localTransformer == nil {
+		proc.localTransformer = transformer.NewLocalTransformer()
+	}
 	rruntime.Go(func() {
 		proc.backendConfigSubscriber()
 	})
@@ -456,6 +464,7 @@ var (
 	writeKeyDestinationMap    map[string][]backendconfig.DestinationT
 	writeKeySourceMap         map[string]backendconfig.SourceT
 	destinationIDtoTypeMap    map[string]string
+	destinationEventFilterMap map[string]*eventFilterT
 	batchDestinations         []string
 	configSubscriberLock      sync.RWMutex
 	customDestinations        []string
@@ -595,6 +604,8 @@ func (proc *HandleT) backendConfigSubscriber() {
 		writeKeyDestinationMap = make(map[string][]backendconfig.DestinationT)
 		writeKeySourceMap = map[string]backendconfig.SourceT{}
 		destinationIDtoTypeMap = make(map[string]string)
+		destinationEventFilterMap = make(map[string]*eventFilterT)
+		transformationVersionIDs := make(map[string]bool)
 		sources := config.Data.(backendconfig.ConfigT)
 		for _, source := range sources.Sources {
 			writeKeySourceMap[source.WriteKey] = source
@@ -602,10 +613,15 @@ func (proc *HandleT) backendConfigSubscriber() {
 				writeKeyDestinationMap[source.WriteKey] = source.Destinations
 				for _, destination := range source.Destinations {
 					destinationIDtoTypeMap[destination.ID] = destination.DestinationDefinition.Name
+					proc.compileEventFilter(destination)
+					for _, transformation := range destination.Transformations {
+						transformationVersionIDs[transformation.VersionID] = true
+					}
 				}
 			}
 		}
 		configSubscriberLock.Unlock()
+		proc.localTransformer.Retain(transformationVersionIDs)
 	}
 }
 
@@ -698,6 +714,7 @@ func makeCommonMetadataFromSingularEvent(singularEvent types.SingularEventT, bat
 	commonMetadata.EventName, _ = misc.MapLookup(singularEvent, "event").(string)
 	commonMetadata.EventType, _ = misc.MapLookup(singularEvent, "type").(string)
 	commonMetadata.SourceDefinitionID = source.SourceDefinition.ID
+	commonMetadata.TraceParent = gjson.GetBytes(batchEvent.Parameters, tracing.TraceParentHeader).Str
 
 	return &commonMetadata
 }
@@ -724,6 +741,7 @@ func enhanceWithMetadata(commonMetadata *transformer.MetadataT, event *transform
 	metadata.EventName = commonMetadata.EventName
 	metadata.EventType = commonMetadata.EventType
 	metadata.SourceDefinitionID = commonMetadata.SourceDefinitionID
+	metadata.TraceParent = commonMetadata.TraceParent
 	metadata.DestinationID = destination.ID
 	metadata.DestinationDefinitionID = destination.DestinationDefinition.ID
 	metadata.DestinationType = destination.DestinationDefinition.Name
@@ -824,6 +842,7 @@ func (proc *HandleT) getDestTransformerEvents(response transformer.ResponseT, co
 		eventMetadata.EventType = userTransformedEvent.Metadata.EventType
 		eventMetadata.SourceDefinitionID = userTransformedEvent.Metadata.SourceDefinitionID
 		eventMetadata.DestinationDefinitionID = userTransformedEvent.Metadata.DestinationDefinitionID
+		eventMetadata.TraceParent = userTransformedEvent.Metadata.TraceParent
 		eventMetadata.SourceCategory = userTransformedEvent.Metadata.SourceCategory
 		updatedEvent := transformer.TransformerEventT{
 			Message:     userTransformedEvent.Output,
@@ -1345,6 +1364,10 @@ func (proc *HandleT) processJobsForDest(subJobs subJob, parsedEventList [][]type
 	reportMetrics = append(reportMetrics, validatedReportMetrics...)
 	//TRACKING PLAN - END
 
+	consentFilteredCountMap := make(map[string]int64)
+	consentFilteredConnectionDetailsMap := make(map[string]*types.ConnectionDetails)
+	consentFilteredStatusDetailsMap := make(map[string]*types.StatusDetail)
+
 	// The below part further segregates events by sourceID and DestinationID.
 	for writeKeyT, eventList := range validatedEventsByWriteKey {
 		for _, event := range eventList {
@@ -1356,10 +1379,21 @@ func (proc *HandleT) processJobsForDest(subJobs subJob, parsedEventList [][]type
 			workspaceID := proc.backendConfig.GetWorkspaceIDForWriteKey(writeKey)
 			workspaceLibraries := proc.backendConfig.GetWorkspaceLibrariesForWorkspaceID(workspaceID)
 
+			deniedConsentCategories := integrations.GetDeniedConsentCategories(singularEvent)
+
 			enabledDestinationsMap := map[string][]backendconfig.DestinationT{}
 			for _, destType := range enabledDestTypes {
-				enabledDestinationsList := getEnabledDestinations(writeKey, destType)
+				enabledDestinationsList, consentFilteredDestinations := integrations.FilterConsentedDestinations(deniedConsentCategories, getEnabledDestinations(writeKey, destType))
 				enabledDestinationsMap[destType] = enabledDestinationsList
+				// events are dropped for destinations requiring consent categories denied by the user
+				for _, destination := range consentFilteredDestinations {
+					if proc.isReportingEnabled() {
+						filteredEvent := transformer.TransformerResponseT{Metadata: event.Metadata}
+						filteredEvent.Metadata.DestinationID = destination.ID
+						filteredEvent.Metadata.DestinationDefinitionID = destination.DestinationDefinition.ID
+						proc.updateMetricMaps(nil, consentFilteredCountMap, consentFilteredConnectionDetailsMap, consentFilteredStatusDetailsMap, filteredEvent, types.ConsentFilteredStatus, []byte(`{}`))
+					}
+				}
 				// Adding a singular event multiple times if there are multiple destinations of same type
 				for _, destination := range enabledDestinationsList {
 					shallowEventCopy := transformer.TransformerEventT{}
@@ -1400,6 +1434,20 @@ func (proc *HandleT) processJobsForDest(subJobs subJob, parsedEventList [][]type
 		}
 	}
 
+	//REPORTING - CONSENT FILTER metrics - START
+	if proc.isReportingEnabled() {
+		types.AssertSameKeys(consentFilteredConnectionDetailsMap, consentFilteredStatusDetailsMap)
+		for k, cd := range consentFilteredConnectionDetailsMap {
+			m := &types.PUReportedMetric{
+				ConnectionDetails: *cd,
+				PUDetails:         *types.CreatePUDetails(types.GATEWAY, types.DESTINATION_FILTER, false, false),
+				StatusDetail:      consentFilteredStatusDetailsMap[k],
+			}
+			reportMetrics = append(reportMetrics, m)
+		}
+	}
+	//REPORTING - CONSENT FILTER metrics - END
+
 	if len(statusList) != len(jobList) {
 		panic(fmt.Errorf("len(statusList):%d != len(jobList):%d", len(statusList), len(jobList)))
 	}
@@ -1444,11 +1492,11 @@ type transformationMessage struct {
 	hasMore bool
 }
 
-func (proc *HandleT) transformations(in transformationMessage) storeMessage {
+func (proc *HandleT) transformations(ctx context.Context, in transformationMessage) storeMessage {
 	//Now do the actual transformation. We call it in batches, once
 	//for each destination ID
 
-	ctx, task := trace.NewTask(context.Background(), "transformations")
+	ctx, task := trace.NewTask(ctx, "transformations")
 	defer task.End()
 
 	var procErrorJobsByDestID = make(map[string][]*jobsdb.JobT)
@@ -1666,6 +1714,45 @@ type transformSrcDestOutput struct {
 	errorsPerDestID map[string][]*jobsdb.JobT
 }
 
+// traceTransformation emits a span of the stage in the trace of every event, failed if the stage failed any event of the trace
+func traceTransformation(stage string, events []transformer.TransformerEventT, response transformer.ResponseT, startedAt time.Time) {
+	if !tracing.Enabled() {
+		return
+	}
+	endedAt := time.Now()
+	failures := make(map[string]string)
+	for i := range response.FailedEvents {
+		failures[response.FailedEvents[i].Metadata.TraceParent] = response.FailedEvents[i].Error
+	}
+	traced := make(map[string]struct{})
+	for i := range events {
+		metadata := &events[i].Metadata
+		if _, ok := traced[metadata.TraceParent]; ok || metadata.TraceParent == "" {
+			continue
+		}
+		traced[metadata.TraceParent] = struct{}{}
+		tracing.RecordSpan(metadata.TraceParent, "processor."+stage, startedAt, endedAt, failures[metadata.TraceParent],
+			attribute.String("sourceId", metadata.SourceID),
+			attribute.String("destinationId", metadata.DestinationID),
+			attribute.String("destType", metadata.DestinationType),
+		)
+	}
+}
+
+// publishUserTransformedEvents publishes the events output by the user transformation to the live tail watchers
+func publishUserTransformedEvents(sourceID, destID string, events []transformer.TransformerEventT) {
+	if !livetail.Watching(livetail.PointUserTransformation, sourceID, destID) {
+		return
+	}
+	for i := range events {
+		message, err := jsonfast.Marshal(events[i].Message)
+		if err != nil {
+			continue
+		}
+		livetail.Publish(livetail.NewEvent(livetail.PointUserTransformation, sourceID, destID, message))
+	}
+}
+
 func (proc *HandleT) transformSrcDest(
 	ctx context.Context,
 	// main inputs
@@ -1732,6 +1819,22 @@ func (proc *HandleT) transformSrcDest(
 	}
 	//REPORTING - END
 
+	//Filtering events based on the event filter of the destination - START
+	if destination.EventFilter != nil {
+		var filteredMetrics []*types.PUReportedMetric
+		eventList, filteredMetrics = proc.filterEvents(sourceID, workspaceID, destination, eventList, trackingPlanEnabled, inCountMap)
+		reportMetrics = append(reportMetrics, filteredMetrics...)
+		if len(eventList) == 0 {
+			return transformSrcDestOutput{
+				destJobs:        destJobs,
+				batchDestJobs:   batchDestJobs,
+				errorsPerDestID: procErrorJobsByDestID,
+				reportMetrics:   reportMetrics,
+			}
+		}
+	}
+	//Filtering events based on the event filter of the destination - END
+
 	url := integrations.GetDestinationURL(destType)
 	var response transformer.ResponseT
 	var eventsToTransform []transformer.TransformerEventT
@@ -1743,7 +1846,12 @@ func (proc *HandleT) transformSrcDest(
 
 		trace.WithRegion(ctx, "UserTransform", func() {
 			startedAt := time.Now()
-			response = proc.transformer.Transform(ctx, eventList, integrations.GetUserTransformURL(), userTransformBatchSize)
+			if transformer.IsLocallyExecutable(destination.Transformations[0]) {
+				response = proc.localTransformer.Transform(ctx, eventList)
+			} else {
+				response = proc.transformer.Transform(ctx, eventList, integrations.GetUserTransformURL(), userTransformBatchSize)
+			}
+			traceTransformation(transformer.UserTransformerStage, eventList, response, startedAt)
 			d := time.Since(startedAt)
 			userTransformationStat.transformTime.SendTiming(d)
 			proc.addToTransformEventByTimePQ(&TransformRequestT{
@@ -1769,6 +1877,7 @@ func (proc *HandleT) transformSrcDest(
 			trace.Logf(ctx, "UserTransform", "User Transform output size: %d", len(eventsToTransform))
 
 			transformationdebugger.UploadTransformationStatus(&transformationdebugger.TransformationStatusT{SourceID: sourceID, DestID: destID, Destination: &destination, UserTransformedEvents: eventsToTransform, EventsByMessageID: eventsByMessageID, FailedEvents: response.FailedEvents, UniqueMessageIds: uniqueMessageIdsBySrcDestKey[srcAndDestKey]})
+			publishUserTransformedEvents(sourceID, destID, eventsToTransform)
 
 			//REPORTING - START
 			if proc.isReportingEnabled() {
@@ -1819,6 +1928,7 @@ func (proc *HandleT) transformSrcDest(
 	s := time.Now()
 	proc.logger.Debug("Supported messages filtering input size", len(eventsToTransform))
 	response = ConvertToFilteredTransformerResponse(eventsToTransform, transformAt != "none")
+	traceTransformation(transformer.EventFilterStage, eventsToTransform, response, s)
 	var successMetrics []*types.PUReportedMetric
 	var successCountMap map[string]int64
 	var successCountMetadataMap map[string]MetricMetadata
@@ -1878,6 +1988,7 @@ func (proc *HandleT) transformSrcDest(
 			proc.logger.Debug("Dest Transform input size", len(eventsToTransform))
 			s := time.Now()
 			response = proc.transformer.Transform(ctx, eventsToTransform, url, transformBatchSize)
+			traceTransformation(transformer.DestTransformerStage, eventsToTransform, response, s)
 
 			destTransformationStat := proc.newDestinationTransformationStat(sourceID, workspaceID, transformAt, destination)
 			destTransformationStat.transformTime.Since(s)
@@ -2001,6 +2112,7 @@ func (proc *HandleT) transformSrcDest(
 				DestinationDefinitionID: destDefID,
 				RecordID:                recordId,
 				WorkspaceId:             workspaceId,
+				TraceParent:             metadata.TraceParent,
 			}
 			marshalledParams, err := jsonfast.Marshal(params)
 			if err != nil {
@@ -2018,6 +2130,11 @@ func (proc *HandleT) transformSrcDest(
 				EventPayload: destEventJSON,
 				WorkspaceId:  workspaceId,
 			}
+			if livetail.Watching(livetail.PointDestinationTransformation, sourceID, destID) {
+				liveEvent := livetail.NewEvent(livetail.PointDestinationTransformation, sourceID, destID, destEventJSON)
+				liveEvent.MessageID, liveEvent.EventName, liveEvent.EventType, liveEvent.RudderID = messageId, eventName, eventType, rudderID
+				livetail.Publish(liveEvent)
+			}
 			if misc.ContainsString(batchDestinations, newJob.CustomVal) {
 				batchDestJobs = append(batchDestJobs, &newJob)
 			} else {
@@ -2196,7 +2313,8 @@ func (proc *HandleT) markExecuting(jobs []*jobsdb.JobT) error {
 
 // handlePendingGatewayJobs is checking for any pending gateway jobs (failed and unprocessed), and routes them appropriately
 // Returns true if any job is handled, otherwise returns false.
-func (proc *HandleT) handlePendingGatewayJobs() bool {
+// Transformations are not stored if ctx is done before they complete, their jobs are processed again on the next start.
+func (proc *HandleT) handlePendingGatewayJobs(ctx context.Context) bool {
 	s := time.Now()
 
 	unprocessedList := proc.getJobs()
@@ -2205,14 +2323,16 @@ func (proc *HandleT) handlePendingGatewayJobs() bool {
 		return false
 	}
 
-	proc.Store(
-		proc.transformations(
-			proc.processJobsForDest(subJob{
-				subJobs: unprocessedList,
-				hasMore: false,
-			}, nil),
-		),
+	transformed := proc.transformations(ctx,
+		proc.processJobsForDest(subJob{
+			subJobs: unprocessedList,
+			hasMore: false,
+		}, nil),
 	)
+	if ctx.Err() != nil {
+		return true
+	}
+	proc.Store(transformed)
 	proc.stats.statLoopTime.Since(s)
 
 	return true
@@ -2239,7 +2359,7 @@ func (proc *HandleT) mainLoop(ctx context.Context) {
 		case <-time.After(mainLoopTimeout):
 			proc.paused = false
 			if isUnLocked {
-				found := proc.handlePendingGatewayJobs()
+				found := proc.handlePendingGatewayJobs(ctx)
 				if found {
 					currLoopSleep = time.Duration(0)
 				} else {
@@ -2405,7 +2525,12 @@ func (proc *HandleT) mainPipeline(ctx context.Context) {
 		defer wg.Done()
 		defer close(chStore)
 		for msg := range chTrans {
-			chStore <- proc.transformations(msg)
+			transformed := proc.transformations(ctx, msg)
+			if ctx.Err() != nil {
+				// transformations may have been cancelled, their jobs are left executing and processed again on the next start
+				continue
+			}
+			chStore <- transformed
 		}
 	}()
 
@@ -169,6 +169,11 @@ var sampleBackendConfig = backendconfig.ConfigT{
 						DisplayName: "enabled-destination-c-definition-display-name",
 						Config:      map[string]interface{}{"transformAtV1": "none"},
 					},
+					Config: map[string]interface{}{
+						"oneTrustCookieCategories": []interface{}{
+							map[string]interface{}{"oneTrustCookieCategory": "C0004"},
+						},
+					},
 				},
 				// This destination should receive no events
 				{
@@ -325,7 +330,7 @@ var _ = Describe("Processor", func() {
 
 			c.mockGatewayJobsDB.EXPECT().GetUnprocessed(jobsdb.GetQueryParamsT{CustomValFilters: gatewayCustomVal, JobCount: c.dbReadBatchSize, EventCount: c.processEventSize}).Return(emptyJobsList).Times(1)
 
-			didWork := processor.handlePendingGatewayJobs()
+			didWork := processor.handlePendingGatewayJobs(context.Background())
 			Expect(didWork).To(Equal(false))
 		})
 
@@ -1059,6 +1064,167 @@ var _ = Describe("Processor", func() {
 		})
 	})
 
+	Context("consent filtering", func() {
+		BeforeEach(func() {
+			c.mockGatewayJobsDB.EXPECT().DeleteExecuting(jobsdb.GetQueryParamsT{CustomValFilters: gatewayCustomVal, JobCount: -1}).Times(1)
+			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return(WorkspaceID).AnyTimes()
+			c.mockBackendConfig.EXPECT().GetWorkspaceLibrariesForWorkspaceID(WorkspaceID).Return(backendconfig.LibrariesT{}).AnyTimes()
+		})
+
+		consentedJob := func(deniedConsentIds string) *jobsdb.JobT {
+			event := `{"rudderId": "some-rudder-id", "messageId": "message-1", "type": "track", "event": "some-event", "context": {"consentManagement": {"deniedConsentIds": ` + deniedConsentIds + `}}}`
+			return &jobsdb.JobT{
+				UUID:         uuid.Must(uuid.NewV4()),
+				JobID:        1010,
+				CustomVal:    gatewayCustomVal[0],
+				EventPayload: []byte(fmt.Sprintf(`{"writeKey": "%s", "batch": [%s], "requestIP": "1.2.3.4", "receivedAt": "2001-01-02T02:23:45.000Z"}`, WriteKeyEnabled, event)),
+				Parameters:   createBatchParameters(SourceIDEnabled),
+			}
+		}
+
+		processJob := func(job *jobsdb.JobT) transformationMessage {
+			mockTransformer := mocksTransformer.NewMockTransformer(c.mockCtrl)
+			mockTransformer.EXPECT().Setup().Times(1)
+			processor := &HandleT{transformer: mockTransformer}
+			Setup(processor, c, false, true)
+			return processor.processJobsForDest(subJob{subJobs: []*jobsdb.JobT{job}}, nil)
+		}
+
+		It("should drop events for destinations requiring denied consent categories and report them", func() {
+			message := processJob(consentedJob(`["C0001", "C0004"]`))
+
+			Expect(message.groupedEvents).To(HaveKey(getKeyFromSourceAndDest(SourceIDEnabled, DestinationIDEnabledA)))
+			Expect(message.groupedEvents).To(HaveKey(getKeyFromSourceAndDest(SourceIDEnabled, DestinationIDEnabledB)))
+			Expect(message.groupedEvents).NotTo(HaveKey(getKeyFromSourceAndDest(SourceIDEnabled, DestinationIDEnabledC)))
+
+			var consentFilteredMetrics []*types.PUReportedMetric
+			for _, metric := range message.reportMetrics {
+				if metric.StatusDetail.Status == types.ConsentFilteredStatus {
+					consentFilteredMetrics = append(consentFilteredMetrics, metric)
+				}
+			}
+			Expect(consentFilteredMetrics).To(HaveLen(1))
+			Expect(consentFilteredMetrics[0].ConnectionDetails.SourceID).To(Equal(SourceIDEnabled))
+			Expect(consentFilteredMetrics[0].ConnectionDetails.DestinationID).To(Equal(DestinationIDEnabledC))
+			Expect(consentFilteredMetrics[0].PUDetails).To(Equal(*types.CreatePUDetails(types.GATEWAY, types.DESTINATION_FILTER, false, false)))
+			Expect(consentFilteredMetrics[0].StatusDetail.Count).To(BeEquivalentTo(1))
+		})
+
+		It("should send events to all destinations if the required consent categories are not denied", func() {
+			message := processJob(consentedJob(`["C0001"]`))
+
+			Expect(message.groupedEvents).To(HaveKey(getKeyFromSourceAndDest(SourceIDEnabled, DestinationIDEnabledC)))
+			for _, metric := range message.reportMetrics {
+				Expect(metric.StatusDetail.Status).NotTo(Equal(types.ConsentFilteredStatus))
+			}
+		})
+	})
+
+	Context("event filtering", func() {
+		var (
+			processor       *HandleT
+			mockTransformer *mocksTransformer.MockTransformer
+			destination     backendconfig.DestinationT
+		)
+
+		BeforeEach(func() {
+			c.mockGatewayJobsDB.EXPECT().DeleteExecuting(jobsdb.GetQueryParamsT{CustomValFilters: gatewayCustomVal, JobCount: -1}).Times(1)
+			mockTransformer = mocksTransformer.NewMockTransformer(c.mockCtrl)
+			mockTransformer.EXPECT().Setup().Times(1)
+			processor = &HandleT{transformer: mockTransformer}
+			configSubscriberLock.Lock()
+			destinationEventFilterMap = nil
+			configSubscriberLock.Unlock()
+			Setup(processor, c, false, true)
+			// wait for the backend config subscriber to compile the event filters of the sample config
+			Eventually(func() bool {
+				configSubscriberLock.RLock()
+				defer configSubscriberLock.RUnlock()
+				return destinationEventFilterMap != nil
+			}).Should(BeTrue())
+			destination = sampleBackendConfig.Sources[1].Destinations[0]
+		})
+
+		setEventFilter := func(filter *backendconfig.EventFilterT) {
+			destination.EventFilter = filter
+			configSubscriberLock.Lock()
+			defer configSubscriberLock.Unlock()
+			delete(destinationEventFilterMap, destination.ID)
+			processor.compileEventFilter(destination)
+		}
+
+		eventList := func(names ...string) []transformer.TransformerEventT {
+			var events []transformer.TransformerEventT
+			for i, name := range names {
+				events = append(events, transformer.TransformerEventT{
+					Message: map[string]interface{}{"type": "track", "event": name, "messageId": fmt.Sprintf("message-%d", i)},
+					Metadata: transformer.MetadataT{
+						SourceID:      SourceIDEnabled,
+						DestinationID: destination.ID,
+						MessageID:     fmt.Sprintf("message-%d", i),
+						EventName:     name,
+						EventType:     "track",
+					},
+					Destination: destination,
+				})
+			}
+			return events
+		}
+
+		filteredMetrics := func(metrics []*types.PUReportedMetric) map[string]int64 {
+			counts := make(map[string]int64)
+			for _, metric := range metrics {
+				if metric.StatusDetail.Status == types.EventFilteredStatus {
+					Expect(metric.PUDetails).To(Equal(*types.CreatePUDetails(types.DESTINATION_FILTER, types.EVENT_FILTER, false, false)))
+					counts[metric.StatusDetail.EventName] += metric.StatusDetail.Count
+				}
+			}
+			return counts
+		}
+
+		It("should drop events denied by the event filter before any transformation", func() {
+			setEventFilter(&backendconfig.EventFilterT{DenyEventNames: []string{"dropped"}})
+			mockTransformer.EXPECT().Transform(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+			output := processor.transformSrcDest(context.Background(), getKeyFromSourceAndDest(SourceIDEnabled, destination.ID), eventList("dropped", "dropped"), map[SourceIDT]bool{}, map[string]types.SingularEventWithReceivedAt{}, map[string]map[string]struct{}{})
+
+			Expect(output.destJobs).To(BeEmpty())
+			Expect(filteredMetrics(output.reportMetrics)).To(Equal(map[string]int64{"dropped": 2}))
+		})
+
+		It("should only transform the events kept by the event filter", func() {
+			setEventFilter(&backendconfig.EventFilterT{AllowEventNames: []string{"kept"}})
+			mockTransformer.EXPECT().Transform(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+				DoAndReturn(func(_ context.Context, events []transformer.TransformerEventT, _ string, _ int) transformer.ResponseT {
+					Expect(events).To(HaveLen(1))
+					Expect(events[0].Message["event"]).To(Equal("kept"))
+					return transformer.ResponseT{}
+				})
+
+			output := processor.transformSrcDest(context.Background(), getKeyFromSourceAndDest(SourceIDEnabled, destination.ID), eventList("kept", "dropped"), map[SourceIDT]bool{}, map[string]types.SingularEventWithReceivedAt{}, map[string]map[string]struct{}{})
+
+			Expect(filteredMetrics(output.reportMetrics)).To(Equal(map[string]int64{"dropped": 1}))
+			for _, metric := range output.reportMetrics {
+				if metric.StatusDetail.EventName == "dropped" {
+					Expect(metric.StatusDetail.Status).NotTo(Equal(types.DiffStatus), "filtered events are not reported as a diff of next stages")
+				}
+			}
+		})
+
+		It("should transform all events of a destination with an invalid event filter", func() {
+			setEventFilter(&backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "event", Operator: "regex", Value: "("}}})
+			mockTransformer.EXPECT().Transform(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+				DoAndReturn(func(_ context.Context, events []transformer.TransformerEventT, _ string, _ int) transformer.ResponseT {
+					Expect(events).To(HaveLen(2))
+					return transformer.ResponseT{}
+				})
+
+			output := processor.transformSrcDest(context.Background(), getKeyFromSourceAndDest(SourceIDEnabled, destination.ID), eventList("kept", "dropped"), map[SourceIDT]bool{}, map[string]types.SingularEventWithReceivedAt{}, map[string]map[string]struct{}{})
+
+			Expect(filteredMetrics(output.reportMetrics)).To(BeEmpty())
+		})
+	})
+
 	Context("Pause and Resume Function Tests", func() {
 		var clearDB = false
 		It("Should Recieve Something on Pause when Processor Is Not Paused", func() {
@@ -1715,10 +1881,79 @@ func Setup(processor *HandleT, c *testContext, enableDedup, enableReporting bool
 }
 
 func handlePendingGatewayJobs(processor *HandleT) {
-	didWork := processor.handlePendingGatewayJobs()
+	didWork := processor.handlePendingGatewayJobs(context.Background())
 	Expect(didWork).To(Equal(true))
 }
 
+var _ = Describe("Event filter", func() {
+	event := types.SingularEventT{
+		"type":       "track",
+		"event":      "Order Completed",
+		"properties": map[string]interface{}{"plan": "pro", "revenue": float64(42), "tags": []interface{}{"a", "b"}},
+	}
+	percentage := func(p float64) *float64 { return &p }
+
+	It("should keep or drop events according to the filter", func() {
+		tests := []struct {
+			filter backendconfig.EventFilterT
+			reason string
+		}{
+			{filter: backendconfig.EventFilterT{}, reason: ""},
+			{filter: backendconfig.EventFilterT{AllowEventTypes: []string{"Track"}}, reason: ""},
+			{filter: backendconfig.EventFilterT{AllowEventTypes: []string{"identify"}}, reason: eventFilterReasonEventType},
+			{filter: backendconfig.EventFilterT{DenyEventTypes: []string{"track"}}, reason: eventFilterReasonEventType},
+			{filter: backendconfig.EventFilterT{AllowEventNames: []string{"Order Completed"}}, reason: ""},
+			{filter: backendconfig.EventFilterT{DenyEventNames: []string{"Order Completed"}}, reason: eventFilterReasonEventName},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "eq", Value: "pro"}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "neq", Value: "pro"}}}, reason: eventFilterReasonCondition},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "in", Value: []interface{}{"free", "pro"}}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "nin", Value: []interface{}{"pro"}}}}, reason: eventFilterReasonCondition},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.revenue", Operator: "gte", Value: float64(42)}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.revenue", Operator: "gt", Value: float64(42)}}}, reason: eventFilterReasonCondition},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.tags", Operator: "contains", Value: "b"}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "regex", Value: "^p"}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.coupon", Operator: "exists"}}}, reason: eventFilterReasonCondition},
+			{filter: backendconfig.EventFilterT{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan.name", Operator: "notExists"}}}, reason: ""},
+			{filter: backendconfig.EventFilterT{SamplingPercentage: percentage(100)}, reason: ""},
+			{filter: backendconfig.EventFilterT{SamplingPercentage: percentage(0)}, reason: eventFilterReasonSampling},
+		}
+		for _, tt := range tests {
+			eventFilter, err := newEventFilter(&tt.filter)
+			Expect(err).To(BeNil())
+			Expect(eventFilter.filteredReason(event, "message-1")).To(Equal(tt.reason), fmt.Sprintf("%+v", tt.filter))
+		}
+	})
+
+	It("should sample events consistently by message id", func() {
+		eventFilter, err := newEventFilter(&backendconfig.EventFilterT{SamplingPercentage: percentage(50)})
+		Expect(err).To(BeNil())
+		kept := 0
+		for i := 0; i < 1000; i++ {
+			messageID := fmt.Sprintf("message-%d", i)
+			reason := eventFilter.filteredReason(event, messageID)
+			Expect(eventFilter.filteredReason(event, messageID)).To(Equal(reason))
+			if reason == "" {
+				kept++
+			}
+		}
+		Expect(kept).To(BeNumerically("~", 500, 100))
+	})
+
+	It("should reject invalid filters", func() {
+		for _, filter := range []backendconfig.EventFilterT{
+			{SamplingPercentage: percentage(101)},
+			{Conditions: []backendconfig.EventFilterConditionT{{Operator: "eq", Value: "pro"}}},
+			{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "like", Value: "pro"}}},
+			{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "in", Value: "pro"}}},
+			{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.revenue", Operator: "gt", Value: "42"}}},
+			{Conditions: []backendconfig.EventFilterConditionT{{Path: "properties.plan", Operator: "regex", Value: "("}}},
+		} {
+			_, err := newEventFilter(&filter)
+			Expect(err).NotTo(BeNil(), fmt.Sprintf("%+v", filter))
+		}
+	})
+})
+
 var _ = Describe("TestJobSplitter", func() {
 	jobs := []*jobsdb.JobT{
 		{
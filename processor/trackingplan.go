@@ -2,6 +2,7 @@ package processor
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/rudderlabs/rudder-server/config"
 	"github.com/rudderlabs/rudder-server/jobsdb"
@@ -75,7 +76,9 @@ func (proc *HandleT) validateEvents(groupedEventsByWriteKey map[WriteKeyT][]tran
 		}
 
 		validationStat.tpValidationTime.Start()
+		startedAt := time.Now()
 		response := proc.transformer.Validate(eventList, integrations.GetTrackingPlanValidationURL(), userTransformBatchSize)
+		traceTransformation(transformer.TrackingPlanValidationStage, eventList, response, startedAt)
 		validationStat.tpValidationTime.End()
 
 		// If transformerInput does not match with transformerOutput then we do not consider transformerOutput
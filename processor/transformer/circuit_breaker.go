@@ -0,0 +1,83 @@
+package transformer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+// circuitBreakerT stops sending requests to a transformer endpoint which is down.
+// The circuit opens after failureThreshold consecutive failed requests. After openDuration it turns half-open,
+// letting a single probe request through: the circuit closes if the probe succeeds and opens again otherwise.
+type circuitBreakerT struct {
+	endpoint string
+	now      func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openedAt  time.Time // zero if the circuit is closed
+	probing   bool
+	stateStat stats.RudderStats
+}
+
+func newCircuitBreaker(endpoint string) *circuitBreakerT {
+	cb := &circuitBreakerT{
+		endpoint:  endpoint,
+		now:       time.Now,
+		stateStat: stats.NewTaggedStat("processor.transformer_circuit_breaker_state", stats.GaugeType, stats.Tags{"endpoint": endpoint}),
+	}
+	cb.stateStat.Gauge(0)
+	return cb
+}
+
+// allow returns false if no request must be sent to the endpoint.
+// Every allowed request must be reported back through success, failure or cancel.
+func (cb *circuitBreakerT) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.openedAt.IsZero() {
+		return true
+	}
+	if cb.probing || cb.now().Sub(cb.openedAt) < circuitBreakerOpenDuration {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+func (cb *circuitBreakerT) success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures = 0
+	cb.probing = false
+	if !cb.openedAt.IsZero() {
+		pkgLogger.Infof("Transformer circuit breaker of %s closed, requests are resumed", cb.endpoint)
+		cb.openedAt = time.Time{}
+		cb.stateStat.Gauge(0)
+	}
+}
+
+func (cb *circuitBreakerT) failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures++
+	if cb.probing {
+		// the probe failed, wait for another openDuration
+		cb.probing = false
+		cb.openedAt = cb.now()
+		return
+	}
+	if cb.openedAt.IsZero() && cb.failures >= circuitBreakerFailureThreshold {
+		pkgLogger.Errorf("Transformer circuit breaker of %s opened after %d consecutive failures", cb.endpoint, cb.failures)
+		cb.openedAt = cb.now()
+		cb.stateStat.Gauge(1)
+	}
+}
+
+// cancel reports a request which was abandoned before getting a response, e.g. because a hedged request won
+func (cb *circuitBreakerT) cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
@@ -0,0 +1,330 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+var (
+	localTransformationEnabled          bool
+	localTransformationTimeout          time.Duration
+	localTransformationMaxMemory        int64
+	localTransformationMaxOutputSize    int
+	localTransformationMaxCallStackSize int
+	localTransformationMaxConcurrency   int
+
+	errLocalTransformationTimeout = errors.New("transformation timed out")
+	errLocalTransformationMemory  = errors.New("transformation exceeded the memory limit")
+
+	exportRegex = regexp.MustCompile(`(?m)^(\s*)export\s+`)
+)
+
+func loadLocalConfig() {
+	config.RegisterBoolConfigVariable(true, &localTransformationEnabled, true, "Processor.localTransformation.enabled")
+	config.RegisterDurationConfigVariable(time.Duration(1000), &localTransformationTimeout, true, time.Millisecond, "Processor.localTransformation.eventTimeout")
+	config.RegisterInt64ConfigVariable(256, &localTransformationMaxMemory, true, 1024*1024, "Processor.localTransformation.maxMemoryInMB")
+	config.RegisterIntConfigVariable(4000, &localTransformationMaxOutputSize, true, 1024, "Processor.localTransformation.maxOutputSizeInKB")
+	config.RegisterIntConfigVariable(1024, &localTransformationMaxCallStackSize, true, 1, "Processor.localTransformation.maxCallStackSize")
+	config.RegisterIntConfigVariable(8, &localTransformationMaxConcurrency, false, 1, "Processor.localTransformation.maxConcurrency")
+}
+
+// IsLocallyExecutable returns true if the transformation is marked to be executed by the processor instead of
+// rudder-transformer, through the executeLocally flag and the javascript code in its config
+func IsLocallyExecutable(transformation backendconfig.TransformationT) bool {
+	if !localTransformationEnabled {
+		return false
+	}
+	executeLocally, _ := transformation.Config["executeLocally"].(bool)
+	code, _ := transformation.Config["code"].(string)
+	return executeLocally && code != ""
+}
+
+// LocalTransformerT executes javascript user transformations in-process with an embedded interpreter.
+// Transformations follow the rudder-transformer contract: a transformEvent(event, metadata) function returning
+// the transformed event, an array of events or nothing to drop the event.
+type LocalTransformerT struct {
+	programsLock sync.Mutex
+	programs     map[string]*localProgramT // transformation version id -> program
+
+	errorStat stats.RudderStats
+}
+
+// localProgramT is the compiled code of a transformation version, with a pool of runtimes it is loaded in
+type localProgramT struct {
+	program  *goja.Program
+	runtimes sync.Pool // *localRuntimeT
+}
+
+type localRuntimeT struct {
+	vm             *goja.Runtime
+	transformEvent goja.Callable
+	stringify      goja.Callable
+	parse          goja.Callable
+	isView         goja.Callable
+
+	allocated int64                  // memory allocated for the event being transformed
+	sizes     map[*goja.Object]int64 // counted memory of the objects allocated for the event being transformed
+}
+
+func NewLocalTransformer() *LocalTransformerT {
+	return &LocalTransformerT{
+		programs:  make(map[string]*localProgramT),
+		errorStat: stats.NewStat("processor.local_transformation_errors", stats.CountType),
+	}
+}
+
+// Transform executes the transformation of the events' destination, returning the same response as the transformer's /customTransform endpoint
+func (lt *LocalTransformerT) Transform(ctx context.Context, clientEvents []TransformerEventT) ResponseT {
+	if len(clientEvents) == 0 {
+		return ResponseT{}
+	}
+	s := time.Now()
+	defer stats.NewTaggedStat("processor.local_transformation_time", stats.TimerType, statsTags(clientEvents[0])).Since(s)
+
+	transformation := clientEvents[0].Destination.Transformations[0]
+	program, err := lt.program(transformation)
+	if err != nil {
+		lt.errorStat.Increment()
+		response := ResponseT{}
+		for i := range clientEvents {
+			response.FailedEvents = append(response.FailedEvents, TransformerResponseT{StatusCode: 400, Error: err.Error(), Metadata: clientEvents[i].Metadata})
+		}
+		return response
+	}
+
+	concurrency := localTransformationMaxConcurrency
+	if concurrency > len(clientEvents) {
+		concurrency = len(clientEvents)
+	}
+	responses := make([][]TransformerResponseT, len(clientEvents))
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				responses[i] = lt.transformEvent(ctx, program, &clientEvents[i])
+			}
+		}()
+	}
+	for i := range clientEvents {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var response ResponseT
+	for _, eventResponses := range responses {
+		for _, eventResponse := range eventResponses {
+			if eventResponse.StatusCode != 200 {
+				response.FailedEvents = append(response.FailedEvents, eventResponse)
+				continue
+			}
+			response.Events = append(response.Events, eventResponse)
+		}
+	}
+	return response
+}
+
+// Retain drops the programs of the transformation versions not in versionIDs, which are no longer used by the backend config
+func (lt *LocalTransformerT) Retain(versionIDs map[string]bool) {
+	lt.programsLock.Lock()
+	defer lt.programsLock.Unlock()
+	for versionID := range lt.programs {
+		if !versionIDs[versionID] {
+			delete(lt.programs, versionID)
+		}
+	}
+}
+
+// program returns the transformation's compiled code, compiling it if needed
+func (lt *LocalTransformerT) program(transformation backendconfig.TransformationT) (*localProgramT, error) {
+	lt.programsLock.Lock()
+	defer lt.programsLock.Unlock()
+	if program, ok := lt.programs[transformation.VersionID]; ok {
+		return program, nil
+	}
+
+	code, _ := transformation.Config["code"].(string)
+	// the transformer runs the code as an es module, which the interpreter doesn't support
+	code, err := instrumentMemory(transformation.VersionID, exportRegex.ReplaceAllString(code, "$1"))
+	if err != nil {
+		return nil, fmt.Errorf("compiling transformation %s: %w", transformation.VersionID, err)
+	}
+	program, err := goja.Compile(transformation.VersionID, code, true)
+	if err != nil {
+		return nil, fmt.Errorf("compiling transformation %s: %w", transformation.VersionID, err)
+	}
+	// fail early if the code doesn't define transformEvent
+	if _, err := newLocalRuntime(program); err != nil {
+		return nil, fmt.Errorf("loading transformation %s: %w", transformation.VersionID, err)
+	}
+
+	lt.programs[transformation.VersionID] = &localProgramT{program: program}
+	return lt.programs[transformation.VersionID], nil
+}
+
+// runtime returns a pooled runtime with the program loaded, or a new one if none is available
+func (program *localProgramT) runtime() (*localRuntimeT, error) {
+	if runtime, ok := program.runtimes.Get().(*localRuntimeT); ok {
+		return runtime, nil
+	}
+	return newLocalRuntime(program.program)
+}
+
+func newLocalRuntime(program *goja.Program) (*localRuntimeT, error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(localTransformationMaxCallStackSize)
+	runtime := &localRuntimeT{vm: vm}
+	if err := runtime.defineCountingFunctions(); err != nil {
+		return nil, err
+	}
+	runtime.resetMemory()
+	if _, err := vm.RunProgram(program); err != nil {
+		return nil, err
+	}
+	transformEvent, ok := goja.AssertFunction(vm.Get("transformEvent"))
+	if !ok {
+		return nil, errors.New("transformEvent function is not defined")
+	}
+	json := vm.Get("JSON").ToObject(vm)
+	runtime.transformEvent = transformEvent
+	runtime.stringify, _ = goja.AssertFunction(json.Get("stringify"))
+	runtime.parse, _ = goja.AssertFunction(json.Get("parse"))
+	return runtime, nil
+}
+
+func (lt *LocalTransformerT) transformEvent(ctx context.Context, program *localProgramT, event *TransformerEventT) []TransformerResponseT {
+	runtime, err := program.runtime()
+	if err != nil {
+		lt.errorStat.Increment()
+		return []TransformerResponseT{{StatusCode: 400, Error: fmt.Sprintf("loading transformation: %v", err), Metadata: event.Metadata}}
+	}
+	outputs, err := runtime.transform(ctx, event)
+	if err != nil {
+		var interrupted *goja.InterruptedError
+		if !errors.As(err, &interrupted) {
+			// interrupted runtimes may be left in an inconsistent state, so they are not reused
+			program.runtimes.Put(runtime)
+		}
+		lt.errorStat.Increment()
+		return []TransformerResponseT{{StatusCode: 400, Error: err.Error(), Metadata: event.Metadata}}
+	}
+	program.runtimes.Put(runtime)
+
+	responses := make([]TransformerResponseT, 0, len(outputs))
+	for _, output := range outputs {
+		responses = append(responses, TransformerResponseT{Output: output, StatusCode: 200, Metadata: event.Metadata})
+	}
+	return responses
+}
+
+// transform executes transformEvent, interrupting it if it takes longer than the event timeout,
+// or if the memory counted by its instrumented code exceeds the memory limit.
+func (runtime *localRuntimeT) transform(ctx context.Context, event *TransformerEventT) (outputs []map[string]interface{}, err error) {
+	vm := runtime.vm
+	runtime.resetMemory()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+		// the interrupt might have been raised right after transformEvent returned
+		vm.ClearInterrupt()
+	}()
+	go func() {
+		defer close(stopped)
+		timeout := time.NewTimer(localTransformationTimeout)
+		defer timeout.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				vm.Interrupt(ctx.Err())
+				return
+			case <-timeout.C:
+				vm.Interrupt(errLocalTransformationTimeout)
+				return
+			}
+		}
+	}()
+
+	message, err := jsonfast.Marshal(event.Message)
+	if err != nil {
+		return nil, err
+	}
+	jsEvent, err := runtime.parse(goja.Undefined(), vm.ToValue(string(message)))
+	if err != nil {
+		return nil, err
+	}
+	metadata := event.Metadata
+	getMetadata := func(goja.FunctionCall) goja.Value {
+		return vm.ToValue(map[string]interface{}{
+			"sourceId":        metadata.SourceID,
+			"sourceType":      metadata.SourceType,
+			"destinationId":   metadata.DestinationID,
+			"destinationType": metadata.DestinationType,
+			"messageId":       metadata.MessageID,
+			"jobRunId":        metadata.JobRunID,
+			"jobId":           metadata.JobID,
+			"sourceBatchId":   metadata.SourceBatchID,
+			"sourceJobId":     metadata.SourceJobID,
+			"sourceJobRunId":  metadata.SourceJobRunID,
+			"sourceTaskId":    metadata.SourceTaskID,
+			"sourceTaskRunId": metadata.SourceTaskRunID,
+			"recordId":        metadata.RecordID,
+		})
+	}
+
+	result, err := runtime.transformEvent(goja.Undefined(), jsEvent, vm.ToValue(getMetadata))
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(result) || goja.IsNull(result) {
+		// the event is filtered out
+		return nil, nil
+	}
+
+	serialized, err := runtime.stringify(goja.Undefined(), result)
+	if err != nil {
+		return nil, err
+	}
+	output := serialized.String()
+	if len(output) > localTransformationMaxOutputSize {
+		return nil, fmt.Errorf("transformation output of %d bytes exceeds the limit of %d bytes", len(output), localTransformationMaxOutputSize)
+	}
+
+	var transformed interface{}
+	if err := jsonfast.Unmarshal([]byte(output), &transformed); err != nil {
+		return nil, err
+	}
+	switch transformed := transformed.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{transformed}, nil
+	case []interface{}:
+		for _, item := range transformed {
+			if item == nil {
+				continue
+			}
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("returned event in events array from user transformation is not an object")
+			}
+			outputs = append(outputs, itemMap)
+		}
+		return outputs, nil
+	}
+	return nil, errors.New("returned event from user transformation is not an object")
+}
@@ -0,0 +1,440 @@
+package transformer
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+// The interpreter doesn't track the memory allocated by the code it runs, so the code of local transformations
+// is instrumented to count it: the expressions allocating memory are wrapped in calls to the counting functions
+// below, which add the size of the value of the expression to the memory allocated for the event being transformed,
+// and return the value unchanged.
+const (
+	allocatedFunction    = "__rudderAllocated"    // calls, constructions, array and object literals
+	concatenatedFunction = "__rudderConcatenated" // string concatenations and template literals
+	assignedFunction     = "__rudderAssigned"     // assignments to properties
+	receiverFunction     = "__rudderReceiver"     // receivers of method calls, which may grow them
+)
+
+const (
+	valueSize    = 16 // the memory of a value, counted for every allocation
+	propertySize = 48 // the memory of an object property
+)
+
+var (
+	countingFunctions = map[string]bool{allocatedFunction: true, concatenatedFunction: true, assignedFunction: true, receiverFunction: true}
+	idxType           = reflect.TypeOf(file.Idx(0))
+	arrayBufferType   = reflect.TypeOf(goja.ArrayBuffer{})
+
+	errUninstrumentableCode = errors.New("code can't be instrumented to count its memory")
+)
+
+type memoryWrapT struct {
+	start, end int // byte offsets of the wrapped expression
+	depth      int // depth of the wrapped expression in the syntax tree
+	function   string
+}
+
+// memoryInstrumenterT collects the expressions of a syntax tree to wrap in counting functions
+type memoryInstrumenterT struct {
+	wraps []memoryWrapT
+	// expressions which can't be wrapped: the links of optional chains and the default values of patterns
+	unwrappable map[ast.Node]bool
+}
+
+// instrumentMemory returns the code with its allocating expressions wrapped in counting functions.
+// The syntax tree doesn't keep parentheses, so a wrap may move across them, e.g. in (a, b) + c: the instrumented
+// code is parsed again and must be the same as the original one once the counting functions are removed.
+// Otherwise, only the wraps keeping the code the same on their own are kept.
+func instrumentMemory(name, code string) (string, error) {
+	program, err := parser.ParseFile(nil, name, code, 0, parser.WithDisableSourceMaps)
+	if err != nil {
+		return "", err
+	}
+	instrumenter := &memoryInstrumenterT{unwrappable: make(map[ast.Node]bool)}
+	instrumenter.walk(reflect.ValueOf(program), 0)
+	sameProgram := func(instrumented string) bool {
+		instrumentedProgram, err := parser.ParseFile(nil, name, instrumented, 0, parser.WithDisableSourceMaps)
+		return err == nil && sameSyntaxTree(reflect.ValueOf(program), reflect.ValueOf(instrumentedProgram))
+	}
+
+	instrumented := applyWraps(code, instrumenter.wraps)
+	if sameProgram(instrumented) {
+		return instrumented, nil
+	}
+	var kept []memoryWrapT
+	for _, wrap := range instrumenter.wraps {
+		if sameProgram(applyWraps(code, []memoryWrapT{wrap})) {
+			kept = append(kept, wrap)
+		}
+	}
+	instrumented = applyWraps(code, kept)
+	if !sameProgram(instrumented) {
+		return "", errUninstrumentableCode
+	}
+	return instrumented, nil
+}
+
+func (instrumenter *memoryInstrumenterT) walk(v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			instrumenter.walk(v.Elem(), depth)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(ast.Node); ok {
+			instrumenter.visit(node, depth)
+			depth++
+		}
+		instrumenter.walk(v.Elem(), depth)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !ignoredField(v.Type().Field(i)) {
+				instrumenter.walk(v.Field(i), depth)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			instrumenter.walk(v.Index(i), depth)
+		}
+	}
+}
+
+// visit wraps the node if it allocates memory. Nodes are visited before their children.
+func (instrumenter *memoryInstrumenterT) visit(node ast.Node, depth int) {
+	switch node := node.(type) {
+	case *ast.OptionalChain:
+		// wrapping a link would end the chain, the chain is wrapped as a whole instead
+		for link := node.Expression; link != nil; {
+			instrumenter.unwrappable[link] = true
+			switch l := link.(type) {
+			case *ast.CallExpression:
+				link = l.Callee
+			case *ast.DotExpression:
+				link = l.Left
+			case *ast.BracketExpression:
+				link = l.Left
+			case *ast.Optional:
+				link = l.Expression
+			default:
+				link = nil
+			}
+		}
+		instrumenter.wrap(node, depth, allocatedFunction)
+	case *ast.ArrayPattern:
+		for _, element := range node.Elements {
+			instrumenter.unwrappable[element] = true
+		}
+	case *ast.ObjectPattern:
+		for _, property := range node.Properties {
+			if property, ok := property.(*ast.PropertyKeyed); ok {
+				instrumenter.unwrappable[property.Value] = true
+			}
+		}
+	case *ast.CallExpression:
+		instrumenter.wrap(node, depth, allocatedFunction)
+		switch callee := node.Callee.(type) {
+		case *ast.DotExpression:
+			instrumenter.wrap(callee.Left, depth+2, receiverFunction)
+		case *ast.BracketExpression:
+			instrumenter.wrap(callee.Left, depth+2, receiverFunction)
+		}
+	case *ast.NewExpression, *ast.ArrayLiteral, *ast.ObjectLiteral:
+		instrumenter.wrap(node, depth, allocatedFunction)
+	case *ast.TemplateLiteral:
+		if node.Tag == nil {
+			instrumenter.wrap(node, depth, concatenatedFunction)
+		}
+	case *ast.BinaryExpression:
+		if node.Operator == token.PLUS {
+			instrumenter.wrap(node, depth, concatenatedFunction)
+		}
+	case *ast.AssignExpression:
+		switch node.Left.(type) {
+		case *ast.DotExpression, *ast.BracketExpression:
+			if node.Operator == token.PLUS {
+				instrumenter.wrap(node, depth, concatenatedFunction)
+			} else {
+				instrumenter.wrap(node, depth, assignedFunction)
+			}
+		default:
+			if node.Operator == token.PLUS {
+				instrumenter.wrap(node, depth, concatenatedFunction)
+			}
+		}
+	}
+}
+
+func (instrumenter *memoryInstrumenterT) wrap(node ast.Node, depth int, function string) {
+	if instrumenter.unwrappable[node] {
+		return
+	}
+	instrumenter.wraps = append(instrumenter.wraps, memoryWrapT{start: nodeStart(node), end: nodeEnd(node), depth: depth, function: function})
+}
+
+// applyWraps inserts the calls to the counting functions in the code, nesting the calls of nested expressions
+func applyWraps(code string, wraps []memoryWrapT) string {
+	opening := make(map[int][]memoryWrapT)
+	closing := make(map[int][]memoryWrapT)
+	var offsets []int
+	for _, wrap := range wraps {
+		if len(opening[wrap.start]) == 0 && len(closing[wrap.start]) == 0 {
+			offsets = append(offsets, wrap.start)
+		}
+		opening[wrap.start] = append(opening[wrap.start], wrap)
+		if len(opening[wrap.end]) == 0 && len(closing[wrap.end]) == 0 {
+			offsets = append(offsets, wrap.end)
+		}
+		closing[wrap.end] = append(closing[wrap.end], wrap)
+	}
+	sort.Ints(offsets)
+
+	var instrumented strings.Builder
+	previous := 0
+	for _, offset := range offsets {
+		instrumented.WriteString(code[previous:offset])
+		previous = offset
+		// expressions ending here are closed before the ones starting here are opened, outer expressions first
+		instrumented.WriteString(strings.Repeat(")", len(closing[offset])))
+		opens := opening[offset]
+		sort.Slice(opens, func(i, j int) bool {
+			if opens[i].end != opens[j].end {
+				return opens[i].end > opens[j].end
+			}
+			return opens[i].depth < opens[j].depth
+		})
+		for _, wrap := range opens {
+			instrumented.WriteString(wrap.function + "(")
+		}
+	}
+	instrumented.WriteString(code[previous:])
+	return instrumented.String()
+}
+
+// nodeStart returns the byte offset of the first character of the node
+func nodeStart(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.BinaryExpression:
+		return nodeStart(node.Left)
+	case *ast.AssignExpression:
+		return nodeStart(node.Left)
+	case *ast.ConditionalExpression:
+		return nodeStart(node.Test)
+	case *ast.SequenceExpression:
+		return nodeStart(node.Sequence[0])
+	case *ast.CallExpression:
+		return nodeStart(node.Callee)
+	case *ast.DotExpression:
+		return nodeStart(node.Left)
+	case *ast.BracketExpression:
+		return nodeStart(node.Left)
+	case *ast.OptionalChain:
+		return nodeStart(node.Expression)
+	case *ast.Optional:
+		return nodeStart(node.Expression)
+	case *ast.UnaryExpression:
+		if node.Postfix {
+			return nodeStart(node.Operand)
+		}
+	}
+	return int(node.Idx0()) - 1
+}
+
+// nodeEnd returns the byte offset following the last character of the node.
+// Unlike Idx1, it accounts for the alternate of conditional expressions and the parentheses of new f().
+func nodeEnd(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.BinaryExpression:
+		return nodeEnd(node.Right)
+	case *ast.AssignExpression:
+		return nodeEnd(node.Right)
+	case *ast.ConditionalExpression:
+		return nodeEnd(node.Alternate)
+	case *ast.SequenceExpression:
+		return nodeEnd(node.Sequence[len(node.Sequence)-1])
+	case *ast.OptionalChain:
+		return nodeEnd(node.Expression)
+	case *ast.Optional:
+		return nodeEnd(node.Expression)
+	case *ast.UnaryExpression:
+		if !node.Postfix {
+			return nodeEnd(node.Operand)
+		}
+	case *ast.ArrowFunctionLiteral:
+		if body, ok := node.Body.(*ast.ExpressionBody); ok {
+			return nodeEnd(body.Expression)
+		}
+	case *ast.NewExpression:
+		// the argument list of new f() is empty
+		if node.RightParenthesis > 0 {
+			return int(node.RightParenthesis)
+		}
+		return nodeEnd(node.Callee)
+	}
+	return int(node.Idx1()) - 1
+}
+
+// sameSyntaxTree returns whether the syntax trees are the same, ignoring positions and the calls
+// to counting functions in the instrumented one
+func sameSyntaxTree(original, instrumented reflect.Value) bool {
+	if original.Kind() == reflect.Interface {
+		if original.IsNil() || instrumented.IsNil() {
+			return original.IsNil() && instrumented.IsNil()
+		}
+		return sameSyntaxTree(original.Elem(), instrumented.Elem())
+	}
+	if instrumented.Kind() == reflect.Ptr && !instrumented.IsNil() {
+		if call, ok := instrumented.Interface().(*ast.CallExpression); ok && isCountingCall(call) {
+			return sameSyntaxTree(original, reflect.ValueOf(call.ArgumentList[0]))
+		}
+	}
+	if original.Type() != instrumented.Type() {
+		return false
+	}
+	switch original.Kind() {
+	case reflect.Ptr:
+		if original.IsNil() || instrumented.IsNil() {
+			return original.IsNil() && instrumented.IsNil()
+		}
+		return sameSyntaxTree(original.Elem(), instrumented.Elem())
+	case reflect.Struct:
+		for i := 0; i < original.NumField(); i++ {
+			if ignoredField(original.Type().Field(i)) {
+				continue
+			}
+			if !sameSyntaxTree(original.Field(i), instrumented.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if original.Len() != instrumented.Len() {
+			return false
+		}
+		for i := 0; i < original.Len(); i++ {
+			if !sameSyntaxTree(original.Index(i), instrumented.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return original.Interface() == instrumented.Interface()
+}
+
+// ignoredField returns whether the field of a syntax tree node doesn't affect the semantics of the code, like
+// positions and the source of functions, or is visited through other fields, like declarations and the file
+func ignoredField(field reflect.StructField) bool {
+	switch field.Name {
+	case "DeclarationList", "File":
+		return true
+	case "Source":
+		return field.Type.Kind() == reflect.String
+	}
+	return field.Type == idxType
+}
+
+func isCountingCall(call *ast.CallExpression) bool {
+	callee, ok := call.Callee.(*ast.Identifier)
+	if !ok || !countingFunctions[callee.Name.String()] || len(call.ArgumentList) != 1 {
+		return false
+	}
+	_, spread := call.ArgumentList[0].(*ast.SpreadElement)
+	return !spread
+}
+
+// defineCountingFunctions defines the counting functions of instrumented code as read-only globals of the runtime
+func (runtime *localRuntimeT) defineCountingFunctions() error {
+	vm := runtime.vm
+	isView, _ := goja.AssertFunction(vm.Get("ArrayBuffer").ToObject(vm).Get("isView"))
+	runtime.isView = isView
+	functions := map[string]func(goja.FunctionCall) goja.Value{
+		allocatedFunction: func(call goja.FunctionCall) goja.Value {
+			value := call.Argument(0)
+			runtime.count(valueSize + runtime.size(value))
+			return value
+		},
+		concatenatedFunction: func(call goja.FunctionCall) goja.Value {
+			value := call.Argument(0)
+			runtime.count(runtime.size(value))
+			return value
+		},
+		assignedFunction: func(call goja.FunctionCall) goja.Value {
+			runtime.count(valueSize)
+			return call.Argument(0)
+		},
+		receiverFunction: func(call goja.FunctionCall) goja.Value {
+			value := call.Argument(0)
+			if _, ok := value.(*goja.Object); ok {
+				runtime.count(runtime.size(value))
+			}
+			return value
+		},
+	}
+	for name, function := range functions {
+		if err := vm.GlobalObject().DefineDataProperty(name, vm.ToValue(function), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count adds memory to the one allocated for the event being transformed, interrupting the transformation
+// once it exceeds the memory limit
+func (runtime *localRuntimeT) count(size int64) {
+	runtime.allocated += size
+	if runtime.allocated > localTransformationMaxMemory {
+		runtime.vm.Interrupt(errLocalTransformationMemory)
+	}
+}
+
+// size returns the memory of a string, or the memory an object grew by since it was last counted for the event
+func (runtime *localRuntimeT) size(value goja.Value) int64 {
+	obj, ok := value.(*goja.Object)
+	if !ok {
+		if exportType := value.ExportType(); exportType != nil && exportType.Kind() == reflect.String {
+			return int64(len(value.String()))
+		}
+		return 0
+	}
+
+	var size int64
+	switch {
+	case obj.ClassName() == "Array":
+		size = obj.Get("length").ToInteger() * valueSize
+	case obj.ExportType() == arrayBufferType:
+		size = int64(len(obj.Export().(goja.ArrayBuffer).Bytes()))
+	case runtime.viewsArrayBuffer(obj):
+		size = obj.Get("byteLength").ToInteger()
+	default:
+		size = int64(len(obj.Keys())) * propertySize
+	}
+	grown := size - runtime.sizes[obj]
+	if grown <= 0 {
+		return 0
+	}
+	runtime.sizes[obj] = size
+	return grown
+}
+
+// viewsArrayBuffer returns whether the object is a typed array or a data view, whose keys are not enumerated
+func (runtime *localRuntimeT) viewsArrayBuffer(obj *goja.Object) bool {
+	isView, err := runtime.isView(goja.Undefined(), obj)
+	return err == nil && isView.ToBoolean()
+}
+
+// resetMemory starts counting the memory allocated for a new event
+func (runtime *localRuntimeT) resetMemory() {
+	runtime.allocated = 0
+	runtime.sizes = make(map[*goja.Object]int64)
+}
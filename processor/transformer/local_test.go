@@ -0,0 +1,189 @@
+package transformer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/processor/transformer"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+func Test_LocalTransformer(t *testing.T) {
+	t.Setenv("RSERVER_PROCESSOR_LOCAL_TRANSFORMATION_MAX_MEMORY_IN_MB", "4")
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	transformer.Init()
+
+	localTransformation := func(versionID, code string) backendconfig.TransformationT {
+		return backendconfig.TransformationT{
+			ID:        "t1",
+			VersionID: versionID,
+			Config:    map[string]interface{}{"executeLocally": true, "code": code},
+		}
+	}
+	events := func(transformation backendconfig.TransformationT, messages ...map[string]interface{}) []transformer.TransformerEventT {
+		events := make([]transformer.TransformerEventT, len(messages))
+		for i := range messages {
+			events[i] = transformer.TransformerEventT{
+				Message:     messages[i],
+				Metadata:    transformer.MetadataT{MessageID: messages[i]["messageId"].(string), SourceID: "s1"},
+				Destination: backendconfig.DestinationT{ID: "d1", Transformations: []backendconfig.TransformationT{transformation}},
+			}
+		}
+		return events
+	}
+
+	t.Run("locally executable", func(t *testing.T) {
+		require.True(t, transformer.IsLocallyExecutable(localTransformation("v1", "function transformEvent(e) { return e }")))
+		require.False(t, transformer.IsLocallyExecutable(localTransformation("v1", "")))
+		require.False(t, transformer.IsLocallyExecutable(backendconfig.TransformationT{VersionID: "v1"}))
+	})
+
+	t.Run("maps, splits and filters events", func(t *testing.T) {
+		lt := transformer.NewLocalTransformer()
+		transformation := localTransformation("v2", `
+			export function transformEvent(event, metadata) {
+				if (event.event === "drop") {
+					return;
+				}
+				if (event.event === "split") {
+					return [{...event, event: "first"}, {...event, event: "second"}];
+				}
+				event.properties.sourceId = metadata(event).sourceId;
+				return event;
+			}`)
+
+		response := lt.Transform(context.Background(), events(transformation,
+			map[string]interface{}{"messageId": "m1", "event": "map", "properties": map[string]interface{}{"count": 1}},
+			map[string]interface{}{"messageId": "m2", "event": "drop"},
+			map[string]interface{}{"messageId": "m3", "event": "split"},
+		))
+		require.Empty(t, response.FailedEvents)
+		require.Len(t, response.Events, 3)
+		require.Equal(t, map[string]interface{}{"messageId": "m1", "event": "map", "properties": map[string]interface{}{"count": float64(1), "sourceId": "s1"}}, response.Events[0].Output)
+		require.Equal(t, "m1", response.Events[0].Metadata.MessageID)
+		require.Equal(t, 200, response.Events[0].StatusCode)
+		require.Equal(t, "first", response.Events[1].Output["event"])
+		require.Equal(t, "second", response.Events[2].Output["event"])
+		require.Equal(t, "m3", response.Events[2].Metadata.MessageID)
+	})
+
+	t.Run("fails events on errors", func(t *testing.T) {
+		lt := transformer.NewLocalTransformer()
+		transformation := localTransformation("v3", `
+			function transformEvent(event) {
+				if (event.event === "throw") {
+					throw new Error("invalid event");
+				}
+				if (event.event === "loop") {
+					while (true) {}
+				}
+				return "not an object";
+			}`)
+
+		response := lt.Transform(context.Background(), events(transformation,
+			map[string]interface{}{"messageId": "m1", "event": "throw"},
+			map[string]interface{}{"messageId": "m2", "event": "loop"},
+			map[string]interface{}{"messageId": "m3", "event": "string"},
+		))
+		require.Empty(t, response.Events)
+		require.Len(t, response.FailedEvents, 3)
+		require.Contains(t, response.FailedEvents[0].Error, "invalid event")
+		require.Equal(t, 400, response.FailedEvents[0].StatusCode)
+		require.Contains(t, response.FailedEvents[1].Error, "transformation timed out")
+		require.Equal(t, "m2", response.FailedEvents[1].Metadata.MessageID)
+		require.Contains(t, response.FailedEvents[2].Error, "not an object")
+	})
+
+	t.Run("fails events exceeding the memory limit", func(t *testing.T) {
+		lt := transformer.NewLocalTransformer()
+		transformation := localTransformation("v6", `
+			function transformEvent(event) {
+				switch (event.event) {
+				case "concat":
+					let s = "x";
+					while (true) { s += s; }
+				case "repeat":
+					return {...event, padding: "x".repeat(8 * 1024 * 1024)};
+				case "push":
+					const values = [];
+					while (true) { values.push(values.length); }
+				case "properties":
+					const object = {};
+					for (let i = 0; ; i++) { object["key" + i] = i; }
+				case "buffers":
+					const buffers = [];
+					while (true) { buffers.push(new Uint8Array(1024 * 1024)); }
+				case "caught":
+					try {
+						let s = "x";
+						while (true) { s = `+"`"+`${s}${s}`+"`"+`; }
+					} catch (e) {
+						return event;
+					}
+				}
+				const {properties: {items = []} = {}} = event;
+				event.items = items.map((item) => ({...item, price: item?.price || 0}));
+				event.label = `+"`"+`${event.event}-${(() => items.length)()}`+"`"+`;
+				return event;
+			}`)
+
+		response := lt.Transform(context.Background(), events(transformation,
+			map[string]interface{}{"messageId": "m1", "event": "concat"},
+			map[string]interface{}{"messageId": "m2", "event": "repeat"},
+			map[string]interface{}{"messageId": "m3", "event": "push"},
+			map[string]interface{}{"messageId": "m4", "event": "properties"},
+			map[string]interface{}{"messageId": "m5", "event": "buffers"},
+			map[string]interface{}{"messageId": "m6", "event": "caught"},
+			map[string]interface{}{"messageId": "m7", "event": "order", "properties": map[string]interface{}{"items": []interface{}{map[string]interface{}{"sku": "a"}}}},
+		))
+		require.Len(t, response.FailedEvents, 6)
+		for i, failedEvent := range response.FailedEvents {
+			require.Contains(t, failedEvent.Error, "transformation exceeded the memory limit")
+			require.Equal(t, fmt.Sprintf("m%d", i+1), failedEvent.Metadata.MessageID)
+		}
+		require.Len(t, response.Events, 1)
+		require.Equal(t, []interface{}{map[string]interface{}{"sku": "a", "price": float64(0)}}, response.Events[0].Output["items"])
+		require.Equal(t, "order-1", response.Events[0].Output["label"])
+	})
+
+	t.Run("drops the transformations no longer in use", func(t *testing.T) {
+		lt := transformer.NewLocalTransformer()
+		transformation := func(label string) backendconfig.TransformationT {
+			return localTransformation("v7", fmt.Sprintf(`function transformEvent(event) { event.label = "%s"; return event }`, label))
+		}
+		label := func(response transformer.ResponseT) interface{} {
+			require.Len(t, response.Events, 1)
+			return response.Events[0].Output["label"]
+		}
+
+		require.Equal(t, "first", label(lt.Transform(context.Background(), events(transformation("first"), map[string]interface{}{"messageId": "m1"}))))
+		lt.Retain(map[string]bool{"v7": true})
+		require.Equal(t, "first", label(lt.Transform(context.Background(), events(transformation("second"), map[string]interface{}{"messageId": "m2"}))))
+		lt.Retain(map[string]bool{"v8": true})
+		require.Equal(t, "second", label(lt.Transform(context.Background(), events(transformation("second"), map[string]interface{}{"messageId": "m3"}))))
+	})
+
+	t.Run("fails all events if the code can't be loaded", func(t *testing.T) {
+		lt := transformer.NewLocalTransformer()
+		response := lt.Transform(context.Background(), events(localTransformation("v4", "function transform(event) { return event }"),
+			map[string]interface{}{"messageId": "m1"},
+			map[string]interface{}{"messageId": "m2"},
+		))
+		require.Len(t, response.FailedEvents, 2)
+		require.Contains(t, response.FailedEvents[0].Error, "transformEvent function is not defined")
+
+		response = lt.Transform(context.Background(), events(localTransformation("v5", "function transformEvent(event) {"),
+			map[string]interface{}{"messageId": "m1"},
+		))
+		require.Len(t, response.FailedEvents, 1)
+		require.Contains(t, response.FailedEvents[0].Error, "compiling transformation v5")
+	})
+}
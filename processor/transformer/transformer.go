@@ -5,11 +5,14 @@ package transformer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"runtime/trace"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -65,6 +68,7 @@ type MetadataT struct {
 	EventType               string   `json:"eventType"`
 	SourceDefinitionID      string   `json:"sourceDefinitionId"`
 	DestinationDefinitionID string   `json:"destinationDefinitionId"`
+	TraceParent             string   `json:"traceparent,omitempty"`
 }
 
 type TransformerEventT struct {
@@ -88,6 +92,12 @@ type HandleT struct {
 	Client *http.Client
 
 	guardConcurrency chan struct{}
+
+	circuitBreakersLock sync.Mutex
+	circuitBreakers     map[string]*circuitBreakerT // transformer base url -> circuit breaker
+
+	parkedRequestsLock sync.Mutex
+	parkedRequests     map[string]int // stage -> number of requests waiting for the transformer to recover
 }
 
 //Transformer provides methods to transform events
@@ -106,6 +116,14 @@ var (
 	maxConcurrency, maxHTTPConnections, maxHTTPIdleConnections, maxRetry int
 	retrySleep                                                           time.Duration
 	pkgLogger                                                            logger.LoggerI
+
+	maxRetryByStage                      map[string]*int
+	hedgingEnabledByStage                map[string]*bool
+	hedgeURLs                            []string
+	hedgeDelay, parkedRetrySleep         time.Duration
+	circuitBreakerFailureThreshold       int
+	circuitBreakerOpenDuration           time.Duration
+	errAllTransformerCircuitBreakersOpen = errors.New("circuit breakers of all transformer urls are open")
 )
 
 func Init() {
@@ -120,6 +138,22 @@ func loadConfig() {
 
 	config.RegisterIntConfigVariable(30, &maxRetry, true, 1, "Processor.maxRetry")
 	config.RegisterDurationConfigVariable(time.Duration(100), &retrySleep, true, time.Millisecond, []string{"Processor.retrySleep", "Processor.retrySleepInMS"}...)
+
+	maxRetryByStage = make(map[string]*int)
+	hedgingEnabledByStage = make(map[string]*bool)
+	for _, stage := range []string{UserTransformerStage, DestTransformerStage, TrackingPlanValidationStage} {
+		maxRetryByStage[stage] = new(int)
+		config.RegisterIntConfigVariable(30, maxRetryByStage[stage], true, 1, "Processor.transformer."+stage+".maxRetry", "Processor.maxRetry")
+		// user transformations might have side effects, so they are not hedged by default
+		hedgingEnabledByStage[stage] = new(bool)
+		config.RegisterBoolConfigVariable(stage != UserTransformerStage, hedgingEnabledByStage[stage], true, "Processor.transformer."+stage+".enableHedging")
+	}
+	config.RegisterStringSliceConfigVariable(nil, &hedgeURLs, false, "Processor.transformer.hedgeURLs")
+	config.RegisterDurationConfigVariable(time.Duration(1000), &hedgeDelay, true, time.Millisecond, "Processor.transformer.hedgeDelay")
+	config.RegisterDurationConfigVariable(time.Duration(1), &parkedRetrySleep, true, time.Second, "Processor.transformer.parkedRetrySleep")
+	config.RegisterIntConfigVariable(5, &circuitBreakerFailureThreshold, true, 1, "Processor.transformer.circuitBreaker.failureThreshold")
+	config.RegisterDurationConfigVariable(time.Duration(10), &circuitBreakerOpenDuration, true, time.Second, "Processor.transformer.circuitBreaker.openDuration")
+	loadLocalConfig()
 }
 
 type TransformerResponseT struct {
@@ -146,6 +180,8 @@ func (trans *HandleT) Setup() {
 	trans.transformTimerStat = stats.NewStat("processor.transformation_time", stats.TimerType)
 
 	trans.guardConcurrency = make(chan struct{}, maxConcurrency)
+	trans.circuitBreakers = make(map[string]*circuitBreakerT)
+	trans.parkedRequests = make(map[string]int)
 	trans.perfStats = &misc.PerfStats{}
 	trans.perfStats.Setup("JS Call")
 
@@ -202,6 +238,7 @@ func (trans *HandleT) Transform(ctx context.Context, clientEvents []TransformerE
 	}
 
 	sTags := statsTags(clientEvents[0])
+	sTags["stage"] = stageFromURL(url)
 
 	s := time.Now()
 	defer stats.NewTaggedStat(
@@ -304,72 +341,31 @@ func (trans *HandleT) request(ctx context.Context, url string, data []Transforme
 	if err != nil {
 		panic(err)
 	}
-	retryCount := 0
-	var resp *http.Response
-	var respData []byte
-	//We should rarely have error communicating with our JS
-	reqFailed := false
-
 	if len(data) == 0 {
 		return nil
 	}
 
 	// assume that the first event is representative
-
-	for {
-		s := time.Now()
-		trace.WithRegion(ctx, "request/post", func() {
-			resp, err = trans.Client.Post(url, "application/json; charset=utf-8", bytes.NewBuffer(rawJSON))
-		})
-		if err == nil {
-			//If no err returned by client.Post, reading body.
-			//If reading body fails, retrying.
-			respData, err = io.ReadAll(resp.Body)
-			resp.Body.Close()
-		}
-
-		if err != nil {
-			trans.requestTime(statsTags(data[0]), time.Since(s))
-			reqFailed = true
-			trans.logger.Errorf("JS HTTP connection error: URL: %v Error: %+v", url, err)
-			if retryCount > maxRetry {
-				panic(fmt.Errorf("JS HTTP connection error: URL: %v Error: %+v", url, err))
-			}
-			retryCount++
-			time.Sleep(retrySleep)
-			//Refresh the connection
-			continue
-		}
-		if reqFailed {
-			trans.logger.Errorf("Failed request succeeded after %v retries, URL: %v", retryCount, url)
-		}
-
-		// perform version compatability check only on success
-		if resp.StatusCode == http.StatusOK {
-			transformerAPIVersion, convErr := strconv.Atoi(resp.Header.Get("apiVersion"))
-			if convErr != nil {
-				transformerAPIVersion = 0
-			}
-			if types.SUPPORTED_TRANSFORMER_API_VERSION != transformerAPIVersion {
-				trans.logger.Errorf("Incompatible transformer version: Expected: %d Received: %d, URL: %v", types.SUPPORTED_TRANSFORMER_API_VERSION, transformerAPIVersion, url)
-				panic(fmt.Errorf("Incompatible transformer version: Expected: %d Received: %d, URL: %v", types.SUPPORTED_TRANSFORMER_API_VERSION, transformerAPIVersion, url))
-			}
-		}
-
-		trans.requestTime(statsTags(data[0]), time.Since(s))
-		break
+	sTags := statsTags(data[0])
+	sTags["stage"] = stageFromURL(url)
+	resp := trans.post(ctx, url, sTags, rawJSON)
+	respData := resp.body
+	if resp.err != nil {
+		// ctx was cancelled before the transformer responded
+		resp.statusCode = http.StatusServiceUnavailable
+		respData = []byte(fmt.Sprintf("Transformer request cancelled: %v", resp.err))
 	}
 
 	// Remove Assertion?
-	if !(resp.StatusCode == http.StatusOK ||
-		resp.StatusCode == http.StatusBadRequest ||
-		resp.StatusCode == http.StatusNotFound ||
-		resp.StatusCode == http.StatusRequestEntityTooLarge) {
-		trans.logger.Errorf("Transformer returned status code: %v", resp.StatusCode)
+	if !(resp.statusCode == http.StatusOK ||
+		resp.statusCode == http.StatusBadRequest ||
+		resp.statusCode == http.StatusNotFound ||
+		resp.statusCode == http.StatusRequestEntityTooLarge) {
+		trans.logger.Errorf("Transformer returned status code: %v", resp.statusCode)
 	}
 
 	var transformerResponses []TransformerResponseT
-	if resp.StatusCode == http.StatusOK {
+	if resp.statusCode == http.StatusOK {
 		integrations.CollectIntgTransformErrorStats(respData)
 
 		trace.Logf(ctx, "Unmarshal", "response raw size: %d", len(respData))
@@ -383,16 +379,241 @@ func (trans *HandleT) request(ctx context.Context, url string, data []Transforme
 			trans.logger.Errorf("Transformer returned : %v", string(respData))
 			respData = []byte(fmt.Sprintf("Failed to unmarshal transformer response: %s", string(respData)))
 			transformerResponses = nil
-			resp.StatusCode = 400
+			resp.statusCode = 400
 		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.statusCode != http.StatusOK {
 		for i := range data {
 			transformEvent := &data[i]
-			resp := TransformerResponseT{StatusCode: resp.StatusCode, Error: string(respData), Metadata: transformEvent.Metadata}
+			resp := TransformerResponseT{StatusCode: resp.statusCode, Error: string(respData), Metadata: transformEvent.Metadata}
 			transformerResponses = append(transformerResponses, resp)
 		}
 	}
 	return transformerResponses
 }
+
+type postResultT struct {
+	statusCode int
+	body       []byte
+	err        error
+}
+
+type endpointT struct {
+	url            string
+	circuitBreaker *circuitBreakerT
+}
+
+// post sends the request until it gets a response from the transformer. Once the retries of the stage are exhausted,
+// or if the circuit breakers of all transformer urls are open, the request is parked: it is retried every
+// parkedRetrySleep, blocking the jobs being transformed until the transformer recovers.
+// It gives up with the error of ctx once ctx is done.
+func (trans *HandleT) post(ctx context.Context, url string, sTags stats.Tags, rawJSON []byte) postResultT {
+	stage := sTags["stage"]
+	endpoints := trans.endpoints(url)
+	retryCount := 0
+	parked := false
+	defer func() {
+		if parked {
+			trans.park(stage, -1)
+		}
+	}()
+
+	for {
+		s := time.Now()
+		var resp postResultT
+		trace.WithRegion(ctx, "request/post", func() {
+			resp = trans.hedgedPost(ctx, endpoints, stage, rawJSON)
+		})
+		if resp.err == nil {
+			trans.requestTime(sTags, time.Since(s))
+			if retryCount > 0 || parked {
+				trans.logger.Errorf("Failed request succeeded after %v retries, URL: %v", retryCount, url)
+			}
+			return resp
+		}
+
+		if !errors.Is(resp.err, errAllTransformerCircuitBreakersOpen) {
+			trans.requestTime(sTags, time.Since(s))
+			trans.logger.Errorf("JS HTTP connection error: URL: %v Error: %+v", url, resp.err)
+			stats.NewTaggedStat("processor.transformer_request_retries", stats.CountType, stats.Tags{"stage": stage}).Increment()
+			retryCount++
+			if retryCount <= *maxRetryByStage[stage] {
+				if err := sleepCtx(ctx, retrySleep); err != nil {
+					return postResultT{err: err}
+				}
+				continue
+			}
+		}
+		if !parked {
+			trans.logger.Errorf("Transformer unavailable, parking %s request until it recovers, URL: %v Error: %+v", stage, url, resp.err)
+			parked = true
+			trans.park(stage, 1)
+		}
+		if err := sleepCtx(ctx, parkedRetrySleep); err != nil {
+			return postResultT{err: err}
+		}
+	}
+}
+
+// sleepCtx sleeps for d, returning the error of ctx if it is done before
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// hedgedPost sends the request to the first transformer url whose circuit breaker allows it, falling back to the next
+// one on failure. If hedging is enabled for the stage, the request is also sent to the next url whenever no response
+// arrived within hedgeDelay. The first successful response wins and the other requests are cancelled.
+func (trans *HandleT) hedgedPost(ctx context.Context, endpoints []endpointT, stage string, rawJSON []byte) postResultT {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan postResultT, len(endpoints))
+	next, inFlight := 0, 0
+	send := func() bool {
+		for next < len(endpoints) {
+			endpoint := endpoints[next]
+			next++
+			if !endpoint.circuitBreaker.allow() {
+				continue
+			}
+			inFlight++
+			go func() {
+				results <- trans.postEndpoint(ctx, endpoint, rawJSON)
+			}()
+			return true
+		}
+		return false
+	}
+	if !send() {
+		return postResultT{err: errAllTransformerCircuitBreakersOpen}
+	}
+
+	var hedgeC <-chan time.Time
+	if *hedgingEnabledByStage[stage] && hedgeDelay > 0 && len(endpoints) > 1 {
+		hedgeTicker := time.NewTicker(hedgeDelay)
+		defer hedgeTicker.Stop()
+		hedgeC = hedgeTicker.C
+	}
+
+	var lastErr error
+	for inFlight > 0 {
+		select {
+		case resp := <-results:
+			inFlight--
+			if resp.err == nil {
+				return resp
+			}
+			lastErr = resp.err
+			send()
+		case <-hedgeC:
+			if send() {
+				stats.NewTaggedStat("processor.transformer_hedged_requests", stats.CountType, stats.Tags{"stage": stage}).Increment()
+			}
+		}
+	}
+	return postResultT{err: lastErr}
+}
+
+func (trans *HandleT) postEndpoint(ctx context.Context, endpoint endpointT, rawJSON []byte) postResultT {
+	resp := trans.doPost(ctx, endpoint.url, rawJSON)
+	switch {
+	case ctx.Err() != nil:
+		endpoint.circuitBreaker.cancel()
+	case resp.err != nil, resp.statusCode >= http.StatusInternalServerError, resp.statusCode == http.StatusTooManyRequests:
+		// the transformer pod is down, or up but failing or overloaded
+		endpoint.circuitBreaker.failure()
+	default:
+		endpoint.circuitBreaker.success()
+	}
+	return resp
+}
+
+func (trans *HandleT) doPost(ctx context.Context, url string, rawJSON []byte) postResultT {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(rawJSON))
+	if err != nil {
+		return postResultT{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := trans.Client.Do(req)
+	if err != nil {
+		return postResultT{err: err}
+	}
+	respData, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return postResultT{err: err}
+	}
+
+	// perform version compatability check only on success
+	if resp.StatusCode == http.StatusOK {
+		transformerAPIVersion, convErr := strconv.Atoi(resp.Header.Get("apiVersion"))
+		if convErr != nil {
+			transformerAPIVersion = 0
+		}
+		if types.SUPPORTED_TRANSFORMER_API_VERSION != transformerAPIVersion {
+			return postResultT{err: fmt.Errorf("Incompatible transformer version: Expected: %d Received: %d, URL: %v", types.SUPPORTED_TRANSFORMER_API_VERSION, transformerAPIVersion, url)}
+		}
+	}
+	return postResultT{statusCode: resp.StatusCode, body: respData}
+}
+
+// endpoints returns url followed by the same url on each of the hedge urls
+func (trans *HandleT) endpoints(url string) []endpointT {
+	endpoints := []endpointT{{url: url, circuitBreaker: trans.circuitBreaker(baseURL(url))}}
+	for _, hedgeURL := range hedgeURLs {
+		hedgeURL = strings.TrimSuffix(hedgeURL, "/")
+		if hedgeURL == baseURL(url) {
+			continue
+		}
+		endpoints = append(endpoints, endpointT{
+			url:            hedgeURL + strings.TrimPrefix(url, baseURL(url)),
+			circuitBreaker: trans.circuitBreaker(hedgeURL),
+		})
+	}
+	return endpoints
+}
+
+func (trans *HandleT) circuitBreaker(base string) *circuitBreakerT {
+	trans.circuitBreakersLock.Lock()
+	defer trans.circuitBreakersLock.Unlock()
+	cb, ok := trans.circuitBreakers[base]
+	if !ok {
+		cb = newCircuitBreaker(base)
+		trans.circuitBreakers[base] = cb
+	}
+	return cb
+}
+
+func (trans *HandleT) park(stage string, delta int) {
+	trans.parkedRequestsLock.Lock()
+	defer trans.parkedRequestsLock.Unlock()
+	trans.parkedRequests[stage] += delta
+	stats.NewTaggedStat("processor.transformer_parked_requests", stats.GaugeType, stats.Tags{"stage": stage}).Gauge(trans.parkedRequests[stage])
+}
+
+// baseURL returns the scheme and host of url
+func baseURL(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func stageFromURL(url string) string {
+	switch {
+	case strings.HasSuffix(url, "/customTransform"):
+		return UserTransformerStage
+	case strings.HasSuffix(url, "/v0/validate"):
+		return TrackingPlanValidationStage
+	}
+	return DestTransformerStage
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rudderlabs/rudder-server/config"
 	"github.com/rudderlabs/rudder-server/processor/transformer"
@@ -128,3 +130,213 @@ func Test_Transformer(t *testing.T) {
 		require.Equal(t, expectedResponse, rsp)
 	}
 }
+
+func newTestEvents(count int) []transformer.TransformerEventT {
+	events := make([]transformer.TransformerEventT, count)
+	for i := range events {
+		msgID := fmt.Sprintf("messageID-%d", i)
+		events[i] = transformer.TransformerEventT{
+			Metadata: transformer.MetadataT{MessageID: msgID},
+			Message:  map[string]interface{}{"src-key-1": msgID, "forceStatusCode": 200},
+		}
+	}
+	return events
+}
+
+func Test_TransformerParking(t *testing.T) {
+	t.Setenv(config.TransformKey("Processor.transformer.dest_transformer.maxRetry"), "1")
+	t.Setenv(config.TransformKey("Processor.retrySleep"), "1ms")
+	t.Setenv(config.TransformKey("Processor.transformer.parkedRetrySleep"), "10ms")
+	t.Setenv(config.TransformKey("Processor.transformer.circuitBreaker.failureThreshold"), "2")
+	t.Setenv(config.TransformKey("Processor.transformer.circuitBreaker.openDuration"), "100ms")
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	transformer.Init()
+
+	var healthy, requests int32
+	ft := &fakeTransformer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			// an incompatible transformer version is handled like a connection error
+			w.Header().Set("apiVersion", "1")
+			return
+		}
+		ft.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	tr := transformer.NewTransformer()
+	tr.Client = srv.Client()
+	tr.Setup()
+
+	done := make(chan transformer.ResponseT)
+	go func() {
+		done <- tr.Transform(context.TODO(), newTestEvents(5), srv.URL+"/v0/ga", 10)
+	}()
+
+	// the request is parked instead of panicking, and the open circuit breaker only lets probes through
+	select {
+	case <-done:
+		t.Fatal("transform returned while the transformer is unavailable")
+	case <-time.After(500 * time.Millisecond):
+	}
+	require.Less(t, atomic.LoadInt32(&requests), int32(10))
+
+	atomic.StoreInt32(&healthy, 1)
+	select {
+	case rsp := <-done:
+		require.Len(t, rsp.Events, 5)
+		require.Empty(t, rsp.FailedEvents)
+	case <-time.After(5 * time.Second):
+		t.Fatal("parked request was not resumed after the transformer recovered")
+	}
+}
+
+func Test_TransformerCircuitBreakerErrorResponses(t *testing.T) {
+	t.Setenv(config.TransformKey("Processor.transformer.dest_transformer.maxRetry"), "1")
+	t.Setenv(config.TransformKey("Processor.retrySleep"), "1ms")
+	t.Setenv(config.TransformKey("Processor.transformer.parkedRetrySleep"), "10ms")
+	t.Setenv(config.TransformKey("Processor.transformer.circuitBreaker.failureThreshold"), "2")
+	t.Setenv(config.TransformKey("Processor.transformer.circuitBreaker.openDuration"), "1h")
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	transformer.Init()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%2 == 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tr := transformer.NewTransformer()
+	tr.Client = srv.Client()
+	tr.Setup()
+
+	// the responses of a misbehaving transformer fail the events and open the circuit breaker
+	for i := 0; i < 2; i++ {
+		rsp := tr.Transform(context.TODO(), newTestEvents(5), srv.URL+"/v0/ga", 10)
+		require.Empty(t, rsp.Events)
+		require.Len(t, rsp.FailedEvents, 5)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan transformer.ResponseT)
+	go func() {
+		done <- tr.Transform(ctx, newTestEvents(5), srv.URL+"/v0/ga", 10)
+	}()
+	select {
+	case <-done:
+		t.Fatal("transform returned while the circuit breaker is open")
+	case <-time.After(200 * time.Millisecond):
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	cancel()
+	<-done
+}
+
+func Test_TransformerParkingCancelled(t *testing.T) {
+	t.Setenv(config.TransformKey("Processor.transformer.dest_transformer.maxRetry"), "1")
+	t.Setenv(config.TransformKey("Processor.retrySleep"), "1ms")
+	t.Setenv(config.TransformKey("Processor.transformer.parkedRetrySleep"), "1h")
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	transformer.Init()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apiVersion", "1")
+	}))
+	defer srv.Close()
+
+	tr := transformer.NewTransformer()
+	tr.Client = srv.Client()
+	tr.Setup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan transformer.ResponseT)
+	go func() {
+		done <- tr.Transform(ctx, newTestEvents(5), srv.URL+"/v0/ga", 10)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case rsp := <-done:
+		require.Empty(t, rsp.Events)
+		require.Len(t, rsp.FailedEvents, 5)
+		require.Equal(t, http.StatusServiceUnavailable, rsp.FailedEvents[0].StatusCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("parked request was not given up once its context was cancelled")
+	}
+}
+
+func Test_TransformerHedging(t *testing.T) {
+	config.Load()
+	logger.Init()
+	stats.Setup()
+
+	var hedgeRequests int32
+	ft := &fakeTransformer{}
+	hedgeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hedgeRequests, 1)
+		ft.ServeHTTP(w, r)
+	}))
+	defer hedgeSrv.Close()
+
+	release := make(chan struct{})
+	slowSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slowSrv.Close()
+	defer close(release)
+
+	downSrv := httptest.NewServer(ft)
+	downSrv.Close()
+
+	t.Setenv(config.TransformKey("Processor.transformer.hedgeURLs"), hedgeSrv.URL)
+	t.Setenv(config.TransformKey("Processor.transformer.hedgeDelay"), "50ms")
+	transformer.Init()
+
+	tr := transformer.NewTransformer()
+	tr.Client = &http.Client{}
+	tr.Setup()
+
+	t.Run("slow transformer is hedged", func(t *testing.T) {
+		s := time.Now()
+		rsp := tr.Transform(context.TODO(), newTestEvents(5), slowSrv.URL+"/v0/ga", 10)
+		require.Len(t, rsp.Events, 5)
+		require.Less(t, time.Since(s), time.Second)
+	})
+
+	t.Run("user transformations are not hedged", func(t *testing.T) {
+		requests := atomic.LoadInt32(&hedgeRequests)
+		done := make(chan struct{})
+		go func() {
+			tr.Transform(context.TODO(), newTestEvents(5), slowSrv.URL+"/customTransform", 10)
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("user transformation was hedged")
+		case <-time.After(300 * time.Millisecond):
+		}
+		require.Equal(t, requests, atomic.LoadInt32(&hedgeRequests))
+		slowSrv.CloseClientConnections()
+		<-done
+	})
+
+	t.Run("unreachable transformer falls back to the next url", func(t *testing.T) {
+		rsp := tr.Transform(context.TODO(), newTestEvents(5), downSrv.URL+"/customTransform", 10)
+		require.Len(t, rsp.Events, 5)
+	})
+}
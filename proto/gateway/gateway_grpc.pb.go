@@ -0,0 +1,172 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GatewayClient is the client API for Gateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GatewayClient interface {
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	BatchStream(ctx context.Context, opts ...grpc.CallOption) (Gateway_BatchStreamClient, error)
+}
+
+type gatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGatewayClient(cc grpc.ClientConnInterface) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Gateway/Batch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) BatchStream(ctx context.Context, opts ...grpc.CallOption) (Gateway_BatchStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gateway_ServiceDesc.Streams[0], "/proto.Gateway/BatchStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gatewayBatchStreamClient{stream}
+	return x, nil
+}
+
+type Gateway_BatchStreamClient interface {
+	Send(*BatchRequest) error
+	CloseAndRecv() (*BatchStreamResponse, error)
+	grpc.ClientStream
+}
+
+type gatewayBatchStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *gatewayBatchStreamClient) Send(m *BatchRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gatewayBatchStreamClient) CloseAndRecv() (*BatchStreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BatchStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GatewayServer is the server API for Gateway service.
+// All implementations must embed UnimplementedGatewayServer
+// for forward compatibility
+type GatewayServer interface {
+	Batch(context.Context, *BatchRequest) (*BatchResponse, error)
+	BatchStream(Gateway_BatchStreamServer) error
+	mustEmbedUnimplementedGatewayServer()
+}
+
+// UnimplementedGatewayServer must be embedded to have forward compatible implementations.
+type UnimplementedGatewayServer struct {
+}
+
+func (UnimplementedGatewayServer) Batch(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedGatewayServer) BatchStream(Gateway_BatchStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method BatchStream not implemented")
+}
+func (UnimplementedGatewayServer) mustEmbedUnimplementedGatewayServer() {}
+
+// UnsafeGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GatewayServer will
+// result in compilation errors.
+type UnsafeGatewayServer interface {
+	mustEmbedUnimplementedGatewayServer()
+}
+
+func RegisterGatewayServer(s grpc.ServiceRegistrar, srv GatewayServer) {
+	s.RegisterService(&Gateway_ServiceDesc, srv)
+}
+
+func _Gateway_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Gateway/Batch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_BatchStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GatewayServer).BatchStream(&gatewayBatchStreamServer{stream})
+}
+
+type Gateway_BatchStreamServer interface {
+	SendAndClose(*BatchStreamResponse) error
+	Recv() (*BatchRequest, error)
+	grpc.ServerStream
+}
+
+type gatewayBatchStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *gatewayBatchStreamServer) SendAndClose(m *BatchStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gatewayBatchStreamServer) Recv() (*BatchRequest, error) {
+	m := new(BatchRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Gateway_ServiceDesc is the grpc.ServiceDesc for Gateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Batch",
+			Handler:    _Gateway_Batch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BatchStream",
+			Handler:       _Gateway_BatchStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/gateway/gateway.proto",
+}
@@ -3,28 +3,94 @@ package ratelimiter
 //go:generate mockgen -destination=../mocks/rate-limiter/mock_ratelimiter.go -package=mocks_ratelimiter github.com/rudderlabs/rudder-server/rate-limiter RateLimiter
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/EagleChen/restrictor"
 	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/rruntime"
 	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/pubsub"
 )
 
 var (
 	eventLimit            int
 	rateLimitWindowInMins time.Duration
 	noOfBucketsInWindow   int
+	overridesFile         string
+	cleanupInterval       time.Duration
 	pkgLogger             logger.LoggerI
 )
 
+// sourceConfigKey is the key in the source config of backend config holding the rate limit of the source
+const sourceConfigKey = "rateLimit"
+
 //RateLimiter is an interface for rate limiting functions
 type RateLimiter interface {
-	LimitReached(key string) bool
+	LimitReached(keys KeysT, events int) LimitStatusT
+}
+
+// KeysT are the entities a request is counted against. Limits are checked for every non empty key.
+type KeysT struct {
+	WorkspaceID string
+	SourceID    string
+	WriteKey    string
+}
+
+// LimitT is the maximum number of events allowed in a rolling window
+type LimitT struct {
+	EventLimit int    `json:"eventLimit"`
+	Window     string `json:"window"`
+}
+
+// LimitStatusT is the state of the most restrictive limit applicable to a request
+type LimitStatusT struct {
+	// Reached is true if the request was rejected, in which case its events are not counted
+	Reached bool
+	// Limit is the event limit of the most restrictive key, 0 if no limit applies
+	Limit int
+	// Remaining is the number of events which can still be sent in the current window
+	Remaining int
+	// ResetAt is the time at which the oldest events counted in the window expire
+	ResetAt time.Time
+	// RetryAfter is the time to wait before the request can be accepted, set only when Reached is true
+	RetryAfter time.Duration
+}
+
+// overridesT is the format of the local override file, containing limits keyed by workspace id, source id and write key
+type overridesT struct {
+	Workspaces map[string]LimitT `json:"workspaces"`
+	Sources    map[string]LimitT `json:"sources"`
+	WriteKeys  map[string]LimitT `json:"writeKeys"`
+}
+
+type limitT struct {
+	events int
+	window time.Duration
+}
+
+// counterT counts events in buckets of bucketSpan, in a rolling window
+type counterT struct {
+	window     time.Duration
+	bucketSpan time.Duration
+	buckets    map[int64]int
 }
 
 //HandleT is a Handle for event limiter
 type HandleT struct {
-	restrictor restrictor.Restrictor
+	lock          sync.Mutex
+	defaultLimit  limitT
+	overrideLimit map[string]limitT
+	configLimit   map[string]limitT
+	counters      map[string]*counterT
+	now           func() time.Time
 }
 
 func Init() {
@@ -39,19 +105,279 @@ func loadConfig() {
 	config.RegisterDurationConfigVariable(time.Duration(60), &rateLimitWindowInMins, false, time.Minute, []string{"RateLimit.rateLimitWindow", "RateLimit.rateLimitWindowInMins"}...)
 	// Number of buckets in time window. 12 by default
 	config.RegisterIntConfigVariable(12, &noOfBucketsInWindow, false, 1, "RateLimit.noOfBucketsInWindow")
+	// Path of a json file with limits per workspace, source and write key, taking precedence over backend config
+	config.RegisterStringConfigVariable("", &overridesFile, false, "RateLimit.overridesFile")
+	// Interval at which counters of idle keys are removed
+	config.RegisterDurationConfigVariable(time.Duration(5), &cleanupInterval, false, time.Minute, "RateLimit.cleanupInterval")
 }
 
-//SetUp eventLimiter
-func (rateLimiter *HandleT) SetUp() {
-	store, err := restrictor.NewMemoryStore()
+//SetUp eventLimiter, its idle counters are cleaned up until ctx is done
+func (rateLimiter *HandleT) SetUp(ctx context.Context, backendConfig backendconfig.BackendConfig) {
+	rateLimiter.defaultLimit = limitT{events: eventLimit, window: rateLimitWindowInMins}
+	rateLimiter.counters = make(map[string]*counterT)
+	rateLimiter.configLimit = make(map[string]limitT)
+	rateLimiter.now = time.Now
+	if overridesFile != "" {
+		if err := rateLimiter.loadOverrides(overridesFile); err != nil {
+			pkgLogger.Errorf("[Rate Limiter] Failed to load overrides from %s: %v", overridesFile, err)
+		}
+	}
+
+	if backendConfig != nil {
+		rruntime.Go(func() {
+			rateLimiter.backendConfigSubscriber(backendConfig)
+		})
+	}
+	rruntime.Go(func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rateLimiter.cleanup()
+			}
+		}
+	})
+}
+
+func (rateLimiter *HandleT) loadOverrides(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		pkgLogger.Error("memory store failed")
+		return err
+	}
+	var overrides overridesT
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return err
+	}
+
+	overrideLimit := make(map[string]limitT)
+	for _, l := range []struct {
+		prefix string
+		limits map[string]LimitT
+	}{
+		{workspacePrefix, overrides.Workspaces},
+		{sourcePrefix, overrides.Sources},
+		{writeKeyPrefix, overrides.WriteKeys},
+	} {
+		for id, limit := range l.limits {
+			parsed, err := rateLimiter.parseLimit(limit)
+			if err != nil {
+				return fmt.Errorf("invalid limit for %s: %w", id, err)
+			}
+			overrideLimit[l.prefix+id] = parsed
+		}
+	}
+
+	rateLimiter.lock.Lock()
+	defer rateLimiter.lock.Unlock()
+	rateLimiter.overrideLimit = overrideLimit
+	return nil
+}
+
+// parseLimit converts a configured limit, defaulting its window to the global rate limit window
+func (rateLimiter *HandleT) parseLimit(limit LimitT) (limitT, error) {
+	window := rateLimiter.defaultLimit.window
+	if limit.Window != "" {
+		var err error
+		if window, err = time.ParseDuration(limit.Window); err != nil {
+			return limitT{}, err
+		}
 	}
+	if window <= 0 {
+		return limitT{}, fmt.Errorf("window should be positive, got %v", window)
+	}
+	return limitT{events: limit.EventLimit, window: window}, nil
+}
 
-	rateLimiter.restrictor = restrictor.NewRestrictor(rateLimitWindowInMins, uint32(eventLimit), uint32(noOfBucketsInWindow), store)
+// backendConfigSubscriber picks up source limits from the `rateLimit` field of source config
+func (rateLimiter *HandleT) backendConfigSubscriber(backendConfig backendconfig.BackendConfig) {
+	ch := make(chan pubsub.DataEvent)
+	backendConfig.Subscribe(ch, backendconfig.TopicProcessConfig)
+	for configEvent := range ch {
+		configLimit := make(map[string]limitT)
+		sources := configEvent.Data.(backendconfig.ConfigT)
+		for _, source := range sources.Sources {
+			raw, ok := source.Config[sourceConfigKey]
+			if !ok {
+				continue
+			}
+			var limit LimitT
+			marshalled, _ := json.Marshal(raw)
+			if err := json.Unmarshal(marshalled, &limit); err != nil {
+				pkgLogger.Errorf("[Rate Limiter] Invalid rate limit for source %s: %v", source.ID, err)
+				continue
+			}
+			parsed, err := rateLimiter.parseLimit(limit)
+			if err != nil {
+				pkgLogger.Errorf("[Rate Limiter] Invalid rate limit for source %s: %v", source.ID, err)
+				continue
+			}
+			configLimit[sourcePrefix+source.ID] = parsed
+		}
+		rateLimiter.lock.Lock()
+		rateLimiter.configLimit = configLimit
+		rateLimiter.lock.Unlock()
+	}
 }
 
-//LimitReached returns true if number of events in the rolling window is less than the max events allowed, else false
-func (rateLimiter *HandleT) LimitReached(key string) bool {
-	return rateLimiter.restrictor.LimitReached(key)
+const (
+	workspacePrefix = "workspace:"
+	sourcePrefix    = "source:"
+	writeKeyPrefix  = "writeKey:"
+)
+
+// limitFor returns the limit of a key, override file first, then backend config.
+// Only workspaces fall back to the global limit.
+func (rateLimiter *HandleT) limitFor(key string) (limitT, bool) {
+	if limit, ok := rateLimiter.overrideLimit[key]; ok {
+		return limit, true
+	}
+	if limit, ok := rateLimiter.configLimit[key]; ok {
+		return limit, true
+	}
+	if strings.HasPrefix(key, workspacePrefix) {
+		return rateLimiter.defaultLimit, true
+	}
+	return limitT{}, false
+}
+
+//LimitReached checks the events against the limits of all keys and counts them if none of the limits is reached.
+//The returned status is the one of the most restrictive limit.
+func (rateLimiter *HandleT) LimitReached(keys KeysT, events int) LimitStatusT {
+	rateLimiter.lock.Lock()
+	defer rateLimiter.lock.Unlock()
+
+	now := rateLimiter.now()
+	var status LimitStatusT
+	var toCount []*counterT
+	for _, key := range []string{workspacePrefix + keys.WorkspaceID, sourcePrefix + keys.SourceID, writeKeyPrefix + keys.WriteKey} {
+		if key == workspacePrefix || key == sourcePrefix || key == writeKeyPrefix {
+			continue
+		}
+		limit, ok := rateLimiter.limitFor(key)
+		if !ok {
+			continue
+		}
+		counter := rateLimiter.counter(key, limit.window)
+		total := counter.total(now)
+		keyStatus := LimitStatusT{
+			Limit:     limit.events,
+			Remaining: limit.events - total - events,
+			ResetAt:   counter.resetAt(now),
+		}
+		if keyStatus.Remaining < 0 {
+			keyStatus.Reached = true
+			keyStatus.Remaining = limit.events - total
+			keyStatus.RetryAfter = counter.retryAfter(now, limit.events-events)
+		}
+		if keyStatus.Remaining < 0 {
+			keyStatus.Remaining = 0
+		}
+		if status.Limit == 0 || moreRestrictive(keyStatus, status) {
+			status = keyStatus
+		}
+		toCount = append(toCount, counter)
+	}
+
+	if !status.Reached {
+		for _, counter := range toCount {
+			counter.add(now, events)
+		}
+	}
+	return status
+}
+
+func moreRestrictive(a, b LimitStatusT) bool {
+	if a.Reached != b.Reached {
+		return a.Reached
+	}
+	if a.Reached {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func (rateLimiter *HandleT) counter(key string, window time.Duration) *counterT {
+	counter, ok := rateLimiter.counters[key]
+	if !ok || counter.window != window {
+		bucketSpan := window / time.Duration(noOfBucketsInWindow)
+		if bucketSpan < time.Second {
+			bucketSpan = time.Second
+		}
+		counter = &counterT{window: window, bucketSpan: bucketSpan, buckets: make(map[int64]int)}
+		rateLimiter.counters[key] = counter
+	}
+	return counter
+}
+
+func (rateLimiter *HandleT) cleanup() {
+	rateLimiter.lock.Lock()
+	defer rateLimiter.lock.Unlock()
+	now := rateLimiter.now()
+	for key, counter := range rateLimiter.counters {
+		if counter.total(now) == 0 {
+			delete(rateLimiter.counters, key)
+		}
+	}
+}
+
+// bucket returns the start of the bucket t belongs to, in unix nanoseconds
+func (c *counterT) bucket(t time.Time) int64 {
+	return t.Truncate(c.bucketSpan).UnixNano()
+}
+
+// total removes buckets which are out of the window and returns the number of events in the window
+func (c *counterT) total(now time.Time) int {
+	boundary := now.Add(-c.window).UnixNano()
+	var total int
+	for start, count := range c.buckets {
+		if start+int64(c.bucketSpan) <= boundary {
+			delete(c.buckets, start)
+			continue
+		}
+		total += count
+	}
+	return total
+}
+
+func (c *counterT) add(now time.Time, events int) {
+	c.buckets[c.bucket(now)] += events
+}
+
+// resetAt returns the time at which the oldest bucket in the window expires
+func (c *counterT) resetAt(now time.Time) time.Time {
+	oldest := int64(math.MaxInt64)
+	for start := range c.buckets {
+		if start < oldest {
+			oldest = start
+		}
+	}
+	if oldest == math.MaxInt64 {
+		return now
+	}
+	return time.Unix(0, oldest).Add(c.bucketSpan + c.window)
+}
+
+// retryAfter returns the time until the events in the window drop to allowed.
+// If allowed is negative the request can never be accepted, and the whole window is returned.
+func (c *counterT) retryAfter(now time.Time, allowed int) time.Duration {
+	if allowed < 0 {
+		return c.window
+	}
+	starts := make([]int64, 0, len(c.buckets))
+	total := 0
+	for start, count := range c.buckets {
+		starts = append(starts, start)
+		total += count
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		total -= c.buckets[start]
+		if total <= allowed {
+			return time.Unix(0, start).Add(c.bucketSpan + c.window).Sub(now)
+		}
+	}
+	return 0
 }
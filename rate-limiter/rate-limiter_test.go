@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+var _ = Describe("RateLimiter", func() {
+	var (
+		rateLimiter *HandleT
+		now         time.Time
+		tmpDir      string
+		cancel      context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		config.Load()
+		logger.Init()
+		Init()
+
+		now = time.Unix(1_000_000, 0)
+		rateLimiter = &HandleT{}
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		rateLimiter.SetUp(ctx, nil)
+		rateLimiter.now = func() time.Time { return now }
+
+		var err error
+		tmpDir, err = os.MkdirTemp("", "rate-limiter")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(tmpDir)
+	})
+
+	writeOverrides := func(content string) string {
+		path := filepath.Join(tmpDir, "overrides.json")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("should count events against the global workspace limit", func() {
+		rateLimiter.defaultLimit = limitT{events: 10, window: time.Minute}
+		keys := KeysT{WorkspaceID: "w1", SourceID: "s1", WriteKey: "wk1"}
+
+		status := rateLimiter.LimitReached(keys, 6)
+		Expect(status.Reached).To(BeFalse())
+		Expect(status.Limit).To(Equal(10))
+		Expect(status.Remaining).To(Equal(4))
+
+		status = rateLimiter.LimitReached(keys, 6)
+		Expect(status.Reached).To(BeTrue())
+		Expect(status.Remaining).To(Equal(4))
+		Expect(status.RetryAfter).To(BeNumerically(">", 55*time.Second))
+		Expect(status.RetryAfter).To(BeNumerically("<=", 65*time.Second))
+
+		// rejected events are not counted
+		Expect(rateLimiter.LimitReached(keys, 4).Reached).To(BeFalse())
+
+		now = now.Add(2 * time.Minute)
+		status = rateLimiter.LimitReached(keys, 10)
+		Expect(status.Reached).To(BeFalse())
+		Expect(status.Remaining).To(Equal(0))
+	})
+
+	It("should apply the most restrictive of workspace, source and write key limits", func() {
+		Expect(rateLimiter.loadOverrides(writeOverrides(`{
+			"workspaces": {"w1": {"eventLimit": 100, "window": "1m"}},
+			"sources": {"s1": {"eventLimit": 5, "window": "1m"}},
+			"writeKeys": {"wk2": {"eventLimit": 3, "window": "1m"}}
+		}`))).To(Succeed())
+
+		// a noisy source does not starve the other sources of the workspace
+		Expect(rateLimiter.LimitReached(KeysT{WorkspaceID: "w1", SourceID: "s1", WriteKey: "wk1"}, 5).Reached).To(BeFalse())
+		status := rateLimiter.LimitReached(KeysT{WorkspaceID: "w1", SourceID: "s1", WriteKey: "wk1"}, 1)
+		Expect(status.Reached).To(BeTrue())
+		Expect(status.Limit).To(Equal(5))
+
+		status = rateLimiter.LimitReached(KeysT{WorkspaceID: "w1", SourceID: "s2", WriteKey: "wk2"}, 2)
+		Expect(status.Reached).To(BeFalse())
+		Expect(status.Limit).To(Equal(3))
+		Expect(status.Remaining).To(Equal(1))
+
+		status = rateLimiter.LimitReached(KeysT{WorkspaceID: "w1", SourceID: "s3", WriteKey: "wk3"}, 1)
+		Expect(status.Limit).To(Equal(100))
+		Expect(status.Remaining).To(Equal(92))
+	})
+
+	It("should reject requests with more events than the limit for the whole window", func() {
+		rateLimiter.defaultLimit = limitT{events: 10, window: time.Minute}
+		status := rateLimiter.LimitReached(KeysT{WorkspaceID: "w1"}, 11)
+		Expect(status.Reached).To(BeTrue())
+		Expect(status.RetryAfter).To(Equal(time.Minute))
+	})
+
+	It("should fail loading invalid overrides", func() {
+		Expect(rateLimiter.loadOverrides(writeOverrides(`{"sources": {"s1": {"eventLimit": 5, "window": "invalid"}}}`))).NotTo(Succeed())
+	})
+})
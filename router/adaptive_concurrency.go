@@ -0,0 +1,157 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/router/types"
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+// adaptiveConcurrencyT limits the number of in-flight jobs per destination ID.
+// Jobs of a destination are not picked up while as many jobs as its limit are in flight, from their pick up
+// until their request completes. The limit follows AIMD: it grows additively (by one per limit healthy responses)
+// and shrinks multiplicatively on 429/5xx responses or when the response latency exceeds latencyThreshold.
+type adaptiveConcurrencyT struct {
+	destName         string
+	minLimit         float64
+	maxLimit         float64
+	decreaseFactor   float64
+	latencyThreshold time.Duration
+	decreaseCooldown time.Duration
+
+	limitersMu sync.Mutex
+	limiters   map[string]*adaptiveLimiterT // destinationID -> limiter
+}
+
+type adaptiveLimiterT struct {
+	mu           sync.Mutex
+	limit        float64
+	inFlight     map[int64]struct{} // ids of the jobs picked up and not completed yet
+	lastDecrease time.Time
+	limitStat    stats.RudderStats
+}
+
+// newAdaptiveConcurrency returns nil if adaptive concurrency is not enabled for destName.
+// The maximum limit defaults to the number of router workers.
+func newAdaptiveConcurrency(destName string, noOfWorkers int) *adaptiveConcurrencyT {
+	if !getRouterConfigBool("adaptiveConcurrency.enabled", destName, false) {
+		return nil
+	}
+	ac := &adaptiveConcurrencyT{
+		destName:       destName,
+		minLimit:       float64(getRouterConfigInt("adaptiveConcurrency.minLimit", destName, 1)),
+		maxLimit:       float64(getRouterConfigInt("adaptiveConcurrency.maxLimit", destName, noOfWorkers)),
+		decreaseFactor: getRouterConfigFloat64("adaptiveConcurrency.decreaseFactor", destName, 0.5),
+		limiters:       make(map[string]*adaptiveLimiterT),
+	}
+	config.RegisterDurationConfigVariable(time.Duration(5), &ac.latencyThreshold, true, time.Second,
+		[]string{"Router." + destName + ".adaptiveConcurrency.latencyThreshold", "Router.adaptiveConcurrency.latencyThreshold"}...)
+	config.RegisterDurationConfigVariable(time.Duration(1), &ac.decreaseCooldown, true, time.Second,
+		[]string{"Router." + destName + ".adaptiveConcurrency.decreaseCooldown", "Router.adaptiveConcurrency.decreaseCooldown"}...)
+	if ac.minLimit < 1 {
+		ac.minLimit = 1
+	}
+	if ac.maxLimit < ac.minLimit {
+		ac.maxLimit = ac.minLimit
+	}
+	if ac.decreaseFactor <= 0 || ac.decreaseFactor >= 1 {
+		ac.decreaseFactor = 0.5
+	}
+	return ac
+}
+
+func (ac *adaptiveConcurrencyT) limiter(destinationID string) *adaptiveLimiterT {
+	ac.limitersMu.Lock()
+	defer ac.limitersMu.Unlock()
+	l, ok := ac.limiters[destinationID]
+	if !ok {
+		l = &adaptiveLimiterT{
+			limit:    ac.maxLimit,
+			inFlight: make(map[int64]struct{}),
+			limitStat: stats.NewTaggedStat("router_adaptive_concurrency_limit", stats.GaugeType, stats.Tags{
+				"destType":      ac.destName,
+				"destinationId": destinationID,
+			}),
+		}
+		l.limitStat.Gauge(int(l.limit))
+		ac.limiters[destinationID] = l
+	}
+	return l
+}
+
+// allow returns false if jobs of destinationID must not be picked up, because as many jobs as its limit are in flight
+func (ac *adaptiveConcurrencyT) allow(destinationID string) bool {
+	l := ac.limiter(destinationID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.inFlight) < int(l.limit)
+}
+
+// picked marks the job of destinationID as in flight, until it is completed or released
+func (ac *adaptiveConcurrencyT) picked(destinationID string, jobID int64) {
+	l := ac.limiter(destinationID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight[jobID] = struct{}{}
+}
+
+// release marks jobs of destinationID which won't be sent as no longer in flight, leaving the limit unchanged.
+// Jobs which are not in flight are ignored.
+func (ac *adaptiveConcurrencyT) release(destinationID string, jobIDs ...int64) {
+	l := ac.limiter(destinationID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, jobID := range jobIDs {
+		delete(l.inFlight, jobID)
+	}
+}
+
+// completed marks the jobs sent to destinationID in a request as no longer in flight, and adapts the limit
+// to the latency and status code of the response
+func (ac *adaptiveConcurrencyT) completed(destinationID string, jobIDs []int64, latency time.Duration, statusCode int) {
+	l := ac.limiter(destinationID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, jobID := range jobIDs {
+		delete(l.inFlight, jobID)
+	}
+	// timed out jobs are not sent, so they say nothing about the destination's health
+	if statusCode == types.RouterTimedOutStatusCode {
+		return
+	}
+
+	prevLimit := int(l.limit)
+	overloaded := statusCode == http.StatusTooManyRequests || statusCode >= 500 || latency > ac.latencyThreshold
+	if overloaded {
+		// requests in flight when the destination got overloaded complete together, decrease once for them
+		if time.Since(l.lastDecrease) > ac.decreaseCooldown {
+			l.limit = math.Max(ac.minLimit, l.limit*ac.decreaseFactor)
+			l.lastDecrease = time.Now()
+		}
+	} else {
+		l.limit = math.Min(ac.maxLimit, l.limit+1/l.limit)
+	}
+	if int(l.limit) != prevLimit {
+		l.limitStat.Gauge(int(l.limit))
+	}
+}
+
+// Status returns the current limit and number of in-flight jobs per destination ID
+func (ac *adaptiveConcurrencyT) Status() map[string]interface{} {
+	ac.limitersMu.Lock()
+	defer ac.limitersMu.Unlock()
+	status := make(map[string]interface{}, len(ac.limiters))
+	for destinationID, l := range ac.limiters {
+		l.mu.Lock()
+		status[destinationID] = map[string]int{
+			"limit":     int(l.limit),
+			"in-flight": len(l.inFlight),
+		}
+		l.mu.Unlock()
+	}
+	return status
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rudderlabs/rudder-server/router/types"
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+var _ = Describe("Adaptive concurrency", func() {
+	var ac *adaptiveConcurrencyT
+
+	BeforeEach(func() {
+		stats.Setup()
+		ac = &adaptiveConcurrencyT{
+			destName:         "WEBHOOK",
+			minLimit:         1,
+			maxLimit:         4,
+			decreaseFactor:   0.5,
+			latencyThreshold: time.Second,
+			limiters:         make(map[string]*adaptiveLimiterT),
+		}
+	})
+
+	limitOf := func(destinationID string) int {
+		return ac.Status()[destinationID].(map[string]int)["limit"]
+	}
+	inFlightOf := func(destinationID string) int {
+		return ac.Status()[destinationID].(map[string]int)["in-flight"]
+	}
+	var jobID int64
+	send := func(destinationID string, latency time.Duration, statusCode int) {
+		jobID++
+		ac.picked(destinationID, jobID)
+		ac.completed(destinationID, []int64{jobID}, latency, statusCode)
+	}
+
+	It("should shrink the limit multiplicatively on overload and grow it additively when healthy", func() {
+		send("d1", 10*time.Millisecond, http.StatusTooManyRequests)
+		Expect(limitOf("d1")).To(Equal(2))
+		send("d1", 2*time.Second, http.StatusOK)
+		Expect(limitOf("d1")).To(Equal(1))
+		send("d1", 10*time.Millisecond, http.StatusBadGateway)
+		Expect(limitOf("d1")).To(Equal(1))
+
+		// one healthy response per unit of limit grows it by one
+		send("d1", 10*time.Millisecond, http.StatusOK)
+		Expect(limitOf("d1")).To(Equal(2))
+		for i := 0; i < 20; i++ {
+			send("d1", 10*time.Millisecond, http.StatusBadRequest)
+		}
+		Expect(limitOf("d1")).To(Equal(4))
+
+		// other destinations are not affected
+		send("d2", 10*time.Millisecond, types.RouterTimedOutStatusCode)
+		Expect(limitOf("d2")).To(Equal(4))
+	})
+
+	It("should only decrease once per cooldown", func() {
+		ac.decreaseCooldown = time.Hour
+		send("d1", 10*time.Millisecond, http.StatusInternalServerError)
+		send("d1", 10*time.Millisecond, http.StatusInternalServerError)
+		Expect(limitOf("d1")).To(Equal(2))
+	})
+
+	It("should not allow picking jobs up over the limit until jobs in flight complete or are released", func() {
+		ac.maxLimit = 2
+		Expect(ac.allow("d1")).To(BeTrue())
+		ac.picked("d1", 1)
+		ac.picked("d1", 2)
+		Expect(ac.allow("d1")).To(BeFalse())
+		Expect(inFlightOf("d1")).To(Equal(2))
+		Expect(ac.allow("d2")).To(BeTrue())
+
+		ac.completed("d1", []int64{1}, 10*time.Millisecond, http.StatusOK)
+		Expect(ac.allow("d1")).To(BeTrue())
+		ac.picked("d1", 3)
+		Expect(ac.allow("d1")).To(BeFalse())
+
+		// released jobs leave the limit unchanged, and releasing them again is a no-op
+		ac.release("d1", 2, 3)
+		ac.release("d1", 2)
+		Expect(inFlightOf("d1")).To(Equal(0))
+		Expect(limitOf("d1")).To(Equal(2))
+	})
+})
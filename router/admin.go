@@ -62,6 +62,12 @@ func (ra *Admin) Status() interface{} {
 		if len(abortedUsersMap) > 0 {
 			routerStatus["aborted-usersmap"] = abortedUsersMap
 		}
+		if router.adaptiveConcurrency != nil {
+			routerStatus["adaptive-concurrency"] = router.adaptiveConcurrency.Status()
+		}
+		if router.circuitBreaker != nil {
+			routerStatus["circuit-breaker"] = router.circuitBreaker.Status()
+		}
 
 		statusList = append(statusList, routerStatus)
 	}
@@ -172,6 +178,30 @@ func (r *RouterRpcHandler) getReadOnlyJobsDB(prefix string) jobsdb.ReadonlyJobsD
 	return r.readonlyBatchRouterDB
 }
 
+// GetCircuitBreakerStates returns the circuit breaker state of every destination of the routers with circuit breaker enabled.
+// arg optionally filters the routers by destination type.
+func (r *RouterRpcHandler) GetCircuitBreakerStates(arg string, result *string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pkgLogger.Error(r)
+			err = fmt.Errorf("internal Rudder server error: %v", r)
+		}
+	}()
+	states := make(map[string]interface{})
+	for name, router := range adminInstance.handles {
+		if router.circuitBreaker == nil || (arg != "" && arg != name) {
+			continue
+		}
+		states[name] = router.circuitBreaker.Status()
+	}
+	response, err := json.MarshalIndent(states, "", " ")
+	if err != nil {
+		return err
+	}
+	*result = string(response)
+	return nil
+}
+
 func (r *RouterRpcHandler) GetDSJobCount(arg string, result *string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
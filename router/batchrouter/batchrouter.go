@@ -37,6 +37,7 @@ import (
 	"github.com/rudderlabs/rudder-server/services/diagnostics"
 	"github.com/rudderlabs/rudder-server/services/filemanager"
 	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
 	"github.com/rudderlabs/rudder-server/utils/pubsub"
@@ -44,6 +45,7 @@ import (
 	warehouseutils "github.com/rudderlabs/rudder-server/warehouse/utils"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -1681,7 +1683,9 @@ func (worker *workerT) workerProcess() {
 					case misc.ContainsString(objectStorageDestinations, brt.destType):
 						destUploadStat := stats.NewStat(fmt.Sprintf(`batch_router.%s_dest_upload_time`, brt.destType), stats.TimerType)
 						destUploadStat.Start()
+						startedAt := time.Now()
 						output := brt.copyJobsToStorage(brt.destType, &batchJobs, true, false)
+						brt.traceUpload(&batchJobs, startedAt, output.Error)
 						brt.recordDeliveryStatus(*batchJobs.BatchDestination, output, false)
 						brt.setJobStatus(&batchJobs, false, output.Error, false)
 						misc.RemoveFilePaths(output.LocalFilePaths...)
@@ -1700,7 +1704,9 @@ func (worker *workerT) workerProcess() {
 						destUploadStat.Start()
 						splitBatchJobs := brt.splitBatchJobsOnTimeWindow(batchJobs)
 						for _, batchJob := range splitBatchJobs {
+							startedAt := time.Now()
 							output := brt.copyJobsToStorage(objectStorageType, batchJob, true, true)
+							brt.traceUpload(batchJob, startedAt, output.Error)
 							postToWarehouseErr := false
 							if output.Error == nil && output.Key != "" {
 								output.Error = brt.postToWarehouse(batchJob, output)
@@ -1735,6 +1741,30 @@ func (worker *workerT) workerProcess() {
 	}
 }
 
+// traceUpload emits an upload span in the trace of each job of the batch
+func (brt *HandleT) traceUpload(batchJobs *BatchJobsT, startedAt time.Time, err error) {
+	if !tracing.Enabled() {
+		return
+	}
+	var errorMessage string
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	endedAt := time.Now()
+	traced := make(map[string]struct{})
+	for _, job := range batchJobs.Jobs {
+		traceParent := gjson.GetBytes(job.Parameters, tracing.TraceParentHeader).Str
+		if _, ok := traced[traceParent]; ok {
+			continue
+		}
+		traced[traceParent] = struct{}{}
+		tracing.RecordSpan(traceParent, "batchrouter.upload", startedAt, endedAt, errorMessage,
+			attribute.String("destType", brt.destType),
+			attribute.String("destinationId", batchJobs.BatchDestination.Destination.ID),
+		)
+	}
+}
+
 func (brt *HandleT) initWorkers() {
 	brt.workers = make([]*workerT, brt.noOfWorkers)
 
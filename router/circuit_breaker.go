@@ -0,0 +1,185 @@
+package router
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/rruntime"
+	"github.com/rudderlabs/rudder-server/services/alert"
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitHalfOpen = "half-open"
+	circuitOpen     = "open"
+)
+
+// circuitBreakerT stops the router from picking up jobs of a destination ID which is down.
+// A circuit opens when the ratio of 5xx responses in a window reaches failureRatio. After openDuration it turns
+// half-open, letting a single probe job through: the circuit closes if the probe succeeds and opens again otherwise.
+type circuitBreakerT struct {
+	destName     string
+	failureRatio float64
+	minRequests  int
+	window       time.Duration
+	openDuration time.Duration
+	alertManager alert.AlertManager
+	now          func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuitT // destinationID -> circuit
+}
+
+type circuitT struct {
+	state          string
+	since          time.Time
+	windowStart    time.Time
+	requests       int
+	failures       int
+	probeStartedAt time.Time // zero if no probe is in flight
+	stateStat      stats.RudderStats
+}
+
+// newCircuitBreaker returns nil if the circuit breaker is not enabled for destName
+func newCircuitBreaker(destName string) *circuitBreakerT {
+	if !getRouterConfigBool("circuitBreaker.enabled", destName, false) {
+		return nil
+	}
+	cb := &circuitBreakerT{
+		destName:     destName,
+		failureRatio: getRouterConfigFloat64("circuitBreaker.failureRatio", destName, 0.9),
+		minRequests:  getRouterConfigInt("circuitBreaker.minRequests", destName, 20),
+		now:          time.Now,
+		circuits:     make(map[string]*circuitT),
+	}
+	config.RegisterDurationConfigVariable(time.Duration(60), &cb.window, true, time.Second,
+		[]string{"Router." + destName + ".circuitBreaker.window", "Router.circuitBreaker.window"}...)
+	config.RegisterDurationConfigVariable(time.Duration(30), &cb.openDuration, true, time.Second,
+		[]string{"Router." + destName + ".circuitBreaker.openDuration", "Router.circuitBreaker.openDuration"}...)
+	if getRouterConfigBool("circuitBreaker.enableAlerts", destName, false) {
+		alertManager, err := alert.New()
+		if err != nil {
+			pkgLogger.Errorf("[%v Router] :: Unable to initialize the alertManager for circuit breaker: %v", destName, err)
+		} else {
+			cb.alertManager = alertManager
+		}
+	}
+	return cb
+}
+
+func (cb *circuitBreakerT) circuit(destinationID string) *circuitT {
+	c, ok := cb.circuits[destinationID]
+	if !ok {
+		c = &circuitT{
+			state:       circuitClosed,
+			since:       cb.now(),
+			windowStart: cb.now(),
+			stateStat: stats.NewTaggedStat("router_circuit_breaker_state", stats.GaugeType, stats.Tags{
+				"destType":      cb.destName,
+				"destinationId": destinationID,
+			}),
+		}
+		c.stateStat.Gauge(0)
+		cb.circuits[destinationID] = c
+	}
+	return c
+}
+
+// allow returns false if jobs of destinationID must not be picked up.
+// When it returns true for a half-open circuit, the job must be marked as a probe through picked once it is assigned to a worker.
+func (cb *circuitBreakerT) allow(destinationID string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(destinationID)
+	switch c.state {
+	case circuitOpen:
+		if cb.now().Sub(c.since) < cb.openDuration {
+			return false
+		}
+		cb.transition(destinationID, c, circuitHalfOpen)
+		return true
+	case circuitHalfOpen:
+		// a probe which didn't report back in time (e.g. skipped by the worker) is considered lost
+		return c.probeStartedAt.IsZero() || cb.now().Sub(c.probeStartedAt) > cb.openDuration
+	}
+	return true
+}
+
+// picked marks the job picked up for a half-open destinationID as the probe
+func (cb *circuitBreakerT) picked(destinationID string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if c := cb.circuit(destinationID); c.state == circuitHalfOpen {
+		c.probeStartedAt = cb.now()
+	}
+}
+
+// record updates the circuit of destinationID with the status code of a request sent to it
+func (cb *circuitBreakerT) record(destinationID string, statusCode int) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(destinationID)
+	failed := statusCode >= 500
+	switch c.state {
+	case circuitClosed:
+		if cb.now().Sub(c.windowStart) > cb.window {
+			c.windowStart, c.requests, c.failures = cb.now(), 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= cb.minRequests && float64(c.failures)/float64(c.requests) >= cb.failureRatio {
+			cb.transition(destinationID, c, circuitOpen)
+		}
+	case circuitHalfOpen:
+		if failed {
+			cb.transition(destinationID, c, circuitOpen)
+		} else {
+			cb.transition(destinationID, c, circuitClosed)
+		}
+	}
+	// responses of requests sent before the circuit opened are ignored
+}
+
+func (cb *circuitBreakerT) transition(destinationID string, c *circuitT, state string) {
+	prevState := c.state
+	c.state, c.since = state, cb.now()
+	c.windowStart, c.requests, c.failures = cb.now(), 0, 0
+	c.probeStartedAt = time.Time{}
+
+	switch state {
+	case circuitClosed:
+		c.stateStat.Gauge(0)
+	case circuitHalfOpen:
+		c.stateStat.Gauge(1)
+	case circuitOpen:
+		c.stateStat.Gauge(2)
+	}
+	pkgLogger.Infof("[%v Router] :: circuit breaker of destination %s changed from %s to %s", cb.destName, destinationID, prevState, state)
+
+	// half-open <-> open transitions are expected while the destination is down, only alert on the circuit opening and recovering
+	if cb.alertManager != nil && (state == circuitOpen && prevState == circuitClosed || state == circuitClosed) {
+		message := fmt.Sprintf("Router circuit breaker of %s destination %s is %s", cb.destName, destinationID, state)
+		rruntime.Go(func() {
+			cb.alertManager.Alert(message)
+		})
+	}
+}
+
+// Status returns the circuit state of every destination ID
+func (cb *circuitBreakerT) Status() map[string]interface{} {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	status := make(map[string]interface{}, len(cb.circuits))
+	for destinationID, c := range cb.circuits {
+		status[destinationID] = map[string]interface{}{
+			"state": c.state,
+			"since": c.since,
+		}
+	}
+	return status
+}
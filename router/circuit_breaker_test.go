@@ -0,0 +1,119 @@
+package router
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rudderlabs/rudder-server/services/stats"
+)
+
+type alertManagerMock struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (a *alertManagerMock) Alert(message string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.messages = append(a.messages, message)
+}
+
+func (a *alertManagerMock) alerts() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.messages...)
+}
+
+var _ = Describe("Circuit breaker", func() {
+	initRouter()
+
+	var (
+		cb           *circuitBreakerT
+		now          time.Time
+		alertManager *alertManagerMock
+	)
+
+	BeforeEach(func() {
+		stats.Setup()
+		now = time.Unix(1_000_000, 0)
+		alertManager = &alertManagerMock{}
+		cb = &circuitBreakerT{
+			destName:     "GA",
+			failureRatio: 0.5,
+			minRequests:  4,
+			window:       time.Minute,
+			openDuration: 30 * time.Second,
+			alertManager: alertManager,
+			now:          func() time.Time { return now },
+			circuits:     make(map[string]*circuitT),
+		}
+	})
+
+	stateOf := func(destinationID string) string {
+		return cb.Status()[destinationID].(map[string]interface{})["state"].(string)
+	}
+
+	It("should open after the failure ratio is reached and close after a successful probe", func() {
+		Expect(cb.allow("d1")).To(BeTrue())
+		cb.record("d1", http.StatusOK)
+		cb.record("d1", http.StatusBadGateway)
+		cb.record("d1", http.StatusBadRequest)
+		Expect(stateOf("d1")).To(Equal(circuitClosed))
+		cb.record("d1", http.StatusGatewayTimeout)
+		Expect(stateOf("d1")).To(Equal(circuitOpen))
+		Expect(cb.allow("d1")).To(BeFalse())
+		Expect(cb.allow("d2")).To(BeTrue())
+		Eventually(alertManager.alerts).Should(ConsistOf("Router circuit breaker of GA destination d1 is open"))
+
+		now = now.Add(31 * time.Second)
+		Expect(cb.allow("d1")).To(BeTrue())
+		Expect(stateOf("d1")).To(Equal(circuitHalfOpen))
+		cb.picked("d1")
+		// a single probe at a time
+		Expect(cb.allow("d1")).To(BeFalse())
+
+		cb.record("d1", http.StatusOK)
+		Expect(stateOf("d1")).To(Equal(circuitClosed))
+		Expect(cb.allow("d1")).To(BeTrue())
+		Eventually(alertManager.alerts).Should(HaveLen(2))
+		Expect(alertManager.alerts()[1]).To(Equal("Router circuit breaker of GA destination d1 is closed"))
+	})
+
+	It("should open again if the probe fails or is lost", func() {
+		for i := 0; i < 4; i++ {
+			cb.record("d1", http.StatusServiceUnavailable)
+		}
+		Expect(stateOf("d1")).To(Equal(circuitOpen))
+
+		now = now.Add(31 * time.Second)
+		Expect(cb.allow("d1")).To(BeTrue())
+		cb.picked("d1")
+		cb.record("d1", http.StatusInternalServerError)
+		Expect(stateOf("d1")).To(Equal(circuitOpen))
+		Expect(cb.allow("d1")).To(BeFalse())
+
+		now = now.Add(31 * time.Second)
+		Expect(cb.allow("d1")).To(BeTrue())
+		cb.picked("d1")
+		Expect(cb.allow("d1")).To(BeFalse())
+		now = now.Add(31 * time.Second)
+		Expect(cb.allow("d1")).To(BeTrue())
+
+		// only opening from closed is alerted
+		Eventually(alertManager.alerts).Should(HaveLen(1))
+		Consistently(alertManager.alerts, 100*time.Millisecond).Should(HaveLen(1))
+	})
+
+	It("should only consider failures within the window", func() {
+		cb.record("d1", http.StatusInternalServerError)
+		cb.record("d1", http.StatusInternalServerError)
+		cb.record("d1", http.StatusInternalServerError)
+		now = now.Add(2 * time.Minute)
+		cb.record("d1", http.StatusInternalServerError)
+		Expect(stateOf("d1")).To(Equal(circuitClosed))
+	})
+})
@@ -17,6 +17,7 @@ import (
 
 	"github.com/rudderlabs/rudder-server/processor/integrations"
 	"github.com/rudderlabs/rudder-server/router/utils"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
 	"github.com/rudderlabs/rudder-server/utils/sysUtils"
@@ -30,8 +31,9 @@ func init() {
 
 //NetHandleT is the wrapper holding private variables
 type NetHandleT struct {
-	httpClient sysUtils.HTTPClientI
-	logger     logger.LoggerI
+	httpClient           sysUtils.HTTPClientI
+	logger               logger.LoggerI
+	propagateTraceParent bool
 }
 
 //Network interface
@@ -162,6 +164,9 @@ func (network *NetHandleT) SendPost(ctx context.Context, structData integrations
 		}
 
 		req.Header.Add("User-Agent", "RudderLabs")
+		if network.propagateTraceParent {
+			tracing.Inject(ctx, req.Header)
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -176,8 +181,9 @@ func (network *NetHandleT) SendPost(ctx context.Context, structData integrations
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return &utils.SendPostResponse{
-				StatusCode:   resp.StatusCode,
-				ResponseBody: []byte(fmt.Sprintf(`Failed to read response body for request for URL : "%s"`, postInfo.URL)),
+				StatusCode:      resp.StatusCode,
+				ResponseBody:    []byte(fmt.Sprintf(`Failed to read response body for request for URL : "%s"`, postInfo.URL)),
+				ResponseHeaders: resp.Header,
 			}
 		}
 		network.logger.Debug(postInfo.URL, " : ", req.Proto, " : ", resp.Proto, resp.ProtoMajor, resp.ProtoMinor, resp.ProtoAtLeast)
@@ -212,6 +218,7 @@ func (network *NetHandleT) SendPost(ctx context.Context, structData integrations
 			StatusCode:          resp.StatusCode,
 			ResponseBody:        respBody,
 			ResponseContentType: contentTypeHeader,
+			ResponseHeaders:     resp.Header,
 		}
 	}
 
@@ -257,4 +264,5 @@ func (network *NetHandleT) Setup(destID string, netClientTimeout time.Duration)
 	network.logger.Info("defaultTransportCopy.MaxIdleConnsPerHost: ", defaultTransportCopy.MaxIdleConnsPerHost)
 	network.logger.Info("netClientTimeout: ", netClientTimeout)
 	network.httpClient = &http.Client{Transport: &defaultTransportCopy, Timeout: netClientTimeout}
+	network.propagateTraceParent = getRouterConfigBool("propagateTraceParent", destID, false)
 }
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/router/types"
+	routerUtils "github.com/rudderlabs/rudder-server/router/utils"
+)
+
+var _ = Describe("Retry-After", func() {
+	initRouter()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	It("should parse the retry time from the destination response headers", func() {
+		Expect(routerUtils.RetryAt(nil, now).IsZero()).To(BeTrue())
+		Expect(routerUtils.RetryAt(http.Header{"Retry-After": []string{"invalid"}}, now).IsZero()).To(BeTrue())
+		Expect(routerUtils.RetryAt(http.Header{"Retry-After": []string{"120"}}, now)).To(Equal(now.Add(2 * time.Minute)))
+		Expect(routerUtils.RetryAt(http.Header{"Retry-After": []string{"Tue, 01 Mar 2022 10:05:00 GMT"}}, now)).To(BeTemporally("==", now.Add(5*time.Minute)))
+		Expect(routerUtils.RetryAt(http.Header{"X-Ratelimit-Reset": []string{"30"}}, now)).To(Equal(now.Add(30 * time.Second)))
+		Expect(routerUtils.RetryAt(http.Header{"X-Ratelimit-Reset": []string{"1646129100"}}, now)).To(BeTemporally("==", now.Add(5*time.Minute)))
+		// Retry-After takes precedence
+		Expect(routerUtils.RetryAt(http.Header{"Retry-After": []string{"10"}, "X-Ratelimit-Reset": []string{"30"}}, now)).To(Equal(now.Add(10 * time.Second)))
+	})
+
+	Context("parking failed jobs", func() {
+		var worker *workerT
+
+		BeforeEach(func() {
+			maxRetryAfter = time.Hour
+			worker = &workerT{
+				retryForJobMap: make(map[int64]time.Time),
+				rt: &HandleT{
+					destName:           "GA",
+					logger:             pkgLogger,
+					parkedDestinations: make(map[string]time.Time),
+				},
+			}
+		})
+
+		It("should park the job until the retry time asked by the destination", func() {
+			retryAt := time.Now().Add(10 * time.Minute)
+			status := &jobsdb.JobStatusT{AttemptNum: 1, ErrorResponse: []byte(`{}`)}
+			worker.setNextRetryTime(retryAt, &types.JobMetadataT{JobID: 1, DestinationID: "d1"}, status)
+
+			Expect(worker.retryForJobMap[1]).To(Equal(retryAt))
+			Expect(status.RetryTime).To(Equal(retryAt))
+			Expect(string(status.ErrorResponse)).To(ContainSubstring(`"retryAfter"`))
+			Expect(worker.rt.isDestinationParked("d1")).To(BeFalse())
+		})
+
+		It("should fall back to exponential backoff and cap the retry time", func() {
+			status := &jobsdb.JobStatusT{AttemptNum: 1, ErrorResponse: []byte(`{}`)}
+			worker.setNextRetryTime(time.Time{}, &types.JobMetadataT{JobID: 1}, status)
+			Expect(worker.retryForJobMap[1]).To(BeTemporally("~", time.Now().Add(minRetryBackoff), time.Second))
+			Expect(string(status.ErrorResponse)).To(Equal(`{}`))
+
+			worker.setNextRetryTime(time.Now().Add(24*time.Hour), &types.JobMetadataT{JobID: 2}, status)
+			Expect(worker.retryForJobMap[2]).To(BeTemporally("~", time.Now().Add(maxRetryAfter), time.Second))
+		})
+
+		It("should park all jobs of the destination if enabled", func() {
+			worker.rt.parkDestinationOnRetryAfter = true
+			status := &jobsdb.JobStatusT{AttemptNum: 1, ErrorResponse: []byte(`{}`)}
+			worker.setNextRetryTime(time.Now().Add(time.Minute), &types.JobMetadataT{JobID: 1, DestinationID: "d1"}, status)
+
+			Expect(worker.rt.isDestinationParked("d1")).To(BeTrue())
+			Expect(worker.rt.isDestinationParked("d2")).To(BeFalse())
+
+			worker.rt.parkedDestinations["d1"] = time.Now().Add(-time.Second)
+			Expect(worker.rt.isDestinationParked("d1")).To(BeFalse())
+		})
+	})
+})
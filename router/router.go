@@ -31,6 +31,8 @@ import (
 	utilTypes "github.com/rudderlabs/rudder-server/utils/types"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/rudderlabs/rudder-server/config"
@@ -38,7 +40,9 @@ import (
 	oauth "github.com/rudderlabs/rudder-server/router/oauthResponseHandler"
 	"github.com/rudderlabs/rudder-server/rruntime"
 	destinationdebugger "github.com/rudderlabs/rudder-server/services/debugger/destination"
+	"github.com/rudderlabs/rudder-server/services/livetail"
 	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/services/tracing"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/misc"
 )
@@ -104,6 +108,11 @@ type HandleT struct {
 	customDestinationManager               customdestinationmanager.DestinationManager
 	throttler                              throttler.Throttler
 	throttlerMutex                         sync.RWMutex
+	adaptiveConcurrency                    *adaptiveConcurrencyT
+	circuitBreaker                         *circuitBreakerT
+	parkDestinationOnRetryAfter            bool
+	parkedDestinations                     map[string]time.Time // destinationID -> time until which no job is sent to the destination
+	parkedDestinationsMutex                sync.RWMutex
 	guaranteeUserEventOrder                bool
 	netClientTimeout                       time.Duration
 	enableBatching                         bool
@@ -178,6 +187,7 @@ type JobParametersT struct {
 	MessageID               string      `json:"message_id"`
 	WorkspaceId             string      `json:"workspaceId"`
 	RudderAccountId         string      `json:"rudderAccountId"`
+	TraceParent             string      `json:"traceparent"`
 }
 
 type workerMessageT struct {
@@ -225,6 +235,7 @@ var (
 	failedEventsCacheSize                                         int
 	readSleep, minSleep, maxStatusUpdateWait, diagnosisTickerTime time.Duration
 	minRetryBackoff, maxRetryBackoff, jobsBatchTimeout            time.Duration
+	maxRetryAfter                                                 time.Duration
 	noOfJobsToBatchInAWorker                                      int
 	pkgLogger                                                     logger.LoggerI
 	Diagnostics                                                   diagnostics.DiagnosticsI
@@ -332,6 +343,7 @@ func loadConfig() {
 	config.RegisterDurationConfigVariable(time.Duration(60), &diagnosisTickerTime, false, time.Second, []string{"Diagnostics.routerTimePeriod", "Diagnostics.routerTimePeriodInS"}...)
 	config.RegisterDurationConfigVariable(time.Duration(10), &minRetryBackoff, true, time.Second, []string{"Router.minRetryBackoff", "Router.minRetryBackoffInS"}...)
 	config.RegisterDurationConfigVariable(time.Duration(300), &maxRetryBackoff, true, time.Second, []string{"Router.maxRetryBackoff", "Router.maxRetryBackoffInS"}...)
+	config.RegisterDurationConfigVariable(time.Duration(3600), &maxRetryAfter, true, time.Second, "Router.maxRetryAfter")
 	config.RegisterDurationConfigVariable(time.Duration(0), &fixedLoopSleep, true, time.Millisecond, []string{"Router.fixedLoopSleep", "Router.fixedLoopSleepInMS"}...)
 	config.RegisterIntConfigVariable(10, &failedEventsCacheSize, false, 1, "Router.failedEventsCacheSize")
 	config.RegisterStringConfigVariable("", &toAbortDestinationIDs, true, "Router.toAbortDestinationIDs")
@@ -414,10 +426,12 @@ func (worker *workerT) workerProcess() {
 		case pause := <-worker.pauseChannel:
 			//Drain the channel
 			for len(worker.channel) > 0 {
-				<-worker.channel
+				message := <-worker.channel
+				worker.releaseJobConcurrency(message.job)
 			}
 
 			//Clear buffers
+			worker.releaseConcurrency()
 			worker.routerJobs = make([]types.RouterJobT, 0)
 			worker.destinationJobs = make([]types.DestinationJobT, 0)
 			worker.jobCountsByDestAndUser = make(map[string]*destJobCountsT)
@@ -446,6 +460,7 @@ func (worker *workerT) workerProcess() {
 			}
 
 			if worker.rt.pausingWorkers {
+				worker.releaseJobConcurrency(message.job)
 				continue
 			}
 
@@ -475,6 +490,7 @@ func (worker *workerT) workerProcess() {
 					if markedAsWaiting {
 						worker.rt.logger.Debugf(`Decrementing in throttle map for destination:%s since job:%d is marked as waiting for user:%s`, parameters.DestinationID, job.JobID, userID)
 						worker.rt.throttler.Dec(parameters.DestinationID, userID, 1, worker.throttledAtTime, throttler.ALL_LEVELS)
+						worker.releaseJobConcurrency(job)
 						continue
 					}
 				}
@@ -496,6 +512,7 @@ func (worker *workerT) workerProcess() {
 				PickedAtTime:     message.workerAssignedTime,
 				ResultSetID:      message.resultSetID,
 				WorkspaceId:      parameters.WorkspaceId,
+				TraceParent:      parameters.TraceParent,
 			}
 
 			worker.rt.configSubscriberLock.RLock()
@@ -512,6 +529,7 @@ func (worker *workerT) workerProcess() {
 					Parameters:    []byte(`{}`),
 					WorkspaceId:   job.WorkspaceId,
 				}
+				worker.releaseJobConcurrency(job)
 				worker.rt.responseQ <- jobResponseT{status: &status, worker: worker, userID: userID, JobT: job}
 				continue
 			}
@@ -583,11 +601,34 @@ func (worker *workerT) workerProcess() {
 func (worker *workerT) processDestinationJobs() {
 	worker.handleWorkerDestinationJobs(context.TODO())
 	//routerJobs/destinationJobs are processed. Clearing the queues.
+	worker.releaseConcurrency()
 	worker.routerJobs = make([]types.RouterJobT, 0)
 	worker.destinationJobs = make([]types.DestinationJobT, 0)
 	worker.jobCountsByDestAndUser = make(map[string]*destJobCountsT)
 }
 
+// releaseConcurrency releases the adaptive concurrency slots of the buffered jobs which were not sent
+func (worker *workerT) releaseConcurrency() {
+	if worker.rt.adaptiveConcurrency == nil {
+		return
+	}
+	for _, routerJob := range worker.routerJobs {
+		worker.rt.adaptiveConcurrency.release(routerJob.JobMetadata.DestinationID, routerJob.JobMetadata.JobID)
+	}
+	for _, destinationJob := range worker.destinationJobs {
+		for _, destinationJobMetadata := range destinationJob.JobMetadataArray {
+			worker.rt.adaptiveConcurrency.release(destinationJobMetadata.DestinationID, destinationJobMetadata.JobID)
+		}
+	}
+}
+
+// releaseJobConcurrency releases the adaptive concurrency slot of a job which won't be sent
+func (worker *workerT) releaseJobConcurrency(job *jobsdb.JobT) {
+	if worker.rt.adaptiveConcurrency != nil {
+		worker.rt.adaptiveConcurrency.release(destinationID(job), job.JobID)
+	}
+}
+
 func (worker *workerT) canSendJobToDestination(prevRespStatusCode int, failedUserIDsMap map[string]struct{}, destinationJob types.DestinationJobT) bool {
 	if prevRespStatusCode == 0 {
 		return true
@@ -696,6 +737,7 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 
 	for _, destinationJob := range worker.destinationJobs {
 		var attemptedToSendTheJob bool
+		var respRetryAt time.Time
 		respBodyArr := make([]string, 0)
 		if destinationJob.StatusCode == 200 || destinationJob.StatusCode == 0 {
 			if worker.canSendJobToDestination(prevRespStatusCode, failedUserIDsMap, destinationJob) {
@@ -717,6 +759,10 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 				})
 				deliveryLatencyStat.Start()
 				startedAt := time.Now()
+				traceCtx, span := tracing.StartFromTraceParent(ctx, destinationJob.JobMetadataArray[0].TraceParent, "router.send",
+					attribute.String("destType", worker.rt.destName),
+					attribute.String("destinationId", destinationID),
+				)
 
 				// TODO: remove trackStuckDelivery once we verify it is not needed,
 				//			router_delivery_exceeded_timeout -> goes to zero
@@ -757,7 +803,7 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 							} else {
 								// stat start
 								pkgLogger.Debugf(`responseTransform status :%v, %s`, worker.rt.transformerProxy, worker.rt.destName)
-								sendCtx, cancel := context.WithTimeout(ctx, worker.rt.netClientTimeout)
+								sendCtx, cancel := context.WithTimeout(traceCtx, worker.rt.netClientTimeout)
 								defer cancel()
 								//transformer proxy start
 								if worker.rt.transformerProxy {
@@ -781,6 +827,7 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 									rdl_time := time.Now()
 									resp := worker.rt.netHandle.SendPost(sendCtx, val)
 									respStatusCode, respBodyTemp, respContentType = resp.StatusCode, string(resp.ResponseBody), resp.ResponseContentType
+									respRetryAt = router_utils.RetryAt(resp.ResponseHeaders, time.Now())
 									// stat end
 									worker.routerDeliveryLatencyStat.SendTiming(time.Since(rdl_time))
 								}
@@ -801,6 +848,13 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 				if respStatusCode != types.RouterTimedOutStatusCode {
 					worker.rt.MultitenantI.UpdateWorkspaceLatencyMap(worker.rt.destName, workspaceID, float64(timeTaken)/float64(time.Second))
 				}
+				if worker.rt.adaptiveConcurrency != nil {
+					jobIDs := make([]int64, 0, len(destinationJob.JobMetadataArray))
+					for _, destinationJobMetadata := range destinationJob.JobMetadataArray {
+						jobIDs = append(jobIDs, destinationJobMetadata.JobID)
+					}
+					worker.rt.adaptiveConcurrency.completed(destinationID, jobIDs, timeTaken, respStatusCode)
+				}
 
 				//Using response status code and body to get response code rudder router logic is based on.
 				// Works when transformer proxy in disabled
@@ -808,6 +862,11 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 					respStatusCode = destinationResponseHandler.IsSuccessStatus(respStatusCode, respBody)
 				}
 
+				if worker.rt.circuitBreaker != nil && respStatusCode != types.RouterTimedOutStatusCode {
+					worker.rt.circuitBreaker.record(destinationID, respStatusCode)
+				}
+				worker.endSendSpans(span, destinationJob, startedAt, respStatusCode, respBody)
+
 				attemptedToSendTheJob = true
 
 				worker.deliveryTimeStat.End()
@@ -861,6 +920,7 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 				destinationJobMetadata: &_destinationJobMetadata,
 				respStatusCode:         respStatusCode,
 				respBody:               respBody,
+				retryAt:                respRetryAt,
 				attemptedToSendTheJob:  attemptedToSendTheJob,
 			})
 		}
@@ -935,12 +995,13 @@ func (worker *workerT) handleWorkerDestinationJobs(ctx context.Context) {
 		status.ErrorResponse = []byte(`{}`)
 		status.ErrorCode = strconv.Itoa(respStatusCode)
 
-		worker.postStatusOnResponseQ(respStatusCode, routerJobResponse.respBody, destinationJob.Message, respContentType, destinationJobMetadata, &status)
+		worker.postStatusOnResponseQ(respStatusCode, routerJobResponse.respBody, destinationJob.Message, respContentType, routerJobResponse.retryAt, destinationJobMetadata, &status)
 
 		worker.sendEventDeliveryStat(destinationJobMetadata, &status, &destinationJob.Destination)
 
 		if attemptedToSendTheJob {
 			worker.sendRouterResponseCountStat(destinationJobMetadata, &status, &destinationJob.Destination)
+			publishLiveEvent(destinationJobMetadata, respStatusCode, routerJobResponse.respBody)
 		}
 	}
 
@@ -974,6 +1035,7 @@ type RouterJobResponse struct {
 	destinationJobMetadata *types.JobMetadataT
 	respStatusCode         int
 	respBody               string
+	retryAt                time.Time // time before which the destination asked not to be called again, zero if not asked
 	attemptedToSendTheJob  bool
 	status                 *jobsdb.JobStatusT
 }
@@ -991,6 +1053,30 @@ func (worker *workerT) recordCountsByDestAndUser(destID, userID string) {
 	}
 }
 
+// endSendSpans ends the span of the request sent to the destination. Jobs batched together with the first one
+// which belong to other traces get a span with the same timing.
+func (worker *workerT) endSendSpans(span trace.Span, destinationJob types.DestinationJobT, startedAt time.Time, respStatusCode int, respBody string) {
+	var errorMessage string
+	if !isSuccessStatus(respStatusCode) {
+		errorMessage = respBody
+	}
+	span.SetAttributes(attribute.Int("statusCode", respStatusCode))
+	tracing.End(span, errorMessage)
+
+	traced := map[string]struct{}{destinationJob.JobMetadataArray[0].TraceParent: {}}
+	for _, jobMetadata := range destinationJob.JobMetadataArray[1:] {
+		if _, ok := traced[jobMetadata.TraceParent]; ok {
+			continue
+		}
+		traced[jobMetadata.TraceParent] = struct{}{}
+		tracing.RecordSpan(jobMetadata.TraceParent, "router.send", startedAt, time.Now(), errorMessage,
+			attribute.String("destType", worker.rt.destName),
+			attribute.String("destinationId", jobMetadata.DestinationID),
+			attribute.Int("statusCode", respStatusCode),
+		)
+	}
+}
+
 func (worker *workerT) recordAPICallCount(apiCallsCount map[string]*destJobCountsT, destinationID string, jobMetadata []types.JobMetadataT) {
 	if _, ok := apiCallsCount[destinationID]; !ok {
 		apiCallsCount[destinationID] = &destJobCountsT{byUser: make(map[string]int)}
@@ -1072,7 +1158,7 @@ func (worker *workerT) updateAbortedMetrics(destinationID, statusCode string) {
 }
 
 func (worker *workerT) postStatusOnResponseQ(respStatusCode int, respBody string, payload json.RawMessage,
-	respContentType string, destinationJobMetadata *types.JobMetadataT, status *jobsdb.JobStatusT) {
+	respContentType string, retryAt time.Time, destinationJobMetadata *types.JobMetadataT, status *jobsdb.JobStatusT) {
 	//Enhancing status.ErrorResponse with firstAttemptedAt
 	firstAttemptedAtTime := time.Now()
 	if destinationJobMetadata.FirstAttemptedAt != "" {
@@ -1135,14 +1221,10 @@ func (worker *workerT) postStatusOnResponseQ(respStatusCode int, respBody string
 				delete(worker.retryForJobMap, destinationJobMetadata.JobID)
 				worker.retryForJobMapMutex.Unlock()
 			} else {
-				worker.retryForJobMapMutex.Lock()
-				worker.retryForJobMap[destinationJobMetadata.JobID] = time.Now().Add(durationBeforeNextAttempt(status.AttemptNum))
-				worker.retryForJobMapMutex.Unlock()
+				worker.setNextRetryTime(retryAt, destinationJobMetadata, status)
 			}
 		} else if respStatusCode == 429 {
-			worker.retryForJobMapMutex.Lock()
-			worker.retryForJobMap[destinationJobMetadata.JobID] = time.Now().Add(durationBeforeNextAttempt(status.AttemptNum))
-			worker.retryForJobMapMutex.Unlock()
+			worker.setNextRetryTime(retryAt, destinationJobMetadata, status)
 		} else {
 			status.JobState = jobsdb.Aborted.State
 		}
@@ -1232,6 +1314,21 @@ func (worker *workerT) sendEventDeliveryStat(destinationJobMetadata *types.JobMe
 	}
 }
 
+// publishLiveEvent publishes the response of the destination to a job to the live tail watchers
+func publishLiveEvent(destinationJobMetadata *types.JobMetadataT, respStatusCode int, respBody string) {
+	if !livetail.Watching(livetail.PointRouterResponse, destinationJobMetadata.SourceID, destinationJobMetadata.DestinationID) {
+		return
+	}
+	job := destinationJobMetadata.JobT
+	liveEvent := livetail.NewEvent(livetail.PointRouterResponse, destinationJobMetadata.SourceID, destinationJobMetadata.DestinationID, job.EventPayload)
+	params := gjson.GetManyBytes(job.Parameters, "message_id", "event_name", "event_type")
+	liveEvent.MessageID, liveEvent.EventName, liveEvent.EventType = params[0].String(), params[1].String(), params[2].String()
+	liveEvent.RudderID = job.UserID
+	liveEvent.StatusCode = respStatusCode
+	liveEvent.Response = respBody
+	livetail.Publish(liveEvent)
+}
+
 func (worker *workerT) sendDestinationResponseToConfigBackend(payload json.RawMessage, destinationJobMetadata *types.JobMetadataT, status *jobsdb.JobStatusT, sourceIDs []string) {
 	//Sending destination response to config backend
 	deliveryStatus := destinationdebugger.DeliveryStatusT{
@@ -1273,6 +1370,42 @@ func (worker *workerT) handleJobForPrevFailedUser(job *jobsdb.JobT, parameters J
 	return false
 }
 
+// setNextRetryTime parks the failed job until the time the destination asked to be retried at, through the
+// Retry-After or X-RateLimit-Reset response headers, falling back to exponential backoff if it didn't.
+// If parkDestinationOnRetryAfter is enabled, all jobs of the destination are parked along with it.
+func (worker *workerT) setNextRetryTime(retryAt time.Time, destinationJobMetadata *types.JobMetadataT, status *jobsdb.JobStatusT) {
+	nextRetryTime := time.Now().Add(durationBeforeNextAttempt(status.AttemptNum))
+	if !retryAt.IsZero() {
+		if maxRetryAt := time.Now().Add(maxRetryAfter); retryAt.After(maxRetryAt) {
+			retryAt = maxRetryAt
+		}
+		nextRetryTime = retryAt
+		status.RetryTime = retryAt
+		status.ErrorResponse = router_utils.EnhanceJSON(status.ErrorResponse, "retryAfter", retryAt.Format(misc.RFC3339Milli))
+		worker.rt.logger.Debugf("[%v Router] :: destination asked to retry job %d after %v", worker.rt.destName, destinationJobMetadata.JobID, retryAt)
+
+		if worker.rt.parkDestinationOnRetryAfter {
+			worker.rt.parkedDestinationsMutex.Lock()
+			if retryAt.After(worker.rt.parkedDestinations[destinationJobMetadata.DestinationID]) {
+				worker.rt.parkedDestinations[destinationJobMetadata.DestinationID] = retryAt
+			}
+			worker.rt.parkedDestinationsMutex.Unlock()
+		}
+	}
+	worker.retryForJobMapMutex.Lock()
+	worker.retryForJobMap[destinationJobMetadata.JobID] = nextRetryTime
+	worker.retryForJobMapMutex.Unlock()
+}
+
+// isDestinationParked returns true if a destination asked, through a Retry-After or X-RateLimit-Reset response header,
+// not to be called until a time that is yet to come
+func (rt *HandleT) isDestinationParked(destinationID string) bool {
+	rt.parkedDestinationsMutex.RLock()
+	defer rt.parkedDestinationsMutex.RUnlock()
+	parkedUntil, ok := rt.parkedDestinations[destinationID]
+	return ok && time.Until(parkedUntil) > 0
+}
+
 func durationBeforeNextAttempt(attempt int) (d time.Duration) {
 	b := backoff.NewExponentialBackOff()
 	b.InitialInterval = minRetryBackoff
@@ -1390,6 +1523,11 @@ func (rt *HandleT) findWorker(job *jobsdb.JobT, throttledAtTime time.Time) (toSe
 		return nil
 	}
 
+	if rt.isDestinationParked(parameters.DestinationID) {
+		rt.logger.Debugf(`[%v Router] :: Skipping processing of job:%d of user:%s as destination:%s asked to retry later`, rt.destName, job.JobID, userID, parameters.DestinationID)
+		return nil
+	}
+
 	if rt.shouldThrottle(parameters.DestinationID, userID, throttledAtTime) {
 		rt.throttledUserMap[userID] = struct{}{}
 		rt.logger.Debugf(`[%v Router] :: Skipping processing of job:%d of user:%s as throttled limits exceeded`, rt.destName, job.JobID, userID)
@@ -1927,6 +2065,8 @@ func (rt *HandleT) readAndProcess() int {
 
 	rt.throttledUserMap = make(map[string]struct{})
 	throttledAtTime := time.Now()
+	// once a job of a destination is deferred, its later jobs are deferred too to keep the order of its users' jobs
+	concurrencyLimitedDestinations := make(map[string]struct{})
 	//Identify jobs which can be processed
 	for _, job := range combinedList {
 		destID := destinationID(job)
@@ -1967,8 +2107,25 @@ func (rt *HandleT) readAndProcess() int {
 			rt.MultitenantI.CalculateSuccessFailureCounts(job.WorkspaceId, rt.destName, false, true)
 			continue
 		}
+		if rt.circuitBreaker != nil && !rt.circuitBreaker.allow(destID) {
+			rt.logger.Debugf(`[%v Router] :: Skipping processing of job:%d as circuit of destination:%s is open`, rt.destName, job.JobID, destID)
+			continue
+		}
+		if rt.adaptiveConcurrency != nil {
+			if _, ok := concurrencyLimitedDestinations[destID]; ok || !rt.adaptiveConcurrency.allow(destID) {
+				concurrencyLimitedDestinations[destID] = struct{}{}
+				rt.logger.Debugf(`[%v Router] :: Skipping processing of job:%d as concurrency limit of destination:%s is reached`, rt.destName, job.JobID, destID)
+				continue
+			}
+		}
 		w := rt.findWorker(job, throttledAtTime)
 		if w != nil {
+			if rt.circuitBreaker != nil {
+				rt.circuitBreaker.picked(destID)
+			}
+			if rt.adaptiveConcurrency != nil {
+				rt.adaptiveConcurrency.picked(destID, job.JobID)
+			}
 			status := jobsdb.JobStatusT{
 				JobID:         job.JobID,
 				AttemptNum:    job.LastJobStatus.AttemptNum,
@@ -2104,6 +2261,10 @@ func (rt *HandleT) Setup(backendConfig backendconfig.BackendConfig, jobsDB jobsd
 	}
 	rt.guaranteeUserEventOrder = getRouterConfigBool("guaranteeUserEventOrder", rt.destName, true)
 	rt.noOfWorkers = getRouterConfigInt("noOfWorkers", destName, 64)
+	rt.adaptiveConcurrency = newAdaptiveConcurrency(destName, rt.noOfWorkers)
+	rt.circuitBreaker = newCircuitBreaker(destName)
+	rt.parkDestinationOnRetryAfter = getRouterConfigBool("parkDestinationOnRetryAfter", destName, false)
+	rt.parkedDestinations = make(map[string]time.Time)
 	maxFailedCountKeys := []string{"Router." + rt.destName + "." + "maxFailedCountForJob", "Router." + "maxFailedCountForJob"}
 	retryTimeWindowKeys := []string{"Router." + rt.destName + "." + "retryTimeWindow", "Router." + rt.destName + "." + "retryTimeWindowInMins", "Router." + "retryTimeWindow", "Router." + "retryTimeWindowInMins"}
 	savePayloadOnErrorKeys := []string{"Router." + rt.destName + "." + "savePayloadOnError", "Router." + "savePayloadOnError"}
@@ -2148,10 +2309,6 @@ func (rt *HandleT) Setup(backendConfig backendconfig.BackendConfig, jobsDB jobsd
 	rt.oauth = oauth.NewOAuthErrorHandler()
 	rt.oauth.Setup()
 
-	var throttler throttler.HandleT
-	throttler.SetUp(rt.destName)
-	rt.throttler = &throttler
-
 	rt.isBackendConfigInitialized = false
 	rt.backendConfigInitialized = make(chan bool)
 
@@ -2163,6 +2320,10 @@ func (rt *HandleT) Setup(backendConfig backendconfig.BackendConfig, jobsDB jobsd
 	rt.backgroundCancel = cancel
 	rt.backgroundWait = g.Wait
 
+	var throttler throttler.HandleT
+	throttler.SetUp(ctx, rt.destName)
+	rt.throttler = &throttler
+
 	rt.initWorkers()
 	g.Go(misc.WithBugsnag(func() error {
 		rt.collectMetrics(ctx)
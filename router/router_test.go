@@ -252,6 +252,88 @@ var _ = Describe("Router", func() {
 			router.Shutdown()
 		})
 
+		It("should defer jobs of destinations whose adaptive concurrency limit is reached", func() {
+			mockMultitenantHandle := mocksMultitenant.NewMockMultiTenantI(c.mockCtrl)
+			mockNetHandle := mocksRouter.NewMockNetHandleI(c.mockCtrl)
+			router := &HandleT{
+				Reporting:    &reportingNOOP{},
+				MultitenantI: mockMultitenantHandle,
+				netHandle:    mockNetHandle,
+			}
+			mockMultitenantHandle.EXPECT().UpdateWorkspaceLatencyMap(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+			router.Setup(c.mockBackendConfig, c.mockRouterJobsDB, c.mockProcErrorsDB, gaDestinationDefinition)
+			router.adaptiveConcurrency = &adaptiveConcurrencyT{
+				destName:         customVal["GA"],
+				minLimit:         1,
+				maxLimit:         1,
+				decreaseFactor:   0.5,
+				latencyThreshold: time.Minute,
+				limiters:         make(map[string]*adaptiveLimiterT),
+			}
+
+			gaPayload := `{"body": {"XML": {}, "FORM": {}, "JSON": {}}, "type": "REST", "files": {}, "method": "POST", "params": {"t": "event", "v": "1", "an": "RudderAndroidClient", "av": "1.0", "ds": "android-sdk", "ea": "Demo Track", "ec": "Demo Category", "el": "Demo Label", "ni": 0, "qt": 59268380964, "ul": "en-US", "cid": "anon_id", "tid": "UA-185645846-1", "uip": "[::1]", "aiid": "com.rudderlabs.android.sdk"}, "userId": "anon_id", "headers": {}, "version": "1", "endpoint": "https://www.google-analytics.com/collect"}`
+			parameters := fmt.Sprintf(`{"source_id": "1fMCVYZboDlYlauh4GFsEo2JU77", "destination_id": "%s", "message_id": "2f548e6d-60f6-44af-a1f4-62b3272445c3", "received_at": "2021-06-28T10:04:48.527+05:30", "transform_at": "processor"}`, gaDestinationID)
+			var unprocessedJobsList []*jobsdb.JobT
+			for i, userID := range []string{"u1", "u2"} {
+				unprocessedJobsList = append(unprocessedJobsList, &jobsdb.JobT{
+					UUID:         uuid.Must(uuid.NewV4()),
+					UserID:       userID,
+					JobID:        int64(2010 + i),
+					CreatedAt:    time.Date(2020, 04, 28, 13, 26, 00, 00, time.UTC),
+					ExpireAt:     time.Date(2020, 04, 28, 13, 26, 00, 00, time.UTC),
+					CustomVal:    customVal["GA"],
+					EventPayload: []byte(gaPayload),
+					LastJobStatus: jobsdb.JobStatusT{
+						AttemptNum: 0,
+					},
+					Parameters:  []byte(parameters),
+					WorkspaceId: workspaceID,
+				})
+			}
+
+			var workspaceCount = map[string]int{}
+			workspaceCount[workspaceID] = len(unprocessedJobsList)
+
+			callGetRouterPickupJobs := mockMultitenantHandle.EXPECT().GetRouterPickupJobs(customVal["GA"], gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(workspaceCount, map[string]float64{}).Times(1)
+
+			callGetAllJobs := c.mockRouterJobsDB.EXPECT().GetAllJobs(workspaceCount,
+				jobsdb.GetQueryParamsT{CustomValFilters: []string{customVal["GA"]}}, 10).Times(1).Return(unprocessedJobsList).After(callGetRouterPickupJobs)
+
+			c.mockRouterJobsDB.EXPECT().UpdateJobStatus(gomock.Any(), []string{customVal["GA"]}, nil).Times(1).
+				Do(func(statuses []*jobsdb.JobStatusT, _ interface{}, _ interface{}) {
+					Expect(statuses).To(HaveLen(1))
+					assertJobStatus(unprocessedJobsList[0], statuses[0], jobsdb.Executing.State, "", `{}`, 0)
+				}).Return(nil).After(callGetAllJobs)
+
+			mockNetHandle.EXPECT().SendPost(gomock.Any(), gomock.Any()).Times(1).Return(
+				&routerUtils.SendPostResponse{StatusCode: 200, ResponseBody: []byte("")})
+
+			mockMultitenantHandle.EXPECT().CalculateSuccessFailureCounts(gomock.Any(), gomock.Any(), true, false).AnyTimes()
+			done := make(chan struct{})
+
+			callBeginTransaction := c.mockRouterJobsDB.EXPECT().BeginGlobalTransaction().Times(1).Return(nil)
+			callAcquireLocks := c.mockRouterJobsDB.EXPECT().AcquireUpdateJobStatusLocks().Times(1).After(callBeginTransaction)
+			callUpdateStatus := c.mockRouterJobsDB.EXPECT().UpdateJobStatusInTxn(gomock.Any(), gomock.Any(), []string{customVal["GA"]}, nil).Times(1).After(callAcquireLocks).
+				Do(func(_ interface{}, statuses []*jobsdb.JobStatusT, _ interface{}, _ interface{}) {
+					Expect(statuses).To(HaveLen(1))
+					assertJobStatus(unprocessedJobsList[0], statuses[0], jobsdb.Succeeded.State, "200", `{"content-type":"","response": "","firstAttemptedAt":"2021-06-28T15:57:30.742+05:30"}`, 1)
+				})
+			callCommitTransaction := c.mockRouterJobsDB.EXPECT().CommitTransaction(gomock.Any()).Times(1).After(callUpdateStatus)
+			c.mockRouterJobsDB.EXPECT().ReleaseUpdateJobStatusLocks().DoAndReturn(
+				func() {
+					close(done)
+				},
+			).Times(1).After(callCommitTransaction)
+
+			<-router.backendConfigInitialized
+			count := router.readAndProcess()
+			Expect(count).To(Equal(1))
+			<-done
+			Expect(router.adaptiveConcurrency.Status()[gaDestinationID].(map[string]int)["in-flight"]).To(Equal(0))
+			router.Shutdown()
+		})
+
 		It("should abort unprocessed jobs to ga destination because of bad payload", func() {
 			mockMultitenantHandle := mocksMultitenant.NewMockMultiTenantI(c.mockCtrl)
 
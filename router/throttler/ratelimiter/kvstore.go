@@ -0,0 +1,86 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/services/kvstoremanager"
+)
+
+// KVLimitStore represents internal limiter data database where data are stored in a key value store (e.g. Redis) shared by all router instances
+type KVLimitStore struct {
+	kvStore        kvstoremanager.KVStoreManager
+	keyPrefix      string
+	expirationTime time.Duration
+}
+
+// NewKVLimitStore creates new shared data store for internal limiter data. Counters are prefixed with keyPrefix and expire after expirationTime from their last update
+func NewKVLimitStore(kvStore kvstoremanager.KVStoreManager, keyPrefix string, expirationTime time.Duration) *KVLimitStore {
+	return &KVLimitStore{
+		kvStore:        kvStore,
+		keyPrefix:      keyPrefix,
+		expirationTime: expirationTime,
+	}
+}
+
+// Inc increments current window limit counter for key
+func (s *KVLimitStore) Inc(key string, window time.Time) error {
+	_, err := s.kvStore.IncrBy(s.kvKey(key, window), 1, s.expirationTime)
+	return err
+}
+
+// Dec decrements current window limit counter for key
+func (s *KVLimitStore) Dec(key string, count int64, window time.Time) error {
+	kvKey := s.kvKey(key, window)
+	val, err := s.kvStore.IncrBy(kvKey, -count, s.expirationTime)
+	if err != nil {
+		return err
+	}
+	if val < 0 {
+		// counters should not go below zero, compensate for concurrent decrements
+		_, err = s.kvStore.IncrBy(kvKey, -val, s.expirationTime)
+	}
+	return err
+}
+
+// Get gets value of previous window counter and current window counter for key
+func (s *KVLimitStore) Get(key string, previousWindow, currentWindow time.Time) (prevValue int64, currValue int64, err error) {
+	result, err := s.kvStore.MGet(s.kvKey(key, previousWindow), s.kvKey(key, currentWindow))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(result) != 2 {
+		return 0, 0, fmt.Errorf("expected 2 values, got %d", len(result))
+	}
+	if prevValue, err = parseCounter(result[0]); err != nil {
+		return 0, 0, err
+	}
+	if currValue, err = parseCounter(result[1]); err != nil {
+		return 0, 0, err
+	}
+	return prevValue, currValue, nil
+}
+
+// kvKey uses a hash tag for key, so that counters of all windows of a key are in the same slot in cluster mode
+func (s *KVLimitStore) kvKey(key string, window time.Time) string {
+	return fmt.Sprintf("%s{%s}_%s", s.keyPrefix, key, window.Format(time.RFC3339))
+}
+
+func parseCounter(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		counter, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if counter < 0 {
+			counter = 0
+		}
+		return counter, nil
+	default:
+		return 0, fmt.Errorf("unexpected counter value type %T", value)
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/services/kvstoremanager"
+)
+
+// kvStoreMock implements the counter operations of kvstoremanager.KVStoreManager over a map
+type kvStoreMock struct {
+	kvstoremanager.KVStoreManager
+	data map[string]int64
+}
+
+func (m *kvStoreMock) IncrBy(key string, value int64, _ time.Duration) (int64, error) {
+	m.data[key] += value
+	return m.data[key], nil
+}
+
+func (m *kvStoreMock) MGet(keys ...string) ([]interface{}, error) {
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if value, ok := m.data[key]; ok {
+			result[i] = strconv.FormatInt(value, 10)
+		}
+	}
+	return result, nil
+}
+
+func TestKVLimitStore(t *testing.T) {
+	kvStore := &kvStoreMock{data: make(map[string]int64)}
+	store := NewKVLimitStore(kvStore, "prefix_", time.Minute)
+	limiter := New(store, 3, time.Minute)
+
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		status, err := limiter.Check("key", now)
+		require.NoError(t, err)
+		require.False(t, status.IsLimited)
+		require.NoError(t, limiter.Inc("key", now))
+	}
+	status, err := limiter.Check("key", now)
+	require.NoError(t, err)
+	require.True(t, status.IsLimited)
+
+	// all windows of a key share the same hash tag
+	require.Contains(t, kvStore.data, "prefix_{key}_"+now.UTC().Format(time.RFC3339))
+
+	// counters never go below zero
+	require.NoError(t, limiter.Dec("key", 5, now))
+	prev, curr, err := store.Get("key", now.Add(-time.Minute), now)
+	require.NoError(t, err)
+	require.Zero(t, prev)
+	require.Zero(t, curr)
+}
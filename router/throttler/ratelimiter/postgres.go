@@ -0,0 +1,269 @@
+package ratelimiter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/rudderlabs/rudder-server/rruntime"
+)
+
+// PostgresLimitStore represents internal limiter data database where data are stored in a postgres table shared by all router instances.
+// Counters are cached in memory and increments are batched, both synced with the table every syncInterval,
+// so that checks and increments do not need a round trip to postgres.
+type PostgresLimitStore struct {
+	db             *sql.DB
+	tableName      string
+	expirationTime time.Duration
+
+	mutex sync.Mutex
+	// values are the counters read from the table at the last sync
+	values map[windowKey]int64
+	// pending are the increments not yet written to the table
+	pending map[windowKey]int64
+	// used are the counters read since the last sync, the others are dropped from values
+	used map[windowKey]bool
+	// syncErr is the error of the last sync, returned by Get until a sync succeeds
+	syncErr error
+}
+
+type windowKey struct {
+	key    string
+	window time.Time
+}
+
+// NewPostgresLimitStore creates new shared data store for internal limiter data in tableName, creating the table if it does not exist.
+// Counters are synced with the table every syncInterval, and counters not updated for expirationTime are removed with a period specified by the flushInterval argument, until ctx is done
+func NewPostgresLimitStore(ctx context.Context, db *sql.DB, tableName string, expirationTime, flushInterval, syncInterval time.Duration) (*PostgresLimitStore, error) {
+	s := &PostgresLimitStore{
+		db:             db,
+		tableName:      tableName,
+		expirationTime: expirationTime,
+		values:         make(map[windowKey]int64),
+		pending:        make(map[windowKey]int64),
+		used:           make(map[windowKey]bool),
+	}
+	sqlStatement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %q (
+		key TEXT NOT NULL,
+		window_start TIMESTAMP NOT NULL,
+		value BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (key, window_start))`, tableName)
+	if _, err := db.ExecContext(ctx, sqlStatement); err != nil {
+		return nil, err
+	}
+	rruntime.Go(func() {
+		s.syncLoop(ctx, flushInterval, syncInterval)
+	})
+	return s, nil
+}
+
+// Inc increments current window limit counter for key
+func (s *PostgresLimitStore) Inc(key string, window time.Time) error {
+	s.add(key, 1, window)
+	return nil
+}
+
+// Dec decrements current window limit counter for key
+func (s *PostgresLimitStore) Dec(key string, count int64, window time.Time) error {
+	s.add(key, -count, window)
+	return nil
+}
+
+func (s *PostgresLimitStore) add(key string, count int64, window time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pending[windowKey{key: key, window: window.UTC()}] += count
+}
+
+// Get gets value of previous window counter and current window counter for key.
+// Counters which are not cached yet are read from the table.
+func (s *PostgresLimitStore) Get(key string, previousWindow, currentWindow time.Time) (prevValue int64, currValue int64, err error) {
+	prevKey := windowKey{key: key, window: previousWindow.UTC()}
+	currKey := windowKey{key: key, window: currentWindow.UTC()}
+
+	s.mutex.Lock()
+	if s.syncErr != nil {
+		s.mutex.Unlock()
+		return 0, 0, s.syncErr
+	}
+	_, prevCached := s.values[prevKey]
+	_, currCached := s.values[currKey]
+	s.mutex.Unlock()
+	var values map[windowKey]int64
+	if !prevCached || !currCached {
+		if values, err = s.read([]windowKey{prevKey, currKey}); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range []windowKey{prevKey, currKey} {
+		if _, ok := s.values[key]; !ok {
+			s.values[key] = values[key]
+		}
+		s.used[key] = true
+	}
+	return s.value(prevKey), s.value(currKey), nil
+}
+
+// value returns the counter of windowKey including the pending increments, it must be called with the mutex held
+func (s *PostgresLimitStore) value(key windowKey) int64 {
+	value := s.values[key] + s.pending[key]
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+func (s *PostgresLimitStore) syncLoop(ctx context.Context, flushInterval, syncInterval time.Duration) {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// write the last increments, the context of the store is already done
+			_ = s.write(context.Background(), s.takePending())
+			return
+		case <-syncTicker.C:
+			s.sync(ctx)
+		case <-flushTicker.C:
+			_, _ = s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %q WHERE updated_at < $1`, s.tableName), time.Now().UTC().Add(-s.expirationTime))
+		}
+	}
+}
+
+// sync writes the pending increments to the table and refreshes the cached counters which were read since the last sync
+func (s *PostgresLimitStore) sync(ctx context.Context) {
+	pending := s.takePending()
+	err := s.write(ctx, pending)
+
+	s.mutex.Lock()
+	if err != nil {
+		// keep the increments to retry them with the next sync
+		for key, count := range pending {
+			if _, ok := s.values[key]; ok {
+				s.values[key] -= count
+			}
+			s.pending[key] += count
+		}
+		s.syncErr = err
+		s.mutex.Unlock()
+		return
+	}
+	keys := make([]windowKey, 0, len(s.used))
+	for key := range s.used {
+		keys = append(keys, key)
+	}
+	s.used = make(map[windowKey]bool)
+	s.mutex.Unlock()
+
+	values, err := s.read(keys)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.syncErr = err
+	if err != nil {
+		return
+	}
+	// the counters not read since the previous sync are dropped, they are read again from the table if needed
+	refreshed := make(map[windowKey]int64, len(keys))
+	for _, key := range keys {
+		refreshed[key] = values[key]
+	}
+	for key := range s.used {
+		if _, ok := refreshed[key]; !ok {
+			refreshed[key] = s.values[key]
+		}
+	}
+	s.values = refreshed
+}
+
+// takePending returns the pending increments and resets them, adding them to the cached counters
+func (s *PostgresLimitStore) takePending() map[windowKey]int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pending := s.pending
+	for key, count := range pending {
+		if _, ok := s.values[key]; ok {
+			s.values[key] += count
+		}
+	}
+	s.pending = make(map[windowKey]int64)
+	return pending
+}
+
+// write adds the increments to the counters of the table in a single transaction
+func (s *PostgresLimitStore) write(ctx context.Context, increments map[windowKey]int64) error {
+	if len(increments) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(increments))
+	windows := make([]string, 0, len(increments))
+	counts := make([]int64, 0, len(increments))
+	for key, count := range increments {
+		keys = append(keys, key.key)
+		windows = append(windows, key.window.Format(time.RFC3339Nano))
+		counts = append(counts, count)
+	}
+
+	txn, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	sqlStatement := fmt.Sprintf(`INSERT INTO %q (key, window_start, value, updated_at)
+		SELECT k, w, 0, $3 FROM UNNEST($1::TEXT[], $2::TIMESTAMP[]) AS u(k, w)
+		ON CONFLICT (key, window_start) DO NOTHING`, s.tableName)
+	if _, err = txn.ExecContext(ctx, sqlStatement, pq.Array(keys), pq.Array(windows), now); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	sqlStatement = fmt.Sprintf(`UPDATE %[1]q SET value = GREATEST(%[1]q.value + u.c, 0), updated_at = $4
+		FROM UNNEST($1::TEXT[], $2::TIMESTAMP[], $3::BIGINT[]) AS u(k, w, c)
+		WHERE %[1]q.key = u.k AND %[1]q.window_start = u.w`, s.tableName)
+	if _, err = txn.ExecContext(ctx, sqlStatement, pq.Array(keys), pq.Array(windows), pq.Array(counts), now); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+// read reads the counters of keys from the table, counters missing in the table are zero.
+// Windows are passed as UTC timestamps in text, as the window_start column has no time zone
+func (s *PostgresLimitStore) read(keys []windowKey) (map[windowKey]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(keys))
+	windows := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.key)
+		windows = append(windows, key.window.Format(time.RFC3339Nano))
+	}
+	sqlStatement := fmt.Sprintf(`SELECT t.key, t.window_start, t.value FROM %[1]q t
+		JOIN UNNEST($1::TEXT[], $2::TIMESTAMP[]) AS u(k, w) ON t.key = u.k AND t.window_start = u.w`, s.tableName)
+	rows, err := s.db.Query(sqlStatement, pq.Array(names), pq.Array(windows))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[windowKey]int64, len(keys))
+	for rows.Next() {
+		var key windowKey
+		var value int64
+		if err = rows.Scan(&key.key, &key.window, &value); err != nil {
+			return nil, err
+		}
+		key.window = key.window.UTC()
+		values[key] = value
+	}
+	return values, rows.Err()
+}
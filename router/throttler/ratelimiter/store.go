@@ -1,9 +1,12 @@
 package ratelimiter
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/rudderlabs/rudder-server/rruntime"
 )
 
 type limitValue struct {
@@ -18,27 +21,37 @@ type MapLimitStore struct {
 	expirationTime time.Duration
 }
 
-// NewMapLimitStore creates new in-memory data store for internal limiter data. Each element of MapLimitStore is set as expired after expirationTime from its last counter increment. Expired elements are removed with a period specified by the flushInterval argument
-func NewMapLimitStore(expirationTime time.Duration, flushInterval time.Duration) (m *MapLimitStore) {
+// NewMapLimitStore creates new in-memory data store for internal limiter data. Each element of MapLimitStore is set as expired after expirationTime from its last counter increment. Expired elements are removed with a period specified by the flushInterval argument, until ctx is done
+func NewMapLimitStore(ctx context.Context, expirationTime time.Duration, flushInterval time.Duration) (m *MapLimitStore) {
 	m = &MapLimitStore{
 		data:           make(map[string]limitValue),
 		expirationTime: expirationTime,
 	}
-	go func() {
+	rruntime.Go(func() {
 		ticker := time.NewTicker(flushInterval)
-		for range ticker.C {
-			m.mutex.Lock()
-			for key, val := range m.data {
-				if val.lastUpdate.Before(time.Now().UTC().Add(-m.expirationTime)) {
-					delete(m.data, key)
-				}
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.removeExpired()
 			}
-			m.mutex.Unlock()
 		}
-	}()
+	})
 	return m
 }
 
+func (m *MapLimitStore) removeExpired() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, val := range m.data {
+		if val.lastUpdate.Before(time.Now().UTC().Add(-m.expirationTime)) {
+			delete(m.data, key)
+		}
+	}
+}
+
 // Inc increments current window limit counter for key
 func (m *MapLimitStore) Inc(key string, window time.Time) error {
 	m.mutex.Lock()
@@ -1,11 +1,19 @@
 package throttler
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
 	"github.com/rudderlabs/rudder-server/router/throttler/ratelimiter"
+	"github.com/rudderlabs/rudder-server/services/kvstoremanager"
+	"github.com/rudderlabs/rudder-server/services/stats"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 )
 
@@ -15,6 +23,15 @@ const (
 	ALL_LEVELS        = "all"
 )
 
+const (
+	// MemoryStore keeps throttling counters in the router process, limits are enforced per router instance
+	MemoryStore = "memory"
+	// SharedStore keeps throttling counters in redis, or postgres if redis is not configured, limits are enforced cluster-wide
+	SharedStore = "shared"
+)
+
+const sharedStoreKeyPrefix = "rudder_router_throttler_"
+
 //Throttler is an interface for throttling functions
 type Throttler interface {
 	CheckLimitReached(destID string, userID string, currentTime time.Time) bool
@@ -30,6 +47,13 @@ type Limiter struct {
 	eventLimit  int
 	timeWindow  time.Duration
 	ratelimiter *ratelimiter.RateLimiter
+
+	// localRatelimiter is used instead of a shared store ratelimiter while the shared store is unreachable,
+	// with the limit divided by the number of router replicas
+	localRatelimiter *ratelimiter.RateLimiter
+	// degradedUntil is the time in unix nanoseconds until which localRatelimiter is used
+	degradedUntil int64
+	degradedStat  stats.RudderStats
 }
 
 type Settings struct {
@@ -46,7 +70,77 @@ type HandleT struct {
 	userLimiter     *Limiter
 }
 
-var pkgLogger logger.LoggerI
+var (
+	pkgLogger             logger.LoggerI
+	storeType             string
+	redisAddress          string
+	redisPassword         string
+	redisClusterMode      bool
+	replicas              int
+	degradedRetryInterval time.Duration
+	// sharedStoreSyncInterval is the interval at which counters of the postgres shared store are synced with the table
+	sharedStoreSyncInterval time.Duration
+
+	sharedStoreOnce sync.Once
+	sharedKVStore   kvstoremanager.KVStoreManager
+	sharedDBHandle  *sql.DB
+)
+
+func loadConfig() {
+	// Store of throttling counters, either memory or shared
+	config.RegisterStringConfigVariable(MemoryStore, &storeType, false, "Router.throttler.store")
+	// Redis used by the shared store, postgres is used if no address is configured
+	config.RegisterStringConfigVariable("", &redisAddress, false, "Router.throttler.redis.address")
+	config.RegisterStringConfigVariable("", &redisPassword, false, "Router.throttler.redis.password")
+	config.RegisterBoolConfigVariable(false, &redisClusterMode, false, "Router.throttler.redis.clusterMode")
+	// Number of router replicas, limits are divided by it while the shared store is unreachable
+	config.RegisterIntConfigVariable(1, &replicas, false, 1, "Router.throttler.replicas")
+	// Time after which the shared store is tried again when it is unreachable
+	config.RegisterDurationConfigVariable(time.Duration(30), &degradedRetryInterval, false, time.Second, "Router.throttler.degradedRetryInterval")
+	// Interval at which counters of the postgres shared store are synced with the table
+	config.RegisterDurationConfigVariable(time.Duration(1), &sharedStoreSyncInterval, false, time.Second, "Router.throttler.postgres.syncInterval")
+}
+
+// sharedStoreExpirationTime is the expiration time of shared store counters, well beyond the two windows a ratelimiter reads
+const sharedStoreExpirationTime = 24 * time.Hour
+
+// newSharedStore returns a store whose counters are shared by the throttlers of all router instances, nil if the memory store is configured
+// or the shared store could not be set up. Connections are shared by the stores of all destinations, background work of the store stops when ctx is done.
+func newSharedStore(ctx context.Context, destName string) ratelimiter.LimitStore {
+	sharedStoreOnce.Do(func() {
+		if storeType != SharedStore {
+			return
+		}
+		if strings.TrimSpace(redisAddress) != "" {
+			sharedKVStore = kvstoremanager.New("REDIS", map[string]interface{}{
+				"address":     redisAddress,
+				"password":    redisPassword,
+				"clusterMode": redisClusterMode,
+			})
+			pkgLogger.Infof(`[[ router-throttler: Using redis shared store at %s ]]`, redisAddress)
+			return
+		}
+		dbHandle, err := sql.Open("postgres", jobsdb.GetConnectionString())
+		if err != nil {
+			pkgLogger.Errorf(`[[ router-throttler: Failed to connect to postgres, falling back to memory store: %v ]]`, err)
+			return
+		}
+		sharedDBHandle = dbHandle
+		pkgLogger.Info(`[[ router-throttler: Using postgres shared store ]]`)
+	})
+	if sharedKVStore != nil {
+		return ratelimiter.NewKVLimitStore(sharedKVStore, sharedStoreKeyPrefix, sharedStoreExpirationTime)
+	}
+	if sharedDBHandle != nil {
+		store, err := ratelimiter.NewPostgresLimitStore(ctx, sharedDBHandle, sharedStoreKeyPrefix+"counters", sharedStoreExpirationTime, time.Minute, sharedStoreSyncInterval)
+		if err != nil {
+			pkgLogger.Errorf(`[[ %s-router-throttler: Failed to setup postgres shared store, falling back to memory store: %v ]]`, destName, err)
+			return nil
+		}
+		return store
+	}
+	return nil
+}
 
 func (throttler *HandleT) setLimits() {
 	destName := throttler.destinationName
@@ -76,9 +170,10 @@ func (throttler *HandleT) setLimits() {
 	}
 }
 
-//SetUp eventLimiter
-func (throttler *HandleT) SetUp(destName string) {
+//SetUp eventLimiter, background work of its stores stops when ctx is done
+func (throttler *HandleT) SetUp(ctx context.Context, destName string) {
 	pkgLogger = logger.NewLogger().Child("router").Child("throttler")
+	loadConfig()
 	throttler.destinationName = destName
 	throttler.destLimiter = &Limiter{}
 	throttler.userLimiter = &Limiter{}
@@ -86,14 +181,79 @@ func (throttler *HandleT) SetUp(destName string) {
 	// check if it has throttling config for destination
 	throttler.setLimits()
 
+	if !throttler.destLimiter.enabled && !throttler.userLimiter.enabled {
+		return
+	}
+	store := newSharedStore(ctx, destName)
 	if throttler.destLimiter.enabled {
-		dataStore := ratelimiter.NewMapLimitStore(2*throttler.destLimiter.timeWindow, 10*time.Second)
-		throttler.destLimiter.ratelimiter = ratelimiter.New(dataStore, int64(throttler.destLimiter.eventLimit), throttler.destLimiter.timeWindow)
+		throttler.destLimiter.setUpRatelimiters(ctx, store, stats.Tags{"destType": destName, "level": DESTINATION_LEVEL})
 	}
 
 	if throttler.userLimiter.enabled {
-		dataStore := ratelimiter.NewMapLimitStore(2*throttler.userLimiter.timeWindow, 10*time.Second)
-		throttler.userLimiter.ratelimiter = ratelimiter.New(dataStore, int64(throttler.userLimiter.eventLimit), throttler.userLimiter.timeWindow)
+		throttler.userLimiter.setUpRatelimiters(ctx, store, stats.Tags{"destType": destName, "level": USER_LEVEL})
+	}
+}
+
+// setUpRatelimiters sets up the ratelimiter on sharedStore, if not nil, and the local ratelimiter which is used in its place
+// while sharedStore is unreachable. Without a sharedStore the local ratelimiter enforces the full limit.
+func (limiter *Limiter) setUpRatelimiters(ctx context.Context, sharedStore ratelimiter.LimitStore, tags stats.Tags) {
+	localLimit := limiter.eventLimit
+	if sharedStore != nil {
+		limiter.ratelimiter = ratelimiter.New(sharedStore, int64(limiter.eventLimit), limiter.timeWindow)
+		localLimit = limiter.eventLimit / replicas
+		if localLimit < 1 {
+			localLimit = 1
+		}
+	}
+	dataStore := ratelimiter.NewMapLimitStore(ctx, 2*limiter.timeWindow, 10*time.Second)
+	limiter.localRatelimiter = ratelimiter.New(dataStore, int64(localLimit), limiter.timeWindow)
+	if limiter.ratelimiter == nil {
+		limiter.ratelimiter = limiter.localRatelimiter
+	}
+	limiter.degradedStat = stats.NewTaggedStat("router_throttler_degraded", stats.CountType, tags)
+}
+
+// current returns the ratelimiter to be used, the local one while in degraded mode
+func (limiter *Limiter) current() *ratelimiter.RateLimiter {
+	if time.Now().UnixNano() < atomic.LoadInt64(&limiter.degradedUntil) {
+		return limiter.localRatelimiter
+	}
+	return limiter.ratelimiter
+}
+
+// degrade switches to the local ratelimiter for degradedRetryInterval, after the shared store returned err.
+// It returns false if there is no local ratelimiter to switch to.
+func (limiter *Limiter) degrade(destinationName string, err error) bool {
+	if limiter.ratelimiter == limiter.localRatelimiter {
+		return false
+	}
+	pkgLogger.Errorf(`[[ %s-router-throttler: Shared store unreachable, using local limits for %v: %v]]`, destinationName, degradedRetryInterval, err)
+	atomic.StoreInt64(&limiter.degradedUntil, time.Now().Add(degradedRetryInterval).UnixNano())
+	limiter.degradedStat.Increment()
+	return true
+}
+
+func (limiter *Limiter) check(destinationName, key string, currentTime time.Time) bool {
+	limitStatus, err := limiter.current().Check(key, currentTime)
+	if err != nil && limiter.degrade(destinationName, err) {
+		limitStatus, err = limiter.localRatelimiter.Check(key, currentTime)
+	}
+	if err != nil {
+		pkgLogger.Errorf(`[[ %s-router-throttler: Error checking limitStatus: %v]]`, destinationName, err)
+		return false
+	}
+	return limitStatus.IsLimited
+}
+
+func (limiter *Limiter) inc(destinationName, key string, currentTime time.Time) {
+	if err := limiter.current().Inc(key, currentTime); err != nil && limiter.degrade(destinationName, err) {
+		_ = limiter.localRatelimiter.Inc(key, currentTime)
+	}
+}
+
+func (limiter *Limiter) dec(destinationName, key string, count int64, currentTime time.Time) {
+	if err := limiter.current().Dec(key, count, currentTime); err != nil && limiter.degrade(destinationName, err) {
+		_ = limiter.localRatelimiter.Dec(key, count, currentTime)
 	}
 }
 
@@ -102,25 +262,13 @@ func (throttler *HandleT) CheckLimitReached(destID string, userID string, curren
 	var destLevelLimitReached bool
 	if throttler.destLimiter.enabled {
 		destKey := throttler.getDestKey(destID)
-		limitStatus, err := throttler.destLimiter.ratelimiter.Check(destKey, currentTime)
-		if err != nil {
-			// TODO: handle this
-			pkgLogger.Errorf(`[[ %s-router-throttler: Error checking limitStatus: %v]]`, throttler.destinationName, err)
-		} else {
-			destLevelLimitReached = limitStatus.IsLimited
-		}
+		destLevelLimitReached = throttler.destLimiter.check(throttler.destinationName, destKey, currentTime)
 	}
 
 	var userLevelLimitReached bool
 	if !destLevelLimitReached && throttler.userLimiter.enabled {
 		userKey := throttler.getUserKey(destID, userID)
-		limitStatus, err := throttler.userLimiter.ratelimiter.Check(userKey, currentTime)
-		if err != nil {
-			// TODO: handle this
-			pkgLogger.Errorf(`[[ %s-router-throttler: Error checking limitStatus: %v]]`, throttler.destinationName, err)
-		} else {
-			userLevelLimitReached = limitStatus.IsLimited
-		}
+		userLevelLimitReached = throttler.userLimiter.check(throttler.destinationName, userKey, currentTime)
 	}
 
 	return destLevelLimitReached || userLevelLimitReached
@@ -131,11 +279,11 @@ func (throttler *HandleT) CheckLimitReached(destID string, userID string, curren
 func (throttler *HandleT) Inc(destID string, userID string, currentTime time.Time) {
 	if throttler.destLimiter.enabled && destID != "" {
 		destKey := throttler.getDestKey(destID)
-		_ = throttler.destLimiter.ratelimiter.Inc(destKey, currentTime)
+		throttler.destLimiter.inc(throttler.destinationName, destKey, currentTime)
 	}
 	if throttler.userLimiter.enabled && userID != "" {
 		userKey := throttler.getUserKey(destID, userID)
-		_ = throttler.userLimiter.ratelimiter.Inc(userKey, currentTime)
+		throttler.userLimiter.inc(throttler.destinationName, userKey, currentTime)
 	}
 }
 
@@ -144,11 +292,11 @@ func (throttler *HandleT) Inc(destID string, userID string, currentTime time.Tim
 func (throttler *HandleT) Dec(destID string, userID string, count int64, currentTime time.Time, atLevel string) {
 	if throttler.destLimiter.enabled && destID != "" && (atLevel == ALL_LEVELS || atLevel == DESTINATION_LEVEL) {
 		destKey := throttler.getDestKey(destID)
-		_ = throttler.destLimiter.ratelimiter.Dec(destKey, count, currentTime)
+		throttler.destLimiter.dec(throttler.destinationName, destKey, count, currentTime)
 	}
 	if throttler.userLimiter.enabled && userID != "" && (atLevel == ALL_LEVELS || atLevel == USER_LEVEL) {
 		userKey := throttler.getUserKey(destID, userID)
-		_ = throttler.userLimiter.ratelimiter.Dec(userKey, count, currentTime)
+		throttler.userLimiter.dec(throttler.destinationName, userKey, count, currentTime)
 	}
 }
 
@@ -0,0 +1,105 @@
+package throttler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/router/throttler/ratelimiter"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+// unreliableStore is a shared store which can be made unreachable
+type unreliableStore struct {
+	*ratelimiter.MapLimitStore
+	unreachable bool
+}
+
+var errUnreachable = errors.New("unreachable")
+
+func (s *unreliableStore) Inc(key string, window time.Time) error {
+	if s.unreachable {
+		return errUnreachable
+	}
+	return s.MapLimitStore.Inc(key, window)
+}
+
+func (s *unreliableStore) Dec(key string, count int64, window time.Time) error {
+	if s.unreachable {
+		return errUnreachable
+	}
+	return s.MapLimitStore.Dec(key, count, window)
+}
+
+func (s *unreliableStore) Get(key string, previousWindow, currentWindow time.Time) (int64, int64, error) {
+	if s.unreachable {
+		return 0, 0, errUnreachable
+	}
+	return s.MapLimitStore.Get(key, previousWindow, currentWindow)
+}
+
+func TestThrottlerDegradedMode(t *testing.T) {
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	pkgLogger = logger.NewLogger().Child("router").Child("throttler")
+	loadConfig()
+	replicas = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &unreliableStore{MapLimitStore: ratelimiter.NewMapLimitStore(ctx, time.Hour, time.Hour)}
+	destLimiter := &Limiter{enabled: true, eventLimit: 4, timeWindow: time.Minute}
+	destLimiter.setUpRatelimiters(ctx, store, stats.Tags{"destType": "DEST", "level": DESTINATION_LEVEL})
+	throttler := &HandleT{destinationName: "DEST", destLimiter: destLimiter, userLimiter: &Limiter{}}
+
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		require.False(t, throttler.CheckLimitReached("d1", "u1", now))
+		throttler.Inc("d1", "u1", now)
+	}
+
+	// while the shared store is unreachable the limit is divided by the replicas
+	store.unreachable = true
+	require.False(t, throttler.CheckLimitReached("d1", "u1", now))
+	throttler.Inc("d1", "u1", now)
+	throttler.Inc("d1", "u1", now)
+	require.True(t, throttler.CheckLimitReached("d1", "u1", now))
+	throttler.Dec("d1", "u1", 1, now, ALL_LEVELS)
+	require.False(t, throttler.CheckLimitReached("d1", "u1", now))
+
+	// the shared store is only tried again after degradedRetryInterval
+	store.unreachable = false
+	require.Equal(t, destLimiter.localRatelimiter, destLimiter.current())
+	destLimiter.degradedUntil = 0
+	require.False(t, throttler.CheckLimitReached("d1", "u1", now))
+	throttler.Inc("d1", "u1", now)
+	require.True(t, throttler.CheckLimitReached("d1", "u1", now))
+}
+
+func TestThrottlerMemoryStore(t *testing.T) {
+	config.Load()
+	logger.Init()
+	stats.Setup()
+	pkgLogger = logger.NewLogger().Child("router").Child("throttler")
+	loadConfig()
+	replicas = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// without a shared store the full limit is enforced locally
+	destLimiter := &Limiter{enabled: true, eventLimit: 2, timeWindow: time.Minute}
+	destLimiter.setUpRatelimiters(ctx, nil, stats.Tags{"destType": "DEST", "level": DESTINATION_LEVEL})
+	throttler := &HandleT{destinationName: "DEST", destLimiter: destLimiter, userLimiter: &Limiter{}}
+
+	now := time.Now().Truncate(time.Minute)
+	throttler.Inc("d1", "u1", now)
+	require.False(t, throttler.CheckLimitReached("d1", "u1", now))
+	throttler.Inc("d1", "u1", now)
+	require.True(t, throttler.CheckLimitReached("d1", "u1", now))
+}
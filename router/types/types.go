@@ -46,6 +46,7 @@ type JobMetadataT struct {
 	JobT             *jobsdb.JobT    `json:"jobsT"`
 	PickedAtTime     time.Time       `json:"pickedAtTime"`
 	ResultSetID      int64           `json:"resultSetID"`
+	TraceParent      string          `json:"traceparent,omitempty"`
 }
 
 //TransformMessageT is used to pass message to the transformer workers
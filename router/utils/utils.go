@@ -2,6 +2,8 @@ package utils
 
 import (
 	"encoding/base64"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +34,34 @@ type SendPostResponse struct {
 	StatusCode          int
 	ResponseContentType string
 	ResponseBody        []byte
+	ResponseHeaders     http.Header
+}
+
+// RetryAt returns the time before which the destination asked not to be called again, using the Retry-After
+// (delay in seconds or http date) and X-RateLimit-Reset (unix timestamp or delay in seconds) response headers.
+// A zero time is returned if neither header is present or parsable.
+func RetryAt(headers http.Header, now time.Time) time.Time {
+	if headers == nil {
+		return time.Time{}
+	}
+	if retryAfter := strings.TrimSpace(headers.Get("Retry-After")); retryAfter != "" {
+		if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil && seconds >= 0 {
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			return t
+		}
+	}
+	if reset := strings.TrimSpace(headers.Get("X-RateLimit-Reset")); reset != "" {
+		if value, err := strconv.ParseFloat(reset, 64); err == nil && value >= 0 {
+			// providers either send the unix timestamp of the reset or the seconds left until it
+			if value > float64(now.Unix())/2 {
+				return time.Unix(0, int64(value*float64(time.Second)))
+			}
+			return now.Add(time.Duration(value * float64(time.Second)))
+		}
+	}
+	return time.Time{}
 }
 
 func Init() {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/rudderlabs/rudder-server/config"
 	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
@@ -30,6 +31,8 @@ type DeliveryStatusT struct {
 var uploadEnabledDestinationIDs map[string]bool
 var configSubscriberLock sync.RWMutex
 
+var sinkConfig debugger.SinkConfigT
+
 var uploader debugger.UploaderI
 
 var (
@@ -118,7 +121,27 @@ func (eventDeliveryStatusUploader *EventDeliveryStatusUploader) Transform(data i
 	return rawJSON, nil
 }
 
+//SinkEvents returns the delivery status for the local sinks, keyed by its destination
+func (eventDeliveryStatusUploader *EventDeliveryStatusUploader) SinkEvents(data interface{}) []*debugger.SinkEventT {
+	deliveryStatus := data.(*DeliveryStatusT)
+	payload, err := json.Marshal(deliveryStatus)
+	if err != nil {
+		pkgLogger.Errorf("[Destination live events] Failed to marshal payload. Err: %v", err)
+		return nil
+	}
+
+	return []*debugger.SinkEventT{{
+		Debugger:    debugger.DestinationDebugger,
+		ID:          deliveryStatus.DestinationID,
+		WorkspaceID: sinkConfig.DestinationWorkspaceID(deliveryStatus.DestinationID),
+		RecordedAt:  time.Now(),
+		Payload:     payload,
+	}}
+}
+
 func updateConfig(sources backendconfig.ConfigT) {
+	sinkConfig.Update(sources)
+
 	configSubscriberLock.Lock()
 	uploadEnabledDestinationIDs = make(map[string]bool)
 	var uploadEnabledDestinationIdsList []string
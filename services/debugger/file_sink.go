@@ -0,0 +1,109 @@
+package debugger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+const defaultFileSinkDir = "rudder-debugger-events"
+
+type workspaceFileT struct {
+	file *os.File
+	size int64
+}
+
+// fileSinkT appends the events of every workspace as NDJSON to <dir>/<workspaceID>.ndjson.
+// Files exceeding fileMaxBytes are rotated to <workspaceID>.ndjson.1, replacing the previous rotated file.
+type fileSinkT struct {
+	lock  sync.Mutex
+	dir   string
+	files map[string]*workspaceFileT
+}
+
+// newFileSink creates dir, defaulting to a directory in the tmp directory of rudder
+func newFileSink(dir string) (*fileSinkT, error) {
+	if dir == "" {
+		tmpDir, err := misc.CreateTMPDIR()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(tmpDir, defaultFileSinkDir)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &fileSinkT{dir: dir, files: make(map[string]*workspaceFileT)}, nil
+}
+
+func (sink *fileSinkT) Write(events []*SinkEventT) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			pkgLogger.Errorf("[Debugger sink] Failed to marshal event: %v", err)
+			continue
+		}
+		line = append(line, '\n')
+		if err := sink.write(event.WorkspaceID, line); err != nil {
+			pkgLogger.Errorf("[Debugger sink] Failed to write event of workspace %s: %v", event.WorkspaceID, err)
+		}
+	}
+}
+
+func (sink *fileSinkT) write(workspaceID string, line []byte) error {
+	workspaceFile, err := sink.open(workspaceID)
+	if err != nil {
+		return err
+	}
+	if workspaceFile.size > 0 && workspaceFile.size+int64(len(line)) > fileMaxBytes {
+		if workspaceFile, err = sink.rotate(workspaceID); err != nil {
+			return err
+		}
+	}
+	n, err := workspaceFile.file.Write(line)
+	workspaceFile.size += int64(n)
+	return err
+}
+
+func (sink *fileSinkT) path(workspaceID string) string {
+	if workspaceID == "" {
+		workspaceID = "unknown-workspace"
+	}
+	return filepath.Join(sink.dir, filepath.Base(workspaceID)+".ndjson")
+}
+
+func (sink *fileSinkT) open(workspaceID string) (*workspaceFileT, error) {
+	if workspaceFile, ok := sink.files[workspaceID]; ok {
+		return workspaceFile, nil
+	}
+	file, err := os.OpenFile(sink.path(workspaceID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	workspaceFile := &workspaceFileT{file: file, size: info.Size()}
+	sink.files[workspaceID] = workspaceFile
+	return workspaceFile, nil
+}
+
+func (sink *fileSinkT) rotate(workspaceID string) (*workspaceFileT, error) {
+	path := sink.path(workspaceID)
+	if err := sink.files[workspaceID].file.Close(); err != nil {
+		return nil, err
+	}
+	delete(sink.files, workspaceID)
+	if err := os.Rename(path, path+".1"); err != nil {
+		return nil, fmt.Errorf("rotating %s: %w", path, err)
+	}
+	return sink.open(workspaceID)
+}
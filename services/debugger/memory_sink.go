@@ -0,0 +1,217 @@
+package debugger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bugsnag/bugsnag-go/v2"
+	"github.com/gorilla/mux"
+)
+
+// subscriberBuffer is the number of events buffered per stream, events are dropped for streams lagging behind
+const subscriberBuffer = 100
+
+type bufferKeyT struct {
+	debugger string
+	id       string
+}
+
+type bufferedEventT struct {
+	sequence int64
+	event    *SinkEventT
+}
+
+type workspaceBufferT struct {
+	bytes int
+	keys  map[bufferKeyT]struct{}
+}
+
+// memorySinkT keeps the latest events of every source, destination and transformation in memory,
+// and serves them, as well as the live ones, over HTTP
+type memorySinkT struct {
+	lock        sync.Mutex
+	sequence    int64
+	buffers     map[bufferKeyT][]*bufferedEventT
+	workspaces  map[string]*workspaceBufferT
+	subscribers map[bufferKeyT]map[chan *SinkEventT]struct{}
+}
+
+func newMemorySink() *memorySinkT {
+	return &memorySinkT{
+		buffers:     make(map[bufferKeyT][]*bufferedEventT),
+		workspaces:  make(map[string]*workspaceBufferT),
+		subscribers: make(map[bufferKeyT]map[chan *SinkEventT]struct{}),
+	}
+}
+
+// Write appends the events to the buffers of their ids, evicting the oldest ones
+// when a buffer exceeds maxEventsPerID or a workspace exceeds memoryMaxBytes
+func (sink *memorySinkT) Write(events []*SinkEventT) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	for _, event := range events {
+		key := bufferKeyT{debugger: event.Debugger, id: event.ID}
+		workspace, ok := sink.workspaces[event.WorkspaceID]
+		if !ok {
+			workspace = &workspaceBufferT{keys: make(map[bufferKeyT]struct{})}
+			sink.workspaces[event.WorkspaceID] = workspace
+		}
+		workspace.keys[key] = struct{}{}
+
+		sink.sequence++
+		sink.buffers[key] = append(sink.buffers[key], &bufferedEventT{sequence: sink.sequence, event: event})
+		workspace.bytes += len(event.Payload)
+		for len(sink.buffers[key]) > maxEventsPerID {
+			sink.evict(workspace, key)
+		}
+		for workspace.bytes > memoryMaxBytes && len(workspace.keys) > 0 {
+			sink.evict(workspace, sink.oldestKey(workspace))
+		}
+
+		for subscriber := range sink.subscribers[key] {
+			select {
+			case subscriber <- event:
+			default:
+			}
+		}
+	}
+}
+
+// evict removes the oldest event of the buffer of key
+func (sink *memorySinkT) evict(workspace *workspaceBufferT, key bufferKeyT) {
+	buffer := sink.buffers[key]
+	workspace.bytes -= len(buffer[0].event.Payload)
+	buffer[0] = nil
+	if len(buffer) == 1 {
+		delete(sink.buffers, key)
+		delete(workspace.keys, key)
+		return
+	}
+	sink.buffers[key] = buffer[1:]
+}
+
+// oldestKey returns the key of the buffer holding the oldest event of the workspace
+func (sink *memorySinkT) oldestKey(workspace *workspaceBufferT) bufferKeyT {
+	var oldest bufferKeyT
+	var oldestSequence int64
+	for key := range workspace.keys {
+		if buffer := sink.buffers[key]; len(buffer) > 0 && (oldestSequence == 0 || buffer[0].sequence < oldestSequence) {
+			oldest, oldestSequence = key, buffer[0].sequence
+		}
+	}
+	return oldest
+}
+
+// events returns the buffered events of key, oldest first
+func (sink *memorySinkT) events(key bufferKeyT) []*SinkEventT {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.eventsLocked(key)
+}
+
+func (sink *memorySinkT) eventsLocked(key bufferKeyT) []*SinkEventT {
+	events := make([]*SinkEventT, 0, len(sink.buffers[key]))
+	for _, buffered := range sink.buffers[key] {
+		events = append(events, buffered.event)
+	}
+	return events
+}
+
+// subscribe returns the buffered events of key and a channel of the ones written afterwards
+func (sink *memorySinkT) subscribe(key bufferKeyT) ([]*SinkEventT, chan *SinkEventT) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	subscriber := make(chan *SinkEventT, subscriberBuffer)
+	if _, ok := sink.subscribers[key]; !ok {
+		sink.subscribers[key] = make(map[chan *SinkEventT]struct{})
+	}
+	sink.subscribers[key][subscriber] = struct{}{}
+	return sink.eventsLocked(key), subscriber
+}
+
+func (sink *memorySinkT) unsubscribe(key bufferKeyT, subscriber chan *SinkEventT) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	delete(sink.subscribers[key], subscriber)
+	if len(sink.subscribers[key]) == 0 {
+		delete(sink.subscribers, key)
+	}
+}
+
+func (sink *memorySinkT) router() *mux.Router {
+	srvMux := mux.NewRouter()
+	srvMux.HandleFunc("/v1/debugger/{debugger}/{id}/events", sink.eventsHandler).Methods("GET")
+	srvMux.HandleFunc("/v1/debugger/{debugger}/{id}/stream", sink.streamHandler).Methods("GET")
+	return srvMux
+}
+
+func (sink *memorySinkT) startWebHandler() {
+	pkgLogger.Infof("Starting debugger events server in %d", sinkWebPort)
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(sinkWebPort),
+		Handler: bugsnag.Handler(sink.router()),
+	}
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		pkgLogger.Errorf("[Debugger sink] Events server stopped: %v", err)
+	}
+}
+
+func requestKey(r *http.Request) bufferKeyT {
+	vars := mux.Vars(r)
+	return bufferKeyT{debugger: vars["debugger"], id: vars["id"]}
+}
+
+// eventsHandler returns the buffered events of a source, destination or transformation
+func (sink *memorySinkT) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sink.events(requestKey(r))); err != nil {
+		pkgLogger.Errorf("[Debugger sink] Failed to write events response: %v", err)
+	}
+}
+
+// streamHandler streams the buffered and live events of a source, destination or transformation as server-sent events
+func (sink *memorySinkT) streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	key := requestKey(r)
+	buffered, subscriber := sink.subscribe(key)
+	defer sink.unsubscribe(key, subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range buffered {
+		if err := writeServerSentEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-subscriber:
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event *SinkEventT) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,193 @@
+package debugger
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/rruntime"
+)
+
+// Debugger names, used to key the events kept by local sinks
+const (
+	SourceDebugger         = "source"
+	DestinationDebugger    = "destination"
+	TransformationDebugger = "transformation"
+)
+
+var (
+	sinksOnce         sync.Once
+	sinks             []SinkI
+	memoryEnabled     bool
+	fileEnabled       bool
+	sampleRate        float64
+	sinkWebPort       int
+	maxEventsPerID    int
+	memoryMaxBytes    int
+	fileDir           string
+	fileMaxBytes      int64
+	sinkChannelBuffer int
+)
+
+func loadSinkConfig() {
+	config.RegisterBoolConfigVariable(false, &memoryEnabled, false, "Debugger.local.memory.enabled")
+	config.RegisterBoolConfigVariable(false, &fileEnabled, false, "Debugger.local.file.enabled")
+	// Fraction of the events kept by local sinks, between 0 and 1
+	config.RegisterFloat64ConfigVariable(1, &sampleRate, true, "Debugger.local.sampleRate")
+	config.RegisterIntConfigVariable(8088, &sinkWebPort, false, 1, "Debugger.local.memory.webPort")
+	config.RegisterIntConfigVariable(100, &maxEventsPerID, true, 1, "Debugger.local.memory.maxEventsPerId")
+	config.RegisterIntConfigVariable(10*1024*1024, &memoryMaxBytes, true, 1, "Debugger.local.memory.maxBytesPerWorkspace")
+	config.RegisterStringConfigVariable("", &fileDir, false, "Debugger.local.file.dir")
+	config.RegisterInt64ConfigVariable(100*1024*1024, &fileMaxBytes, true, 1, "Debugger.local.file.maxBytesPerWorkspace")
+	config.RegisterIntConfigVariable(1024, &sinkChannelBuffer, false, 1, "Debugger.local.channelBuffer")
+}
+
+// SinkEventT is an event recorded by a debugger, as kept by local sinks.
+// ID is the id of the source, destination or transformation the event belongs to.
+type SinkEventT struct {
+	Debugger    string          `json:"debugger"`
+	ID          string          `json:"id"`
+	WorkspaceID string          `json:"workspaceId"`
+	RecordedAt  time.Time       `json:"recordedAt"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// SinkTransformer is implemented by the transformers of debuggers supporting local sinks.
+// It converts the data of a recorded event to the events kept by the sinks.
+type SinkTransformer interface {
+	SinkEvents(data interface{}) []*SinkEventT
+}
+
+// SinkConfigT is the backend config the SinkTransformers of debuggers key their events with.
+// It is behind its own lock, as debuggers record events while holding the lock of their own config.
+type SinkConfigT struct {
+	lock                  sync.RWMutex
+	sourcesByWriteKey     map[string]backendconfig.SourceT
+	sourceWorkspaces      map[string]string
+	destinationWorkspaces map[string]string
+}
+
+// Update replaces the config with the one of the given sources
+func (sinkConfig *SinkConfigT) Update(sources backendconfig.ConfigT) {
+	sourcesByWriteKey := make(map[string]backendconfig.SourceT)
+	sourceWorkspaces := make(map[string]string)
+	destinationWorkspaces := make(map[string]string)
+	for _, source := range sources.Sources {
+		if source.Enabled {
+			sourcesByWriteKey[source.WriteKey] = source
+		}
+		sourceWorkspaces[source.ID] = source.WorkspaceID
+		for _, destination := range source.Destinations {
+			destinationWorkspaces[destination.ID] = source.WorkspaceID
+		}
+	}
+	sinkConfig.lock.Lock()
+	defer sinkConfig.lock.Unlock()
+	sinkConfig.sourcesByWriteKey = sourcesByWriteKey
+	sinkConfig.sourceWorkspaces = sourceWorkspaces
+	sinkConfig.destinationWorkspaces = destinationWorkspaces
+}
+
+// EnabledSource returns the enabled source of the write key
+func (sinkConfig *SinkConfigT) EnabledSource(writeKey string) (backendconfig.SourceT, bool) {
+	sinkConfig.lock.RLock()
+	defer sinkConfig.lock.RUnlock()
+	source, ok := sinkConfig.sourcesByWriteKey[writeKey]
+	return source, ok
+}
+
+// SourceWorkspaceID returns the workspace of the source
+func (sinkConfig *SinkConfigT) SourceWorkspaceID(sourceID string) string {
+	sinkConfig.lock.RLock()
+	defer sinkConfig.lock.RUnlock()
+	return sinkConfig.sourceWorkspaces[sourceID]
+}
+
+// DestinationWorkspaceID returns the workspace of the destination
+func (sinkConfig *SinkConfigT) DestinationWorkspaceID(destinationID string) string {
+	sinkConfig.lock.RLock()
+	defer sinkConfig.lock.RUnlock()
+	return sinkConfig.destinationWorkspaces[destinationID]
+}
+
+// SinkI keeps the events of debuggers locally, for self-hosted setups without a control plane
+type SinkI interface {
+	Write(events []*SinkEventT)
+}
+
+// setupSinks creates the enabled local sinks, once for all debuggers
+func setupSinks() {
+	loadSinkConfig()
+	if memoryEnabled {
+		memorySink := newMemorySink()
+		sinks = append(sinks, memorySink)
+		rruntime.Go(func() {
+			memorySink.startWebHandler()
+		})
+	}
+	if fileEnabled {
+		fileSink, err := newFileSink(fileDir)
+		if err != nil {
+			pkgLogger.Errorf("[Debugger sink] Failed to set up file sink: %v", err)
+		} else {
+			sinks = append(sinks, fileSink)
+		}
+	}
+}
+
+// sinkUploader records the events of a debugger to the local sinks, instead of uploading them to the control plane
+type sinkUploader struct {
+	transformer  SinkTransformer
+	sinks        []SinkI
+	eventChannel chan interface{}
+	sample       func() bool
+}
+
+func newSinkUploader(transformer SinkTransformer, sinks []SinkI) *sinkUploader {
+	return &sinkUploader{
+		transformer:  transformer,
+		sinks:        sinks,
+		eventChannel: make(chan interface{}, sinkChannelBuffer),
+		sample: func() bool {
+			return sampleRate >= 1 || rand.Float64() < sampleRate
+		},
+	}
+}
+
+func (uploader *sinkUploader) Start() {
+	rruntime.Go(func() {
+		uploader.handleEvents()
+	})
+}
+
+// RecordEvent is used to put the event in the eventChannel, which will be processed by handleEvents.
+// Events are dropped when the channel is full, so that sinks never slow down the pipeline.
+func (uploader *sinkUploader) RecordEvent(data interface{}) bool {
+	select {
+	case uploader.eventChannel <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+func (uploader *sinkUploader) handleEvents() {
+	for data := range uploader.eventChannel {
+		events := uploader.transformer.SinkEvents(data)
+		sampled := make([]*SinkEventT, 0, len(events))
+		for _, event := range events {
+			if uploader.sample() {
+				sampled = append(sampled, event)
+			}
+		}
+		if len(sampled) == 0 {
+			continue
+		}
+		for _, sink := range uploader.sinks {
+			sink.Write(sampled)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+)
+
+type sinkTransformerT struct{}
+
+func (*sinkTransformerT) SinkEvents(data interface{}) []*SinkEventT {
+	return []*SinkEventT{sinkEvent(SourceDebugger, data.(string), "w1", `{"t":"a"}`)}
+}
+
+type sinkRecorderT struct {
+	events chan *SinkEventT
+}
+
+func (sink *sinkRecorderT) Write(events []*SinkEventT) {
+	for _, event := range events {
+		sink.events <- event
+	}
+}
+
+func sinkEvent(debugger, id, workspaceID, payload string) *SinkEventT {
+	return &SinkEventT{Debugger: debugger, ID: id, WorkspaceID: workspaceID, RecordedAt: time.Now(), Payload: json.RawMessage(payload)}
+}
+
+func payloads(events []*SinkEventT) []string {
+	res := make([]string, 0, len(events))
+	for _, event := range events {
+		res = append(res, string(event.Payload))
+	}
+	return res
+}
+
+var _ = Describe("Local sinks", func() {
+	initUploader()
+
+	BeforeEach(func() {
+		maxEventsPerID = 2
+		memoryMaxBytes = 1024
+		fileMaxBytes = 1024
+		sinkChannelBuffer = 1
+	})
+
+	Context("memory sink", func() {
+		It("keeps the latest events of every id", func() {
+			sink := newMemorySink()
+			sink.Write([]*SinkEventT{
+				sinkEvent(SourceDebugger, "s1", "w1", `1`),
+				sinkEvent(SourceDebugger, "s1", "w1", `2`),
+				sinkEvent(SourceDebugger, "s1", "w1", `3`),
+				sinkEvent(DestinationDebugger, "s1", "w1", `4`),
+			})
+			Expect(payloads(sink.events(bufferKeyT{SourceDebugger, "s1"}))).To(Equal([]string{`2`, `3`}))
+			Expect(payloads(sink.events(bufferKeyT{DestinationDebugger, "s1"}))).To(Equal([]string{`4`}))
+			Expect(sink.events(bufferKeyT{SourceDebugger, "s2"})).To(BeEmpty())
+			Expect(sink.workspaces["w1"].bytes).To(Equal(3))
+		})
+
+		It("evicts the oldest events of a workspace exceeding its size", func() {
+			memoryMaxBytes = 6
+			sink := newMemorySink()
+			sink.Write([]*SinkEventT{
+				sinkEvent(SourceDebugger, "s1", "w1", `"a"`),
+				sinkEvent(DestinationDebugger, "d1", "w1", `"b"`),
+				sinkEvent(SourceDebugger, "s2", "w2", `"c"`),
+				sinkEvent(DestinationDebugger, "d1", "w1", `"d"`),
+			})
+			Expect(sink.events(bufferKeyT{SourceDebugger, "s1"})).To(BeEmpty())
+			Expect(payloads(sink.events(bufferKeyT{DestinationDebugger, "d1"}))).To(Equal([]string{`"b"`, `"d"`}))
+			Expect(payloads(sink.events(bufferKeyT{SourceDebugger, "s2"}))).To(Equal([]string{`"c"`}))
+			Expect(sink.workspaces["w1"].bytes).To(Equal(6))
+		})
+
+		It("does not block on subscribers lagging behind", func() {
+			sink := newMemorySink()
+			key := bufferKeyT{SourceDebugger, "s1"}
+			_, subscriber := sink.subscribe(key)
+			for i := 0; i < subscriberBuffer+1; i++ {
+				sink.Write([]*SinkEventT{sinkEvent(SourceDebugger, "s1", "w1", `1`)})
+			}
+			Expect(subscriber).To(HaveLen(subscriberBuffer))
+			sink.unsubscribe(key, subscriber)
+			Expect(sink.subscribers).To(BeEmpty())
+		})
+
+		It("serves buffered and live events", func() {
+			sink := newMemorySink()
+			sink.Write([]*SinkEventT{sinkEvent(DestinationDebugger, "d1", "w1", `{"n":1}`)})
+			server := httptest.NewServer(sink.router())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/v1/debugger/destination/d1/events")
+			Expect(err).To(BeNil())
+			var events []*SinkEventT
+			Expect(json.NewDecoder(resp.Body).Decode(&events)).To(Succeed())
+			resp.Body.Close()
+			Expect(payloads(events)).To(Equal([]string{`{"n":1}`}))
+
+			resp, err = http.Get(server.URL + "/v1/debugger/destination/d1/stream")
+			Expect(err).To(BeNil())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+			reader := bufio.NewReader(resp.Body)
+			readEvent := func() *SinkEventT {
+				line, err := reader.ReadString('\n')
+				Expect(err).To(BeNil())
+				_, err = reader.ReadString('\n')
+				Expect(err).To(BeNil())
+				var event SinkEventT
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "data: ")), &event)).To(Succeed())
+				return &event
+			}
+			Expect(string(readEvent().Payload)).To(Equal(`{"n":1}`))
+
+			sink.Write([]*SinkEventT{sinkEvent(DestinationDebugger, "d1", "w1", `{"n":2}`)})
+			Expect(string(readEvent().Payload)).To(Equal(`{"n":2}`))
+		})
+	})
+
+	Context("file sink", func() {
+		It("appends events of every workspace and rotates files exceeding their size", func() {
+			dir, err := os.MkdirTemp("", "debugger-sink")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			sink, err := newFileSink(dir)
+			Expect(err).To(BeNil())
+			event := sinkEvent(SourceDebugger, "s1", "w1", `{"t":"a"}`)
+			line, err := json.Marshal(event)
+			Expect(err).To(BeNil())
+			fileMaxBytes = int64(2*len(line) + 2)
+
+			sink.Write([]*SinkEventT{event, event, sinkEvent(SourceDebugger, "s2", "w2", `{}`)})
+			content, err := os.ReadFile(filepath.Join(dir, "w1.ndjson"))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(Equal(string(line) + "\n" + string(line) + "\n"))
+			Expect(filepath.Join(dir, "w2.ndjson")).To(BeAnExistingFile())
+
+			sink.Write([]*SinkEventT{event})
+			content, err = os.ReadFile(filepath.Join(dir, "w1.ndjson"))
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(Equal(string(line) + "\n"))
+			rotated, err := os.ReadFile(filepath.Join(dir, "w1.ndjson.1"))
+			Expect(err).To(BeNil())
+			Expect(strings.Count(string(rotated), "\n")).To(Equal(2))
+		})
+	})
+
+	Context("sink uploader", func() {
+		It("writes sampled events to every sink", func() {
+			recorder := &sinkRecorderT{events: make(chan *SinkEventT, 10)}
+			uploader := newSinkUploader(&sinkTransformerT{}, []SinkI{recorder, recorder})
+			sampled := false
+			uploader.sample = func() bool {
+				sampled = !sampled
+				return sampled
+			}
+			uploader.Start()
+
+			Eventually(func() bool { return uploader.RecordEvent("s1") }).Should(BeTrue())
+			Eventually(func() bool { return uploader.RecordEvent("s2") }).Should(BeTrue())
+			Eventually(func() bool { return uploader.RecordEvent("s3") }).Should(BeTrue())
+			Eventually(recorder.events).Should(HaveLen(4))
+			for _, id := range []string{"s1", "s1", "s3", "s3"} {
+				Expect((<-recorder.events).ID).To(Equal(id))
+			}
+		})
+
+		It("drops events when the sinks lag behind", func() {
+			uploader := newSinkUploader(&sinkTransformerT{}, nil)
+			Expect(uploader.RecordEvent("s1")).To(BeTrue())
+			Expect(uploader.RecordEvent("s2")).To(BeFalse())
+		})
+	})
+
+	Context("sink config", func() {
+		It("keys sources and destinations by their workspace", func() {
+			var sinkConfig SinkConfigT
+			_, ok := sinkConfig.EnabledSource("wk1")
+			Expect(ok).To(BeFalse())
+
+			sinkConfig.Update(backendconfig.ConfigT{Sources: []backendconfig.SourceT{
+				{ID: "s1", WriteKey: "wk1", WorkspaceID: "w1", Enabled: true, Destinations: []backendconfig.DestinationT{{ID: "d1"}}},
+				{ID: "s2", WriteKey: "wk2", WorkspaceID: "w2"},
+			}})
+			source, ok := sinkConfig.EnabledSource("wk1")
+			Expect(ok).To(BeTrue())
+			Expect(source.ID).To(Equal("s1"))
+			_, ok = sinkConfig.EnabledSource("wk2")
+			Expect(ok).To(BeFalse(), "disabled sources are not sunk")
+			Expect(sinkConfig.SourceWorkspaceID("s2")).To(Equal("w2"))
+			Expect(sinkConfig.DestinationWorkspaceID("d1")).To(Equal("w1"))
+		})
+	})
+})
@@ -34,6 +34,8 @@ type EventUploadBatchT struct {
 var uploadEnabledWriteKeys []string
 var configSubscriberLock sync.RWMutex
 
+var sinkConfig debugger.SinkConfigT
+
 var uploader debugger.UploaderI
 
 var (
@@ -118,12 +120,6 @@ func (eventUploader *EventUploader) Transform(data interface{}) ([]byte, error)
 			continue
 		}
 
-		receivedAtTS, err := time.Parse(time.RFC3339, batchedEvent.ReceivedAt)
-		if err != nil {
-			receivedAtTS = time.Now()
-		}
-		receivedAtStr := receivedAtTS.Format(misc.RFC3339Milli)
-
 		var arr []EventUploadT
 		if value, ok := res[batchedEvent.WriteKey]; ok {
 			arr, _ = value.([]EventUploadT)
@@ -131,18 +127,7 @@ func (eventUploader *EventUploader) Transform(data interface{}) ([]byte, error)
 			arr = make([]EventUploadT, 0)
 		}
 
-		for _, ev := range batchedEvent.Batch {
-			// add the receivedAt time to each event
-			event := map[string]interface{}{
-				"payload":       ev,
-				"receivedAt":    receivedAtStr,
-				"eventName":     misc.GetStringifiedData(ev["event"]),
-				"eventType":     misc.GetStringifiedData(ev["type"]),
-				"errorResponse": make(map[string]interface{}),
-				"errorCode":     200,
-			}
-			arr = append(arr, event)
-		}
+		arr = append(arr, uploadEvents(batchedEvent)...)
 
 		res[batchedEvent.WriteKey] = arr
 	}
@@ -156,7 +141,66 @@ func (eventUploader *EventUploader) Transform(data interface{}) ([]byte, error)
 	return rawJSON, nil
 }
 
+//uploadEvents returns the events of the batch, with the receivedAt time of the batch
+func uploadEvents(batchedEvent EventUploadBatchT) []EventUploadT {
+	receivedAtTS, err := time.Parse(time.RFC3339, batchedEvent.ReceivedAt)
+	if err != nil {
+		receivedAtTS = time.Now()
+	}
+	receivedAtStr := receivedAtTS.Format(misc.RFC3339Milli)
+
+	events := make([]EventUploadT, 0, len(batchedEvent.Batch))
+	for _, ev := range batchedEvent.Batch {
+		// add the receivedAt time to each event
+		event := map[string]interface{}{
+			"payload":       ev,
+			"receivedAt":    receivedAtStr,
+			"eventName":     misc.GetStringifiedData(ev["event"]),
+			"eventType":     misc.GetStringifiedData(ev["type"]),
+			"errorResponse": make(map[string]interface{}),
+			"errorCode":     200,
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+//SinkEvents returns the events of the batch for the local sinks, keyed by their source
+func (eventUploader *EventUploader) SinkEvents(data interface{}) []*debugger.SinkEventT {
+	event := data.(*GatewayEventBatchT)
+	batchedEvent := EventUploadBatchT{}
+	if err := json.Unmarshal([]byte(event.eventBatch), &batchedEvent); err != nil {
+		pkgLogger.Errorf("[Source live events] Failed to unmarshal. Err: %v", err)
+		return nil
+	}
+
+	source, ok := sinkConfig.EnabledSource(event.writeKey)
+	if !ok {
+		return nil
+	}
+
+	recordedAt := time.Now()
+	sinkEvents := make([]*debugger.SinkEventT, 0, len(batchedEvent.Batch))
+	for _, ev := range uploadEvents(batchedEvent) {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			pkgLogger.Errorf("[Source live events] Failed to marshal event. Err: %v", err)
+			continue
+		}
+		sinkEvents = append(sinkEvents, &debugger.SinkEventT{
+			Debugger:    debugger.SourceDebugger,
+			ID:          source.ID,
+			WorkspaceID: source.WorkspaceID,
+			RecordedAt:  recordedAt,
+			Payload:     payload,
+		})
+	}
+	return sinkEvents
+}
+
 func updateConfig(sources backendconfig.ConfigT) {
+	sinkConfig.Update(sources)
+
 	configSubscriberLock.Lock()
 	uploadEnabledWriteKeys = []string{}
 	for _, source := range sources.Sources {
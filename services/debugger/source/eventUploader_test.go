@@ -9,6 +9,7 @@ import (
 	"github.com/rudderlabs/rudder-server/config"
 	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
 	mocksBackendConfig "github.com/rudderlabs/rudder-server/mocks/config/backend-config"
+	"github.com/rudderlabs/rudder-server/services/debugger"
 	"github.com/rudderlabs/rudder-server/utils/logger"
 	"github.com/rudderlabs/rudder-server/utils/pubsub"
 	testutils "github.com/rudderlabs/rudder-server/utils/tests"
@@ -164,6 +165,21 @@ var _ = Describe("eventUploader", func() {
 			recordingEvent = `{"receivedAt":"2021-08-03T17:26:00.279+05:30","writeKey":"1vWezJfHKkbUHexNepDsGcSVWae","requestIP":"[::1]",  "batch": [{"anonymousId":"anon_id","channel":"android-sdk","context":{"app":{"build":"1","name":"RudderAndroidClient","namespace":"com.rudderlabs.android.sdk","version":"1.0"},"device":{"id":"49e4bdd1c280bc00","manufacturer":"Google","model":"Android SDK built for x86","name":"generic_x86"},"library":{"name":"com.rudderstack.android.sdk.core"},"locale":"en-US","network":{"carrier":"Android"},"screen":{"density":420,"height":1794,"width":1080},"traits":{"anonymousId":"49e4bdd1c280bc00"},"user_agent":"Dalvik/2.1.0 (Linux; U; Android 9; Android SDK built for x86 Build/PSR1.180720.075)"},"event":"Demo Track","integrations":{"All":true},"messageId":"7a355fdd-0325-4778-9905-b43f586acdd4","originalTimestamp":"2019-08-12T05:08:30.909Z","properties":{"category":"Demo Category","floatVal":4.501,"label":"Demo Label","testArray":[{"id":"elem1","value":"e1"},{"id":"elem2","value":"e2"}],"testMap":{"t1":"a","t2":4},"value":5},"rudderId":"90ca6da0-292e-4e79-9880-f8009e0ae4a3","sentAt":"2019-08-12T05:08:30.909Z","type":"track"}]}`
 			Expect(RecordEvent(WriteKeyEnabled, recordingEvent)).To(BeTrue())
 		})
+
+		It("builds events of enabled sources for local sinks", func() {
+			updateConfig(sampleBackendConfig)
+			recordingEvent = `{"receivedAt":"2021-08-03T17:26:00.279+05:30","writeKey":"1vWezJfHKkbUHexNepDsGcSVWae","batch":[{"event":"Demo Track","type":"track"},{"type":"identify"}]}`
+			eventUploader := EventUploader{}
+			sinkEvents := eventUploader.SinkEvents(&GatewayEventBatchT{writeKey: WriteKeyEnabled, eventBatch: recordingEvent})
+			Expect(sinkEvents).To(HaveLen(2))
+			Expect(sinkEvents[0].Debugger).To(Equal(debugger.SourceDebugger))
+			Expect(sinkEvents[0].ID).To(Equal(SourceIDEnabled))
+			Expect(sinkEvents[0].WorkspaceID).To(Equal(WorkspaceID))
+			Expect(gjson.GetBytes(sinkEvents[0].Payload, "eventName").String()).To(Equal("Demo Track"))
+			Expect(gjson.GetBytes(sinkEvents[1].Payload, "eventType").String()).To(Equal("identify"))
+
+			Expect(eventUploader.SinkEvents(&GatewayEventBatchT{writeKey: "unknown-write-key", eventBatch: recordingEvent})).To(BeEmpty())
+		})
 	})
 })
 
@@ -177,10 +193,11 @@ var sampleBackendConfig = backendconfig.ConfigT{
 			Enabled:  false,
 		},
 		{
-			ID:       SourceIDEnabled,
-			WriteKey: WriteKeyEnabled,
-			Enabled:  true,
-			Config:   sourceConfigMap{"eventUpload": true},
+			ID:          SourceIDEnabled,
+			WriteKey:    WriteKeyEnabled,
+			WorkspaceID: WorkspaceID,
+			Enabled:     true,
+			Config:      sourceConfigMap{"eventUpload": true},
 			Destinations: []backendconfig.DestinationT{
 				{
 					ID:                 DestinationIDEnabledA,
@@ -76,6 +76,8 @@ var (
 var uploadEnabledTransformations map[string]bool
 var configSubscriberLock sync.RWMutex
 
+var sinkConfig debugger.SinkConfigT
+
 func Init() {
 	loadConfig()
 	pkgLogger = logger.NewLogger().Child("debugger").Child("transformation")
@@ -133,7 +135,27 @@ func (transformationStatusUploader *TransformationStatusUploader) Transform(data
 	return rawJSON, nil
 }
 
+//SinkEvents returns the transformation status for the local sinks, keyed by its transformation
+func (transformationStatusUploader *TransformationStatusUploader) SinkEvents(data interface{}) []*debugger.SinkEventT {
+	transformStatus := data.(*TransformStatusT)
+	payload, err := jsonfast.Marshal(transformStatus)
+	if err != nil {
+		pkgLogger.Errorf("[Transformation status uploader] Failed to marshal payload. Err: %v", err)
+		return nil
+	}
+
+	return []*debugger.SinkEventT{{
+		Debugger:    debugger.TransformationDebugger,
+		ID:          transformStatus.TransformationID,
+		WorkspaceID: sinkConfig.SourceWorkspaceID(transformStatus.SourceID),
+		RecordedAt:  time.Now(),
+		Payload:     payload,
+	}}
+}
+
 func updateConfig(sources backendconfig.ConfigT) {
+	sinkConfig.Update(sources)
+
 	configSubscriberLock.Lock()
 	uploadEnabledTransformations = make(map[string]bool)
 	var uploadEnabledTransformationsIDs []string
@@ -52,7 +52,14 @@ func (uploader *Uploader) Setup() {
 	config.RegisterDurationConfigVariable(time.Duration(100), &uploader.retrySleep, true, time.Millisecond, "Debugger.retrySleepInMS")
 }
 
+//New returns an uploader of the transformed events to the control plane at url,
+//or to the local sinks if any is enabled and the transformer supports them.
 func New(url string, transformer Transformer) UploaderI {
+	sinksOnce.Do(setupSinks)
+	if sinkTransformer, ok := transformer.(SinkTransformer); ok && len(sinks) > 0 {
+		return newSinkUploader(sinkTransformer, sinks)
+	}
+
 	eventBatchChannel := make(chan interface{})
 	eventBuffer := make([]interface{}, 0)
 	client := &http.Client{}
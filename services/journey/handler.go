@@ -0,0 +1,66 @@
+package journey
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Handler serves the journeys of the messages selected by the query parameters of the request,
+// either messageId or userId, along with the from and to RFC3339 times of reception. to defaults to now,
+// from to defaultTimeRange before to, and the time range is limited to maxTimeRange.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	handle := defaultHandle
+	if handle == nil {
+		http.Error(w, "journey lookup is not available", http.StatusNotFound)
+		return
+	}
+	query, err := parseQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	journeys, err := handle.Lookup(r.Context(), query)
+	if err != nil {
+		pkgLogger.Errorf("Failed to look up journey of %+v: %v", query, err)
+		http.Error(w, "failed to look up journey", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(journeys); err != nil {
+		pkgLogger.Errorf("Failed to write journey of %+v: %v", query, err)
+	}
+}
+
+func parseQuery(r *http.Request, now time.Time) (QueryT, error) {
+	params := r.URL.Query()
+	query := QueryT{MessageID: params.Get("messageId"), UserID: params.Get("userId")}
+	if (query.MessageID == "") == (query.UserID == "") {
+		return QueryT{}, fmt.Errorf("either messageId or userId is required")
+	}
+	var err error
+	if from := params.Get("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return QueryT{}, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return QueryT{}, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if query.To.IsZero() {
+		query.To = now
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-defaultTimeRange)
+	}
+	if query.To.Before(query.From) {
+		return QueryT{}, fmt.Errorf("to must not be before from")
+	}
+	if query.To.Sub(query.From) > maxTimeRange {
+		return QueryT{}, fmt.Errorf("time range must not exceed %s", maxTimeRange)
+	}
+	return query, nil
+}
@@ -0,0 +1,384 @@
+// Package journey looks up the journey of messages through the gateway, processor, router and batch router jobsdbs,
+// along with the warehouse uploads of the messages sent to warehouse destinations.
+//
+// Lookups are bounded: every jobsdb is queried for at most maxJobs jobs, from its newest maxDatasets datasets,
+// and only for the jobs created within the time range of reception of the messages, as their payload is not indexed.
+package journey
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+	warehouseutils "github.com/rudderlabs/rudder-server/warehouse/utils"
+)
+
+// Outcomes of the processing of the gateway jobs of a message
+const (
+	OutcomePending      = "pending"
+	OutcomeRouted       = "routed"
+	OutcomeDedupDropped = "dedup_dropped"
+	OutcomeFailed       = "failed"
+	OutcomeFiltered     = "filtered"
+)
+
+var (
+	pkgLogger          logger.LoggerI
+	maxJobs            int
+	maxDatasets        int
+	maxMessages        int
+	maxTimeRange       time.Duration
+	defaultTimeRange   time.Duration
+	maxProcessingDelay time.Duration
+	queryTimeout       time.Duration
+	defaultHandle      *HandleT
+
+	warehouseDBLock sync.RWMutex
+	warehouseDB     *sql.DB
+)
+
+func Init() {
+	loadConfig()
+	pkgLogger = logger.NewLogger().Child("journey")
+}
+
+func loadConfig() {
+	config.RegisterIntConfigVariable(100, &maxJobs, true, 1, "Journey.maxJobs")
+	config.RegisterIntConfigVariable(10, &maxDatasets, true, 1, "Journey.maxDatasets")
+	config.RegisterIntConfigVariable(20, &maxMessages, true, 1, "Journey.maxMessages")
+	config.RegisterDurationConfigVariable(24, &maxTimeRange, true, time.Hour, "Journey.maxTimeRange")
+	config.RegisterDurationConfigVariable(1, &defaultTimeRange, true, time.Hour, "Journey.defaultTimeRange")
+	config.RegisterDurationConfigVariable(1, &maxProcessingDelay, true, time.Hour, "Journey.maxProcessingDelay")
+	config.RegisterDurationConfigVariable(60, &queryTimeout, true, time.Second, "Journey.queryTimeout")
+}
+
+// HandleT looks up journeys in the readonly jobsdbs of the pipeline, and in the warehouse database when set
+type HandleT struct {
+	gatewayDB, procErrorDB, routerDB, batchRouterDB jobsdb.ReadonlyJobsDB
+	warehouseDB                                     *sql.DB
+}
+
+// New returns a handle looking up journeys in the given jobsdbs. Warehouse uploads are not looked up if warehouseDB is nil.
+func New(gatewayDB, procErrorDB, routerDB, batchRouterDB jobsdb.ReadonlyJobsDB, warehouseDB *sql.DB) *HandleT {
+	return &HandleT{
+		gatewayDB:     gatewayDB,
+		procErrorDB:   procErrorDB,
+		routerDB:      routerDB,
+		batchRouterDB: batchRouterDB,
+		warehouseDB:   warehouseDB,
+	}
+}
+
+// Setup sets up the handle serving the lookups of Handler
+func Setup(gatewayDB, procErrorDB, routerDB, batchRouterDB jobsdb.ReadonlyJobsDB) {
+	defaultHandle = New(gatewayDB, procErrorDB, routerDB, batchRouterDB, nil)
+}
+
+// SetWarehouseDB sets the warehouse database of the lookups of Handler once the warehouse service has connected to it.
+// Uploads aren't looked up until then, e.g. on nodes not running the warehouse service.
+func SetWarehouseDB(db *sql.DB) {
+	warehouseDBLock.Lock()
+	defer warehouseDBLock.Unlock()
+	warehouseDB = db
+}
+
+func (handle *HandleT) warehouse() *sql.DB {
+	if handle.warehouseDB != nil {
+		return handle.warehouseDB
+	}
+	warehouseDBLock.RLock()
+	defer warehouseDBLock.RUnlock()
+	return warehouseDB
+}
+
+// QueryT selects the messages to look up, either by their message id, or by the user or anonymous id of their user,
+// within a time range of reception
+type QueryT struct {
+	MessageID string
+	UserID    string
+	From, To  time.Time
+}
+
+// MessageJourneyT is the journey of a message through the pipeline
+type MessageJourneyT struct {
+	MessageID    string                 `json:"messageId"`
+	Gateway      []*GatewayJobT         `json:"gateway"`
+	ProcErrors   []*ProcErrorT          `json:"procErrors"`
+	Destinations []*DestinationJourneyT `json:"destinations"`
+}
+
+// GatewayJobT is a gateway job containing the message, duplicates of the message having a gateway job each
+type GatewayJobT struct {
+	JobID            int64               `json:"jobId"`
+	BatchID          int64               `json:"batchId"`
+	SourceID         string              `json:"sourceId"`
+	UserID           string              `json:"userId"`
+	CreatedAt        time.Time           `json:"createdAt"`
+	State            string              `json:"state"`
+	ProcessorOutcome string              `json:"processorOutcome"`
+	Statuses         []jobsdb.JobStatusT `json:"statuses"`
+}
+
+// ProcErrorT is a failure of the processor for the message, stored in proc_error
+type ProcErrorT struct {
+	JobID         int64           `json:"jobId"`
+	DestinationID string          `json:"destinationId"`
+	Stage         string          `json:"stage"`
+	StatusCode    int             `json:"statusCode"`
+	Error         json.RawMessage `json:"error"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// DestinationJourneyT are the jobs of the message for a destination
+type DestinationJourneyT struct {
+	DestinationID   string             `json:"destinationId"`
+	DestinationType string             `json:"destinationType"`
+	Jobs            []*DestinationJobT `json:"jobs"`
+}
+
+// DestinationJobT is a router or batch router job of the message, along with all of its delivery attempts
+type DestinationJobT struct {
+	JobsDB          string              `json:"jobsdb"`
+	JobID           int64               `json:"jobId"`
+	GatewayJobID    int64               `json:"gatewayJobId"`
+	CreatedAt       time.Time           `json:"createdAt"`
+	State           string              `json:"state"`
+	Statuses        []jobsdb.JobStatusT `json:"statuses"`
+	WarehouseUpload *WarehouseUploadT   `json:"warehouseUpload,omitempty"`
+
+	sourceID   string
+	receivedAt string
+}
+
+// Lookup returns the journeys of the messages selected by query
+func (handle *HandleT) Lookup(ctx context.Context, query QueryT) ([]*MessageJourneyT, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	gatewayQuery := jobsdb.JobsQueryT{From: query.From, To: query.To, Limit: maxJobs, MaxDatasets: maxDatasets}
+	if query.MessageID != "" {
+		gatewayQuery.EventPayloadContains = []string{batchContains("messageId", query.MessageID)}
+	} else {
+		gatewayQuery.EventPayloadContains = []string{batchContains("userId", query.UserID), batchContains("anonymousId", query.UserID)}
+	}
+	gatewayJobs, err := handle.gatewayDB.GetJobsWithStatuses(ctx, gatewayQuery)
+	if err != nil {
+		return nil, fmt.Errorf("looking up gateway jobs: %w", err)
+	}
+	messageIDs := []string{query.MessageID}
+	if query.MessageID == "" {
+		if messageIDs = userMessageIDs(gatewayJobs, query.UserID); len(messageIDs) == 0 {
+			return []*MessageJourneyT{}, nil
+		}
+	}
+
+	// jobs of the messages are created after their reception, up to maxProcessingDelay after the end of the time range
+	procErrorQuery := jobsdb.JobsQueryT{From: query.From, To: query.To.Add(maxProcessingDelay), Limit: maxJobs, MaxDatasets: maxDatasets}
+	destinationQuery := procErrorQuery
+	for _, messageID := range messageIDs {
+		procErrorQuery.EventPayloadContains = append(procErrorQuery.EventPayloadContains, mustMarshal([]map[string]string{{"messageId": messageID}}))
+		destinationQuery.ParametersContain = append(destinationQuery.ParametersContain, mustMarshal(map[string]string{"message_id": messageID}))
+	}
+	procErrorJobs, err := handle.procErrorDB.GetJobsWithStatuses(ctx, procErrorQuery)
+	if err != nil {
+		return nil, fmt.Errorf("looking up proc_error jobs: %w", err)
+	}
+	routerJobs, err := handle.routerDB.GetJobsWithStatuses(ctx, destinationQuery)
+	if err != nil {
+		return nil, fmt.Errorf("looking up router jobs: %w", err)
+	}
+	batchRouterJobs, err := handle.batchRouterDB.GetJobsWithStatuses(ctx, destinationQuery)
+	if err != nil {
+		return nil, fmt.Errorf("looking up batch router jobs: %w", err)
+	}
+
+	journeys := buildJourneys(messageIDs, gatewayJobs, procErrorJobs, routerJobs, batchRouterJobs)
+	if db := handle.warehouse(); db != nil {
+		lookupWarehouseUploads(ctx, db, journeys)
+	}
+	return journeys, nil
+}
+
+func batchContains(key, value string) string {
+	return mustMarshal(map[string]interface{}{"batch": []map[string]string{{key: value}}})
+}
+
+func mustMarshal(v interface{}) string {
+	rawJSON, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(rawJSON)
+}
+
+// userMessageIDs returns the ids of the messages of the user in the gateway jobs, oldest first, up to maxMessages
+func userMessageIDs(gatewayJobs []*jobsdb.JobWithStatusesT, userID string) []string {
+	sortJobs(gatewayJobs)
+	var messageIDs []string
+	seen := make(map[string]bool)
+	for _, job := range gatewayJobs {
+		gjson.GetBytes(job.EventPayload, "batch").ForEach(func(_, message gjson.Result) bool {
+			if message.Get("userId").String() != userID && message.Get("anonymousId").String() != userID {
+				return true
+			}
+			messageID := message.Get("messageId").String()
+			if messageID == "" || seen[messageID] {
+				return true
+			}
+			seen[messageID] = true
+			messageIDs = append(messageIDs, messageID)
+			return len(messageIDs) < maxMessages
+		})
+		if len(messageIDs) >= maxMessages {
+			break
+		}
+	}
+	return messageIDs
+}
+
+func sortJobs(jobs []*jobsdb.JobWithStatusesT) {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+}
+
+func lastState(job *jobsdb.JobWithStatusesT) string {
+	if len(job.Statuses) == 0 {
+		return jobsdb.NotProcessed.State
+	}
+	return job.LastJobStatus.JobState
+}
+
+func buildJourneys(messageIDs []string, gatewayJobs, procErrorJobs, routerJobs, batchRouterJobs []*jobsdb.JobWithStatusesT) []*MessageJourneyT {
+	for _, jobs := range [][]*jobsdb.JobWithStatusesT{gatewayJobs, procErrorJobs, routerJobs, batchRouterJobs} {
+		sortJobs(jobs)
+	}
+	journeys := make([]*MessageJourneyT, 0, len(messageIDs))
+	for _, messageID := range messageIDs {
+		journey := &MessageJourneyT{
+			MessageID:    messageID,
+			Gateway:      []*GatewayJobT{},
+			ProcErrors:   []*ProcErrorT{},
+			Destinations: []*DestinationJourneyT{},
+		}
+		for _, job := range gatewayJobs {
+			if !payloadContains(job.EventPayload, "batch", messageID) {
+				continue
+			}
+			params := gjson.GetManyBytes(job.Parameters, "batch_id", "source_id")
+			journey.Gateway = append(journey.Gateway, &GatewayJobT{
+				JobID:     job.JobID,
+				BatchID:   params[0].Int(),
+				SourceID:  params[1].String(),
+				UserID:    job.UserID,
+				CreatedAt: job.CreatedAt,
+				State:     lastState(job),
+				Statuses:  job.Statuses,
+			})
+		}
+		for _, job := range procErrorJobs {
+			if !payloadContains(job.EventPayload, "", messageID) {
+				continue
+			}
+			params := gjson.GetManyBytes(job.Parameters, "destination_id", "stage", "status_code", "error")
+			journey.ProcErrors = append(journey.ProcErrors, &ProcErrorT{
+				JobID:         job.JobID,
+				DestinationID: params[0].String(),
+				Stage:         params[1].String(),
+				StatusCode:    int(params[2].Int()),
+				Error:         json.RawMessage(params[3].Raw),
+				CreatedAt:     job.CreatedAt,
+			})
+		}
+		destinations := make(map[string]*DestinationJourneyT)
+		addDestinationJobs(journey, destinations, "rt", routerJobs)
+		addDestinationJobs(journey, destinations, "batch_rt", batchRouterJobs)
+		sort.Slice(journey.Destinations, func(i, j int) bool {
+			return journey.Destinations[i].DestinationID < journey.Destinations[j].DestinationID
+		})
+		setProcessorOutcomes(journey)
+		journeys = append(journeys, journey)
+	}
+	return journeys
+}
+
+// payloadContains checks whether the array at path of payload contains a message with messageID
+func payloadContains(payload json.RawMessage, path, messageID string) bool {
+	messages := gjson.ParseBytes(payload)
+	if path != "" {
+		messages = messages.Get(path)
+	}
+	found := false
+	messages.ForEach(func(_, message gjson.Result) bool {
+		found = message.Get("messageId").String() == messageID
+		return !found
+	})
+	return found
+}
+
+func addDestinationJobs(journey *MessageJourneyT, destinations map[string]*DestinationJourneyT, jobsDB string, jobs []*jobsdb.JobWithStatusesT) {
+	for _, job := range jobs {
+		params := gjson.GetManyBytes(job.Parameters, "message_id", "destination_id", "gateway_job_id", "source_id")
+		if params[0].String() != journey.MessageID {
+			continue
+		}
+		destinationID := params[1].String()
+		destination, ok := destinations[destinationID]
+		if !ok {
+			destination = &DestinationJourneyT{DestinationID: destinationID, DestinationType: job.CustomVal}
+			destinations[destinationID] = destination
+			journey.Destinations = append(journey.Destinations, destination)
+		}
+		destination.Jobs = append(destination.Jobs, &DestinationJobT{
+			JobsDB:       jobsDB,
+			JobID:        job.JobID,
+			GatewayJobID: params[2].Int(),
+			CreatedAt:    job.CreatedAt,
+			State:        lastState(job),
+			Statuses:     job.Statuses,
+			sourceID:     params[3].String(),
+			receivedAt:   gjson.GetBytes(job.EventPayload, "metadata.receivedAt").String(),
+		})
+	}
+}
+
+// setProcessorOutcomes sets the outcome of the processing of every gateway job of the journey:
+// pending until the job is processed, routed when the job created destination jobs,
+// dedup_dropped when the message was already processed in an earlier job, failed when it has proc_error jobs,
+// filtered otherwise.
+func setProcessorOutcomes(journey *MessageJourneyT) {
+	routed := make(map[int64]bool)
+	for _, destination := range journey.Destinations {
+		for _, job := range destination.Jobs {
+			routed[job.GatewayJobID] = true
+		}
+	}
+	processedEarlier := false
+	for _, job := range journey.Gateway {
+		switch {
+		case job.State != jobsdb.Succeeded.State:
+			job.ProcessorOutcome = OutcomePending
+		case routed[job.JobID]:
+			job.ProcessorOutcome = OutcomeRouted
+		case processedEarlier:
+			job.ProcessorOutcome = OutcomeDedupDropped
+		case len(journey.ProcErrors) > 0:
+			job.ProcessorOutcome = OutcomeFailed
+		default:
+			job.ProcessorOutcome = OutcomeFiltered
+		}
+		processedEarlier = processedEarlier || job.State == jobsdb.Succeeded.State
+	}
+}
+
+func isWarehouseDestination(destinationType string) bool {
+	return misc.ContainsString(warehouseutils.WarehouseDestinations, destinationType)
+}
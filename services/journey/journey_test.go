@@ -0,0 +1,208 @@
+package journey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+func TestMain(m *testing.M) {
+	config.Load()
+	logger.Init()
+	Init()
+	os.Exit(m.Run())
+}
+
+// readonlyDBT returns its jobs, or its error, to the jobs queries, recording them
+type readonlyDBT struct {
+	jobsdb.ReadonlyJobsDB
+	jobs    []*jobsdb.JobWithStatusesT
+	err     error
+	queries []jobsdb.JobsQueryT
+}
+
+func (db *readonlyDBT) GetJobsWithStatuses(_ context.Context, query jobsdb.JobsQueryT) ([]*jobsdb.JobWithStatusesT, error) {
+	if query.From.IsZero() || query.To.IsZero() {
+		return nil, errors.New("jobs query needs a time range")
+	}
+	db.queries = append(db.queries, query)
+	return db.jobs, db.err
+}
+
+func job(jobID int64, parameters, payload string, states ...string) *jobsdb.JobWithStatusesT {
+	job := &jobsdb.JobWithStatusesT{JobT: jobsdb.JobT{JobID: jobID, Parameters: []byte(parameters), EventPayload: []byte(payload)}}
+	for i, state := range states {
+		job.LastJobStatus = jobsdb.JobStatusT{JobID: jobID, JobState: state, AttemptNum: i + 1}
+		job.Statuses = append(job.Statuses, job.LastJobStatus)
+	}
+	return job
+}
+
+func outcomes(journey *MessageJourneyT) []string {
+	var res []string
+	for _, job := range journey.Gateway {
+		res = append(res, job.ProcessorOutcome)
+	}
+	return res
+}
+
+func TestLookupMessage(t *testing.T) {
+	gatewayDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{
+		job(3, `{"source_id":"s1","batch_id":3}`, `{"batch":[{"messageId":"m1"}]}`),
+		job(2, `{"source_id":"s1","batch_id":2}`, `{"batch":[{"messageId":"m1"}]}`, "executing", "succeeded"),
+		job(1, `{"source_id":"s1","batch_id":1}`, `{"batch":[{"messageId":"m0"},{"messageId":"m1"}]}`, "executing", "succeeded"),
+	}}
+	procErrorDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{
+		job(7, `{"destination_id":"d3","stage":"dest_transformer","status_code":400,"error":"invalid event"}`, `[{"messageId":"m1"}]`),
+	}}
+	routerDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{
+		job(11, `{"message_id":"m1","destination_id":"d2","gateway_job_id":1}`, `{}`, "executing", "failed", "executing", "succeeded"),
+	}}
+	batchRouterDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{
+		job(21, `{"message_id":"m1","destination_id":"d1","gateway_job_id":1}`, `{}`, "executing", "succeeded"),
+		job(22, `{"message_id":"m2","destination_id":"d1","gateway_job_id":1}`, `{}`),
+	}}
+	handle := New(gatewayDB, procErrorDB, routerDB, batchRouterDB, nil)
+
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	journeys, err := handle.Lookup(context.Background(), QueryT{MessageID: "m1", From: from, To: from.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"batch":[{"messageId":"m1"}]}`}, gatewayDB.queries[0].EventPayloadContains)
+	require.Equal(t, []string{`[{"messageId":"m1"}]`}, procErrorDB.queries[0].EventPayloadContains)
+	require.Equal(t, []string{`{"message_id":"m1"}`}, routerDB.queries[0].ParametersContain)
+	require.Equal(t, maxJobs, routerDB.queries[0].Limit)
+	require.Equal(t, maxDatasets, batchRouterDB.queries[0].MaxDatasets)
+	require.Equal(t, from.Add(time.Hour), gatewayDB.queries[0].To)
+	require.Equal(t, from.Add(time.Hour+maxProcessingDelay), routerDB.queries[0].To, "jobs are looked up until maxProcessingDelay after the time range")
+
+	require.Len(t, journeys, 1)
+	journey := journeys[0]
+	require.Equal(t, "m1", journey.MessageID)
+	require.Len(t, journey.Gateway, 3)
+	require.Equal(t, int64(1), journey.Gateway[0].BatchID)
+	require.Equal(t, "s1", journey.Gateway[0].SourceID)
+	require.Equal(t, []string{OutcomeRouted, OutcomeDedupDropped, OutcomePending}, outcomes(journey))
+
+	require.Len(t, journey.ProcErrors, 1)
+	require.Equal(t, "d3", journey.ProcErrors[0].DestinationID)
+	require.Equal(t, 400, journey.ProcErrors[0].StatusCode)
+	require.JSONEq(t, `"invalid event"`, string(journey.ProcErrors[0].Error))
+
+	require.Len(t, journey.Destinations, 2)
+	require.Equal(t, "d1", journey.Destinations[0].DestinationID)
+	require.Len(t, journey.Destinations[0].Jobs, 1, "jobs of other messages are left out")
+	require.Equal(t, "batch_rt", journey.Destinations[0].Jobs[0].JobsDB)
+	require.Equal(t, "d2", journey.Destinations[1].DestinationID)
+	routerJob := journey.Destinations[1].Jobs[0]
+	require.Equal(t, "succeeded", routerJob.State)
+	require.Len(t, routerJob.Statuses, 4)
+	require.Equal(t, int64(1), routerJob.GatewayJobID)
+}
+
+func TestProcessorOutcomes(t *testing.T) {
+	gatewayJobs := []*jobsdb.JobWithStatusesT{job(1, `{}`, `{"batch":[{"messageId":"m1"}]}`, "succeeded")}
+	procErrorJobs := []*jobsdb.JobWithStatusesT{job(2, `{"stage":"user_transformer"}`, `[{"messageId":"m1"}]`)}
+
+	journeys := buildJourneys([]string{"m1"}, gatewayJobs, procErrorJobs, nil, nil)
+	require.Equal(t, []string{OutcomeFailed}, outcomes(journeys[0]))
+
+	journeys = buildJourneys([]string{"m1", "m2"}, gatewayJobs, nil, nil, nil)
+	require.Equal(t, []string{OutcomeFiltered}, outcomes(journeys[0]))
+	require.Empty(t, journeys[1].Gateway)
+}
+
+func TestLookupUser(t *testing.T) {
+	maxMessages = 2
+	defer func() { maxMessages = 20 }()
+	gatewayDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{
+		job(2, `{}`, `{"batch":[{"messageId":"m3","userId":"u1"},{"messageId":"m4","userId":"u1"}]}`),
+		job(1, `{}`, `{"batch":[{"messageId":"m1","anonymousId":"u1"},{"messageId":"m2","userId":"u2"}]}`),
+	}}
+	otherDB := &readonlyDBT{}
+	handle := New(gatewayDB, otherDB, otherDB, otherDB, nil)
+
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	journeys, err := handle.Lookup(context.Background(), QueryT{UserID: "u1", From: from, To: from.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"batch":[{"userId":"u1"}]}`, `{"batch":[{"anonymousId":"u1"}]}`}, gatewayDB.queries[0].EventPayloadContains)
+	require.Equal(t, from.Add(time.Hour), gatewayDB.queries[0].To)
+	require.Len(t, journeys, 2, "messages are limited to maxMessages")
+	require.Equal(t, "m1", journeys[0].MessageID)
+	require.Equal(t, "m3", journeys[1].MessageID)
+	require.Equal(t, from, otherDB.queries[0].From)
+	require.Equal(t, from.Add(time.Hour+maxProcessingDelay), otherDB.queries[0].To)
+
+	gatewayDB.jobs = nil
+	journeys, err = handle.Lookup(context.Background(), QueryT{UserID: "u1", From: from, To: from.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, journeys)
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+	parse := func(rawQuery string) (QueryT, error) {
+		return parseQuery(httptest.NewRequest(http.MethodGet, "/v1/journey?"+rawQuery, nil), now)
+	}
+
+	query, err := parse("messageId=m1")
+	require.NoError(t, err)
+	require.Equal(t, QueryT{MessageID: "m1", From: now.Add(-defaultTimeRange), To: now}, query)
+
+	query, err = parse("userId=u1&from=2022-01-01T12:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, "u1", query.UserID)
+	require.Equal(t, now, query.To)
+
+	for _, rawQuery := range []string{
+		"",
+		"messageId=m1&userId=u1",
+		"userId=u1&from=2021-12-01T00:00:00Z",
+		"messageId=m1&from=2022-01-03T00:00:00Z",
+		"messageId=m1&from=yesterday",
+		"messageId=m1&from=2022-01-01T12:00:00Z&to=2022-01-01T00:00:00Z",
+	} {
+		_, err := parse(rawQuery)
+		require.Error(t, err, rawQuery)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	defaultHandle = nil
+	resp := httptest.NewRecorder()
+	Handler(resp, httptest.NewRequest(http.MethodGet, "/v1/journey?messageId=m1", nil))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	gatewayDB := &readonlyDBT{jobs: []*jobsdb.JobWithStatusesT{job(1, `{}`, `{"batch":[{"messageId":"m1"}]}`)}}
+	Setup(gatewayDB, &readonlyDBT{}, &readonlyDBT{}, &readonlyDBT{})
+	defer func() { defaultHandle = nil }()
+
+	resp = httptest.NewRecorder()
+	Handler(resp, httptest.NewRequest(http.MethodGet, "/v1/journey", nil))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = httptest.NewRecorder()
+	Handler(resp, httptest.NewRequest(http.MethodGet, "/v1/journey?messageId=m1", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var journeys []*MessageJourneyT
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &journeys))
+	require.Len(t, journeys, 1)
+	require.Equal(t, OutcomePending, journeys[0].Gateway[0].ProcessorOutcome)
+	require.Empty(t, journeys[0].Destinations)
+
+	gatewayDB.err = errors.New(`pq: relation "gw_jobs_1" does not exist`)
+	resp = httptest.NewRecorder()
+	Handler(resp, httptest.NewRequest(http.MethodGet, "/v1/journey?messageId=m1", nil))
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.NotContains(t, resp.Body.String(), "gw_jobs_1")
+}
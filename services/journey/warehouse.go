@@ -0,0 +1,70 @@
+package journey
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+	warehouseutils "github.com/rudderlabs/rudder-server/warehouse/utils"
+)
+
+// WarehouseUploadT is the warehouse upload of the staging file a batch router job was written to
+type WarehouseUploadT struct {
+	StagingFileID int64  `json:"stagingFileId"`
+	UploadID      int64  `json:"uploadId,omitempty"`
+	Status        string `json:"status,omitempty"`
+}
+
+// lookupWarehouseUploads sets the warehouse uploads of the succeeded batch router jobs of warehouse destinations
+func lookupWarehouseUploads(ctx context.Context, db *sql.DB, journeys []*MessageJourneyT) {
+	for _, journey := range journeys {
+		for _, destination := range journey.Destinations {
+			if !isWarehouseDestination(destination.DestinationType) {
+				continue
+			}
+			for _, job := range destination.Jobs {
+				if job.JobsDB != "batch_rt" || job.State != jobsdb.Succeeded.State {
+					continue
+				}
+				upload, err := warehouseUpload(ctx, db, job.sourceID, destination.DestinationID, job.receivedAt)
+				if err != nil {
+					pkgLogger.Warnf("Failed to look up the warehouse upload of job %d of destination %s: %v", job.JobID, destination.DestinationID, err)
+					continue
+				}
+				job.WarehouseUpload = upload
+			}
+		}
+	}
+}
+
+// warehouseUpload returns the upload of the first staging file of the source and destination whose events were received
+// around receivedAt, nil if there is none. Staging files record the reception times of their events to the second.
+func warehouseUpload(ctx context.Context, db *sql.DB, sourceID, destinationID, receivedAt string) (*WarehouseUploadT, error) {
+	receivedTime, err := time.Parse(misc.RFC3339Milli, receivedAt)
+	if err != nil {
+		return nil, fmt.Errorf("parsing receivedAt %q: %w", receivedAt, err)
+	}
+	receivedTime = receivedTime.UTC()
+	sqlStatement := fmt.Sprintf(`SELECT staging.id, upload.id, upload.status FROM %[1]s staging
+		LEFT JOIN %[2]s upload ON upload.source_id = staging.source_id AND upload.destination_id = staging.destination_id
+			AND staging.id BETWEEN upload.start_staging_file_id AND upload.end_staging_file_id
+		WHERE staging.source_id = $1 AND staging.destination_id = $2 AND staging.first_event_at <= $3 AND staging.last_event_at >= $4
+		ORDER BY staging.id ASC, upload.id DESC LIMIT 1`,
+		warehouseutils.WarehouseStagingFilesTable, warehouseutils.WarehouseUploadsTable)
+	var upload WarehouseUploadT
+	var uploadID sql.NullInt64
+	var status sql.NullString
+	err = db.QueryRowContext(ctx, sqlStatement, sourceID, destinationID, receivedTime, receivedTime.Truncate(time.Second)).
+		Scan(&upload.StagingFileID, &uploadID, &status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	upload.UploadID, upload.Status = uploadID.Int64, status.String
+	return &upload, nil
+}
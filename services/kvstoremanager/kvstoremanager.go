@@ -2,6 +2,7 @@ package kvstoremanager
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -14,6 +15,8 @@ type KVStoreManager interface {
 	DeleteKey(key string) (err error)
 	HMGet(key string, fields ...string) (result []interface{}, err error)
 	HGetAll(key string) (result map[string]string, err error)
+	IncrBy(key string, value int64, expiration time.Duration) (result int64, err error)
+	MGet(keys ...string) (result []interface{}, err error)
 }
 
 type SettingsT struct {
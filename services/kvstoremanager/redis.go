@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/rudderlabs/rudder-server/utils/types"
@@ -134,3 +135,33 @@ func (m *redisManagerT) HGetAll(key string) (result map[string]string, err error
 	}
 	return result, err
 }
+
+// IncrBy increments the integer value of key by value and sets its expiration, if expiration is not zero.
+// Both are run in a transaction, so that a key is never left without expiration.
+func (m *redisManagerT) IncrBy(key string, value int64, expiration time.Duration) (result int64, err error) {
+	var cmdable redis.Cmdable = m.client
+	if m.clusterMode {
+		cmdable = m.clusterClient
+	}
+	var incrBy *redis.IntCmd
+	_, err = cmdable.TxPipelined(func(pipe redis.Pipeliner) error {
+		incrBy = pipe.IncrBy(key, value)
+		if expiration != 0 {
+			pipe.Expire(key, expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incrBy.Val(), nil
+}
+
+func (m *redisManagerT) MGet(keys ...string) (result []interface{}, err error) {
+	if m.clusterMode {
+		result, err = m.clusterClient.MGet(keys...).Result()
+	} else {
+		result, err = m.client.MGet(keys...).Result()
+	}
+	return result, err
+}
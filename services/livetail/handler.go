@@ -0,0 +1,121 @@
+package livetail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Handler streams the events matching the filter of the request as server-sent events, until the client disconnects,
+// maxDuration elapses or ctx is done.
+//
+// Query parameters are sourceId and/or destinationId, at least one of them being required,
+// and the optional point, eventType and eventName, as comma separated lists, and userId.
+func Handler(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defaultHub.serve(ctx, w, r)
+	}
+}
+
+func parseFilter(r *http.Request) (FilterT, error) {
+	params := r.URL.Query()
+	filter := FilterT{
+		Points:        splitParam(params.Get("point")),
+		SourceID:      params.Get("sourceId"),
+		DestinationID: params.Get("destinationId"),
+		EventTypes:    splitParam(params.Get("eventType")),
+		EventNames:    splitParam(params.Get("eventName")),
+		UserID:        params.Get("userId"),
+	}
+	if filter.SourceID == "" && filter.DestinationID == "" {
+		return FilterT{}, fmt.Errorf("sourceId or destinationId is required")
+	}
+	for _, point := range filter.Points {
+		if !containsFold(Points, point) {
+			return FilterT{}, fmt.Errorf("invalid point %q, must be one of %s", point, strings.Join(Points, ", "))
+		}
+	}
+	return filter, nil
+}
+
+func splitParam(param string) []string {
+	var values []string
+	for _, value := range strings.Split(param, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (hub *hubT) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if !enabled {
+		http.Error(w, "live tail is disabled", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	watcher, ok := hub.watch(filter)
+	if !ok {
+		http.Error(w, fmt.Sprintf("too many watchers, at most %d are allowed", maxWatchers), http.StatusTooManyRequests)
+		return
+	}
+	defer hub.unwatch(watcher)
+	pkgLogger.Infof("Tailing events with filter %+v", filter)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	deadline := time.After(maxDuration)
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.Context().Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+			// comments keep the connection alive, and detect disconnected clients
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-watcher.events:
+			if dropped := atomic.SwapInt64(&watcher.dropped, 0); dropped > 0 {
+				if err = writeEvent(w, "dropped", map[string]int64{"dropped": dropped}); err != nil {
+					return
+				}
+			}
+			err = writeEvent(w, event.Point, event)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, data interface{}) error {
+	rawJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, rawJSON)
+	return err
+}
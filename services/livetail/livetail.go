@@ -0,0 +1,211 @@
+// Package livetail fans out the events observed at points of the pipeline to the watchers tailing them.
+//
+// Publishing never blocks: every watcher has a bounded buffer, and events are dropped for watchers lagging behind.
+// Events are only built when a watcher is tailing their point, source and destination, see Watching.
+package livetail
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+// Points of the pipeline at which events can be tailed
+const (
+	PointGateway                   = "gateway"
+	PointUserTransformation        = "user_transformation"
+	PointDestinationTransformation = "destination_transformation"
+	PointRouterResponse            = "router_response"
+)
+
+// Points lists the points of the pipeline at which events can be tailed
+var Points = []string{PointGateway, PointUserTransformation, PointDestinationTransformation, PointRouterResponse}
+
+var (
+	pkgLogger   logger.LoggerI
+	enabled     bool
+	maxWatchers int
+	bufferSize  int
+	maxDuration time.Duration
+	heartbeat   time.Duration
+	defaultHub  = newHub()
+)
+
+func Init() {
+	loadConfig()
+	pkgLogger = logger.NewLogger().Child("livetail")
+}
+
+func loadConfig() {
+	config.RegisterBoolConfigVariable(false, &enabled, true, "LiveTail.enabled")
+	config.RegisterIntConfigVariable(10, &maxWatchers, true, 1, "LiveTail.maxWatchers")
+	config.RegisterIntConfigVariable(100, &bufferSize, false, 1, "LiveTail.bufferSize")
+	config.RegisterDurationConfigVariable(30, &maxDuration, true, time.Minute, "LiveTail.maxDuration")
+	config.RegisterDurationConfigVariable(15, &heartbeat, false, time.Second, "LiveTail.heartbeat")
+}
+
+// EventT is an event observed at a point of the pipeline
+type EventT struct {
+	Point         string          `json:"point"`
+	SourceID      string          `json:"sourceId"`
+	DestinationID string          `json:"destinationId,omitempty"`
+	MessageID     string          `json:"messageId,omitempty"`
+	EventType     string          `json:"eventType,omitempty"`
+	EventName     string          `json:"eventName,omitempty"`
+	UserID        string          `json:"userId,omitempty"`
+	AnonymousID   string          `json:"anonymousId,omitempty"`
+	RudderID      string          `json:"rudderId,omitempty"`
+	StatusCode    int             `json:"statusCode,omitempty"`
+	Response      string          `json:"response,omitempty"`
+	ObservedAt    time.Time       `json:"observedAt"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// NewEvent returns the event of a rudder message observed at point, reading its ids, type and name from the message
+func NewEvent(point, sourceID, destinationID string, message []byte) *EventT {
+	fields := gjson.GetManyBytes(message, "messageId", "type", "event", "userId", "anonymousId", "rudderId")
+	return &EventT{
+		Point:         point,
+		SourceID:      sourceID,
+		DestinationID: destinationID,
+		MessageID:     fields[0].String(),
+		EventType:     fields[1].String(),
+		EventName:     fields[2].String(),
+		UserID:        fields[3].String(),
+		AnonymousID:   fields[4].String(),
+		RudderID:      fields[5].String(),
+		ObservedAt:    time.Now(),
+		Payload:       message,
+	}
+}
+
+// FilterT selects the events tailed by a watcher. Empty fields match everything.
+// UserID matches the user id, the anonymous id or the rudder id of events.
+type FilterT struct {
+	Points        []string
+	SourceID      string
+	DestinationID string
+	EventTypes    []string
+	EventNames    []string
+	UserID        string
+}
+
+func (filter *FilterT) watches(point, sourceID, destinationID string) bool {
+	if len(filter.Points) > 0 && !containsFold(filter.Points, point) {
+		return false
+	}
+	if filter.SourceID != "" && filter.SourceID != sourceID {
+		return false
+	}
+	return filter.DestinationID == "" || filter.DestinationID == destinationID
+}
+
+func (filter *FilterT) matches(event *EventT) bool {
+	if !filter.watches(event.Point, event.SourceID, event.DestinationID) {
+		return false
+	}
+	if len(filter.EventTypes) > 0 && !containsFold(filter.EventTypes, event.EventType) {
+		return false
+	}
+	if len(filter.EventNames) > 0 && !containsFold(filter.EventNames, event.EventName) {
+		return false
+	}
+	if filter.UserID != "" && filter.UserID != event.UserID && filter.UserID != event.AnonymousID && filter.UserID != event.RudderID {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type watcherT struct {
+	filter  FilterT
+	events  chan *EventT
+	dropped int64
+}
+
+type hubT struct {
+	count    int64
+	lock     sync.RWMutex
+	watchers map[*watcherT]struct{}
+}
+
+func newHub() *hubT {
+	return &hubT{watchers: make(map[*watcherT]struct{})}
+}
+
+// Watching checks whether any watcher tails the events of sourceID and destinationID at point
+func Watching(point, sourceID, destinationID string) bool {
+	return defaultHub.watching(point, sourceID, destinationID)
+}
+
+// Publish sends the event to the watchers it matches, dropping it for the ones lagging behind
+func Publish(event *EventT) {
+	defaultHub.publish(event)
+}
+
+func (hub *hubT) watching(point, sourceID, destinationID string) bool {
+	if atomic.LoadInt64(&hub.count) == 0 {
+		return false
+	}
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	for watcher := range hub.watchers {
+		if watcher.filter.watches(point, sourceID, destinationID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hub *hubT) publish(event *EventT) {
+	if atomic.LoadInt64(&hub.count) == 0 {
+		return
+	}
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	for watcher := range hub.watchers {
+		if !watcher.filter.matches(event) {
+			continue
+		}
+		select {
+		case watcher.events <- event:
+		default:
+			atomic.AddInt64(&watcher.dropped, 1)
+		}
+	}
+}
+
+// watch adds a watcher of the events matching filter, false if there are already maxWatchers
+func (hub *hubT) watch(filter FilterT) (*watcherT, bool) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	if len(hub.watchers) >= maxWatchers {
+		return nil, false
+	}
+	watcher := &watcherT{filter: filter, events: make(chan *EventT, bufferSize)}
+	hub.watchers[watcher] = struct{}{}
+	atomic.StoreInt64(&hub.count, int64(len(hub.watchers)))
+	return watcher, true
+}
+
+func (hub *hubT) unwatch(watcher *watcherT) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	delete(hub.watchers, watcher)
+	atomic.StoreInt64(&hub.count, int64(len(hub.watchers)))
+}
@@ -0,0 +1,128 @@
+package livetail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	config.Load()
+	logger.Init()
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent(PointGateway, "s1", "", []byte(`{"messageId":"m1","type":"track","event":"Order Completed","userId":"u1","anonymousId":"a1","rudderId":"r1"}`))
+	require.Equal(t, "m1", event.MessageID)
+	require.Equal(t, "track", event.EventType)
+	require.Equal(t, "Order Completed", event.EventName)
+	require.Equal(t, "u1", event.UserID)
+	require.Equal(t, "a1", event.AnonymousID)
+	require.Equal(t, "r1", event.RudderID)
+}
+
+func TestFilter(t *testing.T) {
+	event := NewEvent(PointRouterResponse, "s1", "d1", []byte(`{"type":"track","event":"Order Completed","anonymousId":"a1"}`))
+
+	for _, filter := range []FilterT{
+		{SourceID: "s1"},
+		{DestinationID: "d1", Points: []string{PointGateway, PointRouterResponse}},
+		{SourceID: "s1", EventTypes: []string{"Track"}, EventNames: []string{"order completed"}, UserID: "a1"},
+	} {
+		require.True(t, filter.matches(event), "%+v", filter)
+	}
+	for _, filter := range []FilterT{
+		{SourceID: "s2"},
+		{DestinationID: "d1", Points: []string{PointGateway}},
+		{SourceID: "s1", EventTypes: []string{"identify"}},
+		{SourceID: "s1", EventNames: []string{"Order Refunded"}},
+		{SourceID: "s1", UserID: "u1"},
+	} {
+		require.False(t, filter.matches(event), "%+v", filter)
+	}
+}
+
+func TestHub(t *testing.T) {
+	maxWatchers, bufferSize = 2, 1
+	hub := newHub()
+	require.False(t, hub.watching(PointGateway, "s1", ""))
+
+	source, ok := hub.watch(FilterT{SourceID: "s1"})
+	require.True(t, ok)
+	destination, ok := hub.watch(FilterT{DestinationID: "d1"})
+	require.True(t, ok)
+	_, ok = hub.watch(FilterT{SourceID: "s2"})
+	require.False(t, ok, "watchers are limited to maxWatchers")
+
+	require.True(t, hub.watching(PointGateway, "s1", ""))
+	require.False(t, hub.watching(PointGateway, "s2", ""))
+	require.True(t, hub.watching(PointRouterResponse, "s2", "d1"))
+
+	hub.publish(NewEvent(PointGateway, "s1", "", []byte(`{"messageId":"m1"}`)))
+	hub.publish(NewEvent(PointGateway, "s1", "", []byte(`{"messageId":"m2"}`)))
+	require.Equal(t, "m1", (<-source.events).MessageID)
+	require.Equal(t, int64(1), source.dropped, "events are dropped for watchers lagging behind")
+	require.Empty(t, destination.events)
+
+	hub.unwatch(source)
+	hub.unwatch(destination)
+	require.False(t, hub.watching(PointGateway, "s1", ""))
+}
+
+func TestHandler(t *testing.T) {
+	maxWatchers, bufferSize = 10, 10
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(Handler(ctx))
+	defer server.Close()
+
+	enabled = false
+	resp, err := http.Get(server.URL + "?sourceId=s1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	enabled = true
+	defer func() { enabled = false }()
+	for _, query := range []string{"", "?userId=u1", "?sourceId=s1&point=processor"} {
+		resp, err := http.Get(server.URL + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+
+	resp, err = http.Get(server.URL + "?sourceId=s1&point=gateway&eventType=track")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool { return Watching(PointGateway, "s1", "") }, time.Second, 10*time.Millisecond)
+
+	Publish(NewEvent(PointGateway, "s1", "", []byte(`{"messageId":"m1","type":"identify"}`)))
+	Publish(NewEvent(PointGateway, "s1", "", []byte(`{"messageId":"m2","type":"track"}`)))
+
+	reader := bufio.NewReader(resp.Body)
+	name, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: gateway\n", name)
+	data, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	var event EventT
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(data), "data: ")), &event))
+	require.Equal(t, "m2", event.MessageID)
+
+	cancel()
+	require.Eventually(t, func() bool { return !Watching(PointGateway, "s1", "") }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package replay
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupFileT is a backup file of the jobs of a dataset, uploaded by jobsdb.backupTable as
+// <tablePrefix>_jobs_<index>.<minJobID>.<maxJobID>.<minCreatedAt>.<maxCreatedAt>.gz, times being in milliseconds
+type backupFileT struct {
+	key       string
+	minJobID  int64
+	maxJobID  int64
+	startTime time.Time
+	endTime   time.Time
+}
+
+// parseBackupFileKey parses the key of a backup file of jobs of a table prefix.
+// Job status files and failed only backups are not backups of jobs, and are not parsed.
+func parseBackupFileKey(key, tablePrefix string) (backupFileT, bool) {
+	name := path.Base(key)
+	if !strings.HasPrefix(name, tablePrefix+"_jobs_") || !strings.HasSuffix(name, ".gz") {
+		return backupFileT{}, false
+	}
+	parts := strings.Split(strings.TrimSuffix(name, ".gz"), ".")
+	if len(parts) != 5 {
+		return backupFileT{}, false
+	}
+	var numbers [4]int64
+	for i, part := range parts[1:] {
+		number, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return backupFileT{}, false
+		}
+		numbers[i] = number
+	}
+	return backupFileT{
+		key:       key,
+		minJobID:  numbers[0],
+		maxJobID:  numbers[1],
+		startTime: time.Unix(0, numbers[2]*int64(time.Millisecond)),
+		endTime:   time.Unix(0, numbers[3]*int64(time.Millisecond)),
+	}, true
+}
+
+// overlaps checks whether the file has jobs created in [start, end)
+func (file backupFileT) overlaps(start, end time.Time) bool {
+	return file.startTime.Before(end) && !file.endTime.Before(start)
+}
+
+// backupJobT is a row of a jobs table, as dumped by json_agg in backup files
+type backupJobT struct {
+	JobID        int64           `json:"job_id"`
+	WorkspaceID  string          `json:"workspace_id"`
+	UserID       string          `json:"user_id"`
+	Parameters   json.RawMessage `json:"parameters"`
+	CustomVal    string          `json:"custom_val"`
+	EventPayload json.RawMessage `json:"event_payload"`
+	EventCount   int             `json:"event_count"`
+	CreatedAt    string          `json:"created_at"`
+}
+
+// createdAt parses created_at, a timestamp without time zone in UTC
+func (job *backupJobT) createdAt() (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", time.RFC3339Nano} {
+		if createdAt, err := time.Parse(layout, job.CreatedAt); err == nil {
+			return createdAt, true
+		}
+	}
+	return time.Time{}, false
+}
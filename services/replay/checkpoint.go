@@ -0,0 +1,64 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpointT records the progress of a replay, so that a restarted replay does not store jobs twice
+type checkpointT struct {
+	ID        string          `json:"id"`
+	Completed map[string]bool `json:"completed"`
+	Current   string          `json:"current"`
+	Offset    int             `json:"offset"`
+}
+
+// loadCheckpoint reads the checkpoint of the replay with id, starting over if there is none
+func loadCheckpoint(path, id string) (*checkpointT, error) {
+	checkpoint := &checkpointT{ID: id, Completed: make(map[string]bool)}
+	if path == "" {
+		return checkpoint, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading replay checkpoint: %w", err)
+	}
+	var saved checkpointT
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parsing replay checkpoint %s: %w", path, err)
+	}
+	if saved.ID != id {
+		pkgLogger.Infof("Ignoring replay checkpoint %s of a different replay", path)
+		return checkpoint, nil
+	}
+	if saved.Completed == nil {
+		saved.Completed = make(map[string]bool)
+	}
+	return &saved, nil
+}
+
+func (checkpoint *checkpointT) complete(key string) {
+	checkpoint.Completed[key] = true
+	checkpoint.Current, checkpoint.Offset = "", 0
+}
+
+// save writes the checkpoint to a temporary file first, so that a crash never leaves a partial checkpoint
+func (checkpoint *checkpointT) save(path string) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("writing replay checkpoint: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
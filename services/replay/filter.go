@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// userIDDelimiter separates the anonymous id and the user id in the user id the gateway sets on jobs,
+// which the processor keeps on router and batch router jobs
+const userIDDelimiter = "<<>>"
+
+// filterT selects the jobs to replay. Empty lists match everything.
+type filterT struct {
+	sourceIDs     []string
+	eventTypes    []string
+	userIDs       []string
+	destinationID string
+}
+
+// replayJob returns the job to store for a backed up job, false if it is filtered out.
+//
+// Gateway jobs are batches of events: events not matching the event types and users are removed from the batch.
+// Router and batch router jobs are single events of the destination, matched by their event_type parameter and
+// the anonymous id and user id of their job's user id.
+func (h *HandleT) replayJob(backupJob *backupJobT) (*jobsdb.JobT, bool) {
+	createdAt, ok := backupJob.createdAt()
+	if !ok || createdAt.Before(h.startTime) || !createdAt.Before(h.endTime) {
+		return nil, false
+	}
+	if len(h.filter.sourceIDs) > 0 && !misc.ContainsString(h.filter.sourceIDs, gjson.GetBytes(backupJob.Parameters, "source_id").String()) {
+		return nil, false
+	}
+
+	payload, eventCount := []byte(backupJob.EventPayload), backupJob.EventCount
+	if h.target == TargetGateway {
+		var ok bool
+		if payload, eventCount, ok = h.filter.filterBatch(payload); !ok {
+			return nil, false
+		}
+	} else {
+		if gjson.GetBytes(backupJob.Parameters, "destination_id").String() != h.filter.destinationID {
+			return nil, false
+		}
+		if !h.filter.matchesEventType(gjson.GetBytes(backupJob.Parameters, "event_type").String()) ||
+			!h.filter.matchesUser(strings.Split(backupJob.UserID, userIDDelimiter)...) {
+			return nil, false
+		}
+	}
+
+	return &jobsdb.JobT{
+		UUID:         uuid.Must(uuid.NewV4()),
+		UserID:       backupJob.UserID,
+		Parameters:   backupJob.Parameters,
+		CustomVal:    backupJob.CustomVal,
+		EventPayload: payload,
+		EventCount:   eventCount,
+		WorkspaceId:  backupJob.WorkspaceID,
+	}, true
+}
+
+// filterBatch keeps the events of a gateway batch matching the event types and users
+func (filter *filterT) filterBatch(payload []byte) ([]byte, int, bool) {
+	batch := gjson.GetBytes(payload, "batch").Array()
+	if len(filter.eventTypes) == 0 && len(filter.userIDs) == 0 {
+		return payload, len(batch), len(batch) > 0
+	}
+	kept := make([]string, 0, len(batch))
+	for _, event := range batch {
+		if !filter.matchesEventType(event.Get("type").String()) {
+			continue
+		}
+		if !filter.matchesUser(event.Get("userId").String(), event.Get("anonymousId").String()) {
+			continue
+		}
+		kept = append(kept, event.Raw)
+	}
+	if len(kept) == 0 {
+		return nil, 0, false
+	}
+	if len(kept) == len(batch) {
+		return payload, len(batch), true
+	}
+	filtered, err := sjson.SetRawBytes(payload, "batch", []byte("["+strings.Join(kept, ",")+"]"))
+	if err != nil {
+		return nil, 0, false
+	}
+	return filtered, len(kept), true
+}
+
+func (filter *filterT) matchesEventType(eventType string) bool {
+	if len(filter.eventTypes) == 0 {
+		return true
+	}
+	for _, t := range filter.eventTypes {
+		if strings.EqualFold(strings.TrimSpace(t), strings.TrimSpace(eventType)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *filterT) matchesUser(ids ...string) bool {
+	if len(filter.userIDs) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		if id != "" && misc.ContainsString(filter.userIDs, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,383 @@
+// Package replay re-inserts jobs archived in object storage by the backups of jobsdb.
+//
+// Backup files of a jobsdb table prefix (gw, rt or batch_rt) are listed for a time range, downloaded and streamed,
+// and their jobs matching the configured filters are stored again in the gateway, router or batch router jobsdb.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/rruntime"
+	"github.com/rudderlabs/rudder-server/services/filemanager"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+// Jobsdbs jobs can be replayed into
+const (
+	TargetGateway     = "gw"
+	TargetRouter      = "rt"
+	TargetBatchRouter = "batch_rt"
+)
+
+var (
+	pkgLogger        logger.LoggerI
+	startTime        string
+	endTime          string
+	target           string
+	destinationID    string
+	sourceIDs        []string
+	eventTypes       []string
+	userIDs          []string
+	maxJobsPerSecond int
+	storeBatchSize   int
+	listBatchSize    int64
+	checkpointFile   string
+	dryRun           bool
+)
+
+func Init() {
+	loadConfig()
+	pkgLogger = logger.NewLogger().Child("replay")
+}
+
+func loadConfig() {
+	config.RegisterStringConfigVariable("", &startTime, false, "Replay.startTime")
+	config.RegisterStringConfigVariable("", &endTime, false, "Replay.endTime")
+	config.RegisterStringConfigVariable(TargetGateway, &target, false, "Replay.target")
+	config.RegisterStringConfigVariable("", &destinationID, false, "Replay.destinationID")
+	config.RegisterStringSliceConfigVariable(nil, &sourceIDs, false, "Replay.sourceIDs")
+	config.RegisterStringSliceConfigVariable(nil, &eventTypes, false, "Replay.eventTypes")
+	config.RegisterStringSliceConfigVariable(nil, &userIDs, false, "Replay.userIDs")
+	config.RegisterIntConfigVariable(1000, &maxJobsPerSecond, false, 1, "Replay.maxJobsPerSecond")
+	config.RegisterIntConfigVariable(100, &storeBatchSize, false, 1, "Replay.storeBatchSize")
+	config.RegisterInt64ConfigVariable(1000, &listBatchSize, false, 1, "Replay.listBatchSize")
+	config.RegisterStringConfigVariable("", &checkpointFile, false, "Replay.checkpointFile")
+	config.RegisterBoolConfigVariable(false, &dryRun, false, "Replay.dryRun")
+}
+
+// HandleT replays the backup files of a jobsdb table prefix into a target jobsdb
+type HandleT struct {
+	logger         logger.LoggerI
+	fileManager    filemanager.FileManager
+	targetDB       jobsdb.JobsDB
+	target         string
+	pathPrefix     string
+	startTime      time.Time
+	endTime        time.Time
+	filter         filterT
+	maxJobsPerSec  int
+	storeBatchSize int
+	listBatchSize  int64
+	checkpointFile string
+	checkpointID   string
+	dryRun         bool
+
+	rateStart time.Time
+	rateCount int
+
+	replayedJobsStat stats.RudderStats
+	filteredJobsStat stats.RudderStats
+	filesStat        stats.RudderStats
+}
+
+// Setup starts replaying backup files in the background, according to the Replay config.
+// Nothing is replayed if Replay.startTime is not set.
+func Setup(gatewayDB, routerDB, batchRouterDB jobsdb.JobsDB) {
+	if startTime == "" {
+		pkgLogger.Info("Replay.startTime is not set, not replaying any backup")
+		return
+	}
+	targetDBs := map[string]jobsdb.JobsDB{
+		TargetGateway:     gatewayDB,
+		TargetRouter:      routerDB,
+		TargetBatchRouter: batchRouterDB,
+	}
+	fileManager, err := filemanager.DefaultFileManagerFactory.New(&filemanager.SettingsT{
+		Provider: config.GetEnv("JOBS_BACKUP_STORAGE_PROVIDER", "S3"),
+		Config:   filemanager.GetProviderConfigFromEnv(),
+	})
+	if err != nil {
+		pkgLogger.Errorf("Failed to create file manager of backups, not replaying: %v", err)
+		return
+	}
+	handle, err := newHandle(fileManager, targetDBs[target])
+	if err != nil {
+		pkgLogger.Errorf("Invalid replay config, not replaying: %v", err)
+		return
+	}
+	rruntime.Go(func() {
+		if err := handle.Run(context.Background()); err != nil {
+			pkgLogger.Errorf("Replay of %s backups failed: %v", handle.target, err)
+		}
+	})
+}
+
+func newHandle(fileManager filemanager.FileManager, targetDB jobsdb.JobsDB) (*HandleT, error) {
+	if target != TargetGateway && target != TargetRouter && target != TargetBatchRouter {
+		return nil, fmt.Errorf("invalid target %q, must be one of %s, %s or %s", target, TargetGateway, TargetRouter, TargetBatchRouter)
+	}
+	if target != TargetGateway && destinationID == "" {
+		return nil, fmt.Errorf("Replay.destinationID is required to replay into %s", target)
+	}
+	if targetDB == nil {
+		return nil, fmt.Errorf("%s jobsdb is not available", target)
+	}
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Replay.startTime: %w", err)
+	}
+	end := time.Now()
+	if endTime != "" {
+		if end, err = time.Parse(time.RFC3339, endTime); err != nil {
+			return nil, fmt.Errorf("invalid Replay.endTime: %w", err)
+		}
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("Replay.startTime %s is not before Replay.endTime %s", start, end)
+	}
+
+	checkpointPath := checkpointFile
+	if checkpointPath == "" && !dryRun {
+		tmpDirPath, err := misc.CreateTMPDIR()
+		if err != nil {
+			return nil, err
+		}
+		checkpointPath = filepath.Join(tmpDirPath, "rudder-replay", target+"_checkpoint.json")
+	}
+
+	tags := stats.Tags{"target": target, "dryRun": fmt.Sprint(dryRun)}
+	return &HandleT{
+		logger:      pkgLogger,
+		fileManager: fileManager,
+		targetDB:    targetDB,
+		target:      target,
+		// same prefix as the one backups are uploaded with, see jobsdb.getBackUpSettings
+		pathPrefix: strings.TrimSpace(config.GetString(fmt.Sprintf("JobsDB.backup.%v.pathPrefix", target), target)),
+		startTime:  start,
+		endTime:    end,
+		filter: filterT{
+			sourceIDs:     sourceIDs,
+			eventTypes:    eventTypes,
+			userIDs:       userIDs,
+			destinationID: destinationID,
+		},
+		maxJobsPerSec:  maxJobsPerSecond,
+		storeBatchSize: storeBatchSize,
+		listBatchSize:  listBatchSize,
+		checkpointFile: checkpointPath,
+		// identifies the replay with its config, so that the checkpoint of a different replay is not reused
+		checkpointID: strings.Join([]string{
+			target, startTime, endTime, destinationID,
+			strings.Join(sourceIDs, ","), strings.Join(eventTypes, ","), strings.Join(userIDs, ","),
+		}, "|"),
+		dryRun:           dryRun,
+		replayedJobsStat: stats.NewTaggedStat("replay_replayed_jobs", stats.CountType, tags),
+		filteredJobsStat: stats.NewTaggedStat("replay_filtered_jobs", stats.CountType, tags),
+		filesStat:        stats.NewTaggedStat("replay_files", stats.CountType, tags),
+	}, nil
+}
+
+// Run replays all backup files of the time range, skipping the ones already replayed according to the checkpoint
+func (h *HandleT) Run(ctx context.Context) error {
+	files, err := h.listFiles(ctx)
+	if err != nil {
+		return err
+	}
+	h.logger.Infof("Replaying %d %s backup files between %s and %s (dry run: %v)", len(files), h.target, h.startTime, h.endTime, h.dryRun)
+
+	checkpoint, err := loadCheckpoint(h.checkpointFile, h.checkpointID)
+	if err != nil {
+		return err
+	}
+	var replayed, filtered int
+	for _, file := range files {
+		if checkpoint.Completed[file.key] {
+			continue
+		}
+		offset := 0
+		if checkpoint.Current == file.key {
+			offset = checkpoint.Offset
+		}
+		fileReplayed, fileFiltered, err := h.replayFile(ctx, file, offset, checkpoint)
+		if err != nil {
+			return fmt.Errorf("replaying %s: %w", file.key, err)
+		}
+		replayed += fileReplayed
+		filtered += fileFiltered
+		h.filesStat.Increment()
+		checkpoint.complete(file.key)
+		if err := h.saveCheckpoint(checkpoint); err != nil {
+			return err
+		}
+	}
+	h.logger.Infof("Replay of %s backups done: %d jobs replayed, %d jobs filtered out (dry run: %v)", h.target, replayed, filtered, h.dryRun)
+	return nil
+}
+
+// listFiles returns the backup files overlapping the time range, sorted by time.
+// Listing stops once a page has no new keys, since file managers don't all paginate.
+func (h *HandleT) listFiles(ctx context.Context) ([]backupFileT, error) {
+	prefixes := make([]string, 0, 3)
+	for _, prefix := range []string{h.fileManager.GetConfiguredPrefix(), h.pathPrefix, config.GetEnv("INSTANCE_ID", "1")} {
+		if prefix = strings.Trim(prefix, "/"); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	listPrefix := strings.Join(prefixes, "/") + "/"
+
+	var files []backupFileT
+	seen := make(map[string]bool)
+	for {
+		fileObjects, err := h.fileManager.ListFilesWithPrefix(ctx, listPrefix, h.listBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("listing backup files with prefix %s: %w", listPrefix, err)
+		}
+		newObjects := 0
+		for _, fileObject := range fileObjects {
+			if seen[fileObject.Key] {
+				continue
+			}
+			seen[fileObject.Key] = true
+			newObjects++
+			file, ok := parseBackupFileKey(fileObject.Key, h.target)
+			if !ok || !file.overlaps(h.startTime, h.endTime) {
+				continue
+			}
+			files = append(files, file)
+		}
+		if newObjects == 0 || int64(len(fileObjects)) < h.listBatchSize {
+			break
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].minJobID != files[j].minJobID {
+			return files[i].minJobID < files[j].minJobID
+		}
+		return files[i].key < files[j].key
+	})
+	return files, nil
+}
+
+// replayFile streams the jobs of a backup file, skipping the first offset ones, and stores the matching ones
+func (h *HandleT) replayFile(ctx context.Context, file backupFileT, offset int, checkpoint *checkpointT) (replayed, filtered int, err error) {
+	tmpDirPath, err := misc.CreateTMPDIR()
+	if err != nil {
+		return 0, 0, err
+	}
+	downloadDir := filepath.Join(tmpDirPath, "rudder-replay")
+	if err := os.MkdirAll(downloadDir, os.ModePerm); err != nil {
+		return 0, 0, err
+	}
+	downloaded, err := os.CreateTemp(downloadDir, "backup-*.gz")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(downloaded.Name())
+	defer downloaded.Close()
+
+	if err := h.fileManager.Download(ctx, downloaded, file.key); err != nil {
+		return 0, 0, fmt.Errorf("downloading: %w", err)
+	}
+	if _, err := downloaded.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	gzReader, err := gzip.NewReader(downloaded)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer gzReader.Close()
+
+	// lines are read whole, as a single job can be larger than the token limit of a bufio.Scanner
+	reader := bufio.NewReader(gzReader)
+	batch := make([]*jobsdb.JobT, 0, h.storeBatchSize)
+	lineNumber := 0
+	flush := func() error {
+		if len(batch) > 0 && !h.dryRun {
+			if err := h.throttle(ctx, len(batch)); err != nil {
+				return err
+			}
+			if err := h.targetDB.Store(batch); err != nil {
+				return fmt.Errorf("storing jobs: %w", err)
+			}
+		}
+		h.replayedJobsStat.Count(len(batch))
+		replayed += len(batch)
+		batch = batch[:0]
+		checkpoint.Current, checkpoint.Offset = file.key, lineNumber
+		return h.saveCheckpoint(checkpoint)
+	}
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return replayed, filtered, readErr
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lineNumber++
+			if lineNumber > offset {
+				var backupJob backupJobT
+				if err := json.Unmarshal(line, &backupJob); err != nil {
+					return replayed, filtered, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				if job, ok := h.replayJob(&backupJob); ok {
+					batch = append(batch, job)
+				} else {
+					h.filteredJobsStat.Increment()
+					filtered++
+				}
+				if len(batch) >= h.storeBatchSize {
+					if err := flush(); err != nil {
+						return replayed, filtered, err
+					}
+				}
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+	return replayed, filtered, flush()
+}
+
+// throttle blocks until storing n more jobs keeps the replay under maxJobsPerSec
+func (h *HandleT) throttle(ctx context.Context, n int) error {
+	if h.maxJobsPerSec <= 0 {
+		return nil
+	}
+	if h.rateStart.IsZero() {
+		h.rateStart = time.Now()
+	}
+	h.rateCount += n
+	wait := time.Until(h.rateStart.Add(time.Duration(h.rateCount) * time.Second / time.Duration(h.maxJobsPerSec)))
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (h *HandleT) saveCheckpoint(checkpoint *checkpointT) error {
+	if h.dryRun || h.checkpointFile == "" {
+		return nil
+	}
+	return checkpoint.save(h.checkpointFile)
+}
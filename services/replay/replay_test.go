@@ -0,0 +1,231 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	mocksJobsDB "github.com/rudderlabs/rudder-server/mocks/jobsdb"
+	mock_filemanager "github.com/rudderlabs/rudder-server/mocks/services/filemanager"
+	"github.com/rudderlabs/rudder-server/services/filemanager"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	replayStart = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	replayEnd   = time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)
+)
+
+func TestMain(m *testing.M) {
+	config.Load()
+	logger.Init()
+	misc.Init()
+	stats.Setup()
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestParseBackupFileKey(t *testing.T) {
+	file, ok := parseBackupFileKey("backups/gw/1/gw_jobs_12.100.200.1646092800000.1646096400000.gz", "gw")
+	require.True(t, ok)
+	require.Equal(t, int64(100), file.minJobID)
+	require.Equal(t, int64(200), file.maxJobID)
+	require.True(t, file.startTime.Equal(replayStart))
+	require.True(t, file.endTime.Equal(replayStart.Add(time.Hour)))
+	require.True(t, file.overlaps(replayStart, replayEnd))
+	require.False(t, file.overlaps(replayStart.Add(2*time.Hour), replayEnd))
+
+	for _, key := range []string{
+		"backups/gw/1/gw_job_status_12.gz",
+		"backups/gw/1/gw_jobs_12_aborted.gz",
+		"backups/gw/1/batch_rt_jobs_12.100.200.1646092800000.1646096400000.gz",
+		"backups/gw/1/gw_jobs_12.100.x.1646092800000.1646096400000.gz",
+	} {
+		_, ok := parseBackupFileKey(key, "gw")
+		require.False(t, ok, key)
+	}
+}
+
+func TestFilterBatch(t *testing.T) {
+	payload := []byte(`{"writeKey":"wk","batch":[{"type":"track","userId":"u1"},{"type":"identify","userId":"u1"},{"type":"track","anonymousId":"a2"}]}`)
+
+	filter := filterT{}
+	filtered, count, ok := filter.filterBatch(payload)
+	require.True(t, ok)
+	require.Equal(t, 3, count)
+	require.Equal(t, payload, filtered)
+
+	filter = filterT{eventTypes: []string{"Track"}, userIDs: []string{"a2"}}
+	filtered, count, ok = filter.filterBatch(payload)
+	require.True(t, ok)
+	require.Equal(t, 1, count)
+	require.JSONEq(t, `{"writeKey":"wk","batch":[{"type":"track","anonymousId":"a2"}]}`, string(filtered))
+
+	filter = filterT{eventTypes: []string{"page"}}
+	_, _, ok = filter.filterBatch(payload)
+	require.False(t, ok)
+}
+
+func TestRun(t *testing.T) {
+	backupKey := "gw/1/gw_jobs_1.1.3.1646092800000.1646096400000.gz"
+	backup := gzipLines(t,
+		`{"job_id": 1, "workspace_id": "w1", "uuid": "a0b1c2d3-0000-0000-0000-000000000001", "user_id": "a1<<>>u1", "parameters": {"source_id": "s1"}, "custom_val": "GW", "event_payload": {"batch": [{"type": "track", "userId": "u1"}, {"type": "identify", "userId": "u1"}]}, "event_count": 2, "created_at": "2022-03-01T00:10:00.123456", "expire_at": "2022-03-01T00:10:00.123456"}`,
+		`{"job_id": 2, "workspace_id": "w1", "uuid": "a0b1c2d3-0000-0000-0000-000000000002", "user_id": "a2<<>>u2", "parameters": {"source_id": "s2"}, "custom_val": "GW", "event_payload": {"batch": [{"type": "track", "userId": "u2"}]}, "event_count": 1, "created_at": "2022-03-01T00:20:00", "expire_at": "2022-03-01T00:20:00"}`,
+		`{"job_id": 3, "workspace_id": "w1", "uuid": "a0b1c2d3-0000-0000-0000-000000000003", "user_id": "a3<<>>u3", "parameters": {"source_id": "s1"}, "custom_val": "GW", "event_payload": {"batch": [{"type": "track", "userId": "u3"}]}, "event_count": 1, "created_at": "2022-02-28T23:59:59", "expire_at": "2022-02-28T23:59:59"}`,
+	)
+
+	newHandle := func(t *testing.T, ctrl *gomock.Controller, checkpointFile string, dryRun bool) (*HandleT, *mock_filemanager.MockFileManager, *mocksJobsDB.MockJobsDB) {
+		fileManager := mock_filemanager.NewMockFileManager(ctrl)
+		fileManager.EXPECT().GetConfiguredPrefix().Return("").AnyTimes()
+		fileManager.EXPECT().ListFilesWithPrefix(gomock.Any(), "gw/1/", int64(10)).Return([]*filemanager.FileObject{
+			{Key: backupKey},
+			{Key: "gw/1/gw_job_status_1.gz"},
+			{Key: "gw/1/gw_jobs_2.4.5.1646179200000.1646182800000.gz"},
+		}, nil).Times(1)
+		fileManager.EXPECT().Download(gomock.Any(), gomock.Any(), backupKey).DoAndReturn(func(_ context.Context, output *os.File, _ string) error {
+			_, err := output.Write(backup)
+			return err
+		}).AnyTimes()
+		targetDB := mocksJobsDB.NewMockJobsDB(ctrl)
+		return &HandleT{
+			logger:           pkgLogger,
+			fileManager:      fileManager,
+			targetDB:         targetDB,
+			target:           TargetGateway,
+			pathPrefix:       "gw",
+			startTime:        replayStart,
+			endTime:          replayEnd,
+			filter:           filterT{sourceIDs: []string{"s1"}, eventTypes: []string{"track"}},
+			storeBatchSize:   10,
+			listBatchSize:    10,
+			checkpointFile:   checkpointFile,
+			checkpointID:     "test",
+			dryRun:           dryRun,
+			replayedJobsStat: stats.NewTaggedStat("replay_replayed_jobs", stats.CountType, nil),
+			filteredJobsStat: stats.NewTaggedStat("replay_filtered_jobs", stats.CountType, nil),
+			filesStat:        stats.NewTaggedStat("replay_files", stats.CountType, nil),
+		}, fileManager, targetDB
+	}
+
+	t.Run("stores matching jobs and skips them once checkpointed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		handle, _, targetDB := newHandle(t, ctrl, checkpointFile, false)
+		var stored []*jobsdb.JobT
+		targetDB.EXPECT().Store(gomock.Any()).DoAndReturn(func(jobs []*jobsdb.JobT) error {
+			stored = append(stored, jobs...)
+			return nil
+		}).Times(1)
+		require.NoError(t, handle.Run(context.Background()))
+
+		require.Len(t, stored, 1)
+		require.Equal(t, "a1<<>>u1", stored[0].UserID)
+		require.Equal(t, "w1", stored[0].WorkspaceId)
+		require.Equal(t, "GW", stored[0].CustomVal)
+		require.Equal(t, 1, stored[0].EventCount)
+		require.Equal(t, "s1", gjson.GetBytes(stored[0].Parameters, "source_id").String())
+		require.JSONEq(t, `{"batch": [{"type": "track", "userId": "u1"}]}`, string(stored[0].EventPayload))
+		require.NotEqual(t, "a0b1c2d3-0000-0000-0000-000000000001", stored[0].UUID.String())
+
+		checkpoint, err := loadCheckpoint(checkpointFile, "test")
+		require.NoError(t, err)
+		require.True(t, checkpoint.Completed[backupKey])
+
+		handle, _, _ = newHandle(t, ctrl, checkpointFile, false)
+		require.NoError(t, handle.Run(context.Background()))
+	})
+
+	t.Run("resumes a file from the checkpointed offset", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint := &checkpointT{ID: "test", Completed: map[string]bool{}, Current: backupKey, Offset: 1}
+		require.NoError(t, checkpoint.save(checkpointFile))
+
+		handle, _, _ := newHandle(t, ctrl, checkpointFile, false)
+		require.NoError(t, handle.Run(context.Background()))
+	})
+
+	t.Run("dry run does not store jobs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handle, _, _ := newHandle(t, ctrl, "", true)
+		require.NoError(t, handle.Run(context.Background()))
+	})
+
+	t.Run("router jobs are filtered by destination", func(t *testing.T) {
+		handle := &HandleT{
+			target:    TargetRouter,
+			startTime: replayStart,
+			endTime:   replayEnd,
+			filter:    filterT{destinationID: "d1", eventTypes: []string{"track"}},
+		}
+		job := func(destinationID, eventType string) *backupJobT {
+			return &backupJobT{
+				UserID:       "rudder-id",
+				Parameters:   []byte(fmt.Sprintf(`{"source_id": "s1", "destination_id": %q, "event_type": %q}`, destinationID, eventType)),
+				EventPayload: []byte(`{"body": {}}`),
+				EventCount:   1,
+				CreatedAt:    "2022-03-01T01:00:00",
+			}
+		}
+		_, ok := handle.replayJob(job("d1", "track"))
+		require.True(t, ok)
+		_, ok = handle.replayJob(job("d2", "track"))
+		require.False(t, ok)
+		_, ok = handle.replayJob(job("d1", "identify"))
+		require.False(t, ok)
+	})
+
+	t.Run("router jobs are filtered by user", func(t *testing.T) {
+		handle := &HandleT{
+			target:    TargetRouter,
+			startTime: replayStart,
+			endTime:   replayEnd,
+			filter:    filterT{destinationID: "d1", userIDs: []string{"u1", "a2"}},
+		}
+		job := func(userID string) *backupJobT {
+			return &backupJobT{
+				UserID:       userID,
+				Parameters:   []byte(`{"source_id": "s1", "destination_id": "d1", "event_type": "track"}`),
+				EventPayload: []byte(`{"body": {}}`),
+				EventCount:   1,
+				CreatedAt:    "2022-03-01T01:00:00",
+			}
+		}
+		_, ok := handle.replayJob(job("a1<<>>u1"))
+		require.True(t, ok)
+		_, ok = handle.replayJob(job("a2<<>>"))
+		require.True(t, ok)
+		_, ok = handle.replayJob(job("a1<<>>u2"))
+		require.False(t, ok)
+		_, ok = handle.replayJob(job("random-u1"))
+		require.False(t, ok)
+	})
+}
+
+func gzipLines(t *testing.T, lines ...string) []byte {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		_, err := gzWriter.Write([]byte(line + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, gzWriter.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,271 @@
+package reporting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bugsnag/bugsnag-go/v2"
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rudderlabs/rudder-server/jobsdb"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// statuses counted as failures by the errors and top failing destinations queries
+var failedStatuses = []string{jobsdb.Failed.State, jobsdb.Aborted.State}
+
+// queryT is a query of the reports, parsed from the parameters of a request
+type queryT struct {
+	table         string
+	from          time.Time
+	to            time.Time
+	workspaceID   string
+	sourceID      string
+	destinationID string
+	pu            string
+	limit         int
+}
+
+// parseQuery parses the query parameters of a request.
+// Time range defaults to the last hour, and granularity to minute if the range is within the retention of minutes.
+func parseQuery(r *http.Request, now time.Time) (queryT, error) {
+	params := r.URL.Query()
+	query := queryT{
+		from:          now.Add(-time.Hour),
+		to:            now,
+		workspaceID:   params.Get("workspaceId"),
+		sourceID:      params.Get("sourceId"),
+		destinationID: params.Get("destinationId"),
+		pu:            params.Get("pu"),
+		limit:         defaultQueryLimit,
+	}
+	for name, value := range map[string]*time.Time{"from": &query.from, "to": &query.to} {
+		if params.Get(name) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, params.Get(name))
+		if err != nil {
+			return queryT{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*value = parsed
+	}
+	if !query.from.Before(query.to) {
+		return queryT{}, fmt.Errorf("from %s is not before to %s", query.from.Format(time.RFC3339), query.to.Format(time.RFC3339))
+	}
+
+	switch granularity := params.Get("granularity"); granularity {
+	case "minute":
+		query.table = minuteTable
+	case "hour":
+		query.table = hourTable
+	case "":
+		query.table = hourTable
+		if !query.from.Before(now.Add(-minuteRetention)) {
+			query.table = minuteTable
+		}
+	default:
+		return queryT{}, fmt.Errorf("invalid granularity %q, must be minute or hour", granularity)
+	}
+	if query.table == hourTable {
+		query.from = query.from.Truncate(time.Hour)
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 || parsed > maxQueryLimit {
+			return queryT{}, fmt.Errorf("invalid limit %q, must be between 1 and %d", limit, maxQueryLimit)
+		}
+		query.limit = parsed
+	}
+	return query, nil
+}
+
+// where returns the conditions of the query and their arguments
+func (query queryT) where() (string, []interface{}) {
+	conditions := []string{"bucket >= $1", "bucket < $2"}
+	args := []interface{}{query.from.Unix(), query.to.Unix()}
+	for _, filter := range []struct{ column, value string }{
+		{"workspace_id", query.workspaceID},
+		{"source_id", query.sourceID},
+		{"destination_id", query.destinationID},
+		{"pu", query.pu},
+	} {
+		if filter.value == "" {
+			continue
+		}
+		args = append(args, filter.value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", filter.column, len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+type countT struct {
+	Time          time.Time `json:"time"`
+	SourceID      string    `json:"sourceId"`
+	DestinationID string    `json:"destinationId"`
+	InPU          string    `json:"inReportedBy"`
+	PU            string    `json:"reportedBy"`
+	Status        string    `json:"status"`
+	Count         int64     `json:"count"`
+}
+
+type errorSampleT struct {
+	Time           time.Time       `json:"time"`
+	SourceID       string          `json:"sourceId"`
+	DestinationID  string          `json:"destinationId"`
+	PU             string          `json:"reportedBy"`
+	Status         string          `json:"status"`
+	StatusCode     int             `json:"statusCode"`
+	EventName      string          `json:"eventName"`
+	EventType      string          `json:"eventType"`
+	Count          int64           `json:"count"`
+	SampleResponse string          `json:"sampleResponse"`
+	SampleEvent    json.RawMessage `json:"sampleEvent,omitempty"`
+}
+
+type failingDestinationT struct {
+	DestinationID string  `json:"destinationId"`
+	Failed        int64   `json:"failed"`
+	Succeeded     int64   `json:"succeeded"`
+	FailureRate   float64 `json:"failureRate"`
+}
+
+func (handle *HandleT) startWebHandler(ctx context.Context, dbHandle *sql.DB) error {
+	handle.logger.Infof("Starting reporting query API in %d", webPort)
+	srvMux := mux.NewRouter()
+	srvMux.HandleFunc("/v1/reports/counts", handle.queryHandler(dbHandle, queryCounts)).Methods("GET")
+	srvMux.HandleFunc("/v1/reports/errors", handle.queryHandler(dbHandle, queryErrorSamples)).Methods("GET")
+	srvMux.HandleFunc("/v1/reports/top-failing-destinations", handle.queryHandler(dbHandle, queryTopFailingDestinations)).Methods("GET")
+
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(webPort),
+		Handler: bugsnag.Handler(srvMux),
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		<-ctx.Done()
+		return srv.Shutdown(context.Background())
+	})
+	g.Go(func() error {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+func (handle *HandleT) queryHandler(dbHandle *sql.DB, run func(context.Context, *sql.DB, queryT) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseQuery(r, handle.now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := run(r.Context(), dbHandle, query)
+		if err != nil {
+			handle.logger.Errorf("Failed to query reports: %v", err)
+			http.Error(w, "failed to query reports", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			handle.logger.Errorf("Failed to write reports response: %v", err)
+		}
+	}
+}
+
+// queryCounts returns the counts per time bucket, connection, PU and status
+func queryCounts(ctx context.Context, dbHandle *sql.DB, query queryT) (interface{}, error) {
+	where, args := query.where()
+	sqlStatement := fmt.Sprintf(`SELECT bucket, source_id, destination_id, in_pu, pu, status, SUM(count) FROM %s WHERE %s
+		GROUP BY bucket, source_id, destination_id, in_pu, pu, status
+		ORDER BY bucket, source_id, destination_id, in_pu, pu, status`, query.table, where)
+	rows, err := dbHandle.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make([]countT, 0)
+	for rows.Next() {
+		var count countT
+		var bucket int64
+		if err := rows.Scan(&bucket, &count.SourceID, &count.DestinationID, &count.InPU, &count.PU, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		count.Time = time.Unix(bucket, 0).UTC()
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// queryErrorSamples returns the latest samples of failures, limited to query.limit
+func queryErrorSamples(ctx context.Context, dbHandle *sql.DB, query queryT) (interface{}, error) {
+	where, args := query.where()
+	args = append(args, failedStatuses[0], failedStatuses[1], query.limit)
+	sqlStatement := fmt.Sprintf(`SELECT bucket, source_id, destination_id, pu, status, status_code, event_name, event_type, count, sample_response, sample_event
+		FROM %s WHERE %s AND status IN ($%d, $%d) AND sample_response <> ''
+		ORDER BY bucket DESC, count DESC LIMIT $%d`, query.table, where, len(args)-2, len(args)-1, len(args))
+	rows, err := dbHandle.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	samples := make([]errorSampleT, 0)
+	for rows.Next() {
+		var sample errorSampleT
+		var bucket int64
+		var sampleEvent sql.NullString
+		if err := rows.Scan(&bucket, &sample.SourceID, &sample.DestinationID, &sample.PU, &sample.Status, &sample.StatusCode,
+			&sample.EventName, &sample.EventType, &sample.Count, &sample.SampleResponse, &sampleEvent); err != nil {
+			return nil, err
+		}
+		sample.Time = time.Unix(bucket, 0).UTC()
+		if sampleEvent.Valid {
+			sample.SampleEvent = json.RawMessage(sampleEvent.String)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// queryTopFailingDestinations returns the destinations with the most failures, limited to query.limit.
+// Successes are the ones of terminal PUs, i.e. deliveries.
+func queryTopFailingDestinations(ctx context.Context, dbHandle *sql.DB, query queryT) (interface{}, error) {
+	where, args := query.where()
+	args = append(args, failedStatuses[0], failedStatuses[1], jobsdb.Succeeded.State, query.limit)
+	sqlStatement := fmt.Sprintf(`SELECT destination_id, failed, succeeded FROM (
+		SELECT destination_id,
+		COALESCE(SUM(count) FILTER (WHERE status IN ($%[3]d, $%[4]d)), 0) AS failed,
+		COALESCE(SUM(count) FILTER (WHERE status = $%[5]d AND terminal_state), 0) AS succeeded
+		FROM %[1]s WHERE %[2]s AND destination_id <> ''
+		GROUP BY destination_id) AS destinations
+		WHERE failed > 0 ORDER BY failed DESC, destination_id LIMIT $%[6]d`, query.table, where, len(args)-3, len(args)-2, len(args)-1, len(args))
+	rows, err := dbHandle.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	destinations := make([]failingDestinationT, 0)
+	for rows.Next() {
+		var destination failingDestinationT
+		if err := rows.Scan(&destination.DestinationID, &destination.Failed, &destination.Succeeded); err != nil {
+			return nil, err
+		}
+		destination.FailureRate = float64(destination.Failed) / float64(destination.Failed+destination.Succeeded)
+		destinations = append(destinations, destination)
+	}
+	return destinations, rows.Err()
+}
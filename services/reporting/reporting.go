@@ -0,0 +1,294 @@
+// Package reporting is a self-hosted implementation of types.ReportingI.
+//
+// Metrics reported by the processor, router, batch router and warehouse are aggregated per minute, connection, PU and status
+// in the database of the client, inside the transaction they are reported with. Minutes are rolled up per hour, old rows
+// are pruned, and the reports of the core client can be queried through an HTTP API.
+package reporting
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/rruntime"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/pubsub"
+	"github.com/rudderlabs/rudder-server/utils/types"
+)
+
+var (
+	pkgLogger       logger.LoggerI
+	enabled         bool
+	webPort         int
+	rollupInterval  time.Duration
+	minuteRetention time.Duration
+	hourRetention   time.Duration
+	setupRetryDelay time.Duration
+)
+
+func Init() {
+	loadConfig()
+	pkgLogger = logger.NewLogger().Child("reporting")
+}
+
+func loadConfig() {
+	config.RegisterBoolConfigVariable(false, &enabled, false, "Reporting.local.enabled")
+	config.RegisterIntConfigVariable(8087, &webPort, false, 1, "Reporting.local.webPort")
+	config.RegisterDurationConfigVariable(60, &rollupInterval, true, time.Second, "Reporting.local.rollupInterval")
+	config.RegisterDurationConfigVariable(24, &minuteRetention, true, time.Hour, "Reporting.local.minuteRetention")
+	config.RegisterDurationConfigVariable(720, &hourRetention, true, time.Hour, "Reporting.local.hourRetention")
+	config.RegisterDurationConfigVariable(5, &setupRetryDelay, false, time.Second, "Reporting.local.setupRetryDelay")
+}
+
+// IsEnabled checks whether metrics are to be reported to the local database, instead of being discarded
+func IsEnabled() bool {
+	return enabled
+}
+
+// HandleT stores the reported metrics in the database of its clients
+type HandleT struct {
+	logger           logger.LoggerI
+	clientsLock      sync.RWMutex
+	clients          map[string]*types.Client
+	sourcesLock      sync.RWMutex
+	sourceWorkspaces map[string]string
+	now              func() time.Time
+}
+
+// New returns a reporting handle, resolving the workspaces of reported sources from backendConfig
+func New(backendConfig backendconfig.BackendConfig) *HandleT {
+	handle := &HandleT{
+		logger:           pkgLogger,
+		clients:          make(map[string]*types.Client),
+		sourceWorkspaces: make(map[string]string),
+		now:              time.Now,
+	}
+	rruntime.Go(func() {
+		handle.backendConfigSubscriber(backendConfig)
+	})
+	return handle
+}
+
+func (handle *HandleT) backendConfigSubscriber(backendConfig backendconfig.BackendConfig) {
+	ch := make(chan pubsub.DataEvent)
+	backendConfig.Subscribe(ch, backendconfig.TopicBackendConfig)
+	for config := range ch {
+		sourceWorkspaces := make(map[string]string)
+		for _, source := range config.Data.(backendconfig.ConfigT).Sources {
+			sourceWorkspaces[source.ID] = source.WorkspaceID
+		}
+		handle.sourcesLock.Lock()
+		handle.sourceWorkspaces = sourceWorkspaces
+		handle.sourcesLock.Unlock()
+	}
+}
+
+// AddClient connects to the database of the client and creates the report tables, retrying until it succeeds.
+// It then rolls up and prunes reports, and serves the query API for the core client, until ctx is done.
+func (handle *HandleT) AddClient(ctx context.Context, c types.Config) {
+	if c.ClientName == "" {
+		c.ClientName = types.CORE_REPORTING_CLIENT
+	}
+	var dbHandle *sql.DB
+	for {
+		var err error
+		if dbHandle, err = setupDB(c.ConnInfo); err == nil {
+			break
+		}
+		handle.logger.Errorf("Failed to set up reports of client %s, retrying in %v: %v", c.ClientName, setupRetryDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(setupRetryDelay):
+		}
+	}
+	defer dbHandle.Close()
+
+	handle.clientsLock.Lock()
+	handle.clients[c.ClientName] = &types.Client{Config: c, DbHandle: dbHandle}
+	handle.clientsLock.Unlock()
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		handle.maintenanceLoop(ctx, dbHandle)
+		return nil
+	})
+	if c.ClientName == types.CORE_REPORTING_CLIENT {
+		g.Go(func() error {
+			return handle.startWebHandler(ctx, dbHandle)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		handle.logger.Errorf("Reporting of client %s stopped: %v", c.ClientName, err)
+	}
+}
+
+func setupDB(connInfo string) (*sql.DB, error) {
+	dbHandle, err := sql.Open("postgres", connInfo)
+	if err != nil {
+		return nil, err
+	}
+	if err := createTables(dbHandle); err != nil {
+		dbHandle.Close()
+		return nil, err
+	}
+	return dbHandle, nil
+}
+
+// WaitForSetup blocks until the client is added, or ctx is done
+func (handle *HandleT) WaitForSetup(ctx context.Context, clientName string) {
+	for handle.GetClient(clientName) == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (handle *HandleT) GetClient(clientName string) *types.Client {
+	handle.clientsLock.RLock()
+	defer handle.clientsLock.RUnlock()
+	return handle.clients[clientName]
+}
+
+func (handle *HandleT) Enabled() bool {
+	return true
+}
+
+// Report adds the metrics to the reports of the current minute, as part of txn
+func (handle *HandleT) Report(metrics []*types.PUReportedMetric, txn *sql.Tx) {
+	if len(metrics) == 0 || txn == nil {
+		return
+	}
+	reports := handle.aggregate(metrics, handle.now())
+	stmt, err := txn.Prepare(upsertStatement(minuteTable))
+	if err != nil {
+		panic(fmt.Errorf("preparing upsert of reports: %w", err))
+	}
+	defer stmt.Close()
+	for _, report := range reports {
+		if _, err := stmt.Exec(report.values()...); err != nil {
+			panic(fmt.Errorf("upserting reports: %w", err))
+		}
+	}
+}
+
+type reportKeyT struct {
+	bucket        int64
+	workspaceID   string
+	sourceID      string
+	destinationID string
+	inPU          string
+	pu            string
+	status        string
+	statusCode    int
+	eventName     string
+	eventType     string
+}
+
+type reportT struct {
+	reportKeyT
+	sourceDefinitionID      string
+	destinationDefinitionID string
+	sourceCategory          string
+	terminalState           bool
+	initialState            bool
+	count                   int64
+	sampleResponse          string
+	sampleEvent             json.RawMessage
+}
+
+// aggregate sums the metrics per report key, sorted by key so that concurrent transactions lock rows in the same order
+func (handle *HandleT) aggregate(metrics []*types.PUReportedMetric, now time.Time) []*reportT {
+	bucket := now.Unix() - now.Unix()%60
+	handle.sourcesLock.RLock()
+	defer handle.sourcesLock.RUnlock()
+
+	reports := make(map[reportKeyT]*reportT)
+	for _, metric := range metrics {
+		if metric == nil || metric.StatusDetail == nil {
+			continue
+		}
+		key := reportKeyT{
+			bucket:        bucket,
+			workspaceID:   handle.sourceWorkspaces[metric.SourceID],
+			sourceID:      metric.SourceID,
+			destinationID: metric.DestinationID,
+			inPU:          metric.InPU,
+			pu:            metric.PU,
+			status:        metric.StatusDetail.Status,
+			statusCode:    metric.StatusDetail.StatusCode,
+			eventName:     metric.StatusDetail.EventName,
+			eventType:     metric.StatusDetail.EventType,
+		}
+		report, ok := reports[key]
+		if !ok {
+			report = &reportT{
+				reportKeyT:              key,
+				sourceDefinitionID:      metric.SourceDefinitionId,
+				destinationDefinitionID: metric.DestinationDefinitionId,
+				sourceCategory:          metric.SourceCategory,
+				terminalState:           metric.TerminalPU,
+				initialState:            metric.InitialPU,
+			}
+			reports[key] = report
+		}
+		report.count += metric.StatusDetail.Count
+		if metric.StatusDetail.SampleResponse != "" {
+			report.sampleResponse = metric.StatusDetail.SampleResponse
+		}
+		if sampleEvent := metric.StatusDetail.SampleEvent; len(sampleEvent) > 0 && string(sampleEvent) != "{}" && json.Valid(sampleEvent) {
+			report.sampleEvent = sampleEvent
+		}
+	}
+
+	sorted := make([]*reportT, 0, len(reports))
+	for _, report := range reports {
+		sorted = append(sorted, report)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].reportKeyT.less(sorted[j].reportKeyT)
+	})
+	return sorted
+}
+
+func (key reportKeyT) less(other reportKeyT) bool {
+	if key.bucket != other.bucket {
+		return key.bucket < other.bucket
+	}
+	if key.statusCode != other.statusCode {
+		return key.statusCode < other.statusCode
+	}
+	keyFields := []string{key.workspaceID, key.sourceID, key.destinationID, key.inPU, key.pu, key.status, key.eventName, key.eventType}
+	otherFields := []string{other.workspaceID, other.sourceID, other.destinationID, other.inPU, other.pu, other.status, other.eventName, other.eventType}
+	for i := range keyFields {
+		if keyFields[i] != otherFields[i] {
+			return keyFields[i] < otherFields[i]
+		}
+	}
+	return false
+}
+
+// values returns the arguments of the upsert statement
+func (report *reportT) values() []interface{} {
+	var sampleEvent interface{}
+	if len(report.sampleEvent) > 0 {
+		sampleEvent = string(report.sampleEvent)
+	}
+	return []interface{}{
+		report.bucket, report.workspaceID, report.sourceID, report.destinationID,
+		report.sourceDefinitionID, report.destinationDefinitionID, report.sourceCategory,
+		report.inPU, report.pu, report.terminalState, report.initialState,
+		report.status, report.statusCode, report.eventName, report.eventType,
+		report.count, report.sampleResponse, sampleEvent,
+	}
+}
@@ -0,0 +1,120 @@
+package reporting
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+	"github.com/rudderlabs/rudder-server/utils/types"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2022, 3, 1, 10, 30, 45, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	config.Load()
+	logger.Init()
+	Init()
+	os.Exit(m.Run())
+}
+
+func metric(sourceID, destinationID, pu, status string, statusCode int, count int64, sampleResponse, sampleEvent string) *types.PUReportedMetric {
+	return &types.PUReportedMetric{
+		ConnectionDetails: types.ConnectionDetails{SourceID: sourceID, DestinationID: destinationID},
+		PUDetails:         types.PUDetails{InPU: "processor", PU: pu},
+		StatusDetail: &types.StatusDetail{
+			Status:         status,
+			StatusCode:     statusCode,
+			Count:          count,
+			SampleResponse: sampleResponse,
+			SampleEvent:    json.RawMessage(sampleEvent),
+			EventName:      "Order Completed",
+			EventType:      "track",
+		},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	handle := &HandleT{sourceWorkspaces: map[string]string{"s1": "w1"}}
+	reports := handle.aggregate([]*types.PUReportedMetric{
+		metric("s1", "d2", "router", "failed", 500, 1, "timeout", `{"event":"first"}`),
+		metric("s1", "d1", "router", "succeeded", 200, 2, "", "{}"),
+		nil,
+		metric("s1", "d2", "router", "failed", 500, 3, "", `{}`),
+		metric("s1", "d1", "router", "succeeded", 200, 4, "", ""),
+		metric("s2", "d1", "router", "succeeded", 200, 5, "", `not json`),
+	}, now)
+
+	require.Len(t, reports, 3)
+	bucket := time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC).Unix()
+	for i, report := range reports {
+		require.Equal(t, bucket, report.bucket)
+		if i > 0 {
+			require.True(t, reports[i-1].less(report.reportKeyT))
+		}
+	}
+
+	unknownWorkspace, succeeded, failed := reports[0], reports[1], reports[2]
+	require.Equal(t, "d1", succeeded.destinationID)
+	require.Equal(t, "w1", succeeded.workspaceID)
+	require.Equal(t, int64(6), succeeded.count)
+	require.Empty(t, succeeded.sampleEvent)
+	require.Nil(t, succeeded.values()[17])
+
+	require.Equal(t, "d2", failed.destinationID)
+	require.Equal(t, int64(4), failed.count)
+	require.Equal(t, "timeout", failed.sampleResponse)
+	require.JSONEq(t, `{"event":"first"}`, string(failed.sampleEvent))
+	require.Len(t, failed.values(), strings.Count(reportColumns, ",")+1)
+
+	require.Equal(t, "s2", unknownWorkspace.sourceID)
+	require.Equal(t, "", unknownWorkspace.workspaceID)
+	require.Empty(t, unknownWorkspace.sampleEvent)
+}
+
+func TestParseQuery(t *testing.T) {
+	parse := func(rawQuery string) (queryT, error) {
+		return parseQuery(httptest.NewRequest("GET", "/v1/reports/counts?"+rawQuery, nil), now)
+	}
+
+	query, err := parse("")
+	require.NoError(t, err)
+	require.Equal(t, minuteTable, query.table)
+	require.True(t, query.from.Equal(now.Add(-time.Hour)))
+	require.True(t, query.to.Equal(now))
+	require.Equal(t, defaultQueryLimit, query.limit)
+
+	query, err = parse("from=2022-01-01T10:15:00Z&to=2022-01-02T00:00:00Z&limit=10")
+	require.NoError(t, err)
+	require.Equal(t, hourTable, query.table)
+	require.True(t, query.from.Equal(time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)))
+	require.Equal(t, 10, query.limit)
+
+	query, err = parse("granularity=hour")
+	require.NoError(t, err)
+	require.Equal(t, hourTable, query.table)
+
+	for _, rawQuery := range []string{
+		"from=yesterday",
+		"from=2022-03-01T10:00:00Z&to=2022-03-01T09:00:00Z",
+		"granularity=day",
+		"limit=0",
+		"limit=1001",
+		"limit=ten",
+	} {
+		_, err := parse(rawQuery)
+		require.Error(t, err, rawQuery)
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	query := queryT{from: now.Add(-time.Hour), to: now, sourceID: "s1", pu: "router"}
+	where, args := query.where()
+	require.Equal(t, "bucket >= $1 AND bucket < $2 AND source_id = $3 AND pu = $4", where)
+	require.Equal(t, []interface{}{now.Add(-time.Hour).Unix(), now.Unix(), "s1", "router"}, args)
+}
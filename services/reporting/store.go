@@ -0,0 +1,118 @@
+package reporting
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	minuteTable = "local_reports_minute"
+	hourTable   = "local_reports_hour"
+
+	reportColumns    = `bucket, workspace_id, source_id, destination_id, source_definition_id, destination_definition_id, source_category, in_pu, pu, terminal_state, initial_state, status, status_code, event_name, event_type, count, sample_response, sample_event`
+	reportKeyColumns = `bucket, workspace_id, source_id, destination_id, in_pu, pu, status, status_code, event_name, event_type`
+)
+
+func createTables(dbHandle *sql.DB) error {
+	sqlStatement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		bucket BIGINT NOT NULL,
+		workspace_id TEXT NOT NULL,
+		source_id TEXT NOT NULL,
+		destination_id TEXT NOT NULL,
+		source_definition_id TEXT NOT NULL DEFAULT '',
+		destination_definition_id TEXT NOT NULL DEFAULT '',
+		source_category TEXT NOT NULL DEFAULT '',
+		in_pu TEXT NOT NULL,
+		pu TEXT NOT NULL,
+		terminal_state BOOLEAN NOT NULL DEFAULT FALSE,
+		initial_state BOOLEAN NOT NULL DEFAULT FALSE,
+		status TEXT NOT NULL,
+		status_code INT NOT NULL,
+		event_name TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		count BIGINT NOT NULL,
+		sample_response TEXT NOT NULL DEFAULT '',
+		sample_event JSONB,
+		PRIMARY KEY (%s))`, minuteTable, reportKeyColumns)
+	if _, err := dbHandle.Exec(sqlStatement); err != nil {
+		return fmt.Errorf("creating %s: %w", minuteTable, err)
+	}
+	sqlStatement = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)`, hourTable, minuteTable)
+	if _, err := dbHandle.Exec(sqlStatement); err != nil {
+		return fmt.Errorf("creating %s: %w", hourTable, err)
+	}
+	return nil
+}
+
+// upsertStatement adds the count of a report to the one of its key, keeping the latest samples
+func upsertStatement(table string) string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (%[2]s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (%[3]s) DO UPDATE SET
+		count = %[1]s.count + EXCLUDED.count,
+		sample_response = CASE WHEN EXCLUDED.sample_response <> '' THEN EXCLUDED.sample_response ELSE %[1]s.sample_response END,
+		sample_event = COALESCE(EXCLUDED.sample_event, %[1]s.sample_event)`, table, reportColumns, reportKeyColumns)
+}
+
+// rollup recomputes the hourly reports of the previous and current hours from the minute ones.
+// Recomputing whole hours keeps the rollup idempotent, minutes being kept longer than two hours.
+func rollup(ctx context.Context, dbHandle *sql.DB, now time.Time) error {
+	from := now.Unix() - now.Unix()%3600 - 3600
+	sqlStatement := fmt.Sprintf(`INSERT INTO %[1]s (%[3]s)
+		SELECT bucket - bucket %% 3600, workspace_id, source_id, destination_id,
+		MAX(source_definition_id), MAX(destination_definition_id), MAX(source_category),
+		in_pu, pu, BOOL_OR(terminal_state), BOOL_OR(initial_state),
+		status, status_code, event_name, event_type,
+		SUM(count), MAX(sample_response), (ARRAY_AGG(sample_event) FILTER (WHERE sample_event IS NOT NULL))[1]
+		FROM %[2]s WHERE bucket >= $1
+		GROUP BY bucket - bucket %% 3600, workspace_id, source_id, destination_id, in_pu, pu, status, status_code, event_name, event_type
+		ON CONFLICT (%[4]s) DO UPDATE SET
+		count = EXCLUDED.count,
+		sample_response = EXCLUDED.sample_response,
+		sample_event = EXCLUDED.sample_event`, hourTable, minuteTable, reportColumns, reportKeyColumns)
+	_, err := dbHandle.ExecContext(ctx, sqlStatement, from)
+	return err
+}
+
+// prune deletes the reports older than their retention
+func prune(ctx context.Context, dbHandle *sql.DB, now time.Time) error {
+	retentions := map[string]time.Duration{
+		minuteTable: minuteRetentionAtLeast(2 * time.Hour),
+		hourTable:   hourRetention,
+	}
+	for table, retention := range retentions {
+		sqlStatement := fmt.Sprintf(`DELETE FROM %s WHERE bucket < $1`, table)
+		if _, err := dbHandle.ExecContext(ctx, sqlStatement, now.Add(-retention).Unix()); err != nil {
+			return fmt.Errorf("pruning %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// minuteRetentionAtLeast keeps minutes long enough for the rollup of the previous hour
+func minuteRetentionAtLeast(minimum time.Duration) time.Duration {
+	if minuteRetention < minimum {
+		return minimum
+	}
+	return minuteRetention
+}
+
+func (handle *HandleT) maintenanceLoop(ctx context.Context, dbHandle *sql.DB) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rollupInterval):
+		}
+		now := handle.now()
+		if err := rollup(ctx, dbHandle, now); err != nil {
+			handle.logger.Errorf("Failed to roll up reports per hour: %v", err)
+		}
+		if err := prune(ctx, dbHandle, now); err != nil {
+			handle.logger.Errorf("Failed to prune reports: %v", err)
+		}
+	}
+}
@@ -137,37 +137,59 @@ func NewProducer(destinationConfig interface{}, o Opts) (sarama.SyncProducer, er
 	if err != nil {
 		return nil, fmt.Errorf("[Kafka] Error while unmarshalling dest config :: %w", err)
 	}
+	config := getDefaultConfiguration()
+	config.Producer.Timeout = o.Timeout
+	if err = setSecurityConfig(config, destConfig); err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer(getHosts(destConfig), config)
+
+	return producer, err
+}
+
+// NewConsumerGroup creates a consumer group reading from the brokers of config, with the same TLS and SASL settings as producers.
+// Offsets are not committed automatically, consumers commit them once messages are processed.
+func NewConsumerGroup(consumerConfig Config, groupID string) (sarama.ConsumerGroup, error) {
+	config := getDefaultConfiguration()
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	if err := setSecurityConfig(config, consumerConfig); err != nil {
+		return nil, err
+	}
+	return sarama.NewConsumerGroup(getHosts(consumerConfig), groupID, config)
+}
+
+func getHosts(destConfig Config) []string {
 	hosts := make([]string, 0)
 	hostNames := strings.Split(destConfig.HostName, ",")
 	for _, hostName := range hostNames {
 		hosts = append(hosts, hostName+":"+destConfig.Port)
 	}
-	isSslEnabled := destConfig.SslEnabled
-
-	config := getDefaultConfiguration()
-	config.Producer.Timeout = o.Timeout
+	return hosts
+}
 
-	if isSslEnabled {
-		caCertificate := destConfig.CACertificate
-		config.Net.TLS.Enable = true
-		if caCertificate != "" {
-			tlsConfig := NewTLSConfig(caCertificate)
-			if tlsConfig != nil {
-				config.Net.TLS.Config = tlsConfig
-			}
+// setSecurityConfig sets the TLS and SASL config of the connections to the brokers
+func setSecurityConfig(config *sarama.Config, destConfig Config) error {
+	if !destConfig.SslEnabled {
+		return nil
+	}
+	caCertificate := destConfig.CACertificate
+	config.Net.TLS.Enable = true
+	if caCertificate != "" {
+		tlsConfig := NewTLSConfig(caCertificate)
+		if tlsConfig != nil {
+			config.Net.TLS.Config = tlsConfig
 		}
-		if destConfig.UseSASL {
-			// SASL is enabled only with SSL
-			err = SetSASLConfig(config, destConfig)
-			if err != nil {
-				return nil, fmt.Errorf("[Kafka] Error while setting SASL config :: %w", err)
-			}
+	}
+	if destConfig.UseSASL {
+		// SASL is enabled only with SSL
+		if err := SetSASLConfig(config, destConfig); err != nil {
+			return fmt.Errorf("[Kafka] Error while setting SASL config :: %w", err)
 		}
 	}
-
-	producer, err := sarama.NewSyncProducer(hosts, config)
-
-	return producer, err
+	return nil
 }
 
 // Sets SASL authentication config for Kafka
@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+// TraceParentHeader is the W3C trace context header, also used as the key of the trace context in job parameters
+const TraceParentHeader = "traceparent"
+
+const (
+	OTLPExporter = "otlp"
+	FileExporter = "file"
+)
+
+var (
+	enabled        bool
+	exporterType   string
+	otlpEndpoint   string
+	otlpInsecure   bool
+	exportFilePath string
+	samplingRatio  float64
+	pkgLogger      logger.LoggerI
+
+	provider   *sdktrace.TracerProvider
+	tracer     = trace.NewNoopTracerProvider().Tracer("")
+	propagator = propagation.TraceContext{}
+)
+
+func Init() {
+	loadConfig()
+	pkgLogger = logger.NewLogger().Child("tracing")
+}
+
+func loadConfig() {
+	config.RegisterBoolConfigVariable(false, &enabled, false, "Tracing.enabled")
+	config.RegisterStringConfigVariable(OTLPExporter, &exporterType, false, "Tracing.exporter")
+	config.RegisterStringConfigVariable("localhost:4317", &otlpEndpoint, false, "Tracing.otlp.endpoint")
+	config.RegisterBoolConfigVariable(true, &otlpInsecure, false, "Tracing.otlp.insecure")
+	config.RegisterStringConfigVariable("/tmp/rudder-traces.json", &exportFilePath, false, "Tracing.file.path")
+	config.RegisterFloat64ConfigVariable(1, &samplingRatio, false, "Tracing.samplingRatio")
+}
+
+// Setup starts exporting spans if tracing is enabled.
+// Spans of traces started by clients are sampled according to the client's decision, other traces according to samplingRatio.
+func Setup() {
+	if !enabled {
+		return
+	}
+	exporter, err := newExporter()
+	if err != nil {
+		pkgLogger.Errorf("Unable to create the %s trace exporter, tracing is disabled: %v", exporterType, err)
+		enabled = false
+		return
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(samplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("rudder-server"),
+			semconv.ServiceInstanceIDKey.String(config.GetInstanceID()),
+		)),
+	)
+	tracer = provider.Tracer("github.com/rudderlabs/rudder-server")
+	pkgLogger.Infof("Exporting traces with the %s exporter", exporterType)
+}
+
+func newExporter() (sdktrace.SpanExporter, error) {
+	switch exporterType {
+	case OTLPExporter:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(otlpEndpoint)}
+		if otlpInsecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), options...)
+	case FileExporter:
+		file, err := os.OpenFile(exportFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	}
+	return nil, fmt.Errorf("unknown exporter %q", exporterType)
+}
+
+// Stop flushes the spans which are not exported yet
+func Stop() {
+	if provider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		pkgLogger.Errorf("Unable to flush traces: %v", err)
+	}
+}
+
+// Enabled returns true if spans are exported
+func Enabled() bool {
+	return enabled
+}
+
+// Extract returns ctx with the trace context of the traceparent header of an incoming request, if any
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if !enabled {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Start starts a span, child of the span in ctx. If ctx carries no trace context, the span starts a new trace.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartFromTraceParent starts a span in the trace of traceParent. If traceParent is empty, e.g. for jobs stored before
+// tracing was enabled, the returned span is not recorded.
+func StartFromTraceParent(ctx context.Context, traceParent, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !enabled || traceParent == "" {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return Start(contextWithTraceParent(ctx, traceParent), name, attrs...)
+}
+
+// End ends the span, marking it as failed if errorMessage is not empty
+func End(span trace.Span, errorMessage string) {
+	if errorMessage != "" {
+		span.SetStatus(codes.Error, errorMessage)
+	}
+	span.End()
+}
+
+// RecordSpan emits a span which already finished in the trace of traceParent, e.g. for a stage processing a batch of events.
+// Nothing is emitted if traceParent is empty.
+func RecordSpan(traceParent, name string, startedAt, endedAt time.Time, errorMessage string, attrs ...attribute.KeyValue) {
+	if !enabled || traceParent == "" {
+		return
+	}
+	_, span := tracer.Start(contextWithTraceParent(context.Background(), traceParent), name, trace.WithTimestamp(startedAt), trace.WithAttributes(attrs...))
+	if errorMessage != "" {
+		span.SetStatus(codes.Error, errorMessage)
+	}
+	span.End(trace.WithTimestamp(endedAt))
+}
+
+// TraceParent returns the traceparent header value of the span in ctx. It is empty if tracing is disabled or ctx carries no span.
+func TraceParent(ctx context.Context) string {
+	if !enabled {
+		return ""
+	}
+	carrier := propagation.HeaderCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get(TraceParentHeader)
+}
+
+// Inject sets the traceparent header of an outgoing request to the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	if !enabled {
+		return
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func contextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	carrier := propagation.HeaderCarrier{}
+	carrier.Set(TraceParentHeader, traceParent)
+	return propagator.Extract(ctx, carrier)
+}
@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rudderlabs/rudder-server/config"
+	"github.com/rudderlabs/rudder-server/utils/logger"
+)
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		TraceID string
+		SpanID  string
+	}
+	Status struct {
+		Code string
+	}
+}
+
+func readSpans(t *testing.T, path string) map[string]exportedSpan {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	spans := make(map[string]exportedSpan)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span exportedSpan
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &span))
+		spans[span.Name] = span
+	}
+	require.NoError(t, scanner.Err())
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	config.Load()
+	logger.Init()
+	Init()
+
+	traceParent := TraceParent(context.Background())
+	require.Empty(t, traceParent, "nothing is propagated while tracing is disabled")
+
+	enabled = true
+	exporterType = FileExporter
+	exportFilePath = filepath.Join(t.TempDir(), "traces.json")
+	Setup()
+	defer func() {
+		enabled = false
+		provider = nil
+		tracer = trace.NewNoopTracerProvider().Tracer("")
+	}()
+
+	// a client request carrying a trace context
+	header := http.Header{}
+	header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, gatewaySpan := Start(Extract(context.Background(), header), "gateway.store")
+	traceParent = TraceParent(ctx)
+	require.Regexp(t, `^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$`, traceParent)
+	End(gatewaySpan, "")
+
+	// the trace context is persisted with the job, and later stages continue the trace from it
+	startedAt := time.Now()
+	RecordSpan(traceParent, "processor.dest_transformer", startedAt, startedAt.Add(time.Millisecond), "transformation failed")
+	RecordSpan("", "processor.user_transformer", startedAt, startedAt.Add(time.Millisecond), "")
+
+	sendCtx, routerSpan := StartFromTraceParent(context.Background(), traceParent, "router.send")
+	outgoing := http.Header{}
+	Inject(sendCtx, outgoing)
+	End(routerSpan, "")
+	_, untraced := StartFromTraceParent(context.Background(), "", "router.send.untraced")
+	End(untraced, "")
+
+	// a request without trace context starts a new trace
+	ctx, rootSpan := Start(context.Background(), "gateway.root")
+	require.NotEmpty(t, TraceParent(ctx))
+	End(rootSpan, "")
+
+	Stop()
+
+	spans := readSpans(t, exportFilePath)
+	require.Len(t, spans, 4)
+	for _, name := range []string{"gateway.store", "processor.dest_transformer", "router.send"} {
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[name].SpanContext.TraceID, name)
+	}
+	require.Equal(t, "00f067aa0ba902b7", spans["gateway.store"].Parent.SpanID)
+	require.Equal(t, spans["gateway.store"].SpanContext.SpanID, spans["processor.dest_transformer"].Parent.SpanID)
+	require.Equal(t, spans["gateway.store"].SpanContext.SpanID, spans["router.send"].Parent.SpanID)
+	require.Equal(t, "Error", spans["processor.dest_transformer"].Status.Code)
+	require.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans["gateway.root"].SpanContext.TraceID)
+
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans["router.send"].SpanContext.SpanID+"-01", outgoing.Get(TraceParentHeader))
+}
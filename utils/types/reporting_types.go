@@ -22,6 +22,10 @@ const (
 
 var (
 	DiffStatus = "diff"
+	// ConsentFilteredStatus is the status of events dropped for destinations requiring consent categories denied by the user
+	ConsentFilteredStatus = "consent_filtered"
+	// EventFilteredStatus is the status of events dropped by the event filter of destinations
+	EventFilteredStatus = "event_filtered"
 
 	//Module names
 	GATEWAY                = "gateway"
@@ -26,6 +26,7 @@ import (
 	"github.com/rudderlabs/rudder-server/rruntime"
 	"github.com/rudderlabs/rudder-server/services/db"
 	destinationdebugger "github.com/rudderlabs/rudder-server/services/debugger/destination"
+	"github.com/rudderlabs/rudder-server/services/journey"
 	"github.com/rudderlabs/rudder-server/services/pgnotifier"
 	migrator "github.com/rudderlabs/rudder-server/services/sql-migrator"
 	"github.com/rudderlabs/rudder-server/services/validators"
@@ -1670,6 +1671,10 @@ func Start(ctx context.Context, app app.Interface) error {
 	psqlInfo := getConnectionString()
 
 	setupDB(psqlInfo)
+	if dbHandle != nil {
+		// journey lookups of the process find the uploads of messages sent to warehouse destinations through the same connection
+		journey.SetWarehouseDB(dbHandle)
+	}
 	defer func() {
 		if r := recover(); r != nil {
 			pkgLogger.Fatal(r)